@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/lamassuiot/lamassuiot/v4/internal/ca"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/storage"
+)
+
+// runCommand runs a command line operation instead of the API server:
+//
+//	lamassu-ca migrate (up | down | to VERSION | status)
+func runCommand(conf *ca.CAConfig, command string, args []string) {
+	var err error
+	switch command {
+	case "migrate":
+		err = runMigrate(conf, args)
+	default:
+		err = fmt.Errorf("unknown command %q, expected migrate", command)
+	}
+
+	if err != nil {
+		logger.Fatalf("%s failed: %s", command, err)
+	}
+}
+
+func runMigrate(conf *ca.CAConfig, args []string) error {
+	migrator, err := ca.AssembleCASchemaMigrator(conf)
+	if err != nil {
+		return err
+	}
+
+	return storage.RunMigrateCommand(context.Background(), migrator, args, os.Stdout)
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lamassuiot/lamassuiot/v4/internal/kms"
+	kmsapi "github.com/lamassuiot/lamassuiot/v4/pkg/kms"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
+)
+
+const backupPassphraseEnvVar = "LAMASSU_BACKUP_PASSPHRASE"
+
+// runCommand runs a command line operation instead of the API server:
+//
+//	lamassu-kms backup -out kms.backup (-passphrase-file FILE | -recipient PUB.pem)
+//	lamassu-kms restore -in kms.backup (-passphrase-file FILE | -recipient-key KEY.pem) [-dry-run]
+//	lamassu-kms migrate (up | down | to VERSION | status)
+//
+// The passphrase can also be set with the LAMASSU_BACKUP_PASSPHRASE variable.
+func runCommand(conf *kms.KMSConfig, command string, args []string) {
+	var err error
+	switch command {
+	case "backup":
+		err = runBackup(conf, args)
+	case "restore":
+		err = runRestore(conf, args)
+	case "migrate":
+		err = runMigrate(conf, args)
+	default:
+		err = fmt.Errorf("unknown command %q, expected backup, restore or migrate", command)
+	}
+
+	if err != nil {
+		logger.Fatalf("%s failed: %s", command, err)
+	}
+}
+
+func runBackup(conf *kms.KMSConfig, args []string) error {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := flags.String("out", "", "file to write the backup archive to")
+	passphraseFile := flags.String("passphrase-file", "", "file with the passphrase protecting the archive")
+	recipient := flags.String("recipient", "", "PEM public key to protect the archive for")
+	flags.Parse(args)
+
+	if *out == "" {
+		return fmt.Errorf("-out is required")
+	}
+
+	secret := kmsapi.BackupSecret{}
+	var err error
+	if *recipient != "" {
+		pubKey, err := os.ReadFile(*recipient)
+		if err != nil {
+			return err
+		}
+
+		secret.RecipientPublicKey = string(pubKey)
+	} else {
+		secret.Passphrase, err = readPassphrase(*passphraseFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	svc, err := kms.AssembleKMSServiceBackend(conf)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	report, err := svc.Backup(context.Background(), file, secret)
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+
+	return printReport(report)
+}
+
+func runRestore(conf *kms.KMSConfig, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := flags.String("in", "", "backup archive to restore")
+	passphraseFile := flags.String("passphrase-file", "", "file with the passphrase protecting the archive")
+	recipientKey := flags.String("recipient-key", "", "PEM private key the archive is protected for")
+	dryRun := flags.Bool("dry-run", false, "only report what would be restored and the conflicts with existing keys")
+	flags.Parse(args)
+
+	if *in == "" {
+		return fmt.Errorf("-in is required")
+	}
+
+	input := kmsapi.RestoreInput{DryRun: *dryRun}
+	var err error
+	if *recipientKey != "" {
+		input.Secret.RecipientPrivateKey, err = os.ReadFile(*recipientKey)
+	} else {
+		input.Secret.Passphrase, err = readPassphrase(*passphraseFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	svc, err := kms.AssembleKMSServiceBackend(conf)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	report, err := svc.Restore(context.Background(), file, input)
+	if err != nil {
+		return err
+	}
+
+	return printReport(report)
+}
+
+func readPassphrase(passphraseFile string) ([]byte, error) {
+	if passphraseFile == "" {
+		passphrase := os.Getenv(backupPassphraseEnvVar)
+		if passphrase == "" {
+			return nil, fmt.Errorf("a passphrase file, a recipient key or the %s variable is required", backupPassphraseEnvVar)
+		}
+
+		return []byte(passphrase), nil
+	}
+
+	content, err := os.ReadFile(passphraseFile)
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(strings.TrimRight(string(content), "\r\n")), nil
+}
+
+func printReport(report any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
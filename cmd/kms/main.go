@@ -42,6 +42,11 @@ func main() {
 	logger.Debug(string(confBytes))
 	logger.Debug("===================================================")
 
+	if len(os.Args) > 1 {
+		runCommand(conf, os.Args[1], os.Args[2:])
+		return
+	}
+
 	kmsService, err := kms.AssembleKMSService(conf)
 	if err != nil {
 		logger.Fatalf("could not assemble KMS Service: %s", err)
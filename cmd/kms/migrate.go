@@ -0,0 +1,18 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/lamassuiot/lamassuiot/v4/internal/kms"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/storage"
+)
+
+func runMigrate(conf *kms.KMSConfig, args []string) error {
+	migrator, err := kms.AssembleKMSSchemaMigrator(conf)
+	if err != nil {
+		return err
+	}
+
+	return storage.RunMigrateCommand(context.Background(), migrator, args, os.Stdout)
+}
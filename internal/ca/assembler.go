@@ -1,11 +1,11 @@
 package ca
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/lamassuiot/lamassuiot/v4/pkg/ca"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/kms"
-	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/config"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/otel"
@@ -37,25 +37,52 @@ func AssembleCAService(conf *CAConfig) (*ca.CAService, error) {
 }
 
 func createCAStorageInstance(logger *logger.Logger, conf config.PluggableStorageEngine) (CARepository, error) {
-	pconf, err := config.DecodeStruct[config.PostgresConfig](conf.Config)
+	bookmarks, err := storage.NewBookmarkSigner(logger, conf.Bookmarks)
 	if err != nil {
-		return nil, fmt.Errorf("could not decode storage config: %s", err)
+		return nil, fmt.Errorf("could not create bookmark signer: %s", err)
 	}
 
-	psqlCli, err := storage.CreatePostgresDBConnection(logger, pconf, DB_NAME)
+	if conf.Provider == config.Memory {
+		return NewCAMemoryRepository(bookmarks)
+	}
+
+	// Postgres and SQLite share the SQL repository, which adapts to the dialect.
+	dbCli, err := storage.CreateDBConnection(logger, conf, DB_NAME)
 	if err != nil {
 		return nil, fmt.Errorf("could not create storage engine: %s", err)
 	}
 
-	err = psqlCli.AutoMigrate(&models.CACertificate{})
+	migrator, err := storage.NewSchemaMigrator(logger, dbCli, "ca", caSchemaMigrations)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrator.Up(context.Background())
 	if err != nil {
-		return nil, fmt.Errorf("could not migrate CA certificate model: %s", err)
+		return nil, fmt.Errorf("could not migrate CA database schema: %s", err)
 	}
 
-	userStorage, err := NewCAPostgresRepository(logger, psqlCli)
+	userStorage, err := NewCAPostgresRepository(logger, dbCli, bookmarks)
 	if err != nil {
 		return nil, err
 	}
 
 	return userStorage, nil
 }
+
+// AssembleCASchemaMigrator connects to the CA database, for command line
+// schema migrations. Pending migrations are otherwise applied on startup.
+func AssembleCASchemaMigrator(conf *CAConfig) (*storage.SchemaMigrator, error) {
+	lStorage := logger.SetupLogger(conf.Storage.LogLevel, "CA", "Storage")
+
+	if conf.Storage.Provider == config.Memory {
+		return nil, fmt.Errorf("%s storage has no schema to migrate", conf.Storage.Provider)
+	}
+
+	dbCli, err := storage.CreateDBConnection(lStorage, conf.Storage, DB_NAME)
+	if err != nil {
+		return nil, fmt.Errorf("could not create storage engine: %s", err)
+	}
+
+	return storage.NewSchemaMigrator(lStorage, dbCli, "ca", caSchemaMigrations)
+}
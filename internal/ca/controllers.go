@@ -1,37 +1,23 @@
 package ca
 
 import (
+	"context"
+	"errors"
+
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/ca"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
 	fiber_context_mw "github.com/lamassuiot/lamassuiot/v4/pkg/shared/http/server/middleware/context"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/storage"
 )
 
-var CAFiltrableFields = map[string]resources.FilterFieldType{
-	"id":                   resources.StringFilterFieldType,
-	"level":                resources.NumberFilterFieldType,
-	"type":                 resources.EnumFilterFieldType,
-	"serial_number":        resources.StringFilterFieldType,
-	"status":               resources.EnumFilterFieldType,
-	"engine_id":            resources.StringFilterFieldType,
-	"valid_to":             resources.DateFilterFieldType,
-	"valid_from":           resources.DateFilterFieldType,
-	"revocation_timestamp": resources.DateFilterFieldType,
-	"revocation_reason":    resources.EnumFilterFieldType,
-	"subject.common_name":  resources.StringFilterFieldType,
-	"subject_key_id":       resources.StringFilterFieldType,
-}
+var CAFiltrableFields = CAFields.Select("id", "status", "key_id")
 
-var CARequestFiltrableFields = map[string]resources.FilterFieldType{
-	"id":                  resources.StringFilterFieldType,
-	"level":               resources.NumberFilterFieldType,
-	"status":              resources.EnumFilterFieldType,
-	"engine_id":           resources.StringFilterFieldType,
-	"subject_common_name": resources.StringFilterFieldType,
-	"issuer_metadata_id":  resources.StringFilterFieldType,
-}
+// CAExportColumns are the CSV columns of CA exports, unless others are
+// requested.
+var CAExportColumns = []string{"id", "name", "key_id", "status"}
 
 var validate = validator.New()
 
@@ -69,7 +55,10 @@ func (r *caHttpRoutes) CreateCA(ctx *fiber.Ctx) error {
 }
 
 func (r *caHttpRoutes) GetAllCAs(ctx *fiber.Ctx) error {
-	queryParams := resources.FilterQuery(ctx, CAFiltrableFields)
+	queryParams, err := resources.FilterQuery(ctx, CAFiltrableFields)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
+	}
 
 	cas := []models.CACertificate{}
 
@@ -82,13 +71,144 @@ func (r *caHttpRoutes) GetAllCAs(ctx *fiber.Ctx) error {
 	})
 
 	if err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"err": err.Error()})
+		return errorResponse(ctx, err)
+	}
+
+	var total *int
+	if queryParams.IncludeTotal {
+		count, err := r.svc.CountCAs(fiber_context_mw.GetRequestContext(ctx), ca.CountCAsInput{
+			QueryParameters: queryParams,
+		})
+		if err != nil {
+			return errorResponse(ctx, err)
+		}
+		total = &count
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(GetCAsResponse{
 		IterableList: resources.IterableList[models.CACertificate]{
 			NextBookmark: nextBookmark,
 			List:         cas,
+			Total:        total,
 		},
 	})
 }
+
+func (r *caHttpRoutes) ExportCAs(ctx *fiber.Ctx) error {
+	queryParams, err := resources.FilterQuery(ctx, CAFiltrableFields)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
+	}
+
+	queryParams.NextBookmark = ""
+	queryParams.PageSize = resources.ExportBatchSize
+
+	options, err := resources.ExportQuery[models.CACertificate](ctx, CAExportColumns)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
+	}
+
+	return resources.StreamExport(ctx, fiber_context_mw.GetRequestContext(ctx), options, "cas", func(reqCtx context.Context, applyFunc func(models.CACertificate)) error {
+		_, err := r.svc.GetCAs(reqCtx, ca.GetCAsInput{
+			QueryParameters: queryParams,
+			ExhaustiveRun:   true,
+			ApplyFunc:       applyFunc,
+		})
+		return err
+	})
+}
+
+func (r *caHttpRoutes) GetCAStats(ctx *fiber.Ctx) error {
+	queryParams, err := resources.FilterQuery(ctx, CAFiltrableFields)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
+	}
+
+	stats, err := r.svc.GetCAStats(fiber_context_mw.GetRequestContext(ctx), ca.GetCAStatsInput{
+		QueryParameters: queryParams,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(stats)
+}
+
+func (r *caHttpRoutes) GetCA(ctx *fiber.Ctx) error {
+	caCert, err := r.svc.GetCAByID(fiber_context_mw.GetRequestContext(ctx), ca.GetCAByIDInput{
+		ID: ctx.Params("id"),
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return caResponse(ctx, caCert)
+}
+
+func (r *caHttpRoutes) UpdateCAStatus(ctx *fiber.Ctx) error {
+	revision, err := resources.IfMatch(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
+	}
+
+	var requestBody ca.UpdateCAStatusRequestBody
+	if valid, err := parseAndValidate(ctx, &requestBody); !valid {
+		return err
+	}
+
+	caCert, err := r.svc.UpdateCAStatus(fiber_context_mw.GetRequestContext(ctx), ca.UpdateCAStatusInput{
+		ID:       ctx.Params("id"),
+		Status:   requestBody.Status,
+		Revision: revision,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return caResponse(ctx, caCert)
+}
+
+func parseAndValidate(ctx *fiber.Ctx, requestBody any) (bool, error) {
+	if err := ctx.BodyParser(requestBody); err != nil {
+		return false, ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
+	}
+
+	if err := validate.Struct(requestBody); err != nil {
+		errs := make(map[string]string)
+		for _, e := range err.(validator.ValidationErrors) {
+			errs[e.Field()] = e.Tag()
+		}
+		return false, ctx.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"errors": errs})
+	}
+
+	return true, nil
+}
+
+// caResponse returns a CA along with the entity tag of its revision, for
+// clients to make conditional updates with If-Match.
+func caResponse(ctx *fiber.Ctx, caCert *models.CACertificate) error {
+	ctx.Set(fiber.HeaderETag, resources.ETag(caCert.Revision))
+	return ctx.Status(fiber.StatusOK).JSON(caCert)
+}
+
+func errorResponse(ctx *fiber.Ctx, err error) error {
+	var bookmarkErr *storage.InvalidBookmarkError
+	if errors.As(err, &bookmarkErr) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
+	}
+
+	var conflictErr *resources.ConflictError
+	if errors.As(err, &conflictErr) {
+		return ctx.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{"err": err.Error()})
+	}
+
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, ca.ErrCANotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, ca.ErrInvalidCAStatus):
+		status = fiber.StatusBadRequest
+	}
+
+	return ctx.Status(status).JSON(fiber.Map{"err": err.Error()})
+}
@@ -9,5 +9,18 @@ import (
 
 type CARepository interface {
 	Insert(ctx context.Context, cert *models.CACertificate) (*models.CACertificate, error)
+	Update(ctx context.Context, cert *models.CACertificate) (*models.CACertificate, error)
 	SelectAll(ctx context.Context, req resources.StorageListRequest[models.CACertificate]) (string, error)
+	Count(ctx context.Context, queryParams *resources.QueryParameters) (int, error)
+	CountBy(ctx context.Context, queryParams *resources.QueryParameters, field string) (map[string]int, error)
+	SelectExistsByID(ctx context.Context, id string) (bool, *models.CACertificate, error)
+}
+
+// CAFields are the fields CAs can be filtered and sorted by. The API exposes a
+// selection of them, see CAFiltrableFields.
+var CAFields = resources.FilterFields{
+	"id":     {Type: resources.StringFilterFieldType, Column: "id"},
+	"name":   {Type: resources.StringFilterFieldType, Column: "name"},
+	"key_id": {Type: resources.StringFilterFieldType, Column: "key_id"},
+	"status": {Type: resources.EnumFilterFieldType, Column: "status"},
 }
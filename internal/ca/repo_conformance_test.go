@@ -0,0 +1,245 @@
+package ca
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/config"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
+)
+
+// caRepositories lists the CARepository implementations that must pass the
+// conformance suite. Postgres is only tested when LAMASSU_TEST_POSTGRES_HOSTNAME
+// is set, along with the optional _PORT, _USERNAME and _PASSWORD variables.
+func caRepositories() map[string]func(t *testing.T) CARepository {
+	lStorage := logger.SetupLogger(logger.LevelNone, "CA", "Storage")
+
+	return map[string]func(t *testing.T) CARepository{
+		"memory": func(t *testing.T) CARepository {
+			repo, err := createCAStorageInstance(lStorage, config.PluggableStorageEngine{Provider: config.Memory})
+			if err != nil {
+				t.Fatalf("could not create memory repository: %s", err)
+			}
+			return repo
+		},
+		"sqlite": func(t *testing.T) CARepository {
+			repo, err := createCAStorageInstance(lStorage, config.PluggableStorageEngine{
+				Provider: config.SQLite,
+				Config:   map[string]interface{}{"directory": t.TempDir()},
+			})
+			if err != nil {
+				t.Fatalf("could not create sqlite repository: %s", err)
+			}
+			return repo
+		},
+		"postgres": func(t *testing.T) CARepository {
+			conf := postgresTestConfig(t)
+			repo, err := createCAStorageInstance(lStorage, conf)
+			if err != nil {
+				t.Fatalf("could not create postgres repository: %s", err)
+			}
+
+			if err := repo.(*PostgresCAStore).db.Exec("DELETE FROM cas").Error; err != nil {
+				t.Fatalf("could not clean cas: %s", err)
+			}
+			return repo
+		},
+	}
+}
+
+func postgresTestConfig(t *testing.T) config.PluggableStorageEngine {
+	hostname := os.Getenv("LAMASSU_TEST_POSTGRES_HOSTNAME")
+	if hostname == "" {
+		t.Skip("LAMASSU_TEST_POSTGRES_HOSTNAME is not set")
+	}
+
+	port := 5432
+	if p := os.Getenv("LAMASSU_TEST_POSTGRES_PORT"); p != "" {
+		var err error
+		port, err = strconv.Atoi(p)
+		if err != nil {
+			t.Fatalf("invalid LAMASSU_TEST_POSTGRES_PORT: %s", err)
+		}
+	}
+
+	return config.PluggableStorageEngine{
+		Provider: config.Postgres,
+		Config: map[string]interface{}{
+			"hostname": hostname,
+			"port":     port,
+			"username": os.Getenv("LAMASSU_TEST_POSTGRES_USERNAME"),
+			"password": os.Getenv("LAMASSU_TEST_POSTGRES_PASSWORD"),
+		},
+	}
+}
+
+func TestCARepositoryConformance(t *testing.T) {
+	for name, newRepo := range caRepositories() {
+		t.Run(name, func(t *testing.T) {
+			t.Run("Insert", func(t *testing.T) { testCARepositoryInsert(t, newRepo(t)) })
+			t.Run("Select", func(t *testing.T) { testCARepositorySelect(t, newRepo(t)) })
+			t.Run("Revisions", func(t *testing.T) { testCARepositoryRevisions(t, newRepo(t)) })
+		})
+	}
+}
+
+// selectCANames lists one page of CAs, returning their names.
+func selectCANames(t *testing.T, repo CARepository, queryParams *resources.QueryParameters) ([]string, string) {
+	names := []string{}
+	bookmark, err := repo.SelectAll(context.Background(), resources.StorageListRequest[models.CACertificate]{
+		QueryParams: queryParams,
+		ApplyFunc: func(ca models.CACertificate) {
+			names = append(names, ca.Name)
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not select CAs: %s", err)
+	}
+
+	return names, bookmark
+}
+
+func testCARepositoryInsert(t *testing.T, repo CARepository) {
+	ca, err := repo.Insert(context.Background(), &models.CACertificate{Name: "root", KeyID: "key-1", Status: models.CAStatusActive})
+	if err != nil {
+		t.Fatalf("could not insert CA: %s", err)
+	}
+	if _, err := uuid.Parse(ca.ID); err != nil {
+		t.Fatalf("inserted CA has no generated id: %q", ca.ID)
+	}
+
+	var stored []models.CACertificate
+	_, err = repo.SelectAll(context.Background(), resources.StorageListRequest[models.CACertificate]{
+		ExhaustiveRun: true,
+		ApplyFunc:     func(ca models.CACertificate) { stored = append(stored, ca) },
+	})
+	if err != nil {
+		t.Fatalf("could not select CAs: %s", err)
+	}
+	if len(stored) != 1 || stored[0] != *ca {
+		t.Errorf("got %+v, want %+v", stored, *ca)
+	}
+}
+
+func testCARepositoryRevisions(t *testing.T, repo CARepository) {
+	ctx := context.Background()
+	ca, err := repo.Insert(ctx, &models.CACertificate{Name: "root", KeyID: "key-1", Status: models.CAStatusActive})
+	if err != nil {
+		t.Fatalf("could not insert CA: %s", err)
+	}
+
+	_, stale, err := repo.SelectExistsByID(ctx, ca.ID)
+	if err != nil {
+		t.Fatalf("could not select CA: %s", err)
+	}
+
+	ca.Status = models.CAStatusInactive
+	if _, err := repo.Update(ctx, ca); err != nil {
+		t.Fatalf("could not update CA: %s", err)
+	}
+	if ca.Revision != 1 {
+		t.Errorf("updated CA is at revision %d, want 1", ca.Revision)
+	}
+
+	stale.Name = "renamed"
+	_, err = repo.Update(ctx, stale)
+	var conflictErr *resources.ConflictError
+	if !errors.As(err, &conflictErr) {
+		t.Fatalf("stale update returned %v, want a ConflictError", err)
+	}
+
+	exists, stored, err := repo.SelectExistsByID(ctx, ca.ID)
+	if err != nil || !exists {
+		t.Fatalf("updated CA not found: %v", err)
+	}
+	if *stored != *ca {
+		t.Errorf("got %+v, want %+v", *stored, *ca)
+	}
+
+	exists, _, err = repo.SelectExistsByID(ctx, uuid.NewString())
+	if err != nil || exists {
+		t.Errorf("unknown CA reported as existing: %v, %v", exists, err)
+	}
+}
+
+func testCARepositorySelect(t *testing.T, repo CARepository) {
+	for _, ca := range []models.CACertificate{
+		{Name: "root", KeyID: "key-1", Status: models.CAStatusActive},
+		{Name: "issuing-1", KeyID: "key-2", Status: models.CAStatusActive},
+		{Name: "issuing-2", KeyID: "key-3", Status: models.CAStatusInactive},
+		{Name: "Legacy", KeyID: "key-4", Status: models.CAStatusInactive},
+	} {
+		if _, err := repo.Insert(context.Background(), &ca); err != nil {
+			t.Fatalf("could not insert CA %s: %s", ca.Name, err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		filters []resources.FilterOption
+		want    []string
+	}{
+		{"StringEqual", []resources.FilterOption{{Field: "name", FilterOperation: resources.StringEqual, Value: "root"}}, []string{"root"}},
+		{"StringContains", []resources.FilterOption{{Field: "name", FilterOperation: resources.StringContains, Value: "issuing"}}, []string{"issuing-1", "issuing-2"}},
+		{"StringEqualIgnoreCase", []resources.FilterOption{{Field: "name", FilterOperation: resources.StringEqualIgnoreCase, Value: "legacy"}}, []string{"Legacy"}},
+		{"EnumEqual", []resources.FilterOption{{Field: "status", FilterOperation: resources.EnumEqual, Value: "INACTIVE"}}, []string{"issuing-2", "Legacy"}},
+		{"EnumNotEqual", []resources.FilterOption{{Field: "status", FilterOperation: resources.EnumNotEqual, Value: "INACTIVE"}}, []string{"root", "issuing-1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _ := selectCANames(t, repo, &resources.QueryParameters{Filters: tt.filters})
+			slices.Sort(got)
+			slices.Sort(tt.want)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("Count", func(t *testing.T) {
+		got, err := repo.Count(context.Background(), &resources.QueryParameters{
+			PageSize: 1,
+			Filters:  []resources.FilterOption{{Field: "name", FilterOperation: resources.StringContains, Value: "issuing"}},
+		})
+		if err != nil {
+			t.Fatalf("could not count CAs: %s", err)
+		}
+		if got != 2 {
+			t.Errorf("got %d, want 2", got)
+		}
+	})
+
+	t.Run("CountBy", func(t *testing.T) {
+		got, err := repo.CountBy(context.Background(), nil, "status")
+		if err != nil {
+			t.Fatalf("could not count CAs: %s", err)
+		}
+		if want := map[string]int{"ACTIVE": 2, "INACTIVE": 2}; !maps.Equal(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		got, bookmark := selectCANames(t, repo, &resources.QueryParameters{
+			PageSize: 3,
+			Sort:     resources.SortOptions{SortField: "key_id", SortMode: resources.SortModeDesc},
+		})
+		if want := []string{"Legacy", "issuing-2", "issuing-1"}; !slices.Equal(got, want) || bookmark == "" {
+			t.Fatalf("got %v and bookmark %q, want %v and a bookmark", got, bookmark, want)
+		}
+
+		got, bookmark = selectCANames(t, repo, &resources.QueryParameters{NextBookmark: bookmark})
+		if want := []string{"root"}; !slices.Equal(got, want) || bookmark != "" {
+			t.Errorf("got %v and bookmark %q, want %v and no bookmark", got, bookmark, want)
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package ca
+
+import (
+	"context"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/storage"
+)
+
+type MemoryCAStore struct {
+	querier *storage.MemoryQuerier[models.CACertificate]
+}
+
+func NewCAMemoryRepository(bookmarks *storage.BookmarkSigner) (CARepository, error) {
+	querier, err := storage.NewMemoryQuerier[models.CACertificate]("id", CAFields, bookmarks)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MemoryCAStore{
+		querier: querier,
+	}, nil
+}
+
+func (db *MemoryCAStore) Insert(ctx context.Context, u *models.CACertificate) (*models.CACertificate, error) {
+	return db.querier.Insert(ctx, u)
+}
+
+func (db *MemoryCAStore) Update(ctx context.Context, u *models.CACertificate) (*models.CACertificate, error) {
+	return db.querier.Update(ctx, u, u.ID)
+}
+
+func (db *MemoryCAStore) SelectAll(ctx context.Context, req resources.StorageListRequest[models.CACertificate]) (string, error) {
+	return db.querier.SelectAll(ctx, req.QueryParams, req.ExhaustiveRun, req.ApplyFunc)
+}
+
+func (db *MemoryCAStore) Count(ctx context.Context, queryParams *resources.QueryParameters) (int, error) {
+	return db.querier.Count(ctx, queryParams)
+}
+
+func (db *MemoryCAStore) CountBy(ctx context.Context, queryParams *resources.QueryParameters, field string) (map[string]int, error) {
+	return db.querier.CountBy(ctx, queryParams, field)
+}
+
+func (db *MemoryCAStore) SelectExistsByID(ctx context.Context, id string) (bool, *models.CACertificate, error) {
+	return db.querier.SelectExists(ctx, id, nil)
+}
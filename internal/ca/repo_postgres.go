@@ -15,8 +15,8 @@ type PostgresCAStore struct {
 	querier *storage.PostgresDBQuerier[models.CACertificate]
 }
 
-func NewCAPostgresRepository(log *logger.Logger, db *gorm.DB) (CARepository, error) {
-	querier, err := storage.TableQuery(log, db, "cas", "id", models.CACertificate{})
+func NewCAPostgresRepository(log *logger.Logger, db *gorm.DB, bookmarks *storage.BookmarkSigner) (CARepository, error) {
+	querier, err := storage.TableQuery(log, db, "cas", "id", models.CACertificate{}, CAFields, bookmarks)
 	if err != nil {
 		return nil, err
 	}
@@ -31,6 +31,22 @@ func (db *PostgresCAStore) Insert(ctx context.Context, u *models.CACertificate)
 	return db.querier.Insert(ctx, u)
 }
 
+func (db *PostgresCAStore) Update(ctx context.Context, u *models.CACertificate) (*models.CACertificate, error) {
+	return db.querier.Update(ctx, u, u.ID)
+}
+
 func (db *PostgresCAStore) SelectAll(ctx context.Context, req resources.StorageListRequest[models.CACertificate]) (string, error) {
 	return db.querier.SelectAll(ctx, req.QueryParams, []storage.GormExtraOps{}, req.ExhaustiveRun, req.ApplyFunc)
 }
+
+func (db *PostgresCAStore) Count(ctx context.Context, queryParams *resources.QueryParameters) (int, error) {
+	return db.querier.Count(ctx, queryParams, []storage.GormExtraOps{})
+}
+
+func (db *PostgresCAStore) CountBy(ctx context.Context, queryParams *resources.QueryParameters, field string) (map[string]int, error) {
+	return db.querier.CountBy(ctx, queryParams, []storage.GormExtraOps{}, field)
+}
+
+func (db *PostgresCAStore) SelectExistsByID(ctx context.Context, id string) (bool, *models.CACertificate, error) {
+	return db.querier.SelectExists(ctx, id, nil)
+}
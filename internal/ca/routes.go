@@ -12,5 +12,9 @@ func NewCAHTTPLayer(parentRouterGroup *fiber.Router, svc ca.CAService) {
 	rv1 := (*router).Group("/v1")
 
 	rv1.Get("/ca", routes.GetAllCAs)
+	rv1.Get("/ca/stats", routes.GetCAStats)
+	rv1.Get("/ca/export", routes.ExportCAs)
+	rv1.Get("/ca/:id", routes.GetCA)
+	rv1.Put("/ca/:id/status", routes.UpdateCAStatus)
 	rv1.Post("/ca", routes.CreateCA)
 }
@@ -0,0 +1,51 @@
+package ca
+
+import "github.com/lamassuiot/lamassuiot/v4/pkg/shared/storage"
+
+// caSchemaMigrations holds the schema of the CA database. Released migrations
+// must never change: schema changes are new migrations appended at the end.
+var caSchemaMigrations = []storage.Migration{
+	{
+		// Tables created by AutoMigrate in earlier releases are adopted as is,
+		// adding the columns they may lack.
+		Version: 1,
+		Name:    "create cas",
+		Up: storage.DialectSQL([]string{
+			`CREATE TABLE IF NOT EXISTS cas (
+				id uuid DEFAULT gen_random_uuid(),
+				name varchar(255) NOT NULL,
+				PRIMARY KEY (id)
+			)`,
+			`ALTER TABLE cas
+				ADD COLUMN IF NOT EXISTS key_id text,
+				ADD COLUMN IF NOT EXISTS status text`,
+		}, []string{
+			`CREATE TABLE cas (
+				id uuid DEFAULT ` + storage.SQLiteRandomUUID + `,
+				name varchar(255) NOT NULL,
+				key_id text,
+				status text,
+				PRIMARY KEY (id)
+			)`,
+		}),
+		Down: storage.DialectSQL([]string{
+			`DROP TABLE cas`,
+		}, []string{
+			`DROP TABLE cas`,
+		}),
+	},
+	{
+		Version: 2,
+		Name:    "add ca revisions",
+		Up: storage.DialectSQL([]string{
+			`ALTER TABLE cas ADD COLUMN revision bigint NOT NULL DEFAULT 0`,
+		}, []string{
+			`ALTER TABLE cas ADD COLUMN revision integer NOT NULL DEFAULT 0`,
+		}),
+		Down: storage.DialectSQL([]string{
+			`ALTER TABLE cas DROP COLUMN revision`,
+		}, []string{
+			`ALTER TABLE cas DROP COLUMN revision`,
+		}),
+	},
+}
@@ -34,33 +34,35 @@ func NewCAService(builder CAServiceBuilder) ca.CAService {
 }
 
 func (svc *CAServiceBackend) CreateCA(ctx context.Context, input ca.CreateCAInput) error {
-	svc.kmsService.CreateKMSKey(ctx, kms.CreateKMSInput{
+	kmsKey, err := svc.kmsService.CreateKMSKey(ctx, kms.CreateKMSInput{
 		Alias:     input.Name,
-		Algorithm: "RSA",
+		Algorithm: models.KMSKeyAlgorithmRSA,
 		Size:      2048,
-		PublicKey: "",
 	})
+	if err != nil {
+		svc.logger.Errorf("could not create CA key: %s", err)
+		return err
+	}
 
-	ca, err := svc.caStorage.Insert(ctx, &models.CACertificate{
-		Name: input.Name,
+	caCert, err := svc.caStorage.Insert(ctx, &models.CACertificate{
+		Name:   input.Name,
+		KeyID:  kmsKey.ID,
+		Status: models.CAStatusActive,
 	})
-
-	fmt.Println(ca)
-	svc.logger.Info("CA created", "name", input.Name)
-
 	if err != nil {
+		svc.logger.Errorf("could not store CA %s: %s", input.Name, err)
 		return err
 	}
 
+	svc.logger.Infof("CA %s created with KMS key %s", caCert.ID, caCert.KeyID)
 	return nil
 }
 
 func (svc *CAServiceBackend) GetCAs(ctx context.Context, input ca.GetCAsInput) (string, error) {
-	cas := []models.CACertificate{}
 	bookmark, err := svc.caStorage.SelectAll(ctx, resources.StorageListRequest[models.CACertificate]{
-		ApplyFunc: func(item models.CACertificate) {
-			cas = append(cas, item)
-		},
+		ExhaustiveRun: input.ExhaustiveRun,
+		QueryParams:   input.QueryParameters,
+		ApplyFunc:     input.ApplyFunc,
 	})
 	if err != nil {
 		return "", err
@@ -69,3 +71,74 @@ func (svc *CAServiceBackend) GetCAs(ctx context.Context, input ca.GetCAsInput) (
 	return bookmark, nil
 
 }
+
+func (svc *CAServiceBackend) CountCAs(ctx context.Context, input ca.CountCAsInput) (int, error) {
+	return svc.caStorage.Count(ctx, input.QueryParameters)
+}
+
+func (svc *CAServiceBackend) GetCAStats(ctx context.Context, input ca.GetCAStatsInput) (*ca.CAStats, error) {
+	// Stats count every page, only the filters of the query apply.
+	queryParams := &resources.QueryParameters{}
+	if input.QueryParameters != nil {
+		queryParams.Filters = input.QueryParameters.Filters
+		queryParams.FilterGroups = input.QueryParameters.FilterGroups
+	}
+
+	total, err := svc.caStorage.Count(ctx, queryParams)
+	if err != nil {
+		return nil, err
+	}
+
+	byStatus, err := svc.caStorage.CountBy(ctx, queryParams, "status")
+	if err != nil {
+		return nil, err
+	}
+
+	return &ca.CAStats{
+		Total:    total,
+		ByStatus: byStatus,
+	}, nil
+}
+
+func (svc *CAServiceBackend) GetCAByID(ctx context.Context, input ca.GetCAByIDInput) (*models.CACertificate, error) {
+	return svc.getCA(ctx, input.ID)
+}
+
+func (svc *CAServiceBackend) UpdateCAStatus(ctx context.Context, input ca.UpdateCAStatusInput) (*models.CACertificate, error) {
+	if input.Status != models.CAStatusActive && input.Status != models.CAStatusInactive {
+		return nil, fmt.Errorf("%w: %s", ca.ErrInvalidCAStatus, input.Status)
+	}
+
+	caCert, err := svc.getCA(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Revision != nil && *input.Revision != caCert.Revision {
+		return nil, &resources.ConflictError{ID: caCert.ID, Revision: *input.Revision}
+	}
+
+	caCert.Status = input.Status
+	caCert, err = svc.caStorage.Update(ctx, caCert)
+	if err != nil {
+		svc.logger.Errorf("could not update CA %s: %s", input.ID, err)
+		return nil, err
+	}
+
+	svc.logger.Infof("status of CA %s set to %s", caCert.ID, caCert.Status)
+	return caCert, nil
+}
+
+func (svc *CAServiceBackend) getCA(ctx context.Context, id string) (*models.CACertificate, error) {
+	exists, caCert, err := svc.caStorage.SelectExistsByID(ctx, id)
+	if err != nil {
+		svc.logger.Errorf("could not get CA %s: %s", id, err)
+		return nil, err
+	}
+
+	if !exists {
+		return nil, ca.ErrCANotFound
+	}
+
+	return caCert, nil
+}
@@ -1,14 +1,20 @@
 package kms
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/lamassuiot/lamassuiot/v4/pkg/ca"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/kms"
-	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms/cryptoengines"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/config"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/otel"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/storage"
+	secretsmanager "github.com/lamassuiot/lamassuiot/v4/providers/cryptoengines/aws/secrets-manager"
+	"github.com/lamassuiot/lamassuiot/v4/providers/cryptoengines/envelope"
+	fsengine "github.com/lamassuiot/lamassuiot/v4/providers/cryptoengines/localfs"
+	s3filestore "github.com/lamassuiot/lamassuiot/v4/providers/file-store/s3"
 )
 
 const (
@@ -18,42 +24,131 @@ const (
 func AssembleKMSService(conf *KMSConfig) (*kms.KMSService, error) {
 	otel.InitTracer("KMS Service")
 
+	backend, err := AssembleKMSServiceBackend(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	lTasks := logger.SetupLogger(conf.AppConfig.Logs.Level, "KMS", "Tasks")
+	if conf.KeyRotation.Enabled {
+		NewPeriodicTask(lTasks, "key rotation", conf.KeyRotation.CheckInterval, backend.RotateDueKeys).Start(context.Background())
+	}
+
+	NewPeriodicTask(lTasks, "key deletion", conf.KeyDeletion.CheckInterval, backend.DeleteDueKeys).Start(context.Background())
+	if conf.Reconciliation.Enabled {
+		NewPeriodicTask(lTasks, "crypto engine reconciliation", conf.Reconciliation.CheckInterval, backend.SyncCryptoEngines).Start(context.Background())
+	}
+
+	var svc kms.KMSService = backend
+	return &svc, nil
+}
+
+// AssembleKMSServiceBackend builds the KMS service without starting its
+// background tasks, for command line operations such as backups.
+func AssembleKMSServiceBackend(conf *KMSConfig) (*KMSServiceBackend, error) {
 	lSvc := logger.SetupLogger(conf.AppConfig.Logs.Level, "KMS", "Service")
 	lStorage := logger.SetupLogger(conf.Storage.LogLevel, "KMS", "Storage")
+	lCryptoEng := logger.SetupLogger(conf.CryptoEngines.LogLevel, "KMS", "CryptoEngine")
 
 	kmsStorage, err := createKMSStorageInstance(lStorage, conf.Storage)
 	if err != nil {
 		return nil, fmt.Errorf("could not create KMS storage instance: %s", err)
 	}
 
+	engines, err := createCryptoEngines(lCryptoEng, conf.CryptoEngines)
+	if err != nil {
+		return nil, fmt.Errorf("could not create crypto engines: %s", err)
+	}
+
 	svc := NewKMSService(KMSServiceBuilder{
-		Logger:     lSvc,
-		KMSStorage: kmsStorage,
+		Logger:                  lSvc,
+		KMSStorage:              kmsStorage,
+		CryptoEngines:           engines,
+		DefaultCryptoEngine:     conf.CryptoEngines.DefaultEngine,
+		KeyReferences:           NewCAKeyReferenceChecker(ca.NewCASdkService()),
+		JWKSRotatedKeyRetention: conf.JWKS.RotatedKeyRetention,
 	})
 
-	return &svc, nil
+	return svc.(*KMSServiceBackend), nil
 }
 
 func createKMSStorageInstance(logger *logger.Logger, conf config.PluggableStorageEngine) (KMSRepository, error) {
-	pconf, err := config.DecodeStruct[config.PostgresConfig](conf.Config)
+	bookmarks, err := storage.NewBookmarkSigner(logger, conf.Bookmarks)
 	if err != nil {
-		return nil, fmt.Errorf("could not decode storage config: %s", err)
+		return nil, fmt.Errorf("could not create bookmark signer: %s", err)
 	}
 
-	psqlCli, err := storage.CreatePostgresDBConnection(logger, pconf, DB_NAME)
+	if conf.Provider == config.Memory {
+		return NewKMSMemoryRepository(bookmarks)
+	}
+
+	// Postgres and SQLite share the SQL repository, which adapts to the dialect.
+	dbCli, err := storage.CreateDBConnection(logger, conf, DB_NAME)
 	if err != nil {
 		return nil, fmt.Errorf("could not create storage engine: %s", err)
 	}
 
-	err = psqlCli.AutoMigrate(&models.KMSKey{})
+	migrator, err := storage.NewSchemaMigrator(logger, dbCli, "kms", kmsSchemaMigrations)
+	if err != nil {
+		return nil, err
+	}
+
+	err = migrator.Up(context.Background())
 	if err != nil {
-		return nil, fmt.Errorf("could not migrate KMS key model: %s", err)
+		return nil, fmt.Errorf("could not migrate KMS database schema: %s", err)
 	}
 
-	store, err := NewKMSPostgresRepository(logger, psqlCli)
+	store, err := NewKMSPostgresRepository(logger, dbCli, bookmarks)
 	if err != nil {
 		return nil, err
 	}
 
 	return store, nil
 }
+
+// AssembleKMSSchemaMigrator connects to the KMS database, for command line
+// schema migrations. Pending migrations are otherwise applied on startup.
+func AssembleKMSSchemaMigrator(conf *KMSConfig) (*storage.SchemaMigrator, error) {
+	lStorage := logger.SetupLogger(conf.Storage.LogLevel, "KMS", "Storage")
+
+	if conf.Storage.Provider == config.Memory {
+		return nil, fmt.Errorf("%s storage has no schema to migrate", conf.Storage.Provider)
+	}
+
+	dbCli, err := storage.CreateDBConnection(lStorage, conf.Storage, DB_NAME)
+	if err != nil {
+		return nil, fmt.Errorf("could not create storage engine: %s", err)
+	}
+
+	return storage.NewSchemaMigrator(lStorage, dbCli, "kms", kmsSchemaMigrations)
+}
+
+func createCryptoEngines(logger *logger.Logger, conf CryptoEnginesConfig) (map[string]cryptoengines.CryptoEngine, error) {
+	s3filestore.Register()
+	fsengine.Register()
+	secretsmanager.Register()
+	envelope.Register()
+
+	engines := map[string]cryptoengines.CryptoEngine{}
+	for _, engineConf := range conf.CryptoEngines {
+		if _, exists := engines[engineConf.ID]; exists {
+			return nil, fmt.Errorf("duplicate crypto engine id %s", engineConf.ID)
+		}
+
+		engine, err := cryptoengines.BuildCryptoEngine(logger, engineConf)
+		if err != nil {
+			return nil, fmt.Errorf("could not build crypto engine %s: %s", engineConf.ID, err)
+		}
+
+		logger.Infof("crypto engine %s of type %s loaded", engineConf.ID, engineConf.Type)
+		engines[engineConf.ID] = engine
+	}
+
+	if len(engines) > 0 {
+		if _, exists := engines[conf.DefaultEngine]; !exists {
+			return nil, fmt.Errorf("default crypto engine %s not configured", conf.DefaultEngine)
+		}
+	}
+
+	return engines, nil
+}
@@ -0,0 +1,653 @@
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"filippo.io/mldsa"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms/cryptoengines"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/cryptoutils"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Scrypt parameters for passphrase protected archives.
+const (
+	backupScryptN = 1 << 15
+	backupScryptR = 8
+	backupScryptP = 1
+)
+
+// Backup writes an encrypted archive with every KMS key that has not been
+// deleted. The private material of keys held by engines that allow exporting it
+// is included, unless their policy does not allow the export operation. Other
+// keys are backed up as metadata only. The backup is refused when an engine
+// hands out material that could not be restored, as for X25519 and ML-DSA keys.
+func (svc *KMSServiceBackend) Backup(ctx context.Context, w io.Writer, secret kms.BackupSecret) (*kms.BackupReport, error) {
+	kmsKeys := []models.KMSKey{}
+	_, err := svc.kmsStorage.SelectAll(ctx, resources.StorageListRequest[models.KMSKey]{
+		ExhaustiveRun: true,
+		QueryParams:   &resources.QueryParameters{},
+		ApplyFunc: func(kmsKey models.KMSKey) {
+			if kmsKey.Status != models.KMSKeyStatusDeleted {
+				kmsKeys = append(kmsKeys, kmsKey)
+			}
+		},
+	})
+	if err != nil {
+		svc.logger.Errorf("could not list KMS keys: %s", err)
+		return nil, err
+	}
+
+	report := &kms.BackupReport{
+		Keys:             len(kmsKeys),
+		MetadataOnly:     []kms.KeyVersionReference{},
+		ExportNotAllowed: []kms.KeyVersionReference{},
+	}
+
+	material := []kms.BackupKeyMaterial{}
+	for i := range kmsKeys {
+		kmsKey := &kmsKeys[i]
+		engine, err := svc.getCryptoEngine(kmsKey.EngineID)
+		if err != nil {
+			return nil, err
+		}
+
+		exportable := allowsOperation(kmsKey.Policy, models.KMSKeyOperationExport)
+		for _, version := range kmsKey.Versions {
+			if version.State == models.KMSKeyVersionStateDestroyed {
+				continue
+			}
+
+			if !exportable {
+				report.ExportNotAllowed = append(report.ExportNotAllowed, kms.KeyVersionReference{
+					KeyID:       kmsKey.ID,
+					Version:     version.Version,
+					EngineKeyID: version.EngineKeyID,
+				})
+				continue
+			}
+
+			privateKey, err := svc.exportKeyVersion(ctx, kmsKey, &version, engine)
+			if err != nil {
+				return nil, err
+			}
+
+			if privateKey == "" {
+				report.MetadataOnly = append(report.MetadataOnly, kms.KeyVersionReference{
+					KeyID:       kmsKey.ID,
+					Version:     version.Version,
+					EngineKeyID: version.EngineKeyID,
+				})
+				continue
+			}
+
+			material = append(material, kms.BackupKeyMaterial{
+				KeyID:      kmsKey.ID,
+				Version:    version.Version,
+				PrivateKey: privateKey,
+			})
+		}
+	}
+
+	report.ExportedVersions = len(material)
+
+	keysJSON, err := json.Marshal(kmsKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	materialJSON, err := json.Marshal(material)
+	if err != nil {
+		return nil, err
+	}
+
+	archiveKey := make([]byte, 32)
+	if _, err = rand.Read(archiveKey); err != nil {
+		return nil, err
+	}
+
+	protection, err := protectArchiveKey(archiveKey, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	archive := &kms.BackupArchive{
+		Format:     kms.BackupArchiveFormat,
+		Version:    kms.BackupArchiveVersion,
+		CreationTS: time.Now(),
+		Keys:       keysJSON,
+		Protection: *protection,
+	}
+
+	archive.Material, err = sealBackup(archiveKey, materialJSON, keysJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	archive.Checksum, err = backupChecksum(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.NewEncoder(w).Encode(archive)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.logger.Infof("backup of %d KMS keys written, with material for %d key versions, %d not allowed to be exported", report.Keys, report.ExportedVersions, len(report.ExportNotAllowed))
+	return report, nil
+}
+
+// Restore recreates the keys of a backup archive. Keys that already exist are
+// reported as conflicts and left untouched. Archived material is imported into
+// the key's engine unless the engine still holds it.
+func (svc *KMSServiceBackend) Restore(ctx context.Context, r io.Reader, input kms.RestoreInput) (*kms.RestoreReport, error) {
+	kmsKeys, material, err := svc.openBackup(r, input.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	archivedMaterial := map[string]string{}
+	for _, m := range material {
+		archivedMaterial[kms.KeyVersionKID(m.KeyID, m.Version)] = m.PrivateKey
+	}
+
+	report := &kms.RestoreReport{
+		DryRun:          input.DryRun,
+		Restored:        []string{},
+		Conflicts:       []kms.RestoreConflict{},
+		MissingMaterial: []kms.KeyVersionReference{},
+	}
+
+	engineKeys := map[string]map[string]bool{}
+	for i := range kmsKeys {
+		kmsKey := &kmsKeys[i]
+		conflict := func(reason kms.RestoreConflictReason) {
+			report.Conflicts = append(report.Conflicts, kms.RestoreConflict{KeyID: kmsKey.ID, Alias: kmsKey.Alias, Reason: reason})
+		}
+
+		exists, _, err := svc.kmsStorage.SelectExistsByID(ctx, kmsKey.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		if exists {
+			conflict(kms.RestoreConflictKeyExists)
+			continue
+		}
+
+		engine, err := svc.getCryptoEngine(kmsKey.EngineID)
+		if err != nil {
+			conflict(kms.RestoreConflictEngineNotFound)
+			continue
+		}
+
+		if _, listed := engineKeys[kmsKey.EngineID]; !listed {
+			engineKeys[kmsKey.EngineID], err = svc.listEngineKeyIDs(ctx, engine)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		restoredVersions, mismatch, err := svc.restoreKeyVersions(ctx, kmsKey, engine, engineKeys[kmsKey.EngineID], archivedMaterial, input.DryRun)
+		if err != nil {
+			return nil, err
+		}
+
+		if mismatch {
+			conflict(kms.RestoreConflictMaterialMismatch)
+			continue
+		}
+
+		for _, version := range kmsKey.Versions {
+			if version.MaterialMissing && version.State != models.KMSKeyVersionStateDestroyed {
+				report.MissingMaterial = append(report.MissingMaterial, kms.KeyVersionReference{
+					KeyID:       kmsKey.ID,
+					Version:     version.Version,
+					EngineKeyID: version.EngineKeyID,
+				})
+			}
+		}
+
+		if !input.DryRun {
+			_, err = svc.kmsStorage.Insert(ctx, kmsKey)
+			if err != nil {
+				svc.logger.Errorf("could not restore KMS key %s: %s", kmsKey.ID, err)
+				for _, engineKeyID := range restoredVersions {
+					svc.discardEngineKey(ctx, engine, engineKeyID)
+				}
+
+				return nil, err
+			}
+		}
+
+		report.Restored = append(report.Restored, kmsKey.ID)
+	}
+
+	svc.logger.Infof("restore of %d KMS keys: %d restored, %d conflicts, %d versions without material (dry run: %t)",
+		len(kmsKeys), len(report.Restored), len(report.Conflicts), len(report.MissingMaterial), input.DryRun)
+	return report, nil
+}
+
+// restoreKeyVersions brings back the material of the versions of a restored key.
+// It returns the engine key IDs imported into the engine and whether some
+// archived material does not match the public key of its version.
+func (svc *KMSServiceBackend) restoreKeyVersions(ctx context.Context, kmsKey *models.KMSKey, engine cryptoengines.CryptoEngine, engineKeys map[string]bool, archivedMaterial map[string]string, dryRun bool) ([]string, bool, error) {
+	imported := []string{}
+	discard := func() {
+		for _, engineKeyID := range imported {
+			svc.discardEngineKey(ctx, engine, engineKeyID)
+		}
+	}
+
+	for i := range kmsKey.Versions {
+		version := &kmsKey.Versions[i]
+		if version.State == models.KMSKeyVersionStateDestroyed {
+			continue
+		}
+
+		version.MaterialMissing = false
+		if engineKeys[version.EngineKeyID] {
+			continue
+		}
+
+		privateKey, archived := archivedMaterial[kms.KeyVersionKID(kmsKey.ID, version.Version)]
+		if !archived {
+			version.MaterialMissing = true
+			continue
+		}
+
+		engineKeyID, mismatch, err := svc.importBackupMaterial(ctx, kmsKey, version, engine, privateKey, dryRun)
+		if err != nil || mismatch {
+			discard()
+			return nil, mismatch, err
+		}
+
+		if dryRun {
+			continue
+		}
+
+		imported = append(imported, engineKeyID)
+		version.EngineKeyID = engineKeyID
+	}
+
+	return imported, false, nil
+}
+
+// importBackupMaterial imports the archived material of a key version into its
+// engine, returning the new engine key ID. Nothing is imported on dry runs.
+// Private keys must match the public key of their version, while symmetric keys
+// must have the size of their key.
+func (svc *KMSServiceBackend) importBackupMaterial(ctx context.Context, kmsKey *models.KMSKey, version *models.KMSKeyVersion, engine cryptoengines.CryptoEngine, material string, dryRun bool) (string, bool, error) {
+	unreadable := fmt.Errorf("%w: unreadable material for version %d of key %s", kms.ErrInvalidBackupArchive, version.Version, kmsKey.ID)
+
+	var engineKeyID string
+	switch kmsKey.Algorithm {
+	case models.KMSKeyAlgorithmAES, models.KMSKeyAlgorithmHMAC:
+		key, err := svc.keyProvider.ParseSymmetricKey([]byte(material))
+		if err != nil {
+			return "", false, unreadable
+		}
+
+		if len(key)*8 != kmsKey.Size {
+			return "", true, nil
+		}
+
+		if dryRun {
+			return "", false, nil
+		}
+
+		if kmsKey.Algorithm == models.KMSKeyAlgorithmAES {
+			engineKeyID, err = engine.ImportAESKey(ctx, key)
+		} else {
+			engineKeyID, err = engine.ImportHMACKey(ctx, key)
+		}
+		if err != nil {
+			svc.logger.Errorf("could not import version %d of key %s into crypto engine %s: %s", version.Version, kmsKey.ID, kmsKey.EngineID, err)
+			return "", false, err
+		}
+	default:
+		signer, err := svc.keyProvider.ParsePrivateKey([]byte(material))
+		if err != nil {
+			return "", false, unreadable
+		}
+
+		if !publicKeyMatches(svc.keyProvider, signer.Public(), version.PublicKey) {
+			return "", true, nil
+		}
+
+		if dryRun {
+			return "", false, nil
+		}
+
+		switch key := signer.(type) {
+		case *rsa.PrivateKey:
+			engineKeyID, _, err = engine.ImportRSAPrivateKey(ctx, key)
+		case *ecdsa.PrivateKey:
+			engineKeyID, _, err = engine.ImportECDSAPrivateKey(ctx, key)
+		case ed25519.PrivateKey:
+			engineKeyID, _, err = engine.ImportEd25519PrivateKey(ctx, key)
+		default:
+			err = kms.ErrUnsupportedKeyAlgorithm
+		}
+		if err != nil {
+			svc.logger.Errorf("could not import version %d of key %s into crypto engine %s: %s", version.Version, kmsKey.ID, kmsKey.EngineID, err)
+			return "", false, err
+		}
+	}
+
+	return engineKeyID, false, nil
+}
+
+// exportKeyVersion returns the material of a key version, as a PKCS#8 PEM
+// private key or, for AES and HMAC keys, a symmetric key PEM. It returns an
+// empty string when the engine does not hand out the material, as HSMs do.
+// X25519 and ML-DSA keys cannot be imported back into an engine, so backing up
+// their material is refused instead of leaving it out of the archive.
+func (svc *KMSServiceBackend) exportKeyVersion(ctx context.Context, kmsKey *models.KMSKey, version *models.KMSKeyVersion, engine cryptoengines.CryptoEngine) (string, error) {
+	notImportable := fmt.Errorf("%w: material of version %d of %s key %s cannot be imported back into a crypto engine", kms.ErrKMSKeyNotExportable, version.Version, kmsKey.Algorithm, kmsKey.ID)
+
+	switch kmsKey.Algorithm {
+	case models.KMSKeyAlgorithmAES, models.KMSKeyAlgorithmHMAC:
+		key, err := engine.GetSymmetricKeyByID(ctx, version.EngineKeyID)
+		if errors.Is(err, cryptoengines.ErrOperationNotSupported) {
+			return "", nil
+		}
+		if err != nil {
+			svc.logger.Errorf("could not read version %d of key %s from crypto engine %s: %s", version.Version, kmsKey.ID, kmsKey.EngineID, err)
+			return "", err
+		}
+
+		return string(svc.keyProvider.EncodeSymmetricKey(key)), nil
+	case models.KMSKeyAlgorithmX25519:
+		decrypter, err := engine.GetDecrypterByID(ctx, version.EngineKeyID)
+		if errors.Is(err, cryptoengines.ErrOperationNotSupported) {
+			return "", nil
+		}
+		if err != nil {
+			svc.logger.Errorf("could not read version %d of key %s from crypto engine %s: %s", version.Version, kmsKey.ID, kmsKey.EngineID, err)
+			return "", err
+		}
+
+		if _, software := decrypter.(*cryptoengines.ECIESDecrypter); software {
+			return "", notImportable
+		}
+
+		return "", nil
+	}
+
+	signer, err := engine.GetPrivateKeyByID(ctx, version.EngineKeyID)
+	if err != nil {
+		svc.logger.Errorf("could not read version %d of key %s from crypto engine %s: %s", version.Version, kmsKey.ID, kmsKey.EngineID, err)
+		return "", err
+	}
+
+	switch signer.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+	case *mldsa.PrivateKey:
+		return "", notImportable
+	default:
+		return "", nil
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
+
+func publicKeyMatches(keyProvider *cryptoengines.SoftwareKeyProvider, pubKey crypto.PublicKey, publicKeyPEM string) bool {
+	storedPubKey, err := cryptoutils.ParsePublicKey(publicKeyPEM)
+	if err != nil {
+		return false
+	}
+
+	digest, err := keyProvider.EncodePKIXPublicKeyDigest(pubKey)
+	if err != nil {
+		return false
+	}
+
+	storedDigest, err := keyProvider.EncodePKIXPublicKeyDigest(storedPubKey)
+	if err != nil {
+		return false
+	}
+
+	return digest == storedDigest
+}
+
+func protectArchiveKey(archiveKey []byte, secret kms.BackupSecret) (*kms.BackupProtection, error) {
+	if secret.RecipientPublicKey != "" {
+		wrappedKey, err := encryptWithPublicKey(secret.RecipientPublicKey, archiveKey, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		fingerprint, err := recipientFingerprint(secret.RecipientPublicKey)
+		if err != nil {
+			return nil, err
+		}
+
+		return &kms.BackupProtection{
+			Mode:                 kms.BackupProtectionRecipient,
+			WrappedKey:           wrappedKey,
+			RecipientFingerprint: fingerprint,
+		}, nil
+	}
+
+	if len(secret.Passphrase) == 0 {
+		return nil, fmt.Errorf("a passphrase or a recipient public key is required")
+	}
+
+	protection := &kms.BackupProtection{
+		Mode: kms.BackupProtectionPassphrase,
+		Salt: make([]byte, 16),
+		N:    backupScryptN,
+		R:    backupScryptR,
+		P:    backupScryptP,
+	}
+	if _, err := rand.Read(protection.Salt); err != nil {
+		return nil, err
+	}
+
+	// The passphrase key wraps the random archive key, as a recipient key does.
+	passphraseKey, err := scrypt.Key(secret.Passphrase, protection.Salt, protection.N, protection.R, protection.P, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	protection.WrappedKey, err = sealBackup(passphraseKey, archiveKey, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return protection, nil
+}
+
+func (svc *KMSServiceBackend) unprotectArchiveKey(protection kms.BackupProtection, secret kms.BackupSecret) ([]byte, error) {
+	switch protection.Mode {
+	case kms.BackupProtectionPassphrase:
+		if len(secret.Passphrase) == 0 {
+			return nil, fmt.Errorf("the backup archive is protected with a passphrase")
+		}
+
+		// The parameters are read from the archive, so other values could make
+		// the key derivation exhaust the memory or the CPU of the restore.
+		if protection.N != backupScryptN || protection.R != backupScryptR || protection.P != backupScryptP {
+			return nil, fmt.Errorf("%w: unsupported scrypt parameters N=%d r=%d p=%d", kms.ErrInvalidBackupArchive, protection.N, protection.R, protection.P)
+		}
+
+		passphraseKey, err := scrypt.Key(secret.Passphrase, protection.Salt, protection.N, protection.R, protection.P, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", kms.ErrInvalidBackupArchive, err)
+		}
+
+		return openSealedBackup(passphraseKey, protection.WrappedKey, nil)
+	case kms.BackupProtectionRecipient:
+		if len(secret.RecipientPrivateKey) == 0 {
+			return nil, fmt.Errorf("the backup archive is protected for recipient %s", protection.RecipientFingerprint)
+		}
+
+		decrypter, err := svc.keyProvider.ParseDecrypter(secret.RecipientPrivateKey)
+		if err != nil {
+			return nil, err
+		}
+
+		var opts crypto.DecrypterOpts = &cryptoengines.ECIESDecrypterOpts{}
+		if _, isRSA := decrypter.Public().(*rsa.PublicKey); isRSA {
+			opts = &rsa.OAEPOptions{Hash: crypto.SHA256}
+		}
+
+		archiveKey, err := decrypter.Decrypt(rand.Reader, protection.WrappedKey, opts)
+		if err != nil {
+			return nil, kms.ErrBackupIntegrity
+		}
+
+		return archiveKey, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown protection mode %q", kms.ErrInvalidBackupArchive, protection.Mode)
+	}
+}
+
+// openBackup checks and decrypts a backup archive, returning its keys and the
+// archived private key material.
+func (svc *KMSServiceBackend) openBackup(r io.Reader, secret kms.BackupSecret) ([]models.KMSKey, []kms.BackupKeyMaterial, error) {
+	archive := &kms.BackupArchive{}
+	err := json.NewDecoder(r).Decode(archive)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", kms.ErrInvalidBackupArchive, err)
+	}
+
+	if archive.Format != kms.BackupArchiveFormat || archive.Version != kms.BackupArchiveVersion {
+		return nil, nil, fmt.Errorf("%w: unsupported format %s version %d", kms.ErrInvalidBackupArchive, archive.Format, archive.Version)
+	}
+
+	checksum, err := backupChecksum(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(checksum), []byte(archive.Checksum)) != 1 {
+		return nil, nil, kms.ErrBackupIntegrity
+	}
+
+	archiveKey, err := svc.unprotectArchiveKey(archive.Protection, secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	materialJSON, err := openSealedBackup(archiveKey, archive.Material, archive.Keys)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kmsKeys := []models.KMSKey{}
+	err = json.Unmarshal(archive.Keys, &kmsKeys)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", kms.ErrInvalidBackupArchive, err)
+	}
+
+	material := []kms.BackupKeyMaterial{}
+	err = json.Unmarshal(materialJSON, &material)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %s", kms.ErrInvalidBackupArchive, err)
+	}
+
+	// Version key IDs are not serialized.
+	for i := range kmsKeys {
+		for j := range kmsKeys[i].Versions {
+			kmsKeys[i].Versions[j].KMSKeyID = kmsKeys[i].ID
+		}
+	}
+
+	return kmsKeys, material, nil
+}
+
+func backupChecksum(archive *kms.BackupArchive) (string, error) {
+	unsummed := *archive
+	unsummed.Checksum = ""
+	content, err := json.Marshal(unsummed)
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256.Sum256(content)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+func recipientFingerprint(publicKeyPEM string) (string, error) {
+	pubKey, err := cryptoutils.ParsePublicKey(publicKeyPEM)
+	if err != nil {
+		return "", err
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		return "", err
+	}
+
+	digest := sha256.Sum256(der)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// sealBackup encrypts with AES-256-GCM, prefixing the ciphertext with the nonce.
+func sealBackup(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newBackupGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func openSealedBackup(key, sealed, aad []byte) ([]byte, error) {
+	gcm, err := newBackupGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return nil, kms.ErrBackupIntegrity
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], aad)
+	if err != nil {
+		return nil, kms.ErrBackupIntegrity
+	}
+
+	return plaintext, nil
+}
+
+func newBackupGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -1,8 +1,44 @@
 package kms
 
-import "github.com/lamassuiot/lamassuiot/v4/pkg/shared/config"
+import (
+	"time"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms/cryptoengines"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/config"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
+)
 
 type KMSConfig struct {
-	AppConfig config.AppConfig              `mapstructure:"app"`
-	Storage   config.PluggableStorageEngine `mapstructure:"storage"`
+	AppConfig      config.AppConfig              `mapstructure:"app"`
+	Storage        config.PluggableStorageEngine `mapstructure:"storage"`
+	CryptoEngines  CryptoEnginesConfig           `mapstructure:"crypto_engines"`
+	KeyRotation    KeyRotationConfig             `mapstructure:"key_rotation"`
+	KeyDeletion    KeyDeletionConfig             `mapstructure:"key_deletion"`
+	JWKS           JWKSConfig                    `mapstructure:"jwks"`
+	Reconciliation ReconciliationConfig          `mapstructure:"key_reconciliation"`
+}
+
+type CryptoEnginesConfig struct {
+	LogLevel      logger.Level                       `mapstructure:"log_level"`
+	DefaultEngine string                             `mapstructure:"default_id"`
+	CryptoEngines []cryptoengines.CryptoEngineConfig `mapstructure:"engines"`
+}
+
+type KeyRotationConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+}
+
+type KeyDeletionConfig struct {
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+}
+
+type ReconciliationConfig struct {
+	Enabled       bool          `mapstructure:"enabled"`
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+}
+
+type JWKSConfig struct {
+	// RotatedKeyRetention is how long rotated key versions stay in the JWKS.
+	RotatedKeyRetention time.Duration `mapstructure:"rotated_key_retention"`
 }
@@ -1,15 +1,25 @@
 package kms
 
 import (
+	"context"
+	"errors"
+	"strconv"
+
 	"github.com/go-playground/validator/v10"
 	"github.com/gofiber/fiber/v2"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/kms"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms/cryptoengines"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
 	fiber_context_mw "github.com/lamassuiot/lamassuiot/v4/pkg/shared/http/server/middleware/context"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/storage"
 )
 
-var KMSFiltrableFields = map[string]resources.FilterFieldType{}
+var KMSFiltrableFields = KMSKeyFields.Select("engine_id", "status", "unmanaged", "policy.operations", "metadata.*")
+
+// KMSExportColumns are the CSV columns of key exports, unless others are
+// requested.
+var KMSExportColumns = []string{"id", "name", "algorithm", "size", "engine_id", "status", "primary_version", "rotation_period_days", "next_rotation_ts", "deletion_ts", "unmanaged", "creation_ts"}
 
 var validate = validator.New()
 
@@ -24,30 +34,32 @@ func NewKMSHttpRoutes(svc kms.KMSService) *kmsHttpRoutes {
 }
 
 func (r *kmsHttpRoutes) CreateKMSKey(ctx *fiber.Ctx) error {
-	var requestBody kms.CreateKMSInput
-
-	if err := ctx.BodyParser(&requestBody); err != nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
-	}
-
-	if err := validate.Struct(&requestBody); err != nil {
-		errs := make(map[string]string)
-		for _, e := range err.(validator.ValidationErrors) {
-			errs[e.Field()] = e.Tag()
-		}
-		return ctx.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"errors": errs})
+	var requestBody kms.CreateKMSRequestBody
+	if valid, err := parseAndValidate(ctx, &requestBody); !valid {
+		return err
 	}
 
-	err := r.svc.CreateKMSKey(ctx.UserContext(), requestBody)
+	kmsKey, err := r.svc.CreateKMSKey(fiber_context_mw.GetRequestContext(ctx), kms.CreateKMSInput{
+		Alias:              requestBody.Alias,
+		Algorithm:          requestBody.Algorithm,
+		Size:               requestBody.Size,
+		EngineID:           requestBody.EngineID,
+		RotationPeriodDays: requestBody.RotationPeriodDays,
+		Policy:             requestBody.Policy,
+		PublishJWKS:        requestBody.PublishJWKS,
+	})
 	if err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"err": err.Error()})
+		return errorResponse(ctx, err)
 	}
 
-	return ctx.Status(fiber.StatusOK).JSON(nil)
+	return keyResponse(ctx, kmsKey)
 }
 
 func (r *kmsHttpRoutes) GetAllKMSKeys(ctx *fiber.Ctx) error {
-	queryParams := resources.FilterQuery(ctx, KMSFiltrableFields)
+	queryParams, err := resources.FilterQuery(ctx, KMSFiltrableFields)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
+	}
 
 	kmsKeys := []models.KMSKey{}
 
@@ -60,13 +72,593 @@ func (r *kmsHttpRoutes) GetAllKMSKeys(ctx *fiber.Ctx) error {
 	})
 
 	if err != nil {
-		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"err": err.Error()})
+		return errorResponse(ctx, err)
+	}
+
+	var total *int
+	if queryParams.IncludeTotal {
+		count, err := r.svc.CountKMSKeys(fiber_context_mw.GetRequestContext(ctx), kms.CountKMSKeysInput{
+			QueryParameters: queryParams,
+		})
+		if err != nil {
+			return errorResponse(ctx, err)
+		}
+		total = &count
 	}
 
 	return ctx.Status(fiber.StatusOK).JSON(kms.GetKMSKeysResponse{
 		IterableList: resources.IterableList[models.KMSKey]{
 			NextBookmark: nextBookmark,
 			List:         kmsKeys,
+			Total:        total,
 		},
 	})
 }
+
+func (r *kmsHttpRoutes) ExportKMSKeys(ctx *fiber.Ctx) error {
+	queryParams, err := resources.FilterQuery(ctx, KMSFiltrableFields)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
+	}
+
+	queryParams.NextBookmark = ""
+	queryParams.PageSize = resources.ExportBatchSize
+
+	options, err := resources.ExportQuery[models.KMSKey](ctx, KMSExportColumns)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
+	}
+
+	return resources.StreamExport(ctx, fiber_context_mw.GetRequestContext(ctx), options, "kms-keys", func(reqCtx context.Context, applyFunc func(models.KMSKey)) error {
+		_, err := r.svc.GetKMSKeys(reqCtx, kms.GetKMSKeysInput{
+			QueryParameters: queryParams,
+			ExhaustiveRun:   true,
+			ApplyFunc:       applyFunc,
+		})
+		return err
+	})
+}
+
+func (r *kmsHttpRoutes) GetKMSKeyStats(ctx *fiber.Ctx) error {
+	queryParams, err := resources.FilterQuery(ctx, KMSFiltrableFields)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
+	}
+
+	stats, err := r.svc.GetKMSKeyStats(fiber_context_mw.GetRequestContext(ctx), kms.GetKMSKeyStatsInput{
+		QueryParameters: queryParams,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(stats)
+}
+
+func (r *kmsHttpRoutes) Encrypt(ctx *fiber.Ctx) error {
+	var requestBody kms.EncryptRequestBody
+	if valid, err := parseAndValidate(ctx, &requestBody); !valid {
+		return err
+	}
+
+	ciphertext, err := r.svc.Encrypt(fiber_context_mw.GetRequestContext(ctx), kms.EncryptInput{
+		ID:        ctx.Params("id"),
+		Plaintext: requestBody.Plaintext,
+		AAD:       requestBody.AAD,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(kms.EncryptResponse{
+		Ciphertext: ciphertext,
+	})
+}
+
+func (r *kmsHttpRoutes) Decrypt(ctx *fiber.Ctx) error {
+	var requestBody kms.DecryptRequestBody
+	if valid, err := parseAndValidate(ctx, &requestBody); !valid {
+		return err
+	}
+
+	plaintext, err := r.svc.Decrypt(fiber_context_mw.GetRequestContext(ctx), kms.DecryptInput{
+		ID:         ctx.Params("id"),
+		Ciphertext: requestBody.Ciphertext,
+		AAD:        requestBody.AAD,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(kms.DecryptResponse{
+		Plaintext: plaintext,
+	})
+}
+
+func (r *kmsHttpRoutes) GenerateMAC(ctx *fiber.Ctx) error {
+	var requestBody kms.MACRequestBody
+	if valid, err := parseAndValidate(ctx, &requestBody); !valid {
+		return err
+	}
+
+	mac, err := r.svc.GenerateMAC(fiber_context_mw.GetRequestContext(ctx), kms.GenerateMACInput{
+		ID:      ctx.Params("id"),
+		Message: requestBody.Message,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(kms.MACResponse{
+		MAC: mac,
+	})
+}
+
+func (r *kmsHttpRoutes) VerifyMAC(ctx *fiber.Ctx) error {
+	var requestBody kms.VerifyMACRequestBody
+	if valid, err := parseAndValidate(ctx, &requestBody); !valid {
+		return err
+	}
+
+	valid, err := r.svc.VerifyMAC(fiber_context_mw.GetRequestContext(ctx), kms.VerifyMACInput{
+		ID:      ctx.Params("id"),
+		Message: requestBody.Message,
+		MAC:     requestBody.MAC,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(kms.VerifyMACResponse{
+		Valid: valid,
+	})
+}
+
+func (r *kmsHttpRoutes) RotateKMSKey(ctx *fiber.Ctx) error {
+	revision, err := resources.IfMatch(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
+	}
+
+	kmsKey, err := r.svc.RotateKMSKey(fiber_context_mw.GetRequestContext(ctx), kms.RotateKMSKeyInput{
+		ID:       ctx.Params("id"),
+		Revision: revision,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return keyResponse(ctx, kmsKey)
+}
+
+func (r *kmsHttpRoutes) UpdateKMSKeyVersionState(ctx *fiber.Ctx) error {
+	version, err := strconv.Atoi(ctx.Params("version"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": "invalid key version"})
+	}
+
+	revision, err := resources.IfMatch(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
+	}
+
+	var requestBody kms.UpdateKMSKeyVersionStateRequestBody
+	if valid, err := parseAndValidate(ctx, &requestBody); !valid {
+		return err
+	}
+
+	kmsKey, err := r.svc.UpdateKMSKeyVersionState(fiber_context_mw.GetRequestContext(ctx), kms.UpdateKMSKeyVersionStateInput{
+		ID:       ctx.Params("id"),
+		Version:  version,
+		State:    requestBody.State,
+		Revision: revision,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return keyResponse(ctx, kmsKey)
+}
+
+func (r *kmsHttpRoutes) ScheduleKMSKeyDeletion(ctx *fiber.Ctx) error {
+	pendingWindow, err := strconv.Atoi(ctx.Query("pending_window_days", "0"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": "invalid pending window"})
+	}
+
+	revision, err := resources.IfMatch(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
+	}
+
+	kmsKey, err := r.svc.ScheduleKMSKeyDeletion(fiber_context_mw.GetRequestContext(ctx), kms.ScheduleKMSKeyDeletionInput{
+		ID:                ctx.Params("id"),
+		PendingWindowDays: pendingWindow,
+		Revision:          revision,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return keyResponse(ctx, kmsKey)
+}
+
+func (r *kmsHttpRoutes) CancelKMSKeyDeletion(ctx *fiber.Ctx) error {
+	revision, err := resources.IfMatch(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
+	}
+
+	kmsKey, err := r.svc.CancelKMSKeyDeletion(fiber_context_mw.GetRequestContext(ctx), kms.CancelKMSKeyDeletionInput{
+		ID:       ctx.Params("id"),
+		Revision: revision,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return keyResponse(ctx, kmsKey)
+}
+
+func (r *kmsHttpRoutes) UpdateKMSKeyPolicy(ctx *fiber.Ctx) error {
+	revision, err := resources.IfMatch(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
+	}
+
+	var requestBody kms.UpdateKMSKeyPolicyRequestBody
+	if valid, err := parseAndValidate(ctx, &requestBody); !valid {
+		return err
+	}
+
+	kmsKey, err := r.svc.UpdateKMSKeyPolicy(fiber_context_mw.GetRequestContext(ctx), kms.UpdateKMSKeyPolicyInput{
+		ID:       ctx.Params("id"),
+		Policy:   requestBody.Policy,
+		Revision: revision,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return keyResponse(ctx, kmsKey)
+}
+
+func (r *kmsHttpRoutes) UpdateKMSKeyMetadata(ctx *fiber.Ctx) error {
+	revision, err := resources.IfMatch(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
+	}
+
+	var requestBody kms.UpdateKMSKeyMetadataRequestBody
+	if valid, err := parseAndValidate(ctx, &requestBody); !valid {
+		return err
+	}
+
+	kmsKey, err := r.svc.UpdateKMSKeyMetadata(fiber_context_mw.GetRequestContext(ctx), kms.UpdateKMSKeyMetadataInput{
+		ID:       ctx.Params("id"),
+		Metadata: requestBody.Metadata,
+		Revision: revision,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return keyResponse(ctx, kmsKey)
+}
+
+func (r *kmsHttpRoutes) GetKMSKey(ctx *fiber.Ctx) error {
+	kmsKey, err := r.svc.GetKMSKeyByID(fiber_context_mw.GetRequestContext(ctx), kms.GetKMSKeyByIDInput{
+		ID: ctx.Params("id"),
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return keyResponse(ctx, kmsKey)
+}
+
+func (r *kmsHttpRoutes) GetPublicKey(ctx *fiber.Ctx) error {
+	version, err := strconv.Atoi(ctx.Query("version", "0"))
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": "invalid key version"})
+	}
+
+	publicKey, err := r.svc.GetPublicKey(fiber_context_mw.GetRequestContext(ctx), kms.GetPublicKeyInput{
+		ID:      ctx.Params("id"),
+		Version: version,
+		Format:  kms.PublicKeyFormat(ctx.Query("format", string(kms.PublicKeyFormatPEM))),
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(publicKey)
+}
+
+func (r *kmsHttpRoutes) CreateCSR(ctx *fiber.Ctx) error {
+	var requestBody kms.CreateCSRRequestBody
+	if valid, err := parseAndValidate(ctx, &requestBody); !valid {
+		return err
+	}
+
+	csr, err := r.svc.CreateCSR(fiber_context_mw.GetRequestContext(ctx), kms.CreateCSRInput{
+		ID:                ctx.Params("id"),
+		Subject:           requestBody.Subject,
+		DNSNames:          requestBody.DNSNames,
+		EmailAddresses:    requestBody.EmailAddresses,
+		IPAddresses:       requestBody.IPAddresses,
+		URIs:              requestBody.URIs,
+		KeyUsages:         requestBody.KeyUsages,
+		ExtendedKeyUsages: requestBody.ExtendedKeyUsages,
+		Extensions:        requestBody.Extensions,
+		Algorithm:         requestBody.Algorithm,
+		Format:            requestBody.Format,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(csr)
+}
+
+func (r *kmsHttpRoutes) SetKMSKeyJWKSPublication(ctx *fiber.Ctx) error {
+	revision, err := resources.IfMatch(ctx)
+	if err != nil {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
+	}
+
+	var requestBody kms.SetKMSKeyJWKSPublicationRequestBody
+	if valid, err := parseAndValidate(ctx, &requestBody); !valid {
+		return err
+	}
+
+	kmsKey, err := r.svc.SetKMSKeyJWKSPublication(fiber_context_mw.GetRequestContext(ctx), kms.SetKMSKeyJWKSPublicationInput{
+		ID:        ctx.Params("id"),
+		Published: requestBody.Published,
+		Revision:  revision,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return keyResponse(ctx, kmsKey)
+}
+
+func (r *kmsHttpRoutes) GetJWKS(ctx *fiber.Ctx) error {
+	jwks, err := r.svc.GetJWKS(fiber_context_mw.GetRequestContext(ctx))
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(jwks)
+}
+
+func (r *kmsHttpRoutes) SignJWT(ctx *fiber.Ctx) error {
+	var requestBody kms.SignJWTRequestBody
+	if valid, err := parseAndValidate(ctx, &requestBody); !valid {
+		return err
+	}
+
+	token, err := r.svc.SignJWT(fiber_context_mw.GetRequestContext(ctx), kms.SignJWTInput{
+		ID:        ctx.Params("id"),
+		Claims:    requestBody.Claims,
+		Algorithm: requestBody.Algorithm,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(kms.SignJWTResponse{
+		Token: token,
+	})
+}
+
+func (r *kmsHttpRoutes) VerifyJWS(ctx *fiber.Ctx) error {
+	var requestBody kms.VerifyJWSRequestBody
+	if valid, err := parseAndValidate(ctx, &requestBody); !valid {
+		return err
+	}
+
+	output, err := r.svc.VerifyJWS(fiber_context_mw.GetRequestContext(ctx), kms.VerifyJWSInput{
+		Token: requestBody.Token,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(output)
+}
+
+func (r *kmsHttpRoutes) MigrateKMSKey(ctx *fiber.Ctx) error {
+	var requestBody kms.MigrateKMSKeyRequestBody
+	if valid, err := parseAndValidate(ctx, &requestBody); !valid {
+		return err
+	}
+
+	kmsKey, err := r.svc.MigrateKMSKey(fiber_context_mw.GetRequestContext(ctx), kms.MigrateKMSKeyInput{
+		ID:             ctx.Params("id"),
+		TargetEngineID: requestBody.TargetEngineID,
+		DeleteSource:   requestBody.DeleteSource,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return keyResponse(ctx, kmsKey)
+}
+
+func (r *kmsHttpRoutes) ExportKMSKeyShares(ctx *fiber.Ctx) error {
+	var requestBody kms.ExportKMSKeySharesRequestBody
+	if valid, err := parseAndValidate(ctx, &requestBody); !valid {
+		return err
+	}
+
+	shares, err := r.svc.ExportKMSKeyShares(fiber_context_mw.GetRequestContext(ctx), kms.ExportKMSKeySharesInput{
+		ID:        ctx.Params("id"),
+		Version:   requestBody.Version,
+		Shares:    requestBody.Shares,
+		Threshold: requestBody.Threshold,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(shares)
+}
+
+func (r *kmsHttpRoutes) ImportKMSKeyShares(ctx *fiber.Ctx) error {
+	var requestBody kms.ImportKMSKeySharesRequestBody
+	if valid, err := parseAndValidate(ctx, &requestBody); !valid {
+		return err
+	}
+
+	kmsKey, err := r.svc.ImportKMSKeyShares(fiber_context_mw.GetRequestContext(ctx), kms.ImportKMSKeySharesInput{
+		Alias:    requestBody.Alias,
+		EngineID: requestBody.EngineID,
+		Shares:   requestBody.Shares,
+		Policy:   requestBody.Policy,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return keyResponse(ctx, kmsKey)
+}
+
+func (r *kmsHttpRoutes) GetCryptoEngines(ctx *fiber.Ctx) error {
+	engines, err := r.svc.GetCryptoEngines(fiber_context_mw.GetRequestContext(ctx))
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(engines)
+}
+
+func (r *kmsHttpRoutes) SyncCryptoEngine(ctx *fiber.Ctx) error {
+	report, err := r.svc.SyncCryptoEngine(fiber_context_mw.GetRequestContext(ctx), kms.SyncCryptoEngineInput{
+		EngineID: ctx.Params("id"),
+		DryRun:   ctx.QueryBool("dry_run", false),
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(report)
+}
+
+func (r *kmsHttpRoutes) Sign(ctx *fiber.Ctx) error {
+	var requestBody kms.SignRequestBody
+	if valid, err := parseAndValidate(ctx, &requestBody); !valid {
+		return err
+	}
+
+	output, err := r.svc.Sign(fiber_context_mw.GetRequestContext(ctx), kms.SignInput{
+		ID:          ctx.Params("id"),
+		Message:     requestBody.Message,
+		MessageType: requestBody.MessageType,
+		Algorithm:   requestBody.Algorithm,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(kms.SignResponse{
+		Signature:  output.Signature,
+		KeyVersion: output.KeyVersion,
+		Algorithm:  output.Algorithm,
+	})
+}
+
+func (r *kmsHttpRoutes) Verify(ctx *fiber.Ctx) error {
+	var requestBody kms.VerifyRequestBody
+	if valid, err := parseAndValidate(ctx, &requestBody); !valid {
+		return err
+	}
+
+	valid, err := r.svc.Verify(fiber_context_mw.GetRequestContext(ctx), kms.VerifyInput{
+		ID:          ctx.Params("id"),
+		Message:     requestBody.Message,
+		MessageType: requestBody.MessageType,
+		Signature:   requestBody.Signature,
+		Algorithm:   requestBody.Algorithm,
+		KeyVersion:  requestBody.KeyVersion,
+	})
+	if err != nil {
+		return errorResponse(ctx, err)
+	}
+
+	return ctx.Status(fiber.StatusOK).JSON(kms.VerifyResponse{
+		Valid: valid,
+	})
+}
+
+// parseAndValidate decodes the request body into requestBody. When the body
+// is not valid, the error response is written and false is returned.
+func parseAndValidate(ctx *fiber.Ctx, requestBody any) (bool, error) {
+	if err := ctx.BodyParser(requestBody); err != nil {
+		return false, ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": err.Error()})
+	}
+
+	if err := validate.Struct(requestBody); err != nil {
+		errs := make(map[string]string)
+		for _, e := range err.(validator.ValidationErrors) {
+			errs[e.Field()] = e.Tag()
+		}
+		return false, ctx.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"errors": errs})
+	}
+
+	return true, nil
+}
+
+// keyResponse returns a key along with the entity tag of its revision, for
+// clients to make conditional updates with If-Match.
+func keyResponse(ctx *fiber.Ctx, kmsKey *models.KMSKey) error {
+	ctx.Set(fiber.HeaderETag, resources.ETag(kmsKey.Revision))
+	return ctx.Status(fiber.StatusOK).JSON(kmsKey)
+}
+
+func errorResponse(ctx *fiber.Ctx, err error) error {
+	var policyErr *kms.PolicyError
+	if errors.As(err, &policyErr) {
+		return ctx.Status(fiber.StatusForbidden).JSON(fiber.Map{"err": policyErr.Error(), "code": policyErr.Code})
+	}
+
+	var bookmarkErr *storage.InvalidBookmarkError
+	if errors.As(err, &bookmarkErr) {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"err": bookmarkErr.Error()})
+	}
+
+	var conflictErr *resources.ConflictError
+	if errors.As(err, &conflictErr) {
+		return ctx.Status(fiber.StatusPreconditionFailed).JSON(fiber.Map{"err": conflictErr.Error()})
+	}
+
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, kms.ErrKMSKeyNotFound),
+		errors.Is(err, kms.ErrKMSKeyVersionNotFound),
+		errors.Is(err, kms.ErrCryptoEngineNotFound):
+		status = fiber.StatusNotFound
+	case errors.Is(err, kms.ErrKMSKeyPendingDeletion),
+		errors.Is(err, kms.ErrKMSKeyInUse),
+		errors.Is(err, kms.ErrKMSKeyNotMigratable),
+		errors.Is(err, kms.ErrKMSKeyNotExportable):
+		status = fiber.StatusConflict
+	case errors.Is(err, kms.ErrInvalidCiphertext),
+		errors.Is(err, kms.ErrInvalidPendingWindow),
+		errors.Is(err, kms.ErrInvalidPolicy),
+		errors.Is(err, kms.ErrUnsupportedPublicKeyFormat),
+		errors.Is(err, kms.ErrInvalidJWS),
+		errors.Is(err, kms.ErrKMSKeyVersionNotUsable),
+		errors.Is(err, kms.ErrInvalidStateTransition),
+		errors.Is(err, kms.ErrInvalidSignatureRequest),
+		errors.Is(err, kms.ErrInvalidCSRRequest),
+		errors.Is(err, kms.ErrUnsupportedKeyAlgorithm),
+		errors.Is(err, kms.ErrUnsupportedKeyOperation),
+		errors.Is(err, cryptoengines.ErrInvalidKeyShares),
+		errors.Is(err, cryptoengines.ErrOperationNotSupported):
+		status = fiber.StatusBadRequest
+	}
+
+	return ctx.Status(status).JSON(fiber.Map{"err": err.Error()})
+}
@@ -0,0 +1,70 @@
+package kms
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
+)
+
+func TestKeyLifecycleIfMatch(t *testing.T) {
+	app, repo := newPolicyTestApp(t)
+	kmsKey := createTestKey(t, app, `{"alias":"conditional","algorithm":"ECDSA","size":256}`)
+
+	request := func(method, path string, revision int) (int, string) {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("If-Match", resources.ETag(revision))
+
+		res, err := app.Test(req)
+		if err != nil {
+			t.Fatalf("request failed: %s", err)
+		}
+		defer res.Body.Close()
+
+		return res.StatusCode, res.Header.Get("ETag")
+	}
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		check  func(kmsKey *models.KMSKey) bool
+	}{
+		{"Rotate", http.MethodPost, "/v1/kms/" + kmsKey.ID + "/rotate", func(kmsKey *models.KMSKey) bool { return kmsKey.PrimaryVersion == 2 }},
+		{"ScheduleDeletion", http.MethodDelete, "/v1/kms/" + kmsKey.ID, func(kmsKey *models.KMSKey) bool { return kmsKey.Status == models.KMSKeyStatusPendingDeletion }},
+		{"CancelDeletion", http.MethodPost, "/v1/kms/" + kmsKey.ID + "/cancel-deletion", func(kmsKey *models.KMSKey) bool { return kmsKey.Status == models.KMSKeyStatusEnabled }},
+	}
+	stored := func() *models.KMSKey {
+		_, stored, err := repo.SelectExistsByID(context.Background(), kmsKey.ID)
+		if err != nil {
+			t.Fatalf("could not read key: %s", err)
+		}
+
+		return stored
+	}
+
+	for _, step := range steps {
+		revision := stored().Revision
+
+		if status, _ := request(step.method, step.path, revision-1); status != http.StatusPreconditionFailed {
+			t.Errorf("%s: got status %d with a stale revision, want %d", step.name, status, http.StatusPreconditionFailed)
+		}
+
+		if stale := stored(); stale.Revision != revision || step.check(stale) {
+			t.Fatalf("%s: key was modified by a request with a stale revision", step.name)
+		}
+
+		status, etag := request(step.method, step.path, revision)
+		if status != http.StatusOK {
+			t.Fatalf("%s: got status %d with the current revision, want %d", step.name, status, http.StatusOK)
+		}
+
+		updated := stored()
+		if !step.check(updated) || etag != resources.ETag(updated.Revision) {
+			t.Errorf("%s: key was not updated or got ETag %s for revision %d", step.name, etag, updated.Revision)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package kms
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+)
+
+var x509SignatureAlgorithms = map[kms.SigningAlgorithm]x509.SignatureAlgorithm{
+	kms.SigningAlgorithmRSAPKCS1v15SHA256: x509.SHA256WithRSA,
+	kms.SigningAlgorithmRSAPKCS1v15SHA384: x509.SHA384WithRSA,
+	kms.SigningAlgorithmRSAPKCS1v15SHA512: x509.SHA512WithRSA,
+	kms.SigningAlgorithmRSAPSSSHA256:      x509.SHA256WithRSAPSS,
+	kms.SigningAlgorithmRSAPSSSHA384:      x509.SHA384WithRSAPSS,
+	kms.SigningAlgorithmRSAPSSSHA512:      x509.SHA512WithRSAPSS,
+	kms.SigningAlgorithmECDSASHA256:       x509.ECDSAWithSHA256,
+	kms.SigningAlgorithmECDSASHA384:       x509.ECDSAWithSHA384,
+	kms.SigningAlgorithmECDSASHA512:       x509.ECDSAWithSHA512,
+	kms.SigningAlgorithmEd25519:           x509.PureEd25519,
+}
+
+// csrKeyUsages maps key usage names to their bit in the key usage extension and
+// to the key algorithms able to honour them. A nil list allows every signing key.
+var csrKeyUsages = map[string]struct {
+	bit        int
+	algorithms []string
+}{
+	kms.KeyUsageDigitalSignature:  {bit: 0},
+	kms.KeyUsageContentCommitment: {bit: 1},
+	kms.KeyUsageKeyEncipherment:   {bit: 2, algorithms: []string{models.KMSKeyAlgorithmRSA}},
+	kms.KeyUsageDataEncipherment:  {bit: 3, algorithms: []string{models.KMSKeyAlgorithmRSA}},
+	kms.KeyUsageKeyAgreement:      {bit: 4, algorithms: []string{models.KMSKeyAlgorithmECDSA}},
+	kms.KeyUsageCertSign:          {bit: 5},
+	kms.KeyUsageCRLSign:           {bit: 6},
+	kms.KeyUsageEncipherOnly:      {bit: 7, algorithms: []string{models.KMSKeyAlgorithmECDSA}},
+	kms.KeyUsageDecipherOnly:      {bit: 8, algorithms: []string{models.KMSKeyAlgorithmECDSA}},
+}
+
+var csrExtKeyUsages = map[string]asn1.ObjectIdentifier{
+	kms.ExtKeyUsageServerAuth:      {1, 3, 6, 1, 5, 5, 7, 3, 1},
+	kms.ExtKeyUsageClientAuth:      {1, 3, 6, 1, 5, 5, 7, 3, 2},
+	kms.ExtKeyUsageCodeSigning:     {1, 3, 6, 1, 5, 5, 7, 3, 3},
+	kms.ExtKeyUsageEmailProtection: {1, 3, 6, 1, 5, 5, 7, 3, 4},
+	kms.ExtKeyUsageTimeStamping:    {1, 3, 6, 1, 5, 5, 7, 3, 8},
+	kms.ExtKeyUsageOCSPSigning:     {1, 3, 6, 1, 5, 5, 7, 3, 9},
+}
+
+var (
+	oidExtensionKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionSubjectAltName   = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+)
+
+// CreateCSR builds a PKCS#10 certificate signing request for the primary version
+// of a key and signs it through the crypto engine. Signing a CSR is a sign
+// operation for the key policy.
+func (svc *KMSServiceBackend) CreateCSR(ctx context.Context, input kms.CreateCSRInput) (*kms.CertificateSigningRequest, error) {
+	kmsKey, engine, err := svc.getKeyAndEngine(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm, scheme, err := resolveSigningAlgorithm(kmsKey, input.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	// Certificates over P-224 are not supported by crypto/x509.
+	signatureAlgorithm, ok := x509SignatureAlgorithms[algorithm]
+	if !ok || (kmsKey.Algorithm == models.KMSKeyAlgorithmECDSA && kmsKey.Size == 224) {
+		return nil, fmt.Errorf("%w: %s %d keys cannot sign certificate signing requests", kms.ErrUnsupportedKeyOperation, kmsKey.Algorithm, kmsKey.Size)
+	}
+
+	err = authorize(ctx, kmsKey, policyRequest{
+		Operation: models.KMSKeyOperationSign,
+		Algorithm: algorithm,
+		Hash:      hashName(scheme.hash),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	format := input.Format
+	if format == "" {
+		format = kms.CSRFormatPEM
+	}
+
+	if format != kms.CSRFormatPEM && format != kms.CSRFormatDER {
+		return nil, fmt.Errorf("%w: unsupported format %s", kms.ErrInvalidCSRRequest, format)
+	}
+
+	template, err := csrTemplate(kmsKey, input)
+	if err != nil {
+		return nil, err
+	}
+
+	template.SignatureAlgorithm = signatureAlgorithm
+
+	version, err := primaryVersion(kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := engine.GetPrivateKeyByID(ctx, version.EngineKeyID)
+	if err != nil {
+		svc.logger.Errorf("could not get signer for key %s: %s", kmsKey.ID, err)
+		return nil, err
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, signer)
+	if err != nil {
+		svc.logger.Errorf("could not create certificate signing request with key %s: %s", kmsKey.ID, err)
+		return nil, err
+	}
+
+	svc.logger.Infof("certificate signing request for %q created with version %d of key %s", template.Subject.String(), version.Version, kmsKey.ID)
+
+	csr := &kms.CertificateSigningRequest{
+		KeyID:      kmsKey.ID,
+		KeyVersion: version.Version,
+		Algorithm:  algorithm,
+		Format:     format,
+	}
+
+	if format == kms.CSRFormatDER {
+		csr.DER = der
+	} else {
+		csr.PEM = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}))
+	}
+
+	return csr, nil
+}
+
+// csrTemplate validates the request and turns it into a certificate request
+// template. Requested extensions cannot replace the ones built from the subject
+// alternative names and key usages.
+func csrTemplate(kmsKey *models.KMSKey, input kms.CreateCSRInput) (*x509.CertificateRequest, error) {
+	template := &x509.CertificateRequest{
+		Subject:        csrSubject(input.Subject),
+		DNSNames:       input.DNSNames,
+		EmailAddresses: input.EmailAddresses,
+	}
+
+	for _, ip := range input.IPAddresses {
+		parsed := net.ParseIP(ip)
+		if parsed == nil {
+			return nil, fmt.Errorf("%w: invalid IP address %q", kms.ErrInvalidCSRRequest, ip)
+		}
+
+		template.IPAddresses = append(template.IPAddresses, parsed)
+	}
+
+	for _, uri := range input.URIs {
+		parsed, err := url.Parse(uri)
+		if err != nil || parsed.Scheme == "" {
+			return nil, fmt.Errorf("%w: invalid URI %q", kms.ErrInvalidCSRRequest, uri)
+		}
+
+		template.URIs = append(template.URIs, parsed)
+	}
+
+	hasSANs := len(template.DNSNames)+len(template.EmailAddresses)+len(template.IPAddresses)+len(template.URIs) > 0
+	if input.Subject.CommonName == "" && !hasSANs {
+		return nil, fmt.Errorf("%w: a common name or a subject alternative name is required", kms.ErrInvalidCSRRequest)
+	}
+
+	reserved := map[string]bool{}
+	if hasSANs {
+		reserved[oidExtensionSubjectAltName.String()] = true
+	}
+
+	if len(input.KeyUsages) > 0 {
+		extension, err := keyUsageExtension(kmsKey, input.KeyUsages)
+		if err != nil {
+			return nil, err
+		}
+
+		template.ExtraExtensions = append(template.ExtraExtensions, extension)
+		reserved[oidExtensionKeyUsage.String()] = true
+	}
+
+	if len(input.ExtendedKeyUsages) > 0 {
+		extension, err := extKeyUsageExtension(input.ExtendedKeyUsages)
+		if err != nil {
+			return nil, err
+		}
+
+		template.ExtraExtensions = append(template.ExtraExtensions, extension)
+		reserved[oidExtensionExtendedKeyUsage.String()] = true
+	}
+
+	for _, requested := range input.Extensions {
+		oid, err := parseOID(requested.OID)
+		if err != nil {
+			return nil, err
+		}
+
+		if reserved[oid.String()] {
+			return nil, fmt.Errorf("%w: extension %s is set more than once", kms.ErrInvalidCSRRequest, oid)
+		}
+
+		var value asn1.RawValue
+		if rest, err := asn1.Unmarshal(requested.Value, &value); err != nil || len(rest) != 0 {
+			return nil, fmt.Errorf("%w: value of extension %s is not DER encoded", kms.ErrInvalidCSRRequest, oid)
+		}
+
+		template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{
+			Id:       oid,
+			Critical: requested.Critical,
+			Value:    requested.Value,
+		})
+		reserved[oid.String()] = true
+	}
+
+	return template, nil
+}
+
+func csrSubject(subject kms.CSRSubject) pkix.Name {
+	name := pkix.Name{CommonName: subject.CommonName}
+	for _, attribute := range []struct {
+		value  string
+		target *[]string
+	}{
+		{subject.Organization, &name.Organization},
+		{subject.OrganizationUnit, &name.OrganizationalUnit},
+		{subject.Country, &name.Country},
+		{subject.State, &name.Province},
+		{subject.Locality, &name.Locality},
+	} {
+		if attribute.value != "" {
+			*attribute.target = []string{attribute.value}
+		}
+	}
+
+	return name
+}
+
+// keyUsageExtension encodes the key usage extension, checking every usage can be
+// honoured by the key type. Encipher and decipher only qualify key agreement.
+func keyUsageExtension(kmsKey *models.KMSKey, usages []string) (pkix.Extension, error) {
+	bits := map[int]bool{}
+	for _, usage := range usages {
+		keyUsage, ok := csrKeyUsages[usage]
+		if !ok {
+			return pkix.Extension{}, fmt.Errorf("%w: unknown key usage %s", kms.ErrInvalidCSRRequest, usage)
+		}
+
+		if keyUsage.algorithms != nil && !slices.Contains(keyUsage.algorithms, kmsKey.Algorithm) {
+			return pkix.Extension{}, fmt.Errorf("%w: key usage %s is not supported by %s keys", kms.ErrInvalidCSRRequest, usage, kmsKey.Algorithm)
+		}
+
+		bits[keyUsage.bit] = true
+	}
+
+	agreement := csrKeyUsages[kms.KeyUsageKeyAgreement].bit
+	if (bits[csrKeyUsages[kms.KeyUsageEncipherOnly].bit] || bits[csrKeyUsages[kms.KeyUsageDecipherOnly].bit]) && !bits[agreement] {
+		return pkix.Extension{}, fmt.Errorf("%w: encipher and decipher only require key agreement", kms.ErrInvalidCSRRequest)
+	}
+
+	// DER bit strings drop trailing zero bits, bit 0 is the most significant one.
+	bitString := asn1.BitString{}
+	for bit := range bits {
+		bitString.BitLength = max(bitString.BitLength, bit+1)
+	}
+
+	bitString.Bytes = make([]byte, (bitString.BitLength+7)/8)
+	for bit := range bits {
+		bitString.Bytes[bit/8] |= 0x80 >> (bit % 8)
+	}
+
+	value, err := asn1.Marshal(bitString)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+
+	return pkix.Extension{Id: oidExtensionKeyUsage, Critical: true, Value: value}, nil
+}
+
+func extKeyUsageExtension(usages []string) (pkix.Extension, error) {
+	oids := []asn1.ObjectIdentifier{}
+	for _, usage := range usages {
+		oid, ok := csrExtKeyUsages[usage]
+		if !ok {
+			return pkix.Extension{}, fmt.Errorf("%w: unknown extended key usage %s", kms.ErrInvalidCSRRequest, usage)
+		}
+
+		oids = append(oids, oid)
+	}
+
+	value, err := asn1.Marshal(oids)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+
+	return pkix.Extension{Id: oidExtensionExtendedKeyUsage, Value: value}, nil
+}
+
+func parseOID(oid string) (asn1.ObjectIdentifier, error) {
+	arcs := strings.Split(oid, ".")
+	if len(arcs) < 2 {
+		return nil, fmt.Errorf("%w: invalid extension OID %q", kms.ErrInvalidCSRRequest, oid)
+	}
+
+	parsed := make(asn1.ObjectIdentifier, len(arcs))
+	for i, arc := range arcs {
+		value, err := strconv.Atoi(arc)
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("%w: invalid extension OID %q", kms.ErrInvalidCSRRequest, oid)
+		}
+
+		parsed[i] = value
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,175 @@
+package kms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"testing"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/cryptoutils"
+)
+
+func TestCreateCSRSignature(t *testing.T) {
+	app, _ := newPolicyTestApp(t)
+
+	tests := []struct {
+		name      string
+		keyType   string
+		keySize   int
+		algorithm kms.SigningAlgorithm
+		want      x509.SignatureAlgorithm
+	}{
+		{"ECDSAP256", models.KMSKeyAlgorithmECDSA, 256, "", x509.ECDSAWithSHA256},
+		{"ECDSAP384", models.KMSKeyAlgorithmECDSA, 384, "", x509.ECDSAWithSHA384},
+		{"RSAPKCS1v15", models.KMSKeyAlgorithmRSA, 2048, "", x509.SHA256WithRSA},
+		{"RSAPSS", models.KMSKeyAlgorithmRSA, 2048, kms.SigningAlgorithmRSAPSSSHA384, x509.SHA384WithRSAPSS},
+		{"Ed25519", models.KMSKeyAlgorithmEd25519, 256, "", x509.PureEd25519},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kmsKey := createTestKey(t, app, fmt.Sprintf(`{"alias":%q,"algorithm":%q,"size":%d}`, tt.name, tt.keyType, tt.keySize))
+
+			for _, format := range []kms.CSRFormat{kms.CSRFormatPEM, kms.CSRFormatDER} {
+				var response kms.CertificateSigningRequest
+				status := postTestJSON(t, app, "/v1/kms/"+kmsKey.ID+"/csr", kms.CreateCSRRequestBody{
+					Subject:     kms.CSRSubject{CommonName: "device-1", Organization: "Lamassu"},
+					DNSNames:    []string{"device-1.example.com"},
+					IPAddresses: []string{"10.0.0.1"},
+					KeyUsages:   []string{kms.KeyUsageDigitalSignature},
+					Algorithm:   tt.algorithm,
+					Format:      format,
+				}, &response)
+				if status != http.StatusOK {
+					t.Fatalf("got status %d creating %s CSR, want %d", status, format, http.StatusOK)
+				}
+
+				der := response.DER
+				if format == kms.CSRFormatPEM {
+					block, _ := pem.Decode([]byte(response.PEM))
+					if block == nil || block.Type != "CERTIFICATE REQUEST" {
+						t.Fatalf("got PEM %q, want a certificate request", response.PEM)
+					}
+					der = block.Bytes
+				}
+
+				csr, err := x509.ParseCertificateRequest(der)
+				if err != nil {
+					t.Fatalf("could not parse %s CSR: %s", format, err)
+				}
+
+				if err := csr.CheckSignature(); err != nil {
+					t.Errorf("%s CSR signature does not verify: %s", format, err)
+				}
+
+				if csr.SignatureAlgorithm != tt.want {
+					t.Errorf("got signature algorithm %s, want %s", csr.SignatureAlgorithm, tt.want)
+				}
+
+				pubKey, _ := cryptoutils.ParsePublicKey(kmsKey.Versions[0].PublicKey)
+				if !csr.PublicKey.(interface{ Equal(crypto.PublicKey) bool }).Equal(pubKey) {
+					t.Errorf("CSR public key does not match the key")
+				}
+
+				if csr.Subject.CommonName != "device-1" || len(csr.DNSNames) != 1 || len(csr.IPAddresses) != 1 || !csr.IPAddresses[0].Equal([]byte{10, 0, 0, 1}) {
+					t.Errorf("unexpected CSR subject %s, DNS names %v and IP addresses %v", csr.Subject, csr.DNSNames, csr.IPAddresses)
+				}
+			}
+		})
+	}
+}
+
+func TestKeyUsageExtension(t *testing.T) {
+	ecdsaKey := &models.KMSKey{Algorithm: models.KMSKeyAlgorithmECDSA}
+	rsaKey := &models.KMSKey{Algorithm: models.KMSKeyAlgorithmRSA}
+
+	tests := []struct {
+		name   string
+		key    *models.KMSKey
+		usages []string
+		want   []byte
+	}{
+		{"DigitalSignature", ecdsaKey, []string{kms.KeyUsageDigitalSignature}, []byte{0x03, 0x02, 0x07, 0x80}},
+		{"CertAndCRLSign", ecdsaKey, []string{kms.KeyUsageCertSign, kms.KeyUsageCRLSign}, []byte{0x03, 0x02, 0x01, 0x06}},
+		{"KeyEncipherment", rsaKey, []string{kms.KeyUsageDigitalSignature, kms.KeyUsageKeyEncipherment}, []byte{0x03, 0x02, 0x05, 0xa0}},
+		{"DecipherOnly", ecdsaKey, []string{kms.KeyUsageKeyAgreement, kms.KeyUsageDecipherOnly}, []byte{0x03, 0x03, 0x07, 0x08, 0x80}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extension, err := keyUsageExtension(tt.key, tt.usages)
+			if err != nil {
+				t.Fatalf("could not encode key usages: %s", err)
+			}
+
+			if !extension.Id.Equal(oidExtensionKeyUsage) || !extension.Critical {
+				t.Errorf("got extension %s, critical %t, want critical key usage", extension.Id, extension.Critical)
+			}
+
+			if !bytes.Equal(extension.Value, tt.want) {
+				t.Errorf("got key usage %x, want %x", extension.Value, tt.want)
+			}
+
+			// crypto/x509 encodes the same usages with the same bits.
+			if want := stdlibKeyUsage(t, tt.usages); !bytes.Equal(extension.Value, want) {
+				t.Errorf("got key usage %x, crypto/x509 encodes %x", extension.Value, want)
+			}
+		})
+	}
+
+	invalid := []struct {
+		name   string
+		key    *models.KMSKey
+		usages []string
+	}{
+		{"Unknown", ecdsaKey, []string{"sign_everything"}},
+		{"KeyEnciphermentWithECDSA", ecdsaKey, []string{kms.KeyUsageKeyEncipherment}},
+		{"KeyAgreementWithRSA", rsaKey, []string{kms.KeyUsageKeyAgreement}},
+		{"EncipherOnlyWithoutKeyAgreement", ecdsaKey, []string{kms.KeyUsageDigitalSignature, kms.KeyUsageEncipherOnly}},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := keyUsageExtension(tt.key, tt.usages); !errors.Is(err, kms.ErrInvalidCSRRequest) {
+				t.Errorf("got error %v, want %v", err, kms.ErrInvalidCSRRequest)
+			}
+		})
+	}
+}
+
+// stdlibKeyUsage returns the key usage extension crypto/x509 writes in a
+// certificate with the given usages.
+func stdlibKeyUsage(t *testing.T, usages []string) []byte {
+	var keyUsage x509.KeyUsage
+	for _, usage := range usages {
+		keyUsage |= 1 << csrKeyUsages[usage].bit
+	}
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "key usage"},
+		KeyUsage:     keyUsage,
+	}, &x509.Certificate{Subject: pkix.Name{CommonName: "key usage"}}, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("could not create certificate: %s", err)
+	}
+
+	cert, _ := x509.ParseCertificate(der)
+	for _, extension := range cert.Extensions {
+		if extension.Id.Equal(oidExtensionKeyUsage) {
+			return extension.Value
+		}
+	}
+
+	t.Fatalf("certificate has no key usage extension")
+	return nil
+}
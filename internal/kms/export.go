@@ -0,0 +1,137 @@
+package kms
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/cryptoutils"
+)
+
+// GetPublicKey exports the public key of a key version. It is not subject to
+// the key policy, whose export operation only governs private material.
+func (svc *KMSServiceBackend) GetPublicKey(ctx context.Context, input kms.GetPublicKeyInput) (*kms.ExportedPublicKey, error) {
+	kmsKey, _, err := svc.getKeyAndEngine(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	versionNumber := input.Version
+	if versionNumber == 0 {
+		versionNumber = kmsKey.PrimaryVersion
+	}
+
+	versions, err := verificationVersions(kmsKey, versionNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	version := versions[0]
+	if version.PublicKey == "" {
+		return nil, kms.ErrUnsupportedKeyOperation
+	}
+
+	pubKey, err := cryptoutils.ParsePublicKey(version.PublicKey)
+	if err != nil {
+		svc.logger.Errorf("could not parse public key of version %d of key %s: %s", version.Version, kmsKey.ID, err)
+		return nil, err
+	}
+
+	fingerprints, err := svc.publicKeyFingerprints(pubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	format := input.Format
+	if format == "" {
+		format = kms.PublicKeyFormatPEM
+	}
+
+	exported := &kms.ExportedPublicKey{
+		KeyID:        kmsKey.ID,
+		KeyVersion:   version.Version,
+		Format:       format,
+		Fingerprints: *fingerprints,
+	}
+
+	switch format {
+	case kms.PublicKeyFormatPEM:
+		exported.PEM = version.PublicKey
+	case kms.PublicKeyFormatDER:
+		exported.DER, err = cryptoutils.PublicKeyToDER(pubKey)
+	case kms.PublicKeyFormatJWK:
+		exported.JWK, err = keyVersionJWK(kmsKey, version, pubKey)
+	case kms.PublicKeyFormatSSH:
+		// OpenSSH has no encoding for X25519 nor ML-DSA keys.
+		if kmsKey.Algorithm == models.KMSKeyAlgorithmX25519 || kmsKey.Algorithm == models.KMSKeyAlgorithmMLDSA {
+			return nil, kms.ErrUnsupportedKeyOperation
+		}
+
+		exported.SSH, err = cryptoutils.PublicKeyToSSH(pubKey)
+	default:
+		return nil, kms.ErrUnsupportedPublicKeyFormat
+	}
+
+	if err != nil {
+		svc.logger.Errorf("could not encode public key of key %s as %s: %s", kmsKey.ID, format, err)
+		return nil, err
+	}
+
+	return exported, nil
+}
+
+// keyVersionJWK returns the JWK of a key version. Signing keys advertise the JWS
+// algorithm used by default with the key, X25519 keys are advertised for ECDH-ES.
+func keyVersionJWK(kmsKey *models.KMSKey, version *models.KMSKeyVersion, pubKey any) (*cryptoutils.JWK, error) {
+	jwk, err := cryptoutils.PublicKeyToJWK(pubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	jwk.Kid = kms.KeyVersionKID(kmsKey.ID, version.Version)
+	if kmsKey.Algorithm == models.KMSKeyAlgorithmX25519 {
+		jwk.Use = "enc"
+		jwk.Alg = "ECDH-ES"
+		return jwk, nil
+	}
+
+	jwk.Use = "sig"
+	if algorithm, _, err := resolveSigningAlgorithm(kmsKey, ""); err == nil {
+		jwk.Alg = kms.JWSAlgorithm(algorithm)
+	}
+
+	return jwk, nil
+}
+
+func (svc *KMSServiceBackend) publicKeyFingerprints(pubKey any) (*kms.PublicKeyFingerprints, error) {
+	hexDigest, err := svc.keyProvider.EncodePKIXPublicKeyDigest(pubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := hex.DecodeString(hexDigest)
+	if err != nil {
+		return nil, err
+	}
+
+	colon := make([]string, len(digest))
+	for i, b := range digest {
+		colon[i] = strings.ToUpper(hex.EncodeToString([]byte{b}))
+	}
+
+	fingerprints := &kms.PublicKeyFingerprints{
+		SHA256Hex:    hexDigest,
+		SHA256Colon:  strings.Join(colon, ":"),
+		SHA256Base64: base64.StdEncoding.EncodeToString(digest),
+	}
+
+	// OpenSSH has no encoding for X25519 and ML-DSA keys.
+	if sshFingerprint, err := cryptoutils.SSHFingerprint(pubKey); err == nil {
+		fingerprints.SSHSHA256 = sshFingerprint
+	}
+
+	return fingerprints, nil
+}
@@ -0,0 +1,376 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/cryptoutils"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
+	"golang.org/x/crypto/cryptobyte"
+	"golang.org/x/crypto/cryptobyte/asn1"
+)
+
+func (svc *KMSServiceBackend) SetKMSKeyJWKSPublication(ctx context.Context, input kms.SetKMSKeyJWKSPublicationInput) (*models.KMSKey, error) {
+	kmsKey, _, err := svc.getKeyAndEngine(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authorize(ctx, kmsKey, policyRequest{Operation: models.KMSKeyOperationAdmin})
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkRevision(kmsKey, input.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := primaryVersion(kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.Published && version.PublicKey == "" {
+		return nil, kms.ErrUnsupportedKeyOperation
+	}
+
+	kmsKey.JWKSPublished = input.Published
+	kmsKey, err = svc.kmsStorage.Update(ctx, kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.logger.Infof("JWKS publication of KMS key %s set to %t", kmsKey.ID, input.Published)
+	return kmsKey, nil
+}
+
+// GetJWKS returns the public keys of the enabled keys flagged as JWKS-published.
+// Rotated versions stay listed for the configured retention so that tokens
+// signed before a rotation can still be verified by relying parties.
+func (svc *KMSServiceBackend) GetJWKS(ctx context.Context) (*kms.JWKS, error) {
+	publishedKeys := []models.KMSKey{}
+	_, err := svc.kmsStorage.SelectAll(ctx, resources.StorageListRequest[models.KMSKey]{
+		ExhaustiveRun: true,
+		QueryParams: &resources.QueryParameters{
+			Filters: []resources.FilterOption{
+				{
+					Field:           "status",
+					FilterOperation: resources.EnumEqual,
+					Value:           string(models.KMSKeyStatusEnabled),
+				},
+				{
+					Field:           "jwks_published",
+					FilterOperation: resources.EnumEqual,
+					Value:           "true",
+				},
+			},
+		},
+		ApplyFunc: func(kmsKey models.KMSKey) {
+			publishedKeys = append(publishedKeys, kmsKey)
+		},
+	})
+	if err != nil {
+		svc.logger.Errorf("could not list JWKS-published keys: %s", err)
+		return nil, err
+	}
+
+	now := time.Now()
+	jwks := &kms.JWKS{Keys: []cryptoutils.JWK{}}
+	for i := range publishedKeys {
+		kmsKey := &publishedKeys[i]
+		for j := range kmsKey.Versions {
+			version := &kmsKey.Versions[j]
+			if !svc.isJWKSPublishedVersion(kmsKey, version, now) {
+				continue
+			}
+
+			// A broken key must not take the JWKS down for every relying party.
+			pubKey, err := cryptoutils.ParsePublicKey(version.PublicKey)
+			if err != nil {
+				svc.logger.Errorf("skipping version %d of key %s from JWKS, could not parse its public key: %s", version.Version, kmsKey.ID, err)
+				continue
+			}
+
+			jwk, err := keyVersionJWK(kmsKey, version, pubKey)
+			if err != nil {
+				svc.logger.Errorf("skipping version %d of key %s from JWKS, could not encode it as JWK: %s", version.Version, kmsKey.ID, err)
+				continue
+			}
+
+			jwks.Keys = append(jwks.Keys, *jwk)
+		}
+	}
+
+	return jwks, nil
+}
+
+func (svc *KMSServiceBackend) isJWKSPublishedVersion(kmsKey *models.KMSKey, version *models.KMSKeyVersion, now time.Time) bool {
+	if version.State != models.KMSKeyVersionStateEnabled || version.PublicKey == "" {
+		return false
+	}
+
+	if version.Version == kmsKey.PrimaryVersion || version.SupersededTS == nil {
+		return true
+	}
+
+	return now.Before(version.SupersededTS.Add(svc.jwksRetention))
+}
+
+// SignJWT signs a claims set with the primary version of the key and returns it
+// as a compact JWS. The signature is computed by the crypto engine signer and the
+// key policy applies as for any other signature.
+func (svc *KMSServiceBackend) SignJWT(ctx context.Context, input kms.SignJWTInput) (string, error) {
+	kmsKey, engine, err := svc.getKeyAndEngine(ctx, input.ID)
+	if err != nil {
+		return "", err
+	}
+
+	algorithm, err := jwtSigningAlgorithm(kmsKey, input.Algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	version, err := primaryVersion(kmsKey)
+	if err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(map[string]any{
+		"alg": kms.JWSAlgorithm(algorithm),
+		"typ": "JWT",
+		"kid": kms.KeyVersionKID(kmsKey.ID, version.Version),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	claims := input.Claims
+	if claims == nil {
+		claims = map[string]any{}
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	output, err := svc.signWithPrimaryVersion(ctx, kmsKey, engine, kms.SignInput{
+		ID:          kmsKey.ID,
+		Message:     []byte(signingInput),
+		MessageType: kms.SignMessageTypeRaw,
+		Algorithm:   algorithm,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signature := output.Signature
+	if kmsKey.Algorithm == models.KMSKeyAlgorithmECDSA {
+		signature, err = ecdsaSignatureToJWS(signature, ecdsaCoordinateSize(kmsKey.Size))
+		if err != nil {
+			svc.logger.Errorf("could not encode ECDSA signature of key %s: %s", kmsKey.ID, err)
+			return "", err
+		}
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// VerifyJWS verifies a compact JWS signed by a KMS key version, identified by
+// the kid header. A JWS that cannot be attributed to a key is rejected with
+// ErrInvalidJWS, while a bad signature or an expired token yields Valid false.
+func (svc *KMSServiceBackend) VerifyJWS(ctx context.Context, input kms.VerifyJWSInput) (*kms.VerifyJWSOutput, error) {
+	parts := strings.Split(input.Token, ".")
+	if len(parts) != 3 {
+		return nil, kms.ErrInvalidJWS
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, kms.ErrInvalidJWS
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, kms.ErrInvalidJWS
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, kms.ErrInvalidJWS
+	}
+
+	header := map[string]any{}
+	err = json.Unmarshal(headerBytes, &header)
+	if err != nil {
+		return nil, kms.ErrInvalidJWS
+	}
+
+	// No critical extension is understood, so any listed one must be rejected.
+	if _, hasCrit := header["crit"]; hasCrit {
+		return nil, kms.ErrInvalidJWS
+	}
+
+	alg, _ := header["alg"].(string)
+	algorithm, ok := kms.SigningAlgorithmFromJWS(alg)
+	if !ok {
+		return nil, kms.ErrInvalidJWS
+	}
+
+	kid, _ := header["kid"].(string)
+	keyID, keyVersion, err := kms.ParseKeyVersionKID(kid)
+	if err != nil {
+		return nil, kms.ErrInvalidJWS
+	}
+
+	kmsKey, err := svc.getKey(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &kms.VerifyJWSOutput{
+		KeyID:      keyID,
+		KeyVersion: keyVersion,
+		Header:     header,
+	}
+	if json.Valid(payload) {
+		output.Payload = payload
+	}
+
+	if kmsKey.Algorithm == models.KMSKeyAlgorithmECDSA {
+		signature, err = ecdsaSignatureFromJWS(signature, ecdsaCoordinateSize(kmsKey.Size))
+		if err != nil {
+			output.Reason = "malformed signature"
+			return output, nil
+		}
+	}
+
+	valid, err := svc.Verify(ctx, kms.VerifyInput{
+		ID:          keyID,
+		Message:     []byte(parts[0] + "." + parts[1]),
+		MessageType: kms.SignMessageTypeRaw,
+		Signature:   signature,
+		Algorithm:   algorithm,
+		KeyVersion:  keyVersion,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !valid {
+		output.Reason = "invalid signature"
+		return output, nil
+	}
+
+	output.Reason = checkJWTValidity(payload, time.Now())
+	output.Valid = output.Reason == ""
+	return output, nil
+}
+
+// checkJWTValidity checks the exp and nbf claims of a JWT payload, if present.
+// It returns the reason why the token is not valid or an empty string.
+func checkJWTValidity(payload []byte, now time.Time) string {
+	claims := struct {
+		Exp *json.Number `json:"exp"`
+		Nbf *json.Number `json:"nbf"`
+	}{}
+
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if decoder.Decode(&claims) != nil {
+		// Not a JWT claims set: only the signature applies.
+		return ""
+	}
+
+	if claims.Exp != nil {
+		exp, err := claims.Exp.Float64()
+		if err != nil || float64(now.Unix()) >= exp {
+			return "token expired"
+		}
+	}
+
+	if claims.Nbf != nil {
+		nbf, err := claims.Nbf.Float64()
+		if err != nil || float64(now.Unix()) < nbf {
+			return "token not yet valid"
+		}
+	}
+
+	return ""
+}
+
+// jwtSigningAlgorithm resolves the JWS algorithm requested for a JWT, defaulting
+// to the one of the key type. Algorithms without a JWS name are not allowed.
+func jwtSigningAlgorithm(kmsKey *models.KMSKey, jwsAlgorithm string) (kms.SigningAlgorithm, error) {
+	var requested kms.SigningAlgorithm
+	if jwsAlgorithm != "" {
+		algorithm, ok := kms.SigningAlgorithmFromJWS(jwsAlgorithm)
+		if !ok {
+			return "", kms.ErrInvalidSignatureRequest
+		}
+
+		requested = algorithm
+	}
+
+	algorithm, _, err := resolveSigningAlgorithm(kmsKey, requested)
+	if err != nil {
+		return "", err
+	}
+
+	if kms.JWSAlgorithm(algorithm) == "" {
+		return "", kms.ErrUnsupportedKeyOperation
+	}
+
+	return algorithm, nil
+}
+
+func ecdsaCoordinateSize(keySize int) int {
+	return (keySize + 7) / 8
+}
+
+// ecdsaSignatureToJWS converts an ASN.1 ECDSA signature to the fixed-size R || S
+// encoding used by JWS (RFC 7518, section 3.4).
+func ecdsaSignatureToJWS(signature []byte, size int) ([]byte, error) {
+	var r, s big.Int
+	var inner cryptobyte.String
+	input := cryptobyte.String(signature)
+	if !input.ReadASN1(&inner, asn1.SEQUENCE) || !input.Empty() ||
+		!inner.ReadASN1Integer(&r) || !inner.ReadASN1Integer(&s) || !inner.Empty() {
+		return nil, kms.ErrInvalidSignatureRequest
+	}
+
+	if len(r.Bytes()) > size || len(s.Bytes()) > size {
+		return nil, kms.ErrInvalidSignatureRequest
+	}
+
+	out := make([]byte, 2*size)
+	r.FillBytes(out[:size])
+	s.FillBytes(out[size:])
+	return out, nil
+}
+
+func ecdsaSignatureFromJWS(signature []byte, size int) ([]byte, error) {
+	if len(signature) != 2*size {
+		return nil, kms.ErrInvalidJWS
+	}
+
+	r := new(big.Int).SetBytes(signature[:size])
+	s := new(big.Int).SetBytes(signature[size:])
+
+	var builder cryptobyte.Builder
+	builder.AddASN1(asn1.SEQUENCE, func(b *cryptobyte.Builder) {
+		b.AddASN1BigInt(r)
+		b.AddASN1BigInt(s)
+	})
+
+	return builder.Bytes()
+}
@@ -0,0 +1,194 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	jose "github.com/go-jose/go-jose/v4"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+)
+
+func TestGetJWKSSkipsBrokenKeys(t *testing.T) {
+	app, repo := newPolicyTestApp(t)
+
+	published := createTestKey(t, app, `{"alias":"issuer","algorithm":"ECDSA","size":256,"publish_jwks":true}`)
+
+	broken := createTestKey(t, app, `{"alias":"broken","algorithm":"ECDSA","size":256,"publish_jwks":true}`)
+	broken.Versions[0].PublicKey = "-----BEGIN PUBLIC KEY-----\nbroken\n-----END PUBLIC KEY-----\n"
+	if _, err := repo.Update(context.Background(), &broken); err != nil {
+		t.Fatalf("could not update key: %s", err)
+	}
+
+	jwks := getTestJWKS(t, app)
+	if len(jwks.Keys) != 1 || jwks.Keys[0].Kid != kms.KeyVersionKID(published.ID, 1) {
+		t.Errorf("got JWKS %+v, want only the key %s", jwks.Keys, published.ID)
+	}
+}
+
+func TestSignJWTIndependentVerification(t *testing.T) {
+	app, _ := newPolicyTestApp(t)
+
+	tests := []struct {
+		name      string
+		keyType   string
+		keySize   int
+		algorithm string
+		wantAlg   jose.SignatureAlgorithm
+	}{
+		{"ES256", models.KMSKeyAlgorithmECDSA, 256, "", jose.ES256},
+		{"ES384", models.KMSKeyAlgorithmECDSA, 384, "", jose.ES384},
+		{"ES512", models.KMSKeyAlgorithmECDSA, 521, "", jose.ES512},
+		{"RS256", models.KMSKeyAlgorithmRSA, 2048, "RS256", jose.RS256},
+		{"PS384", models.KMSKeyAlgorithmRSA, 2048, "PS384", jose.PS384},
+		{"EdDSA", models.KMSKeyAlgorithmEd25519, 256, "", jose.EdDSA},
+	}
+
+	tokens := map[string]string{}
+	for _, tt := range tests {
+		kmsKey := createTestKey(t, app, fmt.Sprintf(`{"alias":%q,"algorithm":%q,"size":%d,"publish_jwks":true}`, tt.name, tt.keyType, tt.keySize))
+		tokens[tt.name] = signTestJWT(t, app, kmsKey.ID, tt.algorithm)
+	}
+
+	// The JWKS is parsed and the tokens verified by go-jose, as a relying party would.
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	defer res.Body.Close()
+
+	var jwks jose.JSONWebKeySet
+	if err := json.NewDecoder(res.Body).Decode(&jwks); err != nil {
+		t.Fatalf("could not decode JWKS: %s", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jws, err := jose.ParseSigned(tokens[tt.name], []jose.SignatureAlgorithm{tt.wantAlg})
+			if err != nil {
+				t.Fatalf("could not parse token: %s", err)
+			}
+
+			header := jws.Signatures[0].Header
+			keys := jwks.Key(header.KeyID)
+			if len(keys) != 1 {
+				t.Fatalf("got %d JWKS keys with kid %s, want 1", len(keys), header.KeyID)
+			}
+
+			// Keys advertise the algorithm used when none is requested.
+			if tt.algorithm == "" && keys[0].Algorithm != string(tt.wantAlg) {
+				t.Errorf("JWK advertises %s, want %s", keys[0].Algorithm, tt.wantAlg)
+			}
+
+			payload, err := jws.Verify(keys[0])
+			if err != nil {
+				t.Fatalf("token does not verify: %s", err)
+			}
+
+			var claims map[string]any
+			if err := json.Unmarshal(payload, &claims); err != nil || claims["sub"] != "device-1" {
+				t.Errorf("got claims %s", payload)
+			}
+		})
+	}
+
+	t.Run("ES256RawSignature", func(t *testing.T) {
+		// ES256 signatures are the 32 byte R and S values, not an ASN.1 sequence.
+		parts := strings.Split(tokens["ES256"], ".")
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil || len(signature) != 64 {
+			t.Fatalf("got %d byte signature, want 64", len(signature))
+		}
+
+		jws, _ := jose.ParseSigned(tokens["ES256"], []jose.SignatureAlgorithm{jose.ES256})
+		pubKey := jwks.Key(jws.Signatures[0].Header.KeyID)[0].Key.(*ecdsa.PublicKey)
+
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		r := new(big.Int).SetBytes(signature[:32])
+		sig := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pubKey, digest[:], r, sig) {
+			t.Errorf("R || S signature does not verify")
+		}
+	})
+
+	t.Run("TamperedPayload", func(t *testing.T) {
+		parts := strings.Split(tokens["ES256"], ".")
+		parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"device-2"}`))
+
+		jws, err := jose.ParseSigned(strings.Join(parts, "."), []jose.SignatureAlgorithm{jose.ES256})
+		if err != nil {
+			t.Fatalf("could not parse token: %s", err)
+		}
+
+		if _, err := jws.Verify(jwks.Key(jws.Signatures[0].Header.KeyID)[0]); err == nil {
+			t.Errorf("tampered token verifies")
+		}
+	})
+}
+
+func signTestJWT(t *testing.T, app *fiber.App, keyID, algorithm string) string {
+	body, _ := json.Marshal(kms.SignJWTRequestBody{
+		Claims:    map[string]any{"sub": "device-1"},
+		Algorithm: algorithm,
+	})
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/kms/"+keyID+"/jwt", bytes.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	defer res.Body.Close()
+
+	var response kms.SignJWTResponse
+	if res.StatusCode != http.StatusOK || json.NewDecoder(res.Body).Decode(&response) != nil {
+		t.Fatalf("could not sign JWT with key %s: got %d", keyID, res.StatusCode)
+	}
+
+	return response.Token
+}
+
+func createTestKey(t *testing.T, app *fiber.App, body string) models.KMSKey {
+	req := httptest.NewRequest(http.MethodPost, "/v1/kms", strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	defer res.Body.Close()
+
+	var kmsKey models.KMSKey
+	if res.StatusCode != http.StatusOK || json.NewDecoder(res.Body).Decode(&kmsKey) != nil {
+		t.Fatalf("could not create key %s: got %d", body, res.StatusCode)
+	}
+
+	return kmsKey
+}
+
+func getTestJWKS(t *testing.T, app *fiber.App) kms.JWKS {
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	defer res.Body.Close()
+
+	var jwks kms.JWKS
+	if res.StatusCode != http.StatusOK || json.NewDecoder(res.Body).Decode(&jwks) != nil {
+		t.Fatalf("could not get JWKS: got %d", res.StatusCode)
+	}
+
+	return jwks
+}
@@ -0,0 +1,169 @@
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"slices"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms/cryptoengines"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/cryptoutils"
+)
+
+// MigrateKMSKey moves the material of every version of a key to another crypto
+// engine. The material is exported from the source engine and imported into the
+// target one, and the key is only updated once every imported copy has been
+// checked to hold the same public key. Sources whose material cannot be
+// exported, such as HSM-backed engines, are refused with ErrKMSKeyNotMigratable.
+// Keys whose policy does not allow exporting them are refused as well.
+func (svc *KMSServiceBackend) MigrateKMSKey(ctx context.Context, input kms.MigrateKMSKeyInput) (*models.KMSKey, error) {
+	kmsKey, source, err := svc.getKeyAndEngine(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authorize(ctx, kmsKey, policyRequest{Operation: models.KMSKeyOperationExport})
+	if err != nil {
+		return nil, err
+	}
+
+	if kmsKey.EngineID == input.TargetEngineID {
+		return nil, fmt.Errorf("%w: key is already stored in crypto engine %s", kms.ErrKMSKeyNotMigratable, input.TargetEngineID)
+	}
+
+	// Crypto engines can only import RSA and ECDSA private keys.
+	if kmsKey.Algorithm != models.KMSKeyAlgorithmRSA && kmsKey.Algorithm != models.KMSKeyAlgorithmECDSA {
+		return nil, fmt.Errorf("%w: %s keys cannot be imported into a crypto engine", kms.ErrKMSKeyNotMigratable, kmsKey.Algorithm)
+	}
+
+	target, err := svc.getCryptoEngine(input.TargetEngineID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !engineSupportsKey(ctx, target, kmsKey.Algorithm, kmsKey.Size) {
+		return nil, fmt.Errorf("%w: crypto engine %s does not support %s %d keys", kms.ErrKMSKeyNotMigratable, input.TargetEngineID, kmsKey.Algorithm, kmsKey.Size)
+	}
+
+	sourceEngineKeys := map[int]string{}
+	importedEngineKeys := []string{}
+	rollback := func() {
+		for _, engineKeyID := range importedEngineKeys {
+			svc.discardEngineKey(ctx, target, engineKeyID)
+		}
+	}
+
+	for i := range kmsKey.Versions {
+		version := &kmsKey.Versions[i]
+		if version.State == models.KMSKeyVersionStateDestroyed {
+			continue
+		}
+
+		engineKeyID, err := svc.migrateKeyVersion(ctx, kmsKey, version, source, target)
+		if err != nil {
+			rollback()
+			return nil, err
+		}
+
+		importedEngineKeys = append(importedEngineKeys, engineKeyID)
+		sourceEngineKeys[version.Version] = version.EngineKeyID
+		version.EngineKeyID = engineKeyID
+	}
+
+	sourceEngineID := kmsKey.EngineID
+	kmsKey.EngineID = input.TargetEngineID
+
+	// The key and its versions are saved in a single transaction, so the key
+	// either points to the source or to the target engine.
+	kmsKey, err = svc.kmsStorage.Update(ctx, kmsKey)
+	if err != nil {
+		svc.logger.Errorf("could not store migration of key %s to crypto engine %s: %s", input.ID, input.TargetEngineID, err)
+		rollback()
+		return nil, err
+	}
+
+	svc.logger.Infof("KMS key %s migrated from crypto engine %s to %s", kmsKey.ID, sourceEngineID, input.TargetEngineID)
+
+	if input.DeleteSource {
+		for version, engineKeyID := range sourceEngineKeys {
+			err = source.DeleteKey(ctx, engineKeyID)
+			if err != nil {
+				svc.logger.Errorf("could not delete version %d of key %s from source crypto engine %s: %s", version, kmsKey.ID, sourceEngineID, err)
+			}
+		}
+	}
+
+	return kmsKey, nil
+}
+
+// migrateKeyVersion copies the material of a key version into the target engine
+// and returns its engine key ID there.
+func (svc *KMSServiceBackend) migrateKeyVersion(ctx context.Context, kmsKey *models.KMSKey, version *models.KMSKeyVersion, source, target cryptoengines.CryptoEngine) (string, error) {
+	signer, err := source.GetPrivateKeyByID(ctx, version.EngineKeyID)
+	if err != nil {
+		svc.logger.Errorf("could not read version %d of key %s from its crypto engine: %s", version.Version, kmsKey.ID, err)
+		return "", err
+	}
+
+	var engineKeyID string
+	var imported crypto.Signer
+	switch key := signer.(type) {
+	case *rsa.PrivateKey:
+		engineKeyID, imported, err = target.ImportRSAPrivateKey(ctx, key)
+	case *ecdsa.PrivateKey:
+		engineKeyID, imported, err = target.ImportECDSAPrivateKey(ctx, key)
+	default:
+		// Only software keys hand out their private material.
+		return "", fmt.Errorf("%w: source crypto engine does not allow exporting %s key material", kms.ErrKMSKeyNotMigratable, kmsKey.Algorithm)
+	}
+	if err != nil {
+		svc.logger.Errorf("could not import version %d of key %s into the target crypto engine: %s", version.Version, kmsKey.ID, err)
+		return "", err
+	}
+
+	sourceDigest, err := svc.keyProvider.EncodePKIXPublicKeyDigest(signer.Public())
+	if err != nil {
+		svc.discardEngineKey(ctx, target, engineKeyID)
+		return "", err
+	}
+
+	targetDigest, err := svc.keyProvider.EncodePKIXPublicKeyDigest(imported.Public())
+	if err != nil {
+		svc.discardEngineKey(ctx, target, engineKeyID)
+		return "", err
+	}
+
+	storedPubKey, err := cryptoutils.ParsePublicKey(version.PublicKey)
+	if err != nil {
+		svc.discardEngineKey(ctx, target, engineKeyID)
+		return "", err
+	}
+
+	storedDigest, err := svc.keyProvider.EncodePKIXPublicKeyDigest(storedPubKey)
+	if err != nil {
+		svc.discardEngineKey(ctx, target, engineKeyID)
+		return "", err
+	}
+
+	if sourceDigest != targetDigest || sourceDigest != storedDigest {
+		svc.logger.Errorf("public key digest mismatch migrating version %d of key %s: source %s, target %s, stored %s", version.Version, kmsKey.ID, sourceDigest, targetDigest, storedDigest)
+		svc.discardEngineKey(ctx, target, engineKeyID)
+		return "", fmt.Errorf("%w: imported key does not match the source key", kms.ErrKMSKeyNotMigratable)
+	}
+
+	return engineKeyID, nil
+}
+
+func engineSupportsKey(ctx context.Context, engine cryptoengines.CryptoEngine, algorithm string, size int) bool {
+	for _, keyType := range engine.GetEngineConfig(ctx).SupportedKeyTypes {
+		if keyType.Type == algorithm && slices.Contains(keyType.Sizes, size) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,100 @@
+package kms
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/auth"
+)
+
+// policyRequest describes an operation to be authorized against a key policy.
+// Algorithm and Hash are only set for operations that involve them.
+type policyRequest struct {
+	Operation models.KMSKeyOperation
+	Algorithm kms.SigningAlgorithm
+	Hash      string
+}
+
+// authorize checks the request against the key policy. Keys without a policy
+// allow every operation. Admin operations are not bound to the validity window
+// of the policy, so that expired policies can be replaced.
+func authorize(ctx context.Context, kmsKey *models.KMSKey, req policyRequest) error {
+	policy := kmsKey.Policy
+	if policy == nil {
+		return nil
+	}
+
+	now := time.Now()
+	if req.Operation != models.KMSKeyOperationAdmin {
+		if policy.NotBefore != nil && now.Before(*policy.NotBefore) {
+			return kms.ErrPolicyNotYetValid
+		}
+
+		if policy.NotAfter != nil && now.After(*policy.NotAfter) {
+			return kms.ErrPolicyExpired
+		}
+	}
+
+	if len(policy.AllowedPrincipals) > 0 {
+		principal, ok := auth.PrincipalFromContext(ctx)
+		if !ok || !slices.Contains(policy.AllowedPrincipals, principal) {
+			return kms.ErrPolicyPrincipalNotAllowed
+		}
+	}
+
+	if len(policy.AllowedOperations) > 0 && !slices.Contains(policy.AllowedOperations, req.Operation) {
+		return kms.ErrPolicyOperationNotAllowed
+	}
+
+	if req.Algorithm != "" && len(policy.AllowedSignatureAlgorithms) > 0 && !slices.Contains(policy.AllowedSignatureAlgorithms, string(req.Algorithm)) {
+		return kms.ErrPolicyAlgorithmNotAllowed
+	}
+
+	if req.Hash != "" && len(policy.AllowedHashes) > 0 && !slices.Contains(policy.AllowedHashes, req.Hash) {
+		return kms.ErrPolicyHashNotAllowed
+	}
+
+	return nil
+}
+
+// allowsOperation reports whether a policy lists an operation, whoever the
+// caller is. It is meant for operations run without a caller, such as backups.
+func allowsOperation(policy *models.KMSKeyPolicy, operation models.KMSKeyOperation) bool {
+	return policy == nil || len(policy.AllowedOperations) == 0 || slices.Contains(policy.AllowedOperations, operation)
+}
+
+func validatePolicy(policy *models.KMSKeyPolicy) error {
+	if policy == nil {
+		return nil
+	}
+
+	for _, op := range policy.AllowedOperations {
+		switch op {
+		case models.KMSKeyOperationSign, models.KMSKeyOperationVerify, models.KMSKeyOperationEncrypt,
+			models.KMSKeyOperationDecrypt, models.KMSKeyOperationExport, models.KMSKeyOperationAdmin:
+		default:
+			return kms.ErrInvalidPolicy
+		}
+	}
+
+	for _, alg := range policy.AllowedSignatureAlgorithms {
+		if _, ok := signingSchemes[kms.SigningAlgorithm(alg)]; !ok {
+			return kms.ErrInvalidPolicy
+		}
+	}
+
+	for _, hash := range policy.AllowedHashes {
+		if hash != kms.HashSHA256 && hash != kms.HashSHA384 && hash != kms.HashSHA512 {
+			return kms.ErrInvalidPolicy
+		}
+	}
+
+	if policy.NotBefore != nil && policy.NotAfter != nil && !policy.NotBefore.Before(*policy.NotAfter) {
+		return kms.ErrInvalidPolicy
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+package kms
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms/cryptoengines"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/auth"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/config"
+	fiber_context_mw "github.com/lamassuiot/lamassuiot/v4/pkg/shared/http/server/middleware/context"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
+	fsengine "github.com/lamassuiot/lamassuiot/v4/providers/cryptoengines/localfs"
+)
+
+// testPrincipalHeader carries the principal of test requests, which is
+// otherwise taken from their client certificate.
+const testPrincipalHeader = "X-Test-Principal"
+
+func newPolicyTestApp(t *testing.T) (*fiber.App, KMSRepository) {
+	l := logger.SetupLogger(logger.LevelNone, "KMS", "Test")
+
+	repo, err := createKMSStorageInstance(l, config.PluggableStorageEngine{Provider: config.Memory})
+	if err != nil {
+		t.Fatalf("could not create repository: %s", err)
+	}
+
+	engine, err := fsengine.NewFilesystemPEMEngine(l, cryptoengines.CryptoEngineConfigAdapter[fsengine.FilesystemEngineConfig]{
+		Config: fsengine.FilesystemEngineConfig{StorageDirectory: t.TempDir()},
+	})
+	if err != nil {
+		t.Fatalf("could not create crypto engine: %s", err)
+	}
+
+	svc := NewKMSService(KMSServiceBuilder{
+		Logger:              l,
+		KMSStorage:          repo,
+		CryptoEngines:       map[string]cryptoengines.CryptoEngine{"fs": engine},
+		DefaultCryptoEngine: "fs",
+	})
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals(fiber_context_mw.CtxKey, auth.WithPrincipal(context.Background(), c.Get(testPrincipalHeader)))
+		return c.Next()
+	})
+
+	var router fiber.Router = app
+	NewKMSHTTPLayer(&router, svc)
+	return app, repo
+}
+
+func TestUpdateKMSKeyPolicyAuthorization(t *testing.T) {
+	app, repo := newPolicyTestApp(t)
+	ctx := context.Background()
+
+	expired := time.Now().Add(-time.Hour)
+	issuingKey, err := repo.Insert(ctx, &models.KMSKey{
+		Alias:    "issuing-ca",
+		EngineID: "fs",
+		Status:   models.KMSKeyStatusEnabled,
+		Policy: &models.KMSKeyPolicy{
+			AllowedPrincipals: []string{"ca", "pki-admin"},
+			AllowedOperations: []models.KMSKeyOperation{models.KMSKeyOperationSign},
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not insert key: %s", err)
+	}
+
+	adminKey, err := repo.Insert(ctx, &models.KMSKey{
+		Alias:    "administered",
+		EngineID: "fs",
+		Status:   models.KMSKeyStatusEnabled,
+		Policy: &models.KMSKeyPolicy{
+			AllowedPrincipals: []string{"pki-admin"},
+			AllowedOperations: []models.KMSKeyOperation{models.KMSKeyOperationSign, models.KMSKeyOperationAdmin},
+			NotAfter:          &expired,
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not insert key: %s", err)
+	}
+
+	tests := []struct {
+		name       string
+		keyID      string
+		principal  string
+		wantStatus int
+		wantCode   string
+	}{
+		{"PrincipalNotAllowed", issuingKey.ID, "intruder", http.StatusForbidden, "PRINCIPAL_NOT_ALLOWED"},
+		{"NoPrincipal", issuingKey.ID, "", http.StatusForbidden, "PRINCIPAL_NOT_ALLOWED"},
+		{"AdminNotAllowed", issuingKey.ID, "pki-admin", http.StatusForbidden, "OPERATION_NOT_ALLOWED"},
+		{"PrincipalNotAllowedForAdmin", adminKey.ID, "ca", http.StatusForbidden, "PRINCIPAL_NOT_ALLOWED"},
+		{"AdminOfExpiredPolicy", adminKey.ID, "pki-admin", http.StatusOK, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, code := policyTestRequest(t, app, http.MethodPut, "/v1/kms/"+tt.keyID+"/policy", tt.principal, `{"policy":{}}`)
+			if status != tt.wantStatus || code != tt.wantCode {
+				t.Errorf("got %d %q, want %d %q", status, code, tt.wantStatus, tt.wantCode)
+			}
+		})
+	}
+
+	_, stored, err := repo.SelectExistsByID(ctx, issuingKey.ID)
+	if err != nil {
+		t.Fatalf("could not select key: %s", err)
+	}
+	if stored.Policy == nil || len(stored.Policy.AllowedOperations) != 1 || stored.Revision != 0 {
+		t.Errorf("refused updates changed the policy: %+v", stored.Policy)
+	}
+}
+
+func TestAdminOperationsAuthorization(t *testing.T) {
+	app, repo := newPolicyTestApp(t)
+	ctx := context.Background()
+
+	restrictedKey := createPolicyTestKey(t, app, `{"allowed_principals":["ca","pki-admin"],"allowed_operations":["sign"]}`)
+	adminKey := createPolicyTestKey(t, app, `{"allowed_principals":["pki-admin"],"allowed_operations":["sign","admin"]}`)
+
+	// Operations run in order on the administered key, which ends up rotated,
+	// with its first version disabled and its deletion cancelled.
+	operations := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+	}{
+		{"Rotate", http.MethodPost, "/rotate", ""},
+		{"UpdateVersionState", http.MethodPut, "/versions/1/state", `{"state":"DISABLED"}`},
+		{"UpdateMetadata", http.MethodPatch, "/metadata", `{"metadata":{"team":"pki"}}`},
+		{"SetJWKSPublication", http.MethodPut, "/jwks-publication", `{"published":true}`},
+		{"ScheduleDeletion", http.MethodDelete, "", ""},
+		{"CancelDeletion", http.MethodPost, "/cancel-deletion", ""},
+	}
+	for _, op := range operations {
+		t.Run(op.name, func(t *testing.T) {
+			status, code := policyTestRequest(t, app, op.method, "/v1/kms/"+restrictedKey+op.path, "pki-admin", op.body)
+			if status != http.StatusForbidden || code != "OPERATION_NOT_ALLOWED" {
+				t.Errorf("key without admin operation: got %d %q, want 403 OPERATION_NOT_ALLOWED", status, code)
+			}
+
+			status, code = policyTestRequest(t, app, op.method, "/v1/kms/"+adminKey+op.path, "ca", op.body)
+			if status != http.StatusForbidden || code != "PRINCIPAL_NOT_ALLOWED" {
+				t.Errorf("principal not allowed: got %d %q, want 403 PRINCIPAL_NOT_ALLOWED", status, code)
+			}
+
+			status, _ = policyTestRequest(t, app, op.method, "/v1/kms/"+adminKey+op.path, "pki-admin", op.body)
+			if status != http.StatusOK {
+				t.Errorf("allowed admin: got %d, want 200", status)
+			}
+		})
+	}
+
+	_, stored, err := repo.SelectExistsByID(ctx, restrictedKey)
+	if err != nil {
+		t.Fatalf("could not select key: %s", err)
+	}
+	if stored.Revision != 0 || stored.Status != models.KMSKeyStatusEnabled || len(stored.Versions) != 1 || stored.JWKSPublished {
+		t.Errorf("refused operations changed the key: %+v", stored)
+	}
+}
+
+func createPolicyTestKey(t *testing.T, app *fiber.App, policy string) string {
+	return createTestKey(t, app, `{"alias":"key","algorithm":"ECDSA","size":256,"policy":`+policy+`}`).ID
+}
+
+// policyTestRequest sends a request on behalf of the principal, returning the
+// status and the error code of the response.
+func policyTestRequest(t *testing.T, app *fiber.App, method, path, principal, body string) (int, string) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(testPrincipalHeader, principal)
+	if body != "" {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	defer res.Body.Close()
+
+	var errBody struct {
+		Code string `json:"code"`
+	}
+	json.NewDecoder(res.Body).Decode(&errBody)
+	return res.StatusCode, errBody.Code
+}
+
+func TestGetPublicKeyIgnoresPolicy(t *testing.T) {
+	app, _ := newPolicyTestApp(t)
+	keyID := createPolicyTestKey(t, app, `{"allowed_principals":["ca"],"allowed_operations":["sign"]}`)
+
+	status, code := policyTestRequest(t, app, http.MethodGet, "/v1/kms/"+keyID+"/public-key?format=jwk", "relying-party", "")
+	if status != http.StatusOK {
+		t.Errorf("got %d %q, want 200", status, code)
+	}
+}
@@ -0,0 +1,307 @@
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"errors"
+	"maps"
+	"slices"
+	"time"
+
+	"filippo.io/mldsa"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms/cryptoengines"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/cryptoutils"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
+)
+
+// GetCryptoEngines describes the configured crypto engines, sorted by ID.
+func (svc *KMSServiceBackend) GetCryptoEngines(ctx context.Context) ([]kms.EngineInfo, error) {
+	engines := []kms.EngineInfo{}
+	for _, engineID := range slices.Sorted(maps.Keys(svc.cryptoEngines)) {
+		engines = append(engines, kms.EngineInfo{
+			ID:               engineID,
+			Default:          engineID == svc.defaultCryptoEngine,
+			CryptoEngineInfo: svc.cryptoEngines[engineID].GetEngineConfig(ctx),
+		})
+	}
+
+	return engines, nil
+}
+
+// SyncCryptoEngine compares the keys held by a crypto engine with the KMS keys
+// stored for it. Orphaned engine keys are imported as unmanaged KMS keys and key
+// versions whose material is gone are flagged with MaterialMissing. Keys whose
+// flags cannot be stored are reported without aborting the sync.
+func (svc *KMSServiceBackend) SyncCryptoEngine(ctx context.Context, input kms.SyncCryptoEngineInput) (*kms.EngineDriftReport, error) {
+	engine, err := svc.getCryptoEngine(input.EngineID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys are created in the engine before being stored, so the engine is listed
+	// before the database to not report keys being created as orphaned, and again
+	// after it to not report them as missing.
+	engineKeysBefore, err := svc.listEngineKeyIDs(ctx, engine)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every key is listed, not only those of this engine: a key migrated away
+	// may have left a copy of its material behind, which is not an orphan.
+	kmsKeys := []models.KMSKey{}
+	_, err = svc.kmsStorage.SelectAll(ctx, resources.StorageListRequest[models.KMSKey]{
+		ExhaustiveRun: true,
+		QueryParams:   &resources.QueryParameters{},
+		ApplyFunc: func(kmsKey models.KMSKey) {
+			kmsKeys = append(kmsKeys, kmsKey)
+		},
+	})
+	if err != nil {
+		svc.logger.Errorf("could not list KMS keys: %s", err)
+		return nil, err
+	}
+
+	engineKeysAfter, err := svc.listEngineKeyIDs(ctx, engine)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &kms.EngineDriftReport{
+		EngineID:         input.EngineID,
+		DryRun:           input.DryRun,
+		SyncTS:           time.Now(),
+		OrphanedKeys:     []kms.OrphanedEngineKey{},
+		UnrecognizedKeys: []string{},
+		MissingMaterial:  []kms.KeyVersionReference{},
+		RestoredMaterial: []kms.KeyVersionReference{},
+		FailedUpdates:    []string{},
+	}
+
+	knownEngineKeys := map[string]bool{}
+	knownPublicKeys := map[string]bool{}
+	for i := range kmsKeys {
+		kmsKey := &kmsKeys[i]
+		materialMissing := map[int]bool{}
+		for j := range kmsKey.Versions {
+			version := &kmsKey.Versions[j]
+			knownEngineKeys[version.EngineKeyID] = true
+			if version.PublicKey != "" {
+				knownPublicKeys[version.PublicKey] = true
+			}
+
+			if kmsKey.EngineID != input.EngineID || version.State == models.KMSKeyVersionStateDestroyed {
+				continue
+			}
+
+			reference := kms.KeyVersionReference{
+				KeyID:       kmsKey.ID,
+				Version:     version.Version,
+				EngineKeyID: version.EngineKeyID,
+			}
+
+			present := engineKeysAfter[version.EngineKeyID]
+			switch {
+			case !present:
+				report.MissingMaterial = append(report.MissingMaterial, reference)
+			case version.MaterialMissing:
+				report.RestoredMaterial = append(report.RestoredMaterial, reference)
+			default:
+				report.InSync++
+			}
+
+			if version.MaterialMissing == present {
+				version.MaterialMissing = !present
+				materialMissing[version.Version] = !present
+			}
+		}
+
+		if len(materialMissing) > 0 && !input.DryRun {
+			err = svc.updateMaterialMissing(ctx, kmsKey, materialMissing)
+			if err != nil {
+				svc.logger.Errorf("could not update missing material flags of key %s: %s", kmsKey.ID, err)
+				report.FailedUpdates = append(report.FailedUpdates, kmsKey.ID)
+			}
+		}
+	}
+
+	for engineKeyID := range engineKeysBefore {
+		if knownEngineKeys[engineKeyID] {
+			continue
+		}
+
+		algorithm, size, publicKey, err := svc.describeEngineKey(ctx, engine, engineKeyID)
+		if err != nil {
+			svc.logger.Warnf("could not determine the type of key %s in crypto engine %s: %s", engineKeyID, input.EngineID, err)
+			report.UnrecognizedKeys = append(report.UnrecognizedKeys, engineKeyID)
+			continue
+		}
+
+		if knownPublicKeys[publicKey] {
+			continue
+		}
+
+		orphan := kms.OrphanedEngineKey{
+			EngineKeyID: engineKeyID,
+			Algorithm:   algorithm,
+			Size:        size,
+		}
+
+		if !input.DryRun {
+			kmsKey, err := svc.importOrphanedKey(ctx, input.EngineID, orphan, publicKey)
+			if err != nil {
+				return nil, err
+			}
+
+			orphan.ImportedAs = kmsKey.ID
+		}
+
+		report.OrphanedKeys = append(report.OrphanedKeys, orphan)
+	}
+
+	if report.HasDrift() {
+		svc.logger.Warnf("crypto engine %s drift: %d orphaned, %d unrecognized, %d missing, %d restored",
+			input.EngineID, len(report.OrphanedKeys), len(report.UnrecognizedKeys), len(report.MissingMaterial), len(report.RestoredMaterial))
+	} else {
+		svc.logger.Infof("crypto engine %s is in sync with %d key versions", input.EngineID, report.InSync)
+	}
+
+	return report, nil
+}
+
+// SyncCryptoEngines reconciles every configured crypto engine. A failure on one
+// engine does not prevent the others from being reconciled.
+func (svc *KMSServiceBackend) SyncCryptoEngines(ctx context.Context) error {
+	for engineID := range svc.cryptoEngines {
+		_, err := svc.SyncCryptoEngine(ctx, kms.SyncCryptoEngineInput{EngineID: engineID})
+		if err != nil {
+			svc.logger.Errorf("reconciliation of crypto engine %s failed: %s", engineID, err)
+		}
+	}
+
+	return nil
+}
+
+// maxMaterialMissingUpdates bounds the attempts to flag the versions of a key
+// being modified concurrently.
+const maxMaterialMissingUpdates = 3
+
+// updateMaterialMissing stores the missing material flags of the versions of a
+// key. Should the key be modified since it was listed, the flags are applied
+// again to its latest revision.
+func (svc *KMSServiceBackend) updateMaterialMissing(ctx context.Context, kmsKey *models.KMSKey, materialMissing map[int]bool) error {
+	for attempt := 1; ; attempt++ {
+		_, err := svc.kmsStorage.Update(ctx, kmsKey)
+		var conflictErr *resources.ConflictError
+		if !errors.As(err, &conflictErr) || attempt == maxMaterialMissingUpdates {
+			return err
+		}
+
+		kmsKey, err = svc.getKey(ctx, kmsKey.ID)
+		if err != nil {
+			return err
+		}
+
+		for i := range kmsKey.Versions {
+			if missing, ok := materialMissing[kmsKey.Versions[i].Version]; ok {
+				kmsKey.Versions[i].MaterialMissing = missing
+			}
+		}
+	}
+}
+
+func (svc *KMSServiceBackend) listEngineKeyIDs(ctx context.Context, engine cryptoengines.CryptoEngine) (map[string]bool, error) {
+	keyIDs, err := engine.ListPrivateKeyIDs(ctx)
+	if err != nil {
+		svc.logger.Errorf("could not list crypto engine keys: %s", err)
+		return nil, err
+	}
+
+	engineKeys := make(map[string]bool, len(keyIDs))
+	for _, keyID := range keyIDs {
+		engineKeys[keyID] = true
+	}
+
+	return engineKeys, nil
+}
+
+// describeEngineKey returns the algorithm, size and PEM public key of an
+// asymmetric engine key. Symmetric keys cannot be told apart and are rejected.
+func (svc *KMSServiceBackend) describeEngineKey(ctx context.Context, engine cryptoengines.CryptoEngine, engineKeyID string) (string, int, string, error) {
+	var pubKey crypto.PublicKey
+	signer, err := engine.GetPrivateKeyByID(ctx, engineKeyID)
+	if err == nil {
+		pubKey = signer.Public()
+	} else {
+		decrypter, decErr := engine.GetDecrypterByID(ctx, engineKeyID)
+		if decErr != nil {
+			return "", 0, "", err
+		}
+
+		pubKey = decrypter.Public()
+	}
+
+	var algorithm string
+	var size int
+	switch key := pubKey.(type) {
+	case *rsa.PublicKey:
+		algorithm, size = models.KMSKeyAlgorithmRSA, key.N.BitLen()
+	case *ecdsa.PublicKey:
+		algorithm, size = models.KMSKeyAlgorithmECDSA, key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		algorithm, size = models.KMSKeyAlgorithmEd25519, 256
+	case *mldsa.PublicKey:
+		algorithm, size = models.KMSKeyAlgorithmMLDSA, cryptoutils.MLDSASize(key.Parameters())
+	case *ecdh.PublicKey:
+		if key.Curve() != ecdh.X25519() {
+			return "", 0, "", kms.ErrUnsupportedKeyAlgorithm
+		}
+
+		algorithm, size = models.KMSKeyAlgorithmX25519, 256
+	default:
+		return "", 0, "", kms.ErrUnsupportedKeyAlgorithm
+	}
+
+	publicKey, err := cryptoutils.PublicKeyToPEM(pubKey)
+	if err != nil {
+		return "", 0, "", err
+	}
+
+	return algorithm, size, publicKey, nil
+}
+
+func (svc *KMSServiceBackend) importOrphanedKey(ctx context.Context, engineID string, orphan kms.OrphanedEngineKey, publicKey string) (*models.KMSKey, error) {
+	now := time.Now()
+	kmsKey, err := svc.kmsStorage.Insert(ctx, &models.KMSKey{
+		Alias:          orphan.EngineKeyID,
+		Algorithm:      orphan.Algorithm,
+		Size:           orphan.Size,
+		EngineID:       engineID,
+		Status:         models.KMSKeyStatusEnabled,
+		PrimaryVersion: 1,
+		Unmanaged:      true,
+		Versions: []models.KMSKeyVersion{
+			{
+				Version:     1,
+				EngineKeyID: orphan.EngineKeyID,
+				PublicKey:   publicKey,
+				State:       models.KMSKeyVersionStateEnabled,
+				CreationTS:  now,
+			},
+		},
+		CreationTS: now,
+		Metadata:   map[string]any{},
+	})
+	if err != nil {
+		svc.logger.Errorf("could not import orphaned key %s of crypto engine %s: %s", orphan.EngineKeyID, engineID, err)
+		return nil, err
+	}
+
+	svc.logger.Infof("orphaned key %s of crypto engine %s imported as unmanaged KMS key %s", orphan.EngineKeyID, engineID, kmsKey.ID)
+	return kmsKey, nil
+}
@@ -0,0 +1,56 @@
+package kms
+
+import (
+	"context"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/ca"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
+)
+
+// KeyReferenceChecker reports whether a KMS key is still used by another service
+// and therefore must not be deleted.
+type KeyReferenceChecker interface {
+	IsKeyInUse(ctx context.Context, keyID string) (bool, error)
+}
+
+type caKeyReferenceChecker struct {
+	caService ca.CAService
+}
+
+// NewCAKeyReferenceChecker returns a checker that considers a key in use while
+// any active CA references it.
+func NewCAKeyReferenceChecker(caService ca.CAService) KeyReferenceChecker {
+	return &caKeyReferenceChecker{
+		caService: caService,
+	}
+}
+
+func (c *caKeyReferenceChecker) IsKeyInUse(ctx context.Context, keyID string) (bool, error) {
+	inUse := false
+	_, err := c.caService.GetCAs(ctx, ca.GetCAsInput{
+		QueryParameters: &resources.QueryParameters{
+			PageSize: 1,
+			Filters: []resources.FilterOption{
+				{
+					Field:           "key_id",
+					FilterOperation: resources.StringEqual,
+					Value:           keyID,
+				},
+				{
+					Field:           "status",
+					FilterOperation: resources.EnumEqual,
+					Value:           string(models.CAStatusActive),
+				},
+			},
+		},
+		ApplyFunc: func(ca models.CACertificate) {
+			inUse = true
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return inUse, nil
+}
@@ -9,5 +9,31 @@ import (
 
 type KMSRepository interface {
 	Insert(ctx context.Context, key *models.KMSKey) (*models.KMSKey, error)
+	Update(ctx context.Context, key *models.KMSKey) (*models.KMSKey, error)
 	SelectAll(ctx context.Context, req resources.StorageListRequest[models.KMSKey]) (string, error)
+	Count(ctx context.Context, queryParams *resources.QueryParameters) (int, error)
+	CountBy(ctx context.Context, queryParams *resources.QueryParameters, field string) (map[string]int, error)
+	SelectExistsByID(ctx context.Context, id string) (bool, *models.KMSKey, error)
+}
+
+// KMSKeyFields are the fields KMS keys can be filtered and sorted by. The API
+// exposes a selection of them, see KMSFiltrableFields.
+var KMSKeyFields = resources.FilterFields{
+	"id":                   {Type: resources.StringFilterFieldType, Column: "id"},
+	"alias":                {Type: resources.StringFilterFieldType, Column: "alias"},
+	"algorithm":            {Type: resources.StringFilterFieldType, Column: "algorithm"},
+	"size":                 {Type: resources.NumberFilterFieldType, Column: "size"},
+	"engine_id":            {Type: resources.StringFilterFieldType, Column: "engine_id"},
+	"status":               {Type: resources.EnumFilterFieldType, Column: "status"},
+	"deletion_ts":          {Type: resources.DateFilterFieldType, Column: "deletion_ts"},
+	"primary_version":      {Type: resources.NumberFilterFieldType, Column: "primary_version"},
+	"rotation_period_days": {Type: resources.NumberFilterFieldType, Column: "rotation_period_days"},
+	"next_rotation_ts":     {Type: resources.DateFilterFieldType, Column: "next_rotation_ts"},
+	"jwks_published":       {Type: resources.EnumFilterFieldType, Column: "jwks_published"},
+	"unmanaged":            {Type: resources.EnumFilterFieldType, Column: "unmanaged"},
+	"creation_ts":          {Type: resources.DateFilterFieldType, Column: "creation_ts"},
+	"policy.not_before":    {Type: resources.DateFilterFieldType, Column: "policy", Path: []string{"not_before"}},
+	"policy.not_after":     {Type: resources.DateFilterFieldType, Column: "policy", Path: []string{"not_after"}},
+	"policy.operations":    {Type: resources.StringArrayFilterFieldType, Column: "policy", Path: []string{"allowed_operations"}},
+	"metadata.*":           {Type: resources.StringFilterFieldType, Column: "metadata"},
 }
@@ -0,0 +1,870 @@
+package kms
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/config"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/storage"
+	"gorm.io/gorm"
+)
+
+// kmsRepositories lists the KMSRepository implementations that must pass the
+// conformance suite. Postgres is only tested when LAMASSU_TEST_POSTGRES_HOSTNAME
+// is set, along with the optional _PORT, _USERNAME and _PASSWORD variables.
+func kmsRepositories() map[string]func(t *testing.T) KMSRepository {
+	lStorage := logger.SetupLogger(logger.LevelNone, "KMS", "Storage")
+
+	return map[string]func(t *testing.T) KMSRepository{
+		"memory": func(t *testing.T) KMSRepository {
+			repo, err := createKMSStorageInstance(lStorage, config.PluggableStorageEngine{Provider: config.Memory})
+			if err != nil {
+				t.Fatalf("could not create memory repository: %s", err)
+			}
+			return repo
+		},
+		"sqlite": func(t *testing.T) KMSRepository {
+			repo, err := createKMSStorageInstance(lStorage, config.PluggableStorageEngine{
+				Provider: config.SQLite,
+				Config:   map[string]interface{}{"directory": t.TempDir()},
+			})
+			if err != nil {
+				t.Fatalf("could not create sqlite repository: %s", err)
+			}
+			return repo
+		},
+		"postgres": func(t *testing.T) KMSRepository {
+			conf := postgresTestConfig(t)
+			repo, err := createKMSStorageInstance(lStorage, conf)
+			if err != nil {
+				t.Fatalf("could not create postgres repository: %s", err)
+			}
+
+			db := repo.(*PostgresKMSStore).db
+			if err := db.Exec("DELETE FROM kms_key_versions").Error; err != nil {
+				t.Fatalf("could not clean kms_key_versions: %s", err)
+			}
+			if err := db.Exec("DELETE FROM kms_keys").Error; err != nil {
+				t.Fatalf("could not clean kms_keys: %s", err)
+			}
+			return repo
+		},
+	}
+}
+
+func postgresTestConfig(t *testing.T) config.PluggableStorageEngine {
+	hostname := os.Getenv("LAMASSU_TEST_POSTGRES_HOSTNAME")
+	if hostname == "" {
+		t.Skip("LAMASSU_TEST_POSTGRES_HOSTNAME is not set")
+	}
+
+	port := 5432
+	if p := os.Getenv("LAMASSU_TEST_POSTGRES_PORT"); p != "" {
+		var err error
+		port, err = strconv.Atoi(p)
+		if err != nil {
+			t.Fatalf("invalid LAMASSU_TEST_POSTGRES_PORT: %s", err)
+		}
+	}
+
+	return config.PluggableStorageEngine{
+		Provider: config.Postgres,
+		Config: map[string]interface{}{
+			"hostname": hostname,
+			"port":     port,
+			"username": os.Getenv("LAMASSU_TEST_POSTGRES_USERNAME"),
+			"password": os.Getenv("LAMASSU_TEST_POSTGRES_PASSWORD"),
+		},
+	}
+}
+
+func TestKMSRepositoryConformance(t *testing.T) {
+	for name, newRepo := range kmsRepositories() {
+		t.Run(name, func(t *testing.T) {
+			t.Run("Insert", func(t *testing.T) { testKMSRepositoryInsert(t, newRepo(t)) })
+			t.Run("Update", func(t *testing.T) { testKMSRepositoryUpdate(t, newRepo(t)) })
+			t.Run("Revisions", func(t *testing.T) { testKMSRepositoryRevisions(t, newRepo(t)) })
+			t.Run("Filters", func(t *testing.T) { testKMSRepositoryFilters(t, newRepo(t)) })
+			t.Run("FilterGroups", func(t *testing.T) { testKMSRepositoryFilterGroups(t, newRepo(t)) })
+			t.Run("InvalidQueries", func(t *testing.T) { testKMSRepositoryInvalidQueries(t, newRepo(t)) })
+			t.Run("Pagination", func(t *testing.T) { testKMSRepositoryPagination(t, newRepo(t)) })
+			t.Run("Counts", func(t *testing.T) { testKMSRepositoryCounts(t, newRepo(t)) })
+			t.Run("Stats", func(t *testing.T) { testKMSRepositoryStats(t, newRepo(t)) })
+		})
+	}
+}
+
+func kmsTestDate(month int) time.Time {
+	return time.Date(2024, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// insertKMSFixtures stores six keys, in this order: alpha, Beta, gamma,
+// delta-key, epsilon_key and zeta. Sizes and creation dates grow in that order.
+func insertKMSFixtures(t *testing.T, repo KMSRepository) {
+	deletion := kmsTestDate(7)
+	gammaNotAfter := kmsTestDate(9)
+	deltaNotAfter := kmsTestDate(11)
+	fixtures := []models.KMSKey{
+		{Alias: "alpha", Size: 256, EngineID: "fs-1", Status: models.KMSKeyStatusEnabled, CreationTS: kmsTestDate(1), Metadata: map[string]any{"team": "pki", "tier": 2}, Policy: &models.KMSKeyPolicy{AllowedOperations: []models.KMSKeyOperation{models.KMSKeyOperationSign, models.KMSKeyOperationVerify}}},
+		{Alias: "Beta", Size: 384, EngineID: "fs-1", Status: models.KMSKeyStatusPendingDeletion, DeletionTS: &deletion, CreationTS: kmsTestDate(2)},
+		{Alias: "gamma", Size: 521, EngineID: "aws", Status: models.KMSKeyStatusEnabled, Unmanaged: true, CreationTS: kmsTestDate(3), Policy: &models.KMSKeyPolicy{NotAfter: &gammaNotAfter}},
+		{Alias: "delta-key", Size: 2048, EngineID: "aws", Status: models.KMSKeyStatusEnabled, CreationTS: kmsTestDate(4), Policy: &models.KMSKeyPolicy{NotAfter: &deltaNotAfter}},
+		{Alias: "epsilon_key", Size: 3072, EngineID: "fs-2", Status: models.KMSKeyStatusDeleted, CreationTS: kmsTestDate(5)},
+		{Alias: "zeta", Size: 4096, EngineID: "fs-2", Status: models.KMSKeyStatusEnabled, CreationTS: kmsTestDate(6), Metadata: map[string]any{"team": "Ops"}, Policy: &models.KMSKeyPolicy{AllowedOperations: []models.KMSKeyOperation{models.KMSKeyOperationEncrypt}}},
+	}
+
+	for _, key := range fixtures {
+		if _, err := repo.Insert(context.Background(), &key); err != nil {
+			t.Fatalf("could not insert key %s: %s", key.Alias, err)
+		}
+	}
+}
+
+// selectKMSAliases lists one page of keys, returning their aliases.
+func selectKMSAliases(t *testing.T, repo KMSRepository, queryParams *resources.QueryParameters, exhaustive bool) ([]string, string) {
+	aliases := []string{}
+	bookmark, err := repo.SelectAll(context.Background(), resources.StorageListRequest[models.KMSKey]{
+		ExhaustiveRun: exhaustive,
+		QueryParams:   queryParams,
+		ApplyFunc: func(key models.KMSKey) {
+			aliases = append(aliases, key.Alias)
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not select keys: %s", err)
+	}
+
+	return aliases, bookmark
+}
+
+func testKMSRepositoryInsert(t *testing.T, repo KMSRepository) {
+	ctx := context.Background()
+	key, err := repo.Insert(ctx, &models.KMSKey{
+		Alias:          "my-key",
+		Algorithm:      models.KMSKeyAlgorithmECDSA,
+		Size:           256,
+		PrimaryVersion: 1,
+		Metadata:       map[string]any{"team": "pki"},
+		Policy:         &models.KMSKeyPolicy{},
+		Versions: []models.KMSKeyVersion{
+			{Version: 1, EngineKeyID: "engine-key-1", State: models.KMSKeyVersionStateEnabled, CreationTS: kmsTestDate(1)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not insert key: %s", err)
+	}
+
+	if _, err := uuid.Parse(key.ID); err != nil {
+		t.Fatalf("inserted key has no generated id: %q", key.ID)
+	}
+	if key.Status != models.KMSKeyStatusEnabled {
+		t.Errorf("inserted key status is %q, want the %q default", key.Status, models.KMSKeyStatusEnabled)
+	}
+
+	exists, stored, err := repo.SelectExistsByID(ctx, key.ID)
+	if err != nil || !exists {
+		t.Fatalf("inserted key not found: %v", err)
+	}
+	if stored.Alias != "my-key" || stored.Metadata["team"] != "pki" || stored.Policy == nil {
+		t.Errorf("stored key does not match the inserted one: %+v", stored)
+	}
+	if len(stored.Versions) != 1 || stored.Versions[0].KMSKeyID != key.ID || stored.Versions[0].EngineKeyID != "engine-key-1" {
+		t.Errorf("stored key versions do not match the inserted ones: %+v", stored.Versions)
+	}
+
+	// Changes to selected keys must not reach the store until updated.
+	stored.Alias = "changed"
+	stored.Versions[0].EngineKeyID = "changed"
+	_, stored, _ = repo.SelectExistsByID(ctx, key.ID)
+	if stored.Alias != "my-key" || stored.Versions[0].EngineKeyID != "engine-key-1" {
+		t.Errorf("selected key shares state with the store: %+v", stored)
+	}
+
+	exists, _, err = repo.SelectExistsByID(ctx, uuid.NewString())
+	if err != nil || exists {
+		t.Errorf("unknown key reported as existing: %v, %v", exists, err)
+	}
+}
+
+func testKMSRepositoryUpdate(t *testing.T, repo KMSRepository) {
+	ctx := context.Background()
+	key, err := repo.Insert(ctx, &models.KMSKey{
+		Alias:          "rotating",
+		PrimaryVersion: 1,
+		Versions: []models.KMSKeyVersion{
+			{Version: 1, EngineKeyID: "engine-key-1", State: models.KMSKeyVersionStateEnabled, CreationTS: kmsTestDate(1)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not insert key: %s", err)
+	}
+
+	key.PrimaryVersion = 2
+	key.Status = models.KMSKeyStatusPendingDeletion
+	key.Versions = append(key.Versions, models.KMSKeyVersion{Version: 2, EngineKeyID: "engine-key-2", State: models.KMSKeyVersionStateEnabled, CreationTS: kmsTestDate(2)})
+	if _, err := repo.Update(ctx, key); err != nil {
+		t.Fatalf("could not update key: %s", err)
+	}
+
+	_, stored, err := repo.SelectExistsByID(ctx, key.ID)
+	if err != nil {
+		t.Fatalf("could not select key: %s", err)
+	}
+	if stored.PrimaryVersion != 2 || stored.Status != models.KMSKeyStatusPendingDeletion {
+		t.Errorf("stored key does not match the update: %+v", stored)
+	}
+	if len(stored.Versions) != 2 {
+		t.Fatalf("stored key has %d versions, want 2", len(stored.Versions))
+	}
+	for _, version := range stored.Versions {
+		if version.KMSKeyID != key.ID {
+			t.Errorf("version %d belongs to %q, want %q", version.Version, version.KMSKeyID, key.ID)
+		}
+	}
+}
+
+func testKMSRepositoryRevisions(t *testing.T, repo KMSRepository) {
+	ctx := context.Background()
+	key, err := repo.Insert(ctx, &models.KMSKey{
+		Alias:          "contended",
+		PrimaryVersion: 1,
+		Versions: []models.KMSKeyVersion{
+			{Version: 1, EngineKeyID: "engine-key-1", State: models.KMSKeyVersionStateEnabled, CreationTS: kmsTestDate(1)},
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not insert key: %s", err)
+	}
+	if key.Revision != 0 {
+		t.Errorf("inserted key is at revision %d, want 0", key.Revision)
+	}
+
+	_, stale, err := repo.SelectExistsByID(ctx, key.ID)
+	if err != nil {
+		t.Fatalf("could not select key: %s", err)
+	}
+
+	key.Alias = "first"
+	updated, err := repo.Update(ctx, key)
+	if err != nil {
+		t.Fatalf("could not update key: %s", err)
+	}
+	if updated.Revision != 1 {
+		t.Errorf("updated key is at revision %d, want 1", updated.Revision)
+	}
+
+	// Updates from the revision read before the first update must be refused,
+	// along with the changes to their associations.
+	stale.Alias = "second"
+	stale.PrimaryVersion = 2
+	stale.Versions = append(stale.Versions, models.KMSKeyVersion{Version: 2, EngineKeyID: "engine-key-2", State: models.KMSKeyVersionStateEnabled, CreationTS: kmsTestDate(2)})
+	_, err = repo.Update(ctx, stale)
+	var conflictErr *resources.ConflictError
+	if !errors.As(err, &conflictErr) {
+		t.Fatalf("stale update returned %v, want a ConflictError", err)
+	}
+	if conflictErr.ID != key.ID || conflictErr.Revision != 0 {
+		t.Errorf("got conflict on %s at revision %d, want %s at revision 0", conflictErr.ID, conflictErr.Revision, key.ID)
+	}
+	if stale.Revision != 0 {
+		t.Errorf("refused update left the key at revision %d, want 0", stale.Revision)
+	}
+
+	_, stored, err := repo.SelectExistsByID(ctx, key.ID)
+	if err != nil {
+		t.Fatalf("could not select key: %s", err)
+	}
+	if stored.Alias != "first" || stored.PrimaryVersion != 1 || stored.Revision != 1 {
+		t.Errorf("stored key does not match the first update: %+v", stored)
+	}
+	if len(stored.Versions) != 1 {
+		t.Errorf("stored key has %d versions, want 1", len(stored.Versions))
+	}
+
+	// Reading the key again allows updating it.
+	stored.Alias = "third"
+	if _, err := repo.Update(ctx, stored); err != nil {
+		t.Fatalf("could not update key from its latest revision: %s", err)
+	}
+	if stored.Revision != 2 {
+		t.Errorf("updated key is at revision %d, want 2", stored.Revision)
+	}
+
+	_, err = repo.Update(ctx, &models.KMSKey{ID: uuid.NewString(), Alias: "missing"})
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Errorf("update of an unknown key returned %v, want gorm.ErrRecordNotFound", err)
+	}
+}
+
+func testKMSRepositoryFilters(t *testing.T, repo KMSRepository) {
+	insertKMSFixtures(t, repo)
+
+	all := []string{"alpha", "Beta", "gamma", "delta-key", "epsilon_key", "zeta"}
+	without := func(aliases ...string) []string {
+		return slices.DeleteFunc(slices.Clone(all), func(alias string) bool { return slices.Contains(aliases, alias) })
+	}
+
+	tests := []struct {
+		name    string
+		filters []resources.FilterOption
+		want    []string
+	}{
+		{"StringEqual", []resources.FilterOption{{Field: "alias", FilterOperation: resources.StringEqual, Value: "Beta"}}, []string{"Beta"}},
+		{"StringEqualCase", []resources.FilterOption{{Field: "alias", FilterOperation: resources.StringEqual, Value: "beta"}}, []string{}},
+		{"StringEqualIgnoreCase", []resources.FilterOption{{Field: "alias", FilterOperation: resources.StringEqualIgnoreCase, Value: "BETA"}}, []string{"Beta"}},
+		{"StringNotEqual", []resources.FilterOption{{Field: "alias", FilterOperation: resources.StringNotEqual, Value: "alpha"}}, without("alpha")},
+		{"StringNotEqualIgnoreCase", []resources.FilterOption{{Field: "alias", FilterOperation: resources.StringNotEqualIgnoreCase, Value: "ALPHA"}}, without("alpha")},
+		{"StringContains", []resources.FilterOption{{Field: "alias", FilterOperation: resources.StringContains, Value: "eta"}}, []string{"Beta", "zeta"}},
+		{"StringContainsCase", []resources.FilterOption{{Field: "alias", FilterOperation: resources.StringContains, Value: "ETA"}}, []string{}},
+		{"StringContainsIgnoreCase", []resources.FilterOption{{Field: "alias", FilterOperation: resources.StringContainsIgnoreCase, Value: "ETA"}}, []string{"Beta", "zeta"}},
+		{"StringContainsWildcard", []resources.FilterOption{{Field: "alias", FilterOperation: resources.StringContains, Value: "a_k"}}, []string{"delta-key"}},
+		{"StringNotContains", []resources.FilterOption{{Field: "alias", FilterOperation: resources.StringNotContains, Value: "eta"}}, without("Beta", "zeta")},
+		{"StringNotContainsIgnoreCase", []resources.FilterOption{{Field: "alias", FilterOperation: resources.StringNotContainsIgnoreCase, Value: "BETA"}}, without("Beta")},
+		{"StringArrayContains", []resources.FilterOption{{Field: "policy.operations", FilterOperation: resources.StringArrayContains, Value: "sign"}}, []string{"alpha"}},
+		{"StringArrayContainsElement", []resources.FilterOption{{Field: "policy.operations", FilterOperation: resources.StringArrayContains, Value: "sig"}}, []string{}},
+		{"StringArrayContainsIgnoreCase", []resources.FilterOption{{Field: "policy.operations", FilterOperation: resources.StringArrayContainsIgnoreCase, Value: "ENCRYPT"}}, []string{"zeta"}},
+		{"DateEqual", []resources.FilterOption{{Field: "creation_ts", FilterOperation: resources.DateEqual, Value: "2024-03-01T00:00:00Z"}}, []string{"gamma"}},
+		{"DateBefore", []resources.FilterOption{{Field: "creation_ts", FilterOperation: resources.DateBefore, Value: "2024-03-01T00:00:00Z"}}, []string{"alpha", "Beta"}},
+		{"DateAfter", []resources.FilterOption{{Field: "creation_ts", FilterOperation: resources.DateAfter, Value: "2024-03-01T00:00:00Z"}}, []string{"delta-key", "epsilon_key", "zeta"}},
+		{"DateNull", []resources.FilterOption{{Field: "deletion_ts", FilterOperation: resources.DateBefore, Value: "2030-01-01T00:00:00Z"}}, []string{"Beta"}},
+		{"NumberEqual", []resources.FilterOption{{Field: "size", FilterOperation: resources.NumberEqual, Value: "521"}}, []string{"gamma"}},
+		{"NumberNotEqual", []resources.FilterOption{{Field: "size", FilterOperation: resources.NumberNotEqual, Value: "521"}}, without("gamma")},
+		{"NumberLessThan", []resources.FilterOption{{Field: "size", FilterOperation: resources.NumberLessThan, Value: "521"}}, []string{"alpha", "Beta"}},
+		{"NumberLessOrEqualThan", []resources.FilterOption{{Field: "size", FilterOperation: resources.NumberLessOrEqualThan, Value: "521"}}, []string{"alpha", "Beta", "gamma"}},
+		{"NumberGreaterThan", []resources.FilterOption{{Field: "size", FilterOperation: resources.NumberGreaterThan, Value: "2048"}}, []string{"epsilon_key", "zeta"}},
+		{"NumberGreaterOrEqualThan", []resources.FilterOption{{Field: "size", FilterOperation: resources.NumberGreaterOrEqualThan, Value: "2048"}}, []string{"delta-key", "epsilon_key", "zeta"}},
+		{"EnumEqual", []resources.FilterOption{{Field: "status", FilterOperation: resources.EnumEqual, Value: "PENDING_DELETION"}}, []string{"Beta"}},
+		{"EnumNotEqual", []resources.FilterOption{{Field: "status", FilterOperation: resources.EnumNotEqual, Value: "ENABLED"}}, []string{"Beta", "epsilon_key"}},
+		{"BooleanEqual", []resources.FilterOption{{Field: "unmanaged", FilterOperation: resources.EnumEqual, Value: "true"}}, []string{"gamma"}},
+		{"BooleanNotEqual", []resources.FilterOption{{Field: "unmanaged", FilterOperation: resources.EnumNotEqual, Value: "true"}}, without("gamma")},
+		{"JSONPathBefore", []resources.FilterOption{{Field: "policy.not_after", FilterOperation: resources.DateBefore, Value: "2024-10-01T00:00:00Z"}}, []string{"gamma"}},
+		{"JSONPathAfter", []resources.FilterOption{{Field: "policy.not_after", FilterOperation: resources.DateAfter, Value: "2024-01-01T00:00:00Z"}}, []string{"gamma", "delta-key"}},
+		{"In", []resources.FilterOption{{Field: "status", FilterOperation: resources.In, Values: []string{"PENDING_DELETION", "DELETED"}}}, []string{"Beta", "epsilon_key"}},
+		{"NotIn", []resources.FilterOption{{Field: "engine_id", FilterOperation: resources.NotIn, Values: []string{"aws", "fs-2"}}}, []string{"alpha", "Beta"}},
+		{"NumberIn", []resources.FilterOption{{Field: "size", FilterOperation: resources.In, Values: []string{"256", "4096"}}}, []string{"alpha", "zeta"}},
+		{"BooleanIn", []resources.FilterOption{{Field: "unmanaged", FilterOperation: resources.In, Values: []string{"true"}}}, []string{"gamma"}},
+		{"IsNull", []resources.FilterOption{{Field: "deletion_ts", FilterOperation: resources.IsNull}}, without("Beta")},
+		{"NotNull", []resources.FilterOption{{Field: "deletion_ts", FilterOperation: resources.NotNull}}, []string{"Beta"}},
+		{"JSONPathIsNull", []resources.FilterOption{{Field: "policy.not_after", FilterOperation: resources.IsNull}}, without("gamma", "delta-key")},
+		{"DateBetween", []resources.FilterOption{{Field: "creation_ts", FilterOperation: resources.DateBetween, Values: []string{"2024-02-01T00:00:00Z", "2024-04-01T00:00:00Z"}}}, []string{"Beta", "gamma", "delta-key"}},
+		{"NumberBetween", []resources.FilterOption{{Field: "size", FilterOperation: resources.NumberBetween, Values: []string{"384", "2048"}}}, []string{"Beta", "gamma", "delta-key"}},
+		{"MetadataKey", []resources.FilterOption{{Field: "metadata.team", FilterOperation: resources.StringEqual, Value: "pki"}}, []string{"alpha"}},
+		{"MetadataKeyIgnoreCase", []resources.FilterOption{{Field: "metadata.team", FilterOperation: resources.StringEqualIgnoreCase, Value: "OPS"}}, []string{"zeta"}},
+		{"MetadataNumber", []resources.FilterOption{{Field: "metadata.tier", FilterOperation: resources.StringEqual, Value: "2"}}, []string{"alpha"}},
+		{"MetadataKeyExists", []resources.FilterOption{{Field: "metadata.team", FilterOperation: resources.NotNull}}, []string{"alpha", "zeta"}},
+		{"Combined", []resources.FilterOption{
+			{Field: "engine_id", FilterOperation: resources.StringEqual, Value: "aws"},
+			{Field: "size", FilterOperation: resources.NumberGreaterThan, Value: "1000"},
+		}, []string{"delta-key"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, bookmark := selectKMSAliases(t, repo, &resources.QueryParameters{Filters: tt.filters}, false)
+			if !sameKMSAliases(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if bookmark != "" {
+				t.Errorf("got bookmark %q for a single page", bookmark)
+			}
+
+			got, _ = selectKMSAliases(t, repo, &resources.QueryParameters{Filters: tt.filters}, true)
+			if !sameKMSAliases(got, tt.want) {
+				t.Errorf("exhaustive run got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testKMSRepositoryFilterGroups(t *testing.T, repo KMSRepository) {
+	insertKMSFixtures(t, repo)
+
+	tests := []struct {
+		name    string
+		filters []resources.FilterOption
+		groups  [][]resources.FilterOption
+		want    []string
+	}{
+		{"Group", nil, [][]resources.FilterOption{{
+			{Field: "status", FilterOperation: resources.EnumEqual, Value: "DELETED"},
+			{Field: "size", FilterOperation: resources.NumberLessThan, Value: "300"},
+		}}, []string{"alpha", "epsilon_key"}},
+		{"GroupAndFilter", []resources.FilterOption{
+			{Field: "engine_id", FilterOperation: resources.StringEqual, Value: "fs-2"},
+		}, [][]resources.FilterOption{{
+			{Field: "status", FilterOperation: resources.EnumEqual, Value: "DELETED"},
+			{Field: "size", FilterOperation: resources.NumberLessThan, Value: "300"},
+		}}, []string{"epsilon_key"}},
+		{"SingleFilterGroup", []resources.FilterOption{
+			{Field: "engine_id", FilterOperation: resources.StringEqual, Value: "aws"},
+		}, [][]resources.FilterOption{{
+			{Field: "size", FilterOperation: resources.NumberGreaterThan, Value: "1000"},
+		}}, []string{"delta-key"}},
+		{"Groups", nil, [][]resources.FilterOption{
+			{{Field: "status", FilterOperation: resources.EnumEqual, Value: "ENABLED"}},
+			{
+				{Field: "size", FilterOperation: resources.NumberLessThan, Value: "300"},
+				{Field: "size", FilterOperation: resources.NumberGreaterThan, Value: "3000"},
+			},
+		}, []string{"alpha", "zeta"}},
+		{"ExpiringOrDeleted", nil, [][]resources.FilterOption{{
+			{Field: "policy.not_after", FilterOperation: resources.DateBetween, Values: []string{"2024-08-01T00:00:00Z", "2024-10-01T00:00:00Z"}},
+			{Field: "status", FilterOperation: resources.EnumEqual, Value: "DELETED"},
+		}}, []string{"gamma", "epsilon_key"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queryParams := &resources.QueryParameters{Filters: tt.filters, FilterGroups: tt.groups}
+			got, _ := selectKMSAliases(t, repo, queryParams, false)
+			if !sameKMSAliases(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+
+			got, _ = selectKMSAliases(t, repo, queryParams, true)
+			if !sameKMSAliases(got, tt.want) {
+				t.Errorf("exhaustive run got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("Walk", func(t *testing.T) {
+		var got []string
+		queryParams := &resources.QueryParameters{
+			PageSize:     1,
+			FilterGroups: [][]resources.FilterOption{{{Field: "engine_id", FilterOperation: resources.In, Values: []string{"fs-1", "aws"}}}},
+		}
+		for pages := 1; ; pages++ {
+			page, bookmark := selectKMSAliases(t, repo, queryParams, false)
+			got = append(got, page...)
+			if bookmark == "" {
+				break
+			}
+			if pages > 4 {
+				t.Fatalf("too many pages, got %v so far", got)
+			}
+			queryParams = &resources.QueryParameters{NextBookmark: bookmark}
+		}
+
+		if !sameKMSAliases(got, []string{"alpha", "Beta", "gamma", "delta-key"}) {
+			t.Errorf("got %v, want the fs-1 and aws keys", got)
+		}
+	})
+}
+
+func testKMSRepositoryInvalidQueries(t *testing.T, repo KMSRepository) {
+	insertKMSFixtures(t, repo)
+
+	tests := []struct {
+		name        string
+		queryParams *resources.QueryParameters
+	}{
+		{"UnknownField", &resources.QueryParameters{Filters: []resources.FilterOption{{Field: "engine", FilterOperation: resources.StringEqual, Value: "aws"}}}},
+		{"Injection", &resources.QueryParameters{Filters: []resources.FilterOption{{Field: "alias = alias OR 1", FilterOperation: resources.StringEqual, Value: "x"}}}},
+		{"UnspecifiedOperation", &resources.QueryParameters{Filters: []resources.FilterOption{{Field: "alias", FilterOperation: resources.UnspecifiedFilter, Value: "alpha"}}}},
+		{"UnknownSortField", &resources.QueryParameters{Sort: resources.SortOptions{SortField: "alias; DROP TABLE kms_keys"}}},
+		{"InWithoutValues", &resources.QueryParameters{Filters: []resources.FilterOption{{Field: "size", FilterOperation: resources.In}}}},
+		{"BetweenWithOneBound", &resources.QueryParameters{Filters: []resources.FilterOption{{Field: "size", FilterOperation: resources.NumberBetween, Values: []string{"1"}}}}},
+		{"UnknownGroupField", &resources.QueryParameters{FilterGroups: [][]resources.FilterOption{{{Field: "engine", FilterOperation: resources.StringEqual, Value: "aws"}}}}},
+		{"InvalidMetadataKey", &resources.QueryParameters{Filters: []resources.FilterOption{{Field: "metadata.team')--", FilterOperation: resources.NotNull}}}},
+		{"JSONPathSort", &resources.QueryParameters{Sort: resources.SortOptions{SortField: "policy.not_after"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, exhaustive := range []bool{false, true} {
+				_, err := repo.SelectAll(context.Background(), resources.StorageListRequest[models.KMSKey]{
+					ExhaustiveRun: exhaustive,
+					QueryParams:   tt.queryParams,
+					ApplyFunc:     func(models.KMSKey) {},
+				})
+				if err == nil {
+					t.Errorf("query accepted (exhaustive %t)", exhaustive)
+				}
+			}
+		})
+	}
+
+	if got, _ := selectKMSAliases(t, repo, nil, false); len(got) != 6 {
+		t.Errorf("got %v after invalid queries, want every key", got)
+	}
+}
+
+func testKMSRepositoryPagination(t *testing.T, repo KMSRepository) {
+	insertKMSFixtures(t, repo)
+
+	t.Run("DefaultPage", func(t *testing.T) {
+		got, bookmark := selectKMSAliases(t, repo, nil, false)
+		if len(got) != 6 || bookmark != "" {
+			t.Errorf("got %v and bookmark %q, want every key in a single page", got, bookmark)
+		}
+	})
+
+	t.Run("Sorted", func(t *testing.T) {
+		queryParams := &resources.QueryParameters{
+			PageSize: 4,
+			Sort:     resources.SortOptions{SortField: "size", SortMode: resources.SortModeDesc},
+		}
+
+		got, bookmark := selectKMSAliases(t, repo, queryParams, false)
+		if want := []string{"zeta", "epsilon_key", "delta-key", "gamma"}; !slices.Equal(got, want) || bookmark == "" {
+			t.Fatalf("got %v and bookmark %q, want %v and a bookmark", got, bookmark, want)
+		}
+
+		got, bookmark = selectKMSAliases(t, repo, &resources.QueryParameters{NextBookmark: bookmark}, false)
+		if want := []string{"Beta", "alpha"}; !slices.Equal(got, want) || bookmark != "" {
+			t.Errorf("got %v and bookmark %q, want %v and no bookmark", got, bookmark, want)
+		}
+	})
+
+	t.Run("SortedWalk", func(t *testing.T) {
+		// Every page past the first one is requested with the bookmark alone.
+		var got []string
+		queryParams := &resources.QueryParameters{
+			PageSize: 2,
+			Sort:     resources.SortOptions{SortField: "creation_ts"},
+		}
+		for pages := 1; ; pages++ {
+			page, bookmark := selectKMSAliases(t, repo, queryParams, false)
+			got = append(got, page...)
+			if bookmark == "" {
+				break
+			}
+			if pages > 3 {
+				t.Fatalf("too many pages, got %v so far", got)
+			}
+			queryParams = &resources.QueryParameters{NextBookmark: bookmark}
+		}
+
+		if want := []string{"alpha", "Beta", "gamma", "delta-key", "epsilon_key", "zeta"}; !slices.Equal(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("FilteredWalk", func(t *testing.T) {
+		var got []string
+		queryParams := &resources.QueryParameters{
+			PageSize: 2,
+			Sort:     resources.SortOptions{SortField: "size", SortMode: resources.SortModeAsc},
+			Filters:  []resources.FilterOption{{Field: "engine_id", FilterOperation: resources.StringNotEqual, Value: "aws"}},
+		}
+		for pages := 1; ; pages++ {
+			page, bookmark := selectKMSAliases(t, repo, queryParams, false)
+			got = append(got, page...)
+			if bookmark == "" {
+				break
+			}
+			if pages > 2 {
+				t.Fatalf("too many pages, got %v so far", got)
+			}
+			queryParams = &resources.QueryParameters{NextBookmark: bookmark}
+		}
+
+		if want := []string{"alpha", "Beta", "epsilon_key", "zeta"}; !slices.Equal(got, want) {
+			t.Errorf("got %v, want %v", got, want)
+		}
+	})
+
+	t.Run("UnsortedWalk", func(t *testing.T) {
+		var got []string
+		queryParams := &resources.QueryParameters{PageSize: 4}
+		for pages := 1; ; pages++ {
+			page, bookmark := selectKMSAliases(t, repo, queryParams, false)
+			got = append(got, page...)
+			if bookmark == "" {
+				break
+			}
+			if pages > 2 {
+				t.Fatalf("too many pages, got %v so far", got)
+			}
+			queryParams = &resources.QueryParameters{NextBookmark: bookmark}
+		}
+
+		if !sameKMSAliases(got, []string{"alpha", "Beta", "gamma", "delta-key", "epsilon_key", "zeta"}) {
+			t.Errorf("got %v, want every key once", got)
+		}
+	})
+
+	t.Run("TiedSortValues", func(t *testing.T) {
+		// Keys share engine IDs, so pages break ties on the primary key.
+		var got []string
+		queryParams := &resources.QueryParameters{
+			PageSize: 1,
+			Sort:     resources.SortOptions{SortField: "engine_id"},
+		}
+		for pages := 1; ; pages++ {
+			page, bookmark := selectKMSAliases(t, repo, queryParams, false)
+			got = append(got, page...)
+			if bookmark == "" {
+				break
+			}
+			if pages > 6 {
+				t.Fatalf("too many pages, got %v so far", got)
+			}
+			queryParams = &resources.QueryParameters{NextBookmark: bookmark}
+		}
+
+		if !sameKMSAliases(got, []string{"alpha", "Beta", "gamma", "delta-key", "epsilon_key", "zeta"}) {
+			t.Errorf("got %v, want every key once", got)
+		}
+	})
+
+	t.Run("InvalidBookmark", func(t *testing.T) {
+		_, err := repo.SelectAll(context.Background(), resources.StorageListRequest[models.KMSKey]{
+			QueryParams: &resources.QueryParameters{NextBookmark: "%%%"},
+			ApplyFunc:   func(models.KMSKey) {},
+		})
+		var bookmarkErr *storage.InvalidBookmarkError
+		if !errors.As(err, &bookmarkErr) {
+			t.Errorf("got error %v, want an InvalidBookmarkError", err)
+		}
+	})
+
+	t.Run("TamperedBookmark", func(t *testing.T) {
+		queryParams := &resources.QueryParameters{PageSize: 2, BookmarkScope: "GET /v1/kms/keys"}
+		_, bookmark := selectKMSAliases(t, repo, queryParams, false)
+		if bookmark == "" {
+			t.Fatal("got no bookmark")
+		}
+
+		version, rest, _ := strings.Cut(bookmark, ".")
+		payload, mac, _ := strings.Cut(rest, ".")
+		decoded, err := base64.RawURLEncoding.DecodeString(payload)
+		if err != nil {
+			t.Fatalf("could not decode bookmark payload: %s", err)
+		}
+		tampered := strings.Replace(string(decoded), `"l":2`, `"l":1000`, 1)
+
+		for name, bookmark := range map[string]string{
+			"Payload":  version + "." + base64.RawURLEncoding.EncodeToString([]byte(tampered)) + "." + mac,
+			"Version":  "v0." + rest,
+			"Unsigned": version + "." + payload,
+		} {
+			_, err := repo.SelectAll(context.Background(), resources.StorageListRequest[models.KMSKey]{
+				QueryParams: &resources.QueryParameters{NextBookmark: bookmark, BookmarkScope: queryParams.BookmarkScope},
+				ApplyFunc:   func(models.KMSKey) {},
+			})
+			var bookmarkErr *storage.InvalidBookmarkError
+			if !errors.As(err, &bookmarkErr) {
+				t.Errorf("%s: got error %v, want an InvalidBookmarkError", name, err)
+			}
+		}
+	})
+
+	t.Run("BookmarkScope", func(t *testing.T) {
+		_, bookmark := selectKMSAliases(t, repo, &resources.QueryParameters{PageSize: 2, BookmarkScope: "GET /v1/kms/keys"}, false)
+		if bookmark == "" {
+			t.Fatal("got no bookmark")
+		}
+
+		_, err := repo.SelectAll(context.Background(), resources.StorageListRequest[models.KMSKey]{
+			QueryParams: &resources.QueryParameters{NextBookmark: bookmark, BookmarkScope: "GET /v1/cas"},
+			ApplyFunc:   func(models.KMSKey) {},
+		})
+		var bookmarkErr *storage.InvalidBookmarkError
+		if !errors.As(err, &bookmarkErr) {
+			t.Errorf("got error %v, want an InvalidBookmarkError", err)
+		}
+
+		got, _ := selectKMSAliases(t, repo, &resources.QueryParameters{NextBookmark: bookmark, BookmarkScope: "GET /v1/kms/keys"}, false)
+		if len(got) != 2 {
+			t.Errorf("got %v, want the second page", got)
+		}
+	})
+
+	// Runs last, as it inserts keys.
+	t.Run("InsertBetweenPages", func(t *testing.T) {
+		queryParams := &resources.QueryParameters{
+			PageSize: 3,
+			Sort:     resources.SortOptions{SortField: "creation_ts"},
+		}
+		got, bookmark := selectKMSAliases(t, repo, queryParams, false)
+		if want := []string{"alpha", "Beta", "gamma"}; !slices.Equal(got, want) || bookmark == "" {
+			t.Fatalf("got %v and bookmark %q, want %v and a bookmark", got, bookmark, want)
+		}
+
+		// A key sorting before the bookmark must not shift the next page.
+		for _, key := range []models.KMSKey{
+			{Alias: "early", Size: 256, EngineID: "fs-1", Status: models.KMSKeyStatusEnabled, CreationTS: kmsTestDate(0)},
+			{Alias: "late", Size: 256, EngineID: "fs-1", Status: models.KMSKeyStatusEnabled, CreationTS: kmsTestDate(8)},
+		} {
+			if _, err := repo.Insert(context.Background(), &key); err != nil {
+				t.Fatalf("could not insert key %s: %s", key.Alias, err)
+			}
+		}
+
+		got, bookmark = selectKMSAliases(t, repo, &resources.QueryParameters{NextBookmark: bookmark}, false)
+		if want := []string{"delta-key", "epsilon_key", "zeta"}; !slices.Equal(got, want) || bookmark == "" {
+			t.Fatalf("got %v and bookmark %q, want %v and a bookmark", got, bookmark, want)
+		}
+
+		got, bookmark = selectKMSAliases(t, repo, &resources.QueryParameters{NextBookmark: bookmark}, false)
+		if want := []string{"late"}; !slices.Equal(got, want) || bookmark != "" {
+			t.Errorf("got %v and bookmark %q, want %v and no bookmark", got, bookmark, want)
+		}
+	})
+}
+
+func testKMSRepositoryCounts(t *testing.T, repo KMSRepository) {
+	ctx := context.Background()
+	insertKMSFixtures(t, repo)
+
+	counts := []struct {
+		name        string
+		queryParams *resources.QueryParameters
+		want        int
+	}{
+		{"All", nil, 6},
+		{"Filter", &resources.QueryParameters{Filters: []resources.FilterOption{
+			{Field: "engine_id", FilterOperation: resources.StringEqual, Value: "aws"},
+		}}, 2},
+		{"Group", &resources.QueryParameters{FilterGroups: [][]resources.FilterOption{{
+			{Field: "status", FilterOperation: resources.EnumEqual, Value: "DELETED"},
+			{Field: "size", FilterOperation: resources.NumberLessThan, Value: "300"},
+		}}}, 2},
+		{"PageSize", &resources.QueryParameters{PageSize: 2}, 6},
+	}
+
+	for _, tt := range counts {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.Count(ctx, tt.queryParams)
+			if err != nil {
+				t.Fatalf("could not count keys: %s", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("Bookmark", func(t *testing.T) {
+		// The count of a later page covers every page of the list.
+		_, bookmark := selectKMSAliases(t, repo, &resources.QueryParameters{
+			PageSize: 1,
+			Filters:  []resources.FilterOption{{Field: "status", FilterOperation: resources.EnumEqual, Value: "ENABLED"}},
+		}, false)
+
+		got, err := repo.Count(ctx, &resources.QueryParameters{NextBookmark: bookmark})
+		if err != nil {
+			t.Fatalf("could not count keys: %s", err)
+		}
+		if got != 4 {
+			t.Errorf("got %d, want 4", got)
+		}
+	})
+
+	countsBy := []struct {
+		name        string
+		field       string
+		queryParams *resources.QueryParameters
+		want        map[string]int
+	}{
+		{"Status", "status", nil, map[string]int{"ENABLED": 4, "PENDING_DELETION": 1, "DELETED": 1}},
+		{"Engine", "engine_id", &resources.QueryParameters{Filters: []resources.FilterOption{
+			{Field: "size", FilterOperation: resources.NumberGreaterThan, Value: "400"},
+		}}, map[string]int{"aws": 2, "fs-2": 2}},
+		{"Boolean", "unmanaged", nil, map[string]int{"true": 1, "false": 5}},
+		{"JSONPath", "metadata.team", nil, map[string]int{"pki": 1, "Ops": 1, "": 4}},
+	}
+
+	for _, tt := range countsBy {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := repo.CountBy(ctx, tt.queryParams, tt.field)
+			if err != nil {
+				t.Fatalf("could not count keys: %s", err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("UncountableField", func(t *testing.T) {
+		_, err := repo.CountBy(ctx, nil, "size")
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("UnknownField", func(t *testing.T) {
+		_, err := repo.CountBy(ctx, nil, "engine")
+		if !errors.Is(err, storage.ErrUnknownField) {
+			t.Fatalf("got %v, want %v", err, storage.ErrUnknownField)
+		}
+	})
+}
+
+func testKMSRepositoryStats(t *testing.T, repo KMSRepository) {
+	ctx := context.Background()
+	now := time.Now()
+	notAfter := func(days int) *models.KMSKeyPolicy {
+		date := now.AddDate(0, 0, days)
+		return &models.KMSKeyPolicy{NotAfter: &date}
+	}
+
+	for _, key := range []models.KMSKey{
+		{Alias: "expired", Algorithm: models.KMSKeyAlgorithmRSA, EngineID: "fs", Status: models.KMSKeyStatusEnabled, Policy: notAfter(-1)},
+		{Alias: "soon", Algorithm: models.KMSKeyAlgorithmECDSA, EngineID: "fs", Status: models.KMSKeyStatusEnabled, Policy: notAfter(10)},
+		{Alias: "later-this-quarter", Algorithm: models.KMSKeyAlgorithmECDSA, EngineID: "fs", Status: models.KMSKeyStatusEnabled, Policy: notAfter(60)},
+		{Alias: "next-year", Algorithm: models.KMSKeyAlgorithmRSA, EngineID: "aws", Status: models.KMSKeyStatusDeleted, Policy: notAfter(365)},
+		{Alias: "forever", Algorithm: models.KMSKeyAlgorithmRSA, EngineID: "aws", Status: models.KMSKeyStatusEnabled},
+	} {
+		key.CreationTS = now
+		if _, err := repo.Insert(ctx, &key); err != nil {
+			t.Fatalf("could not insert key %s: %s", key.Alias, err)
+		}
+	}
+
+	svc := &KMSServiceBackend{kmsStorage: repo}
+
+	stats, err := svc.GetKMSKeyStats(ctx, kms.GetKMSKeyStatsInput{})
+	if err != nil {
+		t.Fatalf("could not get stats: %s", err)
+	}
+
+	want := &kms.KMSKeyStats{
+		Total:    5,
+		ByStatus: map[string]int{"ENABLED": 4, "DELETED": 1},
+		ByType:   map[string]int{models.KMSKeyAlgorithmRSA: 3, models.KMSKeyAlgorithmECDSA: 2},
+		ByEngine: map[string]int{"fs": 3, "aws": 2},
+		ByExpiry: kms.KMSKeyExpiryStats{Expired: 1, Next30Days: 1, Next90Days: 1, Later: 1, NoExpiry: 1},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("got %+v, want %+v", stats, want)
+	}
+
+	t.Run("Filtered", func(t *testing.T) {
+		stats, err := svc.GetKMSKeyStats(ctx, kms.GetKMSKeyStatsInput{
+			QueryParameters: &resources.QueryParameters{
+				PageSize: 1,
+				Filters:  []resources.FilterOption{{Field: "status", FilterOperation: resources.EnumEqual, Value: "ENABLED"}},
+			},
+		})
+		if err != nil {
+			t.Fatalf("could not get stats: %s", err)
+		}
+
+		wantExpiry := kms.KMSKeyExpiryStats{Expired: 1, Next30Days: 1, Next90Days: 1, NoExpiry: 1}
+		if stats.Total != 4 || stats.ByExpiry != wantExpiry {
+			t.Errorf("got total %d and %+v, want 4 and %+v", stats.Total, stats.ByExpiry, wantExpiry)
+		}
+	})
+}
+
+func sameKMSAliases(got, want []string) bool {
+	return len(got) == len(want) && !slices.ContainsFunc(want, func(alias string) bool { return !slices.Contains(got, alias) })
+}
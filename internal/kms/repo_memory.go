@@ -0,0 +1,48 @@
+package kms
+
+import (
+	"context"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/storage"
+)
+
+type MemoryKMSStore struct {
+	querier *storage.MemoryQuerier[models.KMSKey]
+}
+
+func NewKMSMemoryRepository(bookmarks *storage.BookmarkSigner) (KMSRepository, error) {
+	querier, err := storage.NewMemoryQuerier[models.KMSKey]("id", KMSKeyFields, bookmarks)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MemoryKMSStore{
+		querier: querier,
+	}, nil
+}
+
+func (db *MemoryKMSStore) Insert(ctx context.Context, u *models.KMSKey) (*models.KMSKey, error) {
+	return db.querier.Insert(ctx, u)
+}
+
+func (db *MemoryKMSStore) Update(ctx context.Context, u *models.KMSKey) (*models.KMSKey, error) {
+	return db.querier.Update(ctx, u, u.ID)
+}
+
+func (db *MemoryKMSStore) SelectAll(ctx context.Context, req resources.StorageListRequest[models.KMSKey]) (string, error) {
+	return db.querier.SelectAll(ctx, req.QueryParams, req.ExhaustiveRun, req.ApplyFunc)
+}
+
+func (db *MemoryKMSStore) Count(ctx context.Context, queryParams *resources.QueryParameters) (int, error) {
+	return db.querier.Count(ctx, queryParams)
+}
+
+func (db *MemoryKMSStore) CountBy(ctx context.Context, queryParams *resources.QueryParameters, field string) (map[string]int, error) {
+	return db.querier.CountBy(ctx, queryParams, field)
+}
+
+func (db *MemoryKMSStore) SelectExistsByID(ctx context.Context, id string) (bool, *models.KMSKey, error) {
+	return db.querier.SelectExists(ctx, id, nil)
+}
@@ -15,8 +15,8 @@ type PostgresKMSStore struct {
 	querier *storage.PostgresDBQuerier[models.KMSKey]
 }
 
-func NewKMSPostgresRepository(log *logger.Logger, db *gorm.DB) (KMSRepository, error) {
-	querier, err := storage.TableQuery(log, db, "kms", "id", models.KMSKey{})
+func NewKMSPostgresRepository(log *logger.Logger, db *gorm.DB, bookmarks *storage.BookmarkSigner) (KMSRepository, error) {
+	querier, err := storage.TableQuery(log, db, "kms_keys", "id", models.KMSKey{}, KMSKeyFields, bookmarks)
 	if err != nil {
 		return nil, err
 	}
@@ -31,6 +31,22 @@ func (db *PostgresKMSStore) Insert(ctx context.Context, u *models.KMSKey) (*mode
 	return db.querier.Insert(ctx, u)
 }
 
+func (db *PostgresKMSStore) Update(ctx context.Context, u *models.KMSKey) (*models.KMSKey, error) {
+	return db.querier.Update(ctx, u, u.ID)
+}
+
 func (db *PostgresKMSStore) SelectAll(ctx context.Context, req resources.StorageListRequest[models.KMSKey]) (string, error) {
 	return db.querier.SelectAll(ctx, req.QueryParams, []storage.GormExtraOps{}, req.ExhaustiveRun, req.ApplyFunc)
 }
+
+func (db *PostgresKMSStore) Count(ctx context.Context, queryParams *resources.QueryParameters) (int, error) {
+	return db.querier.Count(ctx, queryParams, []storage.GormExtraOps{})
+}
+
+func (db *PostgresKMSStore) CountBy(ctx context.Context, queryParams *resources.QueryParameters, field string) (map[string]int, error) {
+	return db.querier.CountBy(ctx, queryParams, []storage.GormExtraOps{}, field)
+}
+
+func (db *PostgresKMSStore) SelectExistsByID(ctx context.Context, id string) (bool, *models.KMSKey, error) {
+	return db.querier.SelectExists(ctx, id, nil)
+}
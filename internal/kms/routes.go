@@ -11,6 +11,35 @@ func NewKMSHTTPLayer(parentRouterGroup *fiber.Router, svc kms.KMSService) {
 	router := parentRouterGroup
 	rv1 := (*router).Group("/v1")
 
+	// Relying parties fetch the JWKS from its well-known location, outside /v1.
+	(*router).Get("/.well-known/jwks.json", routes.GetJWKS)
+
 	rv1.Get("/kms", routes.GetAllKMSKeys)
+	rv1.Get("/kms/stats", routes.GetKMSKeyStats)
+	rv1.Get("/kms/export", routes.ExportKMSKeys)
+	rv1.Get("/kms/:id", routes.GetKMSKey)
 	rv1.Post("/kms", routes.CreateKMSKey)
+	rv1.Post("/kms/jws/verify", routes.VerifyJWS)
+	rv1.Post("/kms/shares/import", routes.ImportKMSKeyShares)
+	rv1.Delete("/kms/:id", routes.ScheduleKMSKeyDeletion)
+	rv1.Post("/kms/:id/cancel-deletion", routes.CancelKMSKeyDeletion)
+	rv1.Put("/kms/:id/policy", routes.UpdateKMSKeyPolicy)
+	rv1.Patch("/kms/:id/metadata", routes.UpdateKMSKeyMetadata)
+	rv1.Get("/kms/:id/public-key", routes.GetPublicKey)
+	rv1.Post("/kms/:id/csr", routes.CreateCSR)
+	rv1.Put("/kms/:id/jwks-publication", routes.SetKMSKeyJWKSPublication)
+	rv1.Post("/kms/:id/jwt", routes.SignJWT)
+	rv1.Post("/kms/:id/rotate", routes.RotateKMSKey)
+	rv1.Post("/kms/:id/migrate", routes.MigrateKMSKey)
+	rv1.Post("/kms/:id/shares", routes.ExportKMSKeyShares)
+	rv1.Put("/kms/:id/versions/:version/state", routes.UpdateKMSKeyVersionState)
+	rv1.Post("/kms/:id/sign", routes.Sign)
+	rv1.Post("/kms/:id/verify", routes.Verify)
+	rv1.Post("/kms/:id/encrypt", routes.Encrypt)
+	rv1.Post("/kms/:id/decrypt", routes.Decrypt)
+	rv1.Post("/kms/:id/mac", routes.GenerateMAC)
+	rv1.Post("/kms/:id/verify-mac", routes.VerifyMAC)
+
+	rv1.Get("/engines", routes.GetCryptoEngines)
+	rv1.Post("/engines/:id/sync", routes.SyncCryptoEngine)
 }
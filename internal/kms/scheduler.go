@@ -0,0 +1,56 @@
+package kms
+
+import (
+	"context"
+	"time"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
+)
+
+const defaultTaskInterval = time.Hour
+
+// PeriodicTask runs a background maintenance job, such as rotating or
+// deleting due keys, at a fixed interval.
+type PeriodicTask struct {
+	logger   *logger.Logger
+	name     string
+	interval time.Duration
+	run      func(ctx context.Context) error
+}
+
+func NewPeriodicTask(logger *logger.Logger, name string, interval time.Duration, run func(ctx context.Context) error) *PeriodicTask {
+	if interval <= 0 {
+		interval = defaultTaskInterval
+	}
+
+	return &PeriodicTask{
+		logger:   logger,
+		name:     name,
+		interval: interval,
+		run:      run,
+	}
+}
+
+// Start runs the task in the background until the context is cancelled.
+func (t *PeriodicTask) Start(ctx context.Context) {
+	t.logger.Infof("%s task started with an interval of %s", t.name, t.interval)
+
+	go func() {
+		ticker := time.NewTicker(t.interval)
+		defer ticker.Stop()
+
+		for {
+			t.logger.Debugf("running %s task", t.name)
+			if err := t.run(ctx); err != nil {
+				t.logger.Errorf("%s task failed: %s", t.name, err)
+			}
+
+			select {
+			case <-ctx.Done():
+				t.logger.Infof("%s task stopped", t.name)
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,100 @@
+package kms
+
+import "github.com/lamassuiot/lamassuiot/v4/pkg/shared/storage"
+
+// kmsSchemaMigrations holds the schema of the KMS database. Released migrations
+// must never change: schema changes are new migrations appended at the end.
+var kmsSchemaMigrations = []storage.Migration{
+	{
+		// Tables created by AutoMigrate in earlier releases are adopted as is,
+		// adding the columns they may lack.
+		Version: 1,
+		Name:    "create kms keys",
+		Up: storage.DialectSQL([]string{
+			`CREATE TABLE IF NOT EXISTS kms_keys (
+				id uuid DEFAULT gen_random_uuid(),
+				alias varchar(255) NOT NULL,
+				PRIMARY KEY (id)
+			)`,
+			`ALTER TABLE kms_keys
+				ADD COLUMN IF NOT EXISTS algorithm text,
+				ADD COLUMN IF NOT EXISTS size bigint,
+				ADD COLUMN IF NOT EXISTS engine_id text,
+				ADD COLUMN IF NOT EXISTS status text DEFAULT 'ENABLED',
+				ADD COLUMN IF NOT EXISTS deletion_ts timestamptz,
+				ADD COLUMN IF NOT EXISTS primary_version bigint,
+				ADD COLUMN IF NOT EXISTS rotation_period_days bigint,
+				ADD COLUMN IF NOT EXISTS next_rotation_ts timestamptz,
+				ADD COLUMN IF NOT EXISTS policy text,
+				ADD COLUMN IF NOT EXISTS jwks_published boolean,
+				ADD COLUMN IF NOT EXISTS unmanaged boolean,
+				ADD COLUMN IF NOT EXISTS metadata text,
+				ADD COLUMN IF NOT EXISTS creation_ts timestamptz`,
+			`CREATE TABLE IF NOT EXISTS kms_key_versions (
+				kms_key_id uuid,
+				version bigint,
+				PRIMARY KEY (kms_key_id, version),
+				CONSTRAINT fk_kms_keys_versions FOREIGN KEY (kms_key_id) REFERENCES kms_keys(id)
+			)`,
+			`ALTER TABLE kms_key_versions
+				ADD COLUMN IF NOT EXISTS engine_key_id text,
+				ADD COLUMN IF NOT EXISTS public_key text,
+				ADD COLUMN IF NOT EXISTS state text,
+				ADD COLUMN IF NOT EXISTS creation_ts timestamptz,
+				ADD COLUMN IF NOT EXISTS superseded_ts timestamptz,
+				ADD COLUMN IF NOT EXISTS material_missing boolean`,
+		}, []string{
+			`CREATE TABLE kms_keys (
+				id uuid DEFAULT ` + storage.SQLiteRandomUUID + `,
+				alias varchar(255) NOT NULL,
+				algorithm text,
+				size integer,
+				engine_id text,
+				status text DEFAULT 'ENABLED',
+				deletion_ts datetime,
+				primary_version integer,
+				rotation_period_days integer,
+				next_rotation_ts datetime,
+				policy text,
+				jwks_published numeric,
+				unmanaged numeric,
+				metadata text,
+				creation_ts datetime,
+				PRIMARY KEY (id)
+			)`,
+			`CREATE TABLE kms_key_versions (
+				kms_key_id uuid,
+				version integer,
+				engine_key_id text,
+				public_key text,
+				state text,
+				creation_ts datetime,
+				superseded_ts datetime,
+				material_missing numeric,
+				PRIMARY KEY (kms_key_id, version),
+				CONSTRAINT fk_kms_keys_versions FOREIGN KEY (kms_key_id) REFERENCES kms_keys(id)
+			)`,
+		}),
+		Down: storage.DialectSQL([]string{
+			`DROP TABLE kms_key_versions`,
+			`DROP TABLE kms_keys`,
+		}, []string{
+			`DROP TABLE kms_key_versions`,
+			`DROP TABLE kms_keys`,
+		}),
+	},
+	{
+		Version: 2,
+		Name:    "add kms key revisions",
+		Up: storage.DialectSQL([]string{
+			`ALTER TABLE kms_keys ADD COLUMN revision bigint NOT NULL DEFAULT 0`,
+		}, []string{
+			`ALTER TABLE kms_keys ADD COLUMN revision integer NOT NULL DEFAULT 0`,
+		}),
+		Down: storage.DialectSQL([]string{
+			`ALTER TABLE kms_keys DROP COLUMN revision`,
+		}, []string{
+			`ALTER TABLE kms_keys DROP COLUMN revision`,
+		}),
+	},
+}
@@ -2,65 +2,1100 @@ package kms
 
 import (
 	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
 	"fmt"
 	"time"
 
 	"github.com/lamassuiot/lamassuiot/v4/pkg/kms"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms/cryptoengines"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/cryptoutils"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
 )
 
 type KMSServiceBackend struct {
-	logger     *logger.Logger
-	kmsStorage KMSRepository
+	logger              *logger.Logger
+	kmsStorage          KMSRepository
+	cryptoEngines       map[string]cryptoengines.CryptoEngine
+	defaultCryptoEngine string
+	keyReferences       KeyReferenceChecker
+	keyProvider         *cryptoengines.SoftwareKeyProvider
+	jwksRetention       time.Duration
 }
 
 type KMSServiceBuilder struct {
-	Logger     *logger.Logger
-	KMSStorage KMSRepository
+	Logger              *logger.Logger
+	KMSStorage          KMSRepository
+	CryptoEngines       map[string]cryptoengines.CryptoEngine
+	DefaultCryptoEngine string
+	KeyReferences       KeyReferenceChecker
+	// JWKSRotatedKeyRetention is how long a rotated key version keeps being
+	// published in the JWKS. Defaults to DefaultJWKSRotatedKeyRetention.
+	JWKSRotatedKeyRetention time.Duration
 }
 
+const DefaultJWKSRotatedKeyRetention = 7 * 24 * time.Hour
+
 func NewKMSService(builder KMSServiceBuilder) kms.KMSService {
+	jwksRetention := builder.JWKSRotatedKeyRetention
+	if jwksRetention <= 0 {
+		jwksRetention = DefaultJWKSRotatedKeyRetention
+	}
+
 	svc := KMSServiceBackend{
-		logger:     builder.Logger,
-		kmsStorage: builder.KMSStorage,
+		logger:              builder.Logger,
+		kmsStorage:          builder.KMSStorage,
+		cryptoEngines:       builder.CryptoEngines,
+		defaultCryptoEngine: builder.DefaultCryptoEngine,
+		keyReferences:       builder.KeyReferences,
+		keyProvider:         cryptoengines.NewSoftwareKeyProvider(builder.Logger),
+		jwksRetention:       jwksRetention,
 	}
 
 	return &svc
 }
 
-func (svc *KMSServiceBackend) CreateKMSKey(ctx context.Context, input kms.CreateKMSInput) error {
+func (svc *KMSServiceBackend) CreateKMSKey(ctx context.Context, input kms.CreateKMSInput) (*models.KMSKey, error) {
+	if input.RotationPeriodDays < 0 {
+		return nil, fmt.Errorf("rotation period must not be negative")
+	}
+
+	err := validatePolicy(input.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	engineID := input.EngineID
+	if engineID == "" {
+		engineID = svc.defaultCryptoEngine
+	}
+
+	engine, err := svc.getCryptoEngine(engineID)
+	if err != nil {
+		return nil, err
+	}
+
+	engineKeyID, publicKey, err := svc.createEngineKey(ctx, engine, input.Algorithm, input.Size)
+	if err != nil {
+		svc.logger.Errorf("could not create %s key in crypto engine %s: %s", input.Algorithm, engineID, err)
+		return nil, err
+	}
+
+	now := time.Now()
 	kmsKey, err := svc.kmsStorage.Insert(ctx, &models.KMSKey{
-		Alias:      input.Alias,
-		Algorithm:  input.Algorithm,
-		Size:       input.Size,
-		PublicKey:  input.PublicKey,
-		CreationTS: time.Now(),
+		Alias:              input.Alias,
+		Algorithm:          input.Algorithm,
+		Size:               input.Size,
+		EngineID:           engineID,
+		Status:             models.KMSKeyStatusEnabled,
+		PrimaryVersion:     1,
+		RotationPeriodDays: input.RotationPeriodDays,
+		NextRotationTS:     nextRotation(now, input.RotationPeriodDays),
+		Policy:             input.Policy,
+		JWKSPublished:      input.PublishJWKS,
+		Versions: []models.KMSKeyVersion{
+			{
+				Version:     1,
+				EngineKeyID: engineKeyID,
+				PublicKey:   publicKey,
+				State:       models.KMSKeyVersionStateEnabled,
+				CreationTS:  now,
+			},
+		},
+		CreationTS: now,
 		Metadata:   map[string]any{},
 	})
+	if err != nil {
+		svc.logger.Errorf("could not store KMS key %s: %s", input.Alias, err)
+		svc.discardEngineKey(ctx, engine, engineKeyID)
+		return nil, err
+	}
 
-	fmt.Println(kmsKey)
 	svc.logger.Info("KMS key created", "name", input.Alias)
+	return kmsKey, nil
+}
+
+func (svc *KMSServiceBackend) GetKMSKeys(ctx context.Context, input kms.GetKMSKeysInput) (string, error) {
+	bookmark, err := svc.kmsStorage.SelectAll(ctx, resources.StorageListRequest[models.KMSKey]{
+		ExhaustiveRun: input.ExhaustiveRun,
+		QueryParams:   input.QueryParameters,
+		ApplyFunc:     input.ApplyFunc,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return bookmark, nil
+
+}
+
+func (svc *KMSServiceBackend) GetKMSKeyByID(ctx context.Context, input kms.GetKMSKeyByIDInput) (*models.KMSKey, error) {
+	return svc.getKey(ctx, input.ID)
+}
+
+// RotateKMSKey creates a new version of the key in the same crypto engine and
+// promotes it as the primary version. Previous versions are left untouched.
+func (svc *KMSServiceBackend) RotateKMSKey(ctx context.Context, input kms.RotateKMSKeyInput) (*models.KMSKey, error) {
+	kmsKey, engine, err := svc.getKeyAndEngine(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authorize(ctx, kmsKey, policyRequest{Operation: models.KMSKeyOperationAdmin})
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkRevision(kmsKey, input.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.rotateKey(ctx, kmsKey, engine)
+}
+
+// rotateKey rotates a key without checking its policy, which is left to the
+// callers acting on behalf of a principal.
+func (svc *KMSServiceBackend) rotateKey(ctx context.Context, kmsKey *models.KMSKey, engine cryptoengines.CryptoEngine) (*models.KMSKey, error) {
+	engineKeyID, publicKey, err := svc.createEngineKey(ctx, engine, kmsKey.Algorithm, kmsKey.Size)
+	if err != nil {
+		svc.logger.Errorf("could not create new version for key %s: %s", kmsKey.ID, err)
+		return nil, err
+	}
+
+	newVersion := 0
+	for _, version := range kmsKey.Versions {
+		newVersion = max(newVersion, version.Version)
+	}
+	newVersion++
+
+	now := time.Now()
+	if previous := kmsKey.GetVersion(kmsKey.PrimaryVersion); previous != nil {
+		previous.SupersededTS = &now
+	}
+
+	kmsKey.Versions = append(kmsKey.Versions, models.KMSKeyVersion{
+		KMSKeyID:    kmsKey.ID,
+		Version:     newVersion,
+		EngineKeyID: engineKeyID,
+		PublicKey:   publicKey,
+		State:       models.KMSKeyVersionStateEnabled,
+		CreationTS:  now,
+	})
+	kmsKey.PrimaryVersion = newVersion
+	kmsKey.NextRotationTS = nextRotation(now, kmsKey.RotationPeriodDays)
 
+	kmsKey, err = svc.kmsStorage.Update(ctx, kmsKey)
+	if err != nil {
+		svc.logger.Errorf("could not store version %d of key %s: %s", newVersion, kmsKey.ID, err)
+		svc.discardEngineKey(ctx, engine, engineKeyID)
+		return nil, err
+	}
+
+	svc.logger.Infof("KMS key %s rotated to version %d", kmsKey.ID, newVersion)
+	return kmsKey, nil
+}
+
+// RotateDueKeys rotates every key whose automatic rotation period has elapsed.
+func (svc *KMSServiceBackend) RotateDueKeys(ctx context.Context) error {
+	dueKeys := []string{}
+	_, err := svc.kmsStorage.SelectAll(ctx, resources.StorageListRequest[models.KMSKey]{
+		ExhaustiveRun: true,
+		QueryParams: &resources.QueryParameters{
+			Filters: []resources.FilterOption{
+				{
+					Field:           "status",
+					FilterOperation: resources.EnumEqual,
+					Value:           string(models.KMSKeyStatusEnabled),
+				},
+				{
+					Field:           "next_rotation_ts",
+					FilterOperation: resources.DateBefore,
+					Value:           time.Now().Format(time.RFC3339),
+				},
+			},
+		},
+		ApplyFunc: func(kmsKey models.KMSKey) {
+			dueKeys = append(dueKeys, kmsKey.ID)
+		},
+	})
 	if err != nil {
 		return err
 	}
 
+	for _, keyID := range dueKeys {
+		kmsKey, engine, err := svc.getKeyAndEngine(ctx, keyID)
+		if err == nil {
+			_, err = svc.rotateKey(ctx, kmsKey, engine)
+		}
+		if err != nil {
+			svc.logger.Errorf("scheduled rotation of key %s failed: %s", keyID, err)
+		}
+	}
+
 	return nil
 }
 
-func (svc *KMSServiceBackend) GetKMSKeys(ctx context.Context, input kms.GetKMSKeysInput) (string, error) {
-	kmsKeys := []models.KMSKey{}
-	bookmark, err := svc.kmsStorage.SelectAll(ctx, resources.StorageListRequest[models.KMSKey]{
-		ApplyFunc: func(item models.KMSKey) {
-			kmsKeys = append(kmsKeys, item)
+// UpdateKMSKeyVersionState enables or disables a version. Versions are only
+// destroyed along with their key, once its pending deletion window ends, see
+// ScheduleKMSKeyDeletion.
+func (svc *KMSServiceBackend) UpdateKMSKeyVersionState(ctx context.Context, input kms.UpdateKMSKeyVersionStateInput) (*models.KMSKey, error) {
+	kmsKey, _, err := svc.getKeyAndEngine(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authorize(ctx, kmsKey, policyRequest{Operation: models.KMSKeyOperationAdmin})
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkRevision(kmsKey, input.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	version := kmsKey.GetVersion(input.Version)
+	if version == nil {
+		return nil, kms.ErrKMSKeyVersionNotFound
+	}
+
+	if version.State == input.State {
+		return kmsKey, nil
+	}
+
+	if version.State == models.KMSKeyVersionStateDestroyed ||
+		(input.State != models.KMSKeyVersionStateEnabled && input.State != models.KMSKeyVersionStateDisabled) {
+		return nil, kms.ErrInvalidStateTransition
+	}
+
+	version.State = input.State
+	return svc.kmsStorage.Update(ctx, kmsKey)
+}
+
+// UpdateKMSKeyPolicy replaces the policy of a key. The caller must be allowed
+// the admin operation by the current policy.
+func (svc *KMSServiceBackend) UpdateKMSKeyPolicy(ctx context.Context, input kms.UpdateKMSKeyPolicyInput) (*models.KMSKey, error) {
+	err := validatePolicy(input.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	kmsKey, _, err := svc.getKeyAndEngine(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authorize(ctx, kmsKey, policyRequest{Operation: models.KMSKeyOperationAdmin})
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkRevision(kmsKey, input.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	kmsKey.Policy = input.Policy
+	kmsKey, err = svc.kmsStorage.Update(ctx, kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.logger.Infof("policy of KMS key %s updated", kmsKey.ID)
+	return kmsKey, nil
+}
+
+func (svc *KMSServiceBackend) UpdateKMSKeyMetadata(ctx context.Context, input kms.UpdateKMSKeyMetadataInput) (*models.KMSKey, error) {
+	kmsKey, err := svc.getKey(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authorize(ctx, kmsKey, policyRequest{Operation: models.KMSKeyOperationAdmin})
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkRevision(kmsKey, input.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	if kmsKey.Metadata == nil {
+		kmsKey.Metadata = map[string]any{}
+	}
+	for key, value := range input.Metadata {
+		if value == nil {
+			delete(kmsKey.Metadata, key)
+			continue
+		}
+		kmsKey.Metadata[key] = value
+	}
+
+	kmsKey, err = svc.kmsStorage.Update(ctx, kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.logger.Infof("metadata of KMS key %s updated", kmsKey.ID)
+	return kmsKey, nil
+}
+
+// ScheduleKMSKeyDeletion disables the key and schedules the destruction of its
+// material once the pending window ends. Until then the deletion can be cancelled.
+func (svc *KMSServiceBackend) ScheduleKMSKeyDeletion(ctx context.Context, input kms.ScheduleKMSKeyDeletionInput) (*models.KMSKey, error) {
+	pendingWindow := input.PendingWindowDays
+	if pendingWindow == 0 {
+		pendingWindow = kms.DefaultPendingWindowDays
+	}
+
+	if pendingWindow < kms.MinPendingWindowDays || pendingWindow > kms.MaxPendingWindowDays {
+		return nil, kms.ErrInvalidPendingWindow
+	}
+
+	kmsKey, err := svc.getKey(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authorize(ctx, kmsKey, policyRequest{Operation: models.KMSKeyOperationAdmin})
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkRevision(kmsKey, input.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	if kmsKey.Status == models.KMSKeyStatusPendingDeletion {
+		return nil, kms.ErrKMSKeyPendingDeletion
+	}
+
+	err = svc.checkKeyNotInUse(ctx, kmsKey.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	deletionTS := time.Now().AddDate(0, 0, pendingWindow)
+	kmsKey.Status = models.KMSKeyStatusPendingDeletion
+	kmsKey.DeletionTS = &deletionTS
+
+	kmsKey, err = svc.kmsStorage.Update(ctx, kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.logger.Infof("KMS key %s scheduled for deletion at %s", kmsKey.ID, deletionTS.Format(time.RFC3339))
+	return kmsKey, nil
+}
+
+func (svc *KMSServiceBackend) CancelKMSKeyDeletion(ctx context.Context, input kms.CancelKMSKeyDeletionInput) (*models.KMSKey, error) {
+	kmsKey, err := svc.getKey(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authorize(ctx, kmsKey, policyRequest{Operation: models.KMSKeyOperationAdmin})
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkRevision(kmsKey, input.Revision)
+	if err != nil {
+		return nil, err
+	}
+
+	if kmsKey.Status != models.KMSKeyStatusPendingDeletion {
+		return nil, kms.ErrInvalidStateTransition
+	}
+
+	kmsKey.Status = models.KMSKeyStatusEnabled
+	kmsKey.DeletionTS = nil
+
+	kmsKey, err = svc.kmsStorage.Update(ctx, kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.logger.Infof("deletion of KMS key %s cancelled", kmsKey.ID)
+	return kmsKey, nil
+}
+
+// DeleteDueKeys destroys the material of every key whose pending deletion window
+// has ended. The key record is kept with all its versions marked as destroyed.
+func (svc *KMSServiceBackend) DeleteDueKeys(ctx context.Context) error {
+	dueKeys := []string{}
+	_, err := svc.kmsStorage.SelectAll(ctx, resources.StorageListRequest[models.KMSKey]{
+		ExhaustiveRun: true,
+		QueryParams: &resources.QueryParameters{
+			Filters: []resources.FilterOption{
+				{
+					Field:           "status",
+					FilterOperation: resources.EnumEqual,
+					Value:           string(models.KMSKeyStatusPendingDeletion),
+				},
+				{
+					Field:           "deletion_ts",
+					FilterOperation: resources.DateBefore,
+					Value:           time.Now().Format(time.RFC3339),
+				},
+			},
+		},
+		ApplyFunc: func(kmsKey models.KMSKey) {
+			dueKeys = append(dueKeys, kmsKey.ID)
 		},
 	})
+	if err != nil {
+		return err
+	}
+
+	for _, keyID := range dueKeys {
+		err := svc.deleteKeyMaterial(ctx, keyID)
+		if err != nil {
+			svc.logger.Errorf("scheduled deletion of key %s failed: %s", keyID, err)
+		}
+	}
+
+	return nil
+}
+
+func (svc *KMSServiceBackend) deleteKeyMaterial(ctx context.Context, id string) error {
+	kmsKey, err := svc.getKey(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if kmsKey.Status != models.KMSKeyStatusPendingDeletion {
+		return nil
+	}
+
+	// A CA may have started using the key while it was pending deletion.
+	err = svc.checkKeyNotInUse(ctx, kmsKey.ID)
+	if err != nil {
+		return err
+	}
+
+	engine, err := svc.getCryptoEngine(kmsKey.EngineID)
+	if err != nil {
+		return err
+	}
+
+	for i := range kmsKey.Versions {
+		version := &kmsKey.Versions[i]
+		if version.State == models.KMSKeyVersionStateDestroyed {
+			continue
+		}
+
+		err = engine.DeleteKey(ctx, version.EngineKeyID)
+		if err != nil {
+			return fmt.Errorf("could not destroy version %d: %w", version.Version, err)
+		}
+
+		version.State = models.KMSKeyVersionStateDestroyed
+	}
+
+	kmsKey.Status = models.KMSKeyStatusDeleted
+	kmsKey.NextRotationTS = nil
+
+	_, err = svc.kmsStorage.Update(ctx, kmsKey)
+	if err != nil {
+		return err
+	}
+
+	svc.logger.Infof("KMS key %s deleted", kmsKey.ID)
+	return nil
+}
+
+// discardEngineKey deletes an engine key that could not be stored, so that it is
+// not left behind as an orphan. Failures are left for reconciliation to report.
+func (svc *KMSServiceBackend) discardEngineKey(ctx context.Context, engine cryptoengines.CryptoEngine, engineKeyID string) {
+	err := engine.DeleteKey(ctx, engineKeyID)
+	if err != nil {
+		svc.logger.Errorf("could not discard unstored engine key %s: %s", engineKeyID, err)
+	}
+}
+
+func (svc *KMSServiceBackend) checkKeyNotInUse(ctx context.Context, id string) error {
+	if svc.keyReferences == nil {
+		return nil
+	}
+
+	inUse, err := svc.keyReferences.IsKeyInUse(ctx, id)
+	if err != nil {
+		svc.logger.Errorf("could not check references to key %s: %s", id, err)
+		return err
+	}
+
+	if inUse {
+		return kms.ErrKMSKeyInUse
+	}
+
+	return nil
+}
+
+func (svc *KMSServiceBackend) Sign(ctx context.Context, input kms.SignInput) (*kms.SignOutput, error) {
+	kmsKey, engine, err := svc.getKeyAndEngine(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.signWithPrimaryVersion(ctx, kmsKey, engine, input)
+}
+
+func (svc *KMSServiceBackend) signWithPrimaryVersion(ctx context.Context, kmsKey *models.KMSKey, engine cryptoengines.CryptoEngine, input kms.SignInput) (*kms.SignOutput, error) {
+	algorithm, scheme, err := resolveSigningAlgorithm(kmsKey, input.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authorize(ctx, kmsKey, policyRequest{
+		Operation: models.KMSKeyOperationSign,
+		Algorithm: algorithm,
+		Hash:      hashName(scheme.hash),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := messageDigest(scheme.hash, input.Message, input.MessageType)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := primaryVersion(kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := engine.GetPrivateKeyByID(ctx, version.EngineKeyID)
+	if err != nil {
+		svc.logger.Errorf("could not get signer for key %s: %s", kmsKey.ID, err)
+		return nil, err
+	}
+
+	signature, err := scheme.sign(signer, digest)
+	if err != nil {
+		svc.logger.Errorf("could not sign with key %s: %s", kmsKey.ID, err)
+		return nil, err
+	}
+
+	return &kms.SignOutput{
+		Signature:  signature,
+		KeyVersion: version.Version,
+		Algorithm:  algorithm,
+	}, nil
+}
+
+func (svc *KMSServiceBackend) Verify(ctx context.Context, input kms.VerifyInput) (bool, error) {
+	kmsKey, _, err := svc.getKeyAndEngine(ctx, input.ID)
+	if err != nil {
+		return false, err
+	}
+
+	algorithm, scheme, err := resolveSigningAlgorithm(kmsKey, input.Algorithm)
+	if err != nil {
+		return false, err
+	}
+
+	err = authorize(ctx, kmsKey, policyRequest{
+		Operation: models.KMSKeyOperationVerify,
+		Algorithm: algorithm,
+		Hash:      hashName(scheme.hash),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	digest, err := messageDigest(scheme.hash, input.Message, input.MessageType)
+	if err != nil {
+		return false, err
+	}
+
+	versions, err := verificationVersions(kmsKey, input.KeyVersion)
+	if err != nil {
+		return false, err
+	}
+
+	for _, version := range versions {
+		pubKey, err := cryptoutils.ParsePublicKey(version.PublicKey)
+		if err != nil {
+			svc.logger.Errorf("could not parse public key of version %d of key %s: %s", version.Version, kmsKey.ID, err)
+			return false, err
+		}
+
+		if scheme.verify(pubKey, digest, input.Signature) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (svc *KMSServiceBackend) Encrypt(ctx context.Context, input kms.EncryptInput) (string, error) {
+	kmsKey, engine, err := svc.getKeyAndEngine(ctx, input.ID)
 	if err != nil {
 		return "", err
 	}
 
-	return bookmark, nil
+	err = authorize(ctx, kmsKey, policyRequest{Operation: models.KMSKeyOperationEncrypt})
+	if err != nil {
+		return "", err
+	}
+
+	version, err := primaryVersion(kmsKey)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext := kms.Ciphertext{
+		KeyID:      kmsKey.ID,
+		KeyVersion: version.Version,
+	}
+	aad := ciphertextAAD(ciphertext, input.AAD)
+
+	switch {
+	case kmsKey.Algorithm == models.KMSKeyAlgorithmAES:
+		ciphertext.Data, err = engine.EncryptAESGCM(ctx, version.EngineKeyID, input.Plaintext, aad)
+	case supportsAsymmetricEncryption(kmsKey):
+		ciphertext.Data, err = encryptWithPublicKey(version.PublicKey, input.Plaintext, aad)
+	default:
+		return "", kms.ErrUnsupportedKeyOperation
+	}
+
+	if err != nil {
+		svc.logger.Errorf("could not encrypt with key %s: %s", kmsKey.ID, err)
+		return "", err
+	}
+
+	return ciphertext.String(), nil
+}
+
+func (svc *KMSServiceBackend) Decrypt(ctx context.Context, input kms.DecryptInput) ([]byte, error) {
+	ciphertext, err := kms.ParseCiphertext(input.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	if ciphertext.KeyID != input.ID {
+		return nil, kms.ErrInvalidCiphertext
+	}
+
+	kmsKey, engine, err := svc.getKeyAndEngine(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authorize(ctx, kmsKey, policyRequest{Operation: models.KMSKeyOperationDecrypt})
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := verificationVersions(kmsKey, ciphertext.KeyVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(versions) == 0 {
+		return nil, kms.ErrKMSKeyVersionNotUsable
+	}
+
+	version := versions[0]
+	aad := ciphertextAAD(*ciphertext, input.AAD)
+
+	var plaintext []byte
+	switch {
+	case kmsKey.Algorithm == models.KMSKeyAlgorithmAES:
+		plaintext, err = engine.DecryptAESGCM(ctx, version.EngineKeyID, ciphertext.Data, aad)
+	case supportsAsymmetricEncryption(kmsKey):
+		decrypter, decErr := engine.GetDecrypterByID(ctx, version.EngineKeyID)
+		if decErr != nil {
+			svc.logger.Errorf("could not get decrypter for key %s: %s", kmsKey.ID, decErr)
+			return nil, decErr
+		}
+
+		var opts crypto.DecrypterOpts = &cryptoengines.ECIESDecrypterOpts{AAD: aad}
+		if kmsKey.Algorithm == models.KMSKeyAlgorithmRSA {
+			opts = &rsa.OAEPOptions{Hash: crypto.SHA256, Label: aad}
+		}
+
+		plaintext, err = decrypter.Decrypt(rand.Reader, ciphertext.Data, opts)
+	default:
+		return nil, kms.ErrUnsupportedKeyOperation
+	}
+
+	if err != nil {
+		svc.logger.Errorf("could not decrypt with key %s: %s", kmsKey.ID, err)
+		return nil, kms.ErrInvalidCiphertext
+	}
+
+	return plaintext, nil
+}
+
+func (svc *KMSServiceBackend) GenerateMAC(ctx context.Context, input kms.GenerateMACInput) ([]byte, error) {
+	kmsKey, engine, err := svc.getKeyAndEngine(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authorizeMAC(ctx, kmsKey, models.KMSKeyOperationSign)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := primaryVersion(kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return svc.computeMAC(ctx, kmsKey, version, engine, input.Message)
+}
+
+func (svc *KMSServiceBackend) VerifyMAC(ctx context.Context, input kms.VerifyMACInput) (bool, error) {
+	kmsKey, engine, err := svc.getKeyAndEngine(ctx, input.ID)
+	if err != nil {
+		return false, err
+	}
+
+	err = authorizeMAC(ctx, kmsKey, models.KMSKeyOperationVerify)
+	if err != nil {
+		return false, err
+	}
+
+	versions, err := verificationVersions(kmsKey, 0)
+	if err != nil {
+		return false, err
+	}
+
+	for _, version := range versions {
+		mac, err := svc.computeMAC(ctx, kmsKey, version, engine, input.Message)
+		if err != nil {
+			return false, err
+		}
+
+		if hmac.Equal(mac, input.MAC) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// authorizeMAC checks MAC operations against the key policy. MACs are governed
+// by the sign and verify operations and the hash of the HMAC key.
+func authorizeMAC(ctx context.Context, kmsKey *models.KMSKey, operation models.KMSKeyOperation) error {
+	if kmsKey.Algorithm != models.KMSKeyAlgorithmHMAC {
+		return kms.ErrUnsupportedKeyOperation
+	}
+
+	hash, err := hmacHashFromSize(kmsKey.Size)
+	if err != nil {
+		return err
+	}
+
+	return authorize(ctx, kmsKey, policyRequest{
+		Operation: operation,
+		Hash:      hashName(hash),
+	})
+}
+
+func (svc *KMSServiceBackend) computeMAC(ctx context.Context, kmsKey *models.KMSKey, version *models.KMSKeyVersion, engine cryptoengines.CryptoEngine, message []byte) ([]byte, error) {
+	if kmsKey.Algorithm != models.KMSKeyAlgorithmHMAC {
+		return nil, kms.ErrUnsupportedKeyOperation
+	}
+
+	hash, err := hmacHashFromSize(kmsKey.Size)
+	if err != nil {
+		return nil, err
+	}
+
+	mac, err := engine.ComputeHMAC(ctx, version.EngineKeyID, hash, message)
+	if err != nil {
+		svc.logger.Errorf("could not compute MAC with key %s: %s", kmsKey.ID, err)
+		return nil, err
+	}
+
+	return mac, nil
+}
+
+// createEngineKey generates a new key in the engine, returning its engine ID and,
+// for asymmetric keys, the PEM encoded public key.
+func (svc *KMSServiceBackend) createEngineKey(ctx context.Context, engine cryptoengines.CryptoEngine, algorithm string, size int) (string, string, error) {
+	var engineKeyID, publicKey string
+	var err error
+
+	switch algorithm {
+	case models.KMSKeyAlgorithmRSA:
+		var signer crypto.Signer
+		engineKeyID, signer, err = engine.CreateRSAPrivateKey(ctx, size)
+		if err == nil {
+			publicKey, err = cryptoutils.PublicKeyToPEM(signer.Public())
+		}
+	case models.KMSKeyAlgorithmECDSA:
+		curve, curveErr := curveFromSize(size)
+		if curveErr != nil {
+			return "", "", curveErr
+		}
+
+		var signer crypto.Signer
+		engineKeyID, signer, err = engine.CreateECDSAPrivateKey(ctx, curve)
+		if err == nil {
+			publicKey, err = cryptoutils.PublicKeyToPEM(signer.Public())
+		}
+	case models.KMSKeyAlgorithmEd25519:
+		if size != 256 {
+			return "", "", kms.ErrUnsupportedKeyAlgorithm
+		}
+
+		var signer crypto.Signer
+		engineKeyID, signer, err = engine.CreateEd25519PrivateKey(ctx)
+		if err == nil {
+			publicKey, err = cryptoutils.PublicKeyToPEM(signer.Public())
+		}
+	case models.KMSKeyAlgorithmMLDSA:
+		params, ok := cryptoutils.MLDSAParameters(size)
+		if !ok {
+			return "", "", kms.ErrUnsupportedKeyAlgorithm
+		}
+
+		var signer crypto.Signer
+		engineKeyID, signer, err = engine.CreateMLDSAPrivateKey(ctx, params)
+		if err == nil {
+			publicKey, err = cryptoutils.PublicKeyToPEM(signer.Public())
+		}
+	case models.KMSKeyAlgorithmX25519:
+		if size != 256 {
+			return "", "", kms.ErrUnsupportedKeyAlgorithm
+		}
+
+		var pubKey *ecdh.PublicKey
+		engineKeyID, pubKey, err = engine.CreateX25519PrivateKey(ctx)
+		if err == nil {
+			publicKey, err = cryptoutils.PublicKeyToPEM(pubKey)
+		}
+	case models.KMSKeyAlgorithmAES:
+		if size != 128 && size != 256 {
+			return "", "", kms.ErrUnsupportedKeyAlgorithm
+		}
+
+		engineKeyID, err = engine.CreateAESKey(ctx, size)
+	case models.KMSKeyAlgorithmHMAC:
+		if _, hashErr := hmacHashFromSize(size); hashErr != nil {
+			return "", "", hashErr
+		}
+
+		engineKeyID, err = engine.CreateHMACKey(ctx, size)
+	default:
+		return "", "", kms.ErrUnsupportedKeyAlgorithm
+	}
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return engineKeyID, publicKey, nil
+}
+
+func (svc *KMSServiceBackend) getKey(ctx context.Context, id string) (*models.KMSKey, error) {
+	exists, kmsKey, err := svc.kmsStorage.SelectExistsByID(ctx, id)
+	if err != nil {
+		svc.logger.Errorf("could not get KMS key %s: %s", id, err)
+		return nil, err
+	}
+
+	if !exists || kmsKey.Status == models.KMSKeyStatusDeleted {
+		return nil, kms.ErrKMSKeyNotFound
+	}
+
+	return kmsKey, nil
+}
+
+// checkRevision refuses updates expecting another revision of the key. Updates
+// racing with others from the same revision are refused by the storage.
+func checkRevision(kmsKey *models.KMSKey, revision *int) error {
+	if revision != nil && *revision != kmsKey.Revision {
+		return &resources.ConflictError{ID: kmsKey.ID, Revision: *revision}
+	}
+
+	return nil
+}
+
+// getKeyAndEngine returns a key that can be operated on along with its crypto
+// engine. Keys pending deletion refuse every operation.
+func (svc *KMSServiceBackend) getKeyAndEngine(ctx context.Context, id string) (*models.KMSKey, cryptoengines.CryptoEngine, error) {
+	kmsKey, err := svc.getKey(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if kmsKey.Status == models.KMSKeyStatusPendingDeletion {
+		return nil, nil, kms.ErrKMSKeyPendingDeletion
+	}
+
+	engine, err := svc.getCryptoEngine(kmsKey.EngineID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return kmsKey, engine, nil
+}
+
+func (svc *KMSServiceBackend) getCryptoEngine(engineID string) (cryptoengines.CryptoEngine, error) {
+	engine, ok := svc.cryptoEngines[engineID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", kms.ErrCryptoEngineNotFound, engineID)
+	}
+
+	return engine, nil
+}
+
+// primaryVersion returns the version used for new signatures, encryptions and MACs.
+func primaryVersion(kmsKey *models.KMSKey) (*models.KMSKeyVersion, error) {
+	version := kmsKey.GetVersion(kmsKey.PrimaryVersion)
+	if version == nil {
+		return nil, kms.ErrKMSKeyVersionNotFound
+	}
 
+	if version.State != models.KMSKeyVersionStateEnabled {
+		return nil, kms.ErrKMSKeyVersionNotUsable
+	}
+
+	return version, nil
+}
+
+// verificationVersions returns the versions that can be used to verify or
+// decrypt. Any version not destroyed qualifies. A zero version selects all of them.
+func verificationVersions(kmsKey *models.KMSKey, version int) ([]*models.KMSKeyVersion, error) {
+	if version != 0 {
+		keyVersion := kmsKey.GetVersion(version)
+		if keyVersion == nil {
+			return nil, kms.ErrKMSKeyVersionNotFound
+		}
+
+		if keyVersion.State == models.KMSKeyVersionStateDestroyed {
+			return nil, kms.ErrKMSKeyVersionNotUsable
+		}
+
+		return []*models.KMSKeyVersion{keyVersion}, nil
+	}
+
+	versions := []*models.KMSKeyVersion{}
+	for i := range kmsKey.Versions {
+		if kmsKey.Versions[i].State != models.KMSKeyVersionStateDestroyed {
+			versions = append(versions, &kmsKey.Versions[i])
+		}
+	}
+
+	return versions, nil
+}
+
+func nextRotation(from time.Time, periodDays int) *time.Time {
+	if periodDays <= 0 {
+		return nil
+	}
+
+	next := from.AddDate(0, 0, periodDays)
+	return &next
+}
+
+func ciphertextAAD(ciphertext kms.Ciphertext, aad []byte) []byte {
+	return append([]byte(ciphertext.Header()), aad...)
+}
+
+// supportsAsymmetricEncryption reports whether the key can be used with RSA-OAEP
+// or ECIES. ECIES is only offered over P-256 and X25519.
+func supportsAsymmetricEncryption(kmsKey *models.KMSKey) bool {
+	switch kmsKey.Algorithm {
+	case models.KMSKeyAlgorithmRSA, models.KMSKeyAlgorithmX25519:
+		return true
+	case models.KMSKeyAlgorithmECDSA:
+		return kmsKey.Size == 256
+	default:
+		return false
+	}
+}
+
+func encryptWithPublicKey(publicKey string, plaintext, aad []byte) ([]byte, error) {
+	pubKey, err := cryptoutils.ParsePublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	switch pub := pubKey.(type) {
+	case *rsa.PublicKey:
+		return rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, plaintext, aad)
+	case *ecdsa.PublicKey:
+		ecdhPub, err := pub.ECDH()
+		if err != nil {
+			return nil, err
+		}
+
+		return cryptoengines.EncryptECIES(ecdhPub, plaintext, aad)
+	case *ecdh.PublicKey:
+		return cryptoengines.EncryptECIES(pub, plaintext, aad)
+	default:
+		return nil, kms.ErrUnsupportedKeyOperation
+	}
+}
+
+func messageDigest(hash crypto.Hash, message []byte, messageType kms.SignMessageType) ([]byte, error) {
+	if hash == 0 {
+		if messageType == kms.SignMessageTypeDigest {
+			return nil, kms.ErrInvalidSignatureRequest
+		}
+
+		return message, nil
+	}
+
+	switch messageType {
+	case kms.SignMessageTypeDigest:
+		if len(message) != hash.Size() {
+			return nil, kms.ErrInvalidSignatureRequest
+		}
+
+		return message, nil
+	case kms.SignMessageTypeRaw, "":
+		hasher := hash.New()
+		hasher.Write(message)
+		return hasher.Sum(nil), nil
+	default:
+		return nil, kms.ErrInvalidSignatureRequest
+	}
+}
+
+func curveFromSize(size int) (elliptic.Curve, error) {
+	switch size {
+	case 224:
+		return elliptic.P224(), nil
+	case 256:
+		return elliptic.P256(), nil
+	case 384:
+		return elliptic.P384(), nil
+	case 521:
+		return elliptic.P521(), nil
+	default:
+		return nil, kms.ErrUnsupportedKeyAlgorithm
+	}
+}
+
+func hmacHashFromSize(size int) (crypto.Hash, error) {
+	switch size {
+	case 256:
+		return crypto.SHA256, nil
+	case 384:
+		return crypto.SHA384, nil
+	case 512:
+		return crypto.SHA512, nil
+	default:
+		return 0, kms.ErrUnsupportedKeyAlgorithm
+	}
 }
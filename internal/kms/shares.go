@@ -0,0 +1,156 @@
+package kms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"time"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/cryptoutils"
+)
+
+// ExportKMSKeyShares splits the material of a key version into Shamir shares for
+// M-of-N custody. Only software-backed RSA and ECDSA keys can be exported, as
+// only those can be imported back into a crypto engine.
+func (svc *KMSServiceBackend) ExportKMSKeyShares(ctx context.Context, input kms.ExportKMSKeySharesInput) (*kms.KMSKeyShares, error) {
+	kmsKey, engine, err := svc.getKeyAndEngine(ctx, input.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = authorize(ctx, kmsKey, policyRequest{Operation: models.KMSKeyOperationExport})
+	if err != nil {
+		return nil, err
+	}
+
+	if kmsKey.Algorithm != models.KMSKeyAlgorithmRSA && kmsKey.Algorithm != models.KMSKeyAlgorithmECDSA {
+		return nil, fmt.Errorf("%w: %s keys cannot be imported back into a crypto engine", kms.ErrKMSKeyNotExportable, kmsKey.Algorithm)
+	}
+
+	versionNumber := input.Version
+	if versionNumber == 0 {
+		versionNumber = kmsKey.PrimaryVersion
+	}
+
+	versions, err := verificationVersions(kmsKey, versionNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	version := versions[0]
+	signer, err := engine.GetPrivateKeyByID(ctx, version.EngineKeyID)
+	if err != nil {
+		svc.logger.Errorf("could not read version %d of key %s from its crypto engine: %s", version.Version, kmsKey.ID, err)
+		return nil, err
+	}
+
+	switch signer.(type) {
+	case *rsa.PrivateKey, *ecdsa.PrivateKey:
+	default:
+		return nil, fmt.Errorf("%w: crypto engine %s does not hand out key material", kms.ErrKMSKeyNotExportable, kmsKey.EngineID)
+	}
+
+	shares, err := svc.keyProvider.SplitPrivateKey(signer, input.Shares, input.Threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	svc.logger.Infof("version %d of KMS key %s exported as %d shares with threshold %d", version.Version, kmsKey.ID, input.Shares, input.Threshold)
+	return &kms.KMSKeyShares{
+		KeyID:      kmsKey.ID,
+		KeyVersion: version.Version,
+		Threshold:  input.Threshold,
+		Shares:     shares,
+	}, nil
+}
+
+// ImportKMSKeyShares rebuilds a key from its Shamir shares and imports it into a
+// crypto engine as a new KMS key.
+func (svc *KMSServiceBackend) ImportKMSKeyShares(ctx context.Context, input kms.ImportKMSKeySharesInput) (*models.KMSKey, error) {
+	err := validatePolicy(input.Policy)
+	if err != nil {
+		return nil, err
+	}
+
+	engineID := input.EngineID
+	if engineID == "" {
+		engineID = svc.defaultCryptoEngine
+	}
+
+	engine, err := svc.getCryptoEngine(engineID)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := svc.keyProvider.CombinePrivateKeyShares(input.Shares)
+	if err != nil {
+		return nil, err
+	}
+
+	var algorithm string
+	var size int
+	switch key := signer.(type) {
+	case *rsa.PrivateKey:
+		algorithm, size = models.KMSKeyAlgorithmRSA, key.N.BitLen()
+	case *ecdsa.PrivateKey:
+		algorithm, size = models.KMSKeyAlgorithmECDSA, key.Curve.Params().BitSize
+	default:
+		return nil, kms.ErrUnsupportedKeyAlgorithm
+	}
+
+	if !engineSupportsKey(ctx, engine, algorithm, size) {
+		return nil, fmt.Errorf("%w: crypto engine %s does not support %s %d keys", kms.ErrUnsupportedKeyAlgorithm, engineID, algorithm, size)
+	}
+
+	var engineKeyID string
+	var imported crypto.Signer
+	if key, isRSA := signer.(*rsa.PrivateKey); isRSA {
+		engineKeyID, imported, err = engine.ImportRSAPrivateKey(ctx, key)
+	} else {
+		engineKeyID, imported, err = engine.ImportECDSAPrivateKey(ctx, signer.(*ecdsa.PrivateKey))
+	}
+	if err != nil {
+		svc.logger.Errorf("could not import rebuilt key into crypto engine %s: %s", engineID, err)
+		return nil, err
+	}
+
+	publicKey, err := cryptoutils.PublicKeyToPEM(imported.Public())
+	if err != nil {
+		svc.discardEngineKey(ctx, engine, engineKeyID)
+		return nil, err
+	}
+
+	now := time.Now()
+	kmsKey, err := svc.kmsStorage.Insert(ctx, &models.KMSKey{
+		Alias:          input.Alias,
+		Algorithm:      algorithm,
+		Size:           size,
+		EngineID:       engineID,
+		Status:         models.KMSKeyStatusEnabled,
+		PrimaryVersion: 1,
+		Policy:         input.Policy,
+		Versions: []models.KMSKeyVersion{
+			{
+				Version:     1,
+				EngineKeyID: engineKeyID,
+				PublicKey:   publicKey,
+				State:       models.KMSKeyVersionStateEnabled,
+				CreationTS:  now,
+			},
+		},
+		CreationTS: now,
+		Metadata:   map[string]any{},
+	})
+	if err != nil {
+		svc.logger.Errorf("could not store KMS key %s rebuilt from shares: %s", input.Alias, err)
+		svc.discardEngineKey(ctx, engine, engineKeyID)
+		return nil, err
+	}
+
+	svc.logger.Infof("KMS key %s rebuilt from %d shares into crypto engine %s", kmsKey.ID, len(input.Shares), engineID)
+	return kmsKey, nil
+}
@@ -0,0 +1,138 @@
+package kms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+
+	"filippo.io/mldsa"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+)
+
+// signingScheme describes how a signing algorithm is applied. Ed25519 and ML-DSA
+// have no prehash, so their hash is zero and they sign the raw message. keySize
+// is set for algorithms bound to a single key size, such as the ML-DSA parameter
+// sets.
+type signingScheme struct {
+	keyAlgorithm string
+	keySize      int
+	hash         crypto.Hash
+	pss          bool
+}
+
+var signingSchemes = map[kms.SigningAlgorithm]signingScheme{
+	kms.SigningAlgorithmRSAPKCS1v15SHA256: {keyAlgorithm: models.KMSKeyAlgorithmRSA, hash: crypto.SHA256},
+	kms.SigningAlgorithmRSAPKCS1v15SHA384: {keyAlgorithm: models.KMSKeyAlgorithmRSA, hash: crypto.SHA384},
+	kms.SigningAlgorithmRSAPKCS1v15SHA512: {keyAlgorithm: models.KMSKeyAlgorithmRSA, hash: crypto.SHA512},
+	kms.SigningAlgorithmRSAPSSSHA256:      {keyAlgorithm: models.KMSKeyAlgorithmRSA, hash: crypto.SHA256, pss: true},
+	kms.SigningAlgorithmRSAPSSSHA384:      {keyAlgorithm: models.KMSKeyAlgorithmRSA, hash: crypto.SHA384, pss: true},
+	kms.SigningAlgorithmRSAPSSSHA512:      {keyAlgorithm: models.KMSKeyAlgorithmRSA, hash: crypto.SHA512, pss: true},
+	kms.SigningAlgorithmECDSASHA256:       {keyAlgorithm: models.KMSKeyAlgorithmECDSA, hash: crypto.SHA256},
+	kms.SigningAlgorithmECDSASHA384:       {keyAlgorithm: models.KMSKeyAlgorithmECDSA, hash: crypto.SHA384},
+	kms.SigningAlgorithmECDSASHA512:       {keyAlgorithm: models.KMSKeyAlgorithmECDSA, hash: crypto.SHA512},
+	kms.SigningAlgorithmEd25519:           {keyAlgorithm: models.KMSKeyAlgorithmEd25519},
+	kms.SigningAlgorithmMLDSA44:           {keyAlgorithm: models.KMSKeyAlgorithmMLDSA, keySize: 44},
+	kms.SigningAlgorithmMLDSA65:           {keyAlgorithm: models.KMSKeyAlgorithmMLDSA, keySize: 65},
+	kms.SigningAlgorithmMLDSA87:           {keyAlgorithm: models.KMSKeyAlgorithmMLDSA, keySize: 87},
+}
+
+// resolveSigningAlgorithm returns the signing algorithm to use with the key. When
+// none is requested, RSA keys default to PKCS#1 v1.5 with SHA-256, ECDSA keys to
+// the hash matching the curve size and ML-DSA keys to their parameter set.
+func resolveSigningAlgorithm(kmsKey *models.KMSKey, algorithm kms.SigningAlgorithm) (kms.SigningAlgorithm, signingScheme, error) {
+	if algorithm == "" {
+		switch kmsKey.Algorithm {
+		case models.KMSKeyAlgorithmRSA:
+			algorithm = kms.SigningAlgorithmRSAPKCS1v15SHA256
+		case models.KMSKeyAlgorithmECDSA:
+			switch kmsKey.Size {
+			case 224, 256:
+				algorithm = kms.SigningAlgorithmECDSASHA256
+			case 384:
+				algorithm = kms.SigningAlgorithmECDSASHA384
+			case 521:
+				algorithm = kms.SigningAlgorithmECDSASHA512
+			}
+		case models.KMSKeyAlgorithmEd25519:
+			algorithm = kms.SigningAlgorithmEd25519
+		case models.KMSKeyAlgorithmMLDSA:
+			switch kmsKey.Size {
+			case 44:
+				algorithm = kms.SigningAlgorithmMLDSA44
+			case 65:
+				algorithm = kms.SigningAlgorithmMLDSA65
+			case 87:
+				algorithm = kms.SigningAlgorithmMLDSA87
+			}
+		}
+	}
+
+	scheme, ok := signingSchemes[algorithm]
+	if !ok || scheme.keyAlgorithm != kmsKey.Algorithm || (scheme.keySize != 0 && scheme.keySize != kmsKey.Size) {
+		return "", signingScheme{}, kms.ErrUnsupportedKeyOperation
+	}
+
+	return algorithm, scheme, nil
+}
+
+func (s signingScheme) signerOpts() crypto.SignerOpts {
+	switch {
+	case s.pss:
+		return &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: s.hash}
+	case s.keyAlgorithm == models.KMSKeyAlgorithmMLDSA:
+		return &mldsa.Options{}
+	default:
+		return s.hash
+	}
+}
+
+func (s signingScheme) sign(signer crypto.Signer, digest []byte) ([]byte, error) {
+	return signer.Sign(rand.Reader, digest, s.signerOpts())
+}
+
+// verify checks the signature with the verification primitive of the scheme. A
+// public key of another type never verifies.
+func (s signingScheme) verify(pubKey any, digest, signature []byte) bool {
+	switch s.keyAlgorithm {
+	case models.KMSKeyAlgorithmRSA:
+		pub, ok := pubKey.(*rsa.PublicKey)
+		if !ok {
+			return false
+		}
+
+		if s.pss {
+			return rsa.VerifyPSS(pub, s.hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+
+		return rsa.VerifyPKCS1v15(pub, s.hash, digest, signature) == nil
+	case models.KMSKeyAlgorithmECDSA:
+		pub, ok := pubKey.(*ecdsa.PublicKey)
+		return ok && ecdsa.VerifyASN1(pub, digest, signature)
+	case models.KMSKeyAlgorithmEd25519:
+		pub, ok := pubKey.(ed25519.PublicKey)
+		return ok && ed25519.Verify(pub, digest, signature)
+	case models.KMSKeyAlgorithmMLDSA:
+		pub, ok := pubKey.(*mldsa.PublicKey)
+		return ok && mldsa.Verify(pub, digest, signature, nil) == nil
+	default:
+		return false
+	}
+}
+
+func hashName(hash crypto.Hash) string {
+	switch hash {
+	case 0:
+		return ""
+	case crypto.SHA256:
+		return kms.HashSHA256
+	case crypto.SHA384:
+		return kms.HashSHA384
+	case crypto.SHA512:
+		return kms.HashSHA512
+	default:
+		return hash.String()
+	}
+}
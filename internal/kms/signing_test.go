@@ -0,0 +1,106 @@
+package kms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"filippo.io/mldsa"
+	"github.com/gofiber/fiber/v2"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/cryptoutils"
+)
+
+func TestMLDSASignVerify(t *testing.T) {
+	app, _ := newPolicyTestApp(t)
+	message := []byte("firmware image")
+
+	tests := []struct {
+		size      int
+		params    *mldsa.Parameters
+		algorithm kms.SigningAlgorithm
+	}{
+		{44, mldsa.MLDSA44(), kms.SigningAlgorithmMLDSA44},
+		{65, mldsa.MLDSA65(), kms.SigningAlgorithmMLDSA65},
+		{87, mldsa.MLDSA87(), kms.SigningAlgorithmMLDSA87},
+	}
+	for _, tt := range tests {
+		t.Run(tt.params.String(), func(t *testing.T) {
+			kmsKey := createTestKey(t, app, fmt.Sprintf(`{"alias":%q,"algorithm":%q,"size":%d}`, tt.params, models.KMSKeyAlgorithmMLDSA, tt.size))
+
+			var signed kms.SignResponse
+			status := postTestJSON(t, app, "/v1/kms/"+kmsKey.ID+"/sign", kms.SignRequestBody{Message: message}, &signed)
+			if status != http.StatusOK {
+				t.Fatalf("got status %d signing, want %d", status, http.StatusOK)
+			}
+
+			if signed.Algorithm != tt.algorithm || signed.KeyVersion != 1 || len(signed.Signature) != tt.params.SignatureSize() {
+				t.Errorf("got %s signature of %d bytes with version %d, want %s signature of %d bytes with version 1",
+					signed.Algorithm, len(signed.Signature), signed.KeyVersion, tt.algorithm, tt.params.SignatureSize())
+			}
+
+			// The published public key verifies the signature outside the KMS.
+			pubKey, err := cryptoutils.ParsePublicKey(kmsKey.Versions[0].PublicKey)
+			if err != nil {
+				t.Fatalf("could not parse public key: %s", err)
+			}
+
+			pub, ok := pubKey.(*mldsa.PublicKey)
+			if !ok || pub.Parameters() != tt.params {
+				t.Fatalf("got public key %T, want %s public key", pubKey, tt.params)
+			}
+
+			if err := mldsa.Verify(pub, message, signed.Signature, nil); err != nil {
+				t.Errorf("signature does not verify: %s", err)
+			}
+
+			verifyTests := []struct {
+				name      string
+				message   []byte
+				signature []byte
+				valid     bool
+			}{
+				{"Valid", message, signed.Signature, true},
+				{"OtherMessage", []byte("other image"), signed.Signature, false},
+				{"TamperedSignature", message, append([]byte{signed.Signature[0] ^ 1}, signed.Signature[1:]...), false},
+			}
+			for _, vt := range verifyTests {
+				var verified kms.VerifyResponse
+				status := postTestJSON(t, app, "/v1/kms/"+kmsKey.ID+"/verify", kms.VerifyRequestBody{Message: vt.message, Signature: vt.signature}, &verified)
+				if status != http.StatusOK || verified.Valid != vt.valid {
+					t.Errorf("%s: got status %d and valid %t, want %d and %t", vt.name, status, verified.Valid, http.StatusOK, vt.valid)
+				}
+			}
+
+			// ML-DSA signs the message itself, so digests are refused.
+			status = postTestJSON(t, app, "/v1/kms/"+kmsKey.ID+"/sign", kms.SignRequestBody{Message: message, MessageType: kms.SignMessageTypeDigest}, nil)
+			if status != http.StatusBadRequest {
+				t.Errorf("got status %d signing a digest, want %d", status, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func postTestJSON(t *testing.T, app *fiber.App, path string, body, response any) int {
+	encoded, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(encoded))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	defer res.Body.Close()
+
+	if response != nil && res.StatusCode == http.StatusOK {
+		if err := json.NewDecoder(res.Body).Decode(response); err != nil {
+			t.Fatalf("could not decode response: %s", err)
+		}
+	}
+
+	return res.StatusCode
+}
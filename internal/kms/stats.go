@@ -0,0 +1,97 @@
+package kms
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
+)
+
+func (svc *KMSServiceBackend) CountKMSKeys(ctx context.Context, input kms.CountKMSKeysInput) (int, error) {
+	return svc.kmsStorage.Count(ctx, input.QueryParameters)
+}
+
+func (svc *KMSServiceBackend) GetKMSKeyStats(ctx context.Context, input kms.GetKMSKeyStatsInput) (*kms.KMSKeyStats, error) {
+	queryParams := withFilters(input.QueryParameters, nil, nil)
+
+	total, err := svc.kmsStorage.Count(ctx, queryParams)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &kms.KMSKeyStats{Total: total}
+	for field, counts := range map[string]*map[string]int{
+		"status":    &stats.ByStatus,
+		"algorithm": &stats.ByType,
+		"engine_id": &stats.ByEngine,
+	} {
+		*counts, err = svc.kmsStorage.CountBy(ctx, queryParams, field)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	in30Days := now.AddDate(0, 0, 30)
+	in90Days := now.AddDate(0, 0, 90)
+	for _, bucket := range []struct {
+		count *int
+		query *resources.QueryParameters
+	}{
+		{&stats.ByExpiry.Expired, expiringBetween(input.QueryParameters, time.Time{}, now)},
+		{&stats.ByExpiry.Next30Days, expiringBetween(input.QueryParameters, now, in30Days)},
+		{&stats.ByExpiry.Next90Days, expiringBetween(input.QueryParameters, in30Days, in90Days)},
+		{&stats.ByExpiry.Later, expiringBetween(input.QueryParameters, in90Days, time.Time{})},
+		{&stats.ByExpiry.NoExpiry, withFilters(input.QueryParameters, []resources.FilterOption{
+			{Field: "policy.not_after", FilterOperation: resources.IsNull},
+		}, nil)},
+	} {
+		*bucket.count, err = svc.kmsStorage.Count(ctx, bucket.query)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
+
+// expiringBetween selects the keys of the query whose policy expires from a
+// time, included, until another, excluded. Zero times leave the range open.
+func expiringBetween(queryParams *resources.QueryParameters, from time.Time, until time.Time) *resources.QueryParameters {
+	filters := []resources.FilterOption{}
+	groups := [][]resources.FilterOption{}
+
+	if !from.IsZero() {
+		value := from.Format(time.RFC3339)
+		groups = append(groups, []resources.FilterOption{
+			{Field: "policy.not_after", FilterOperation: resources.DateAfter, Value: value},
+			{Field: "policy.not_after", FilterOperation: resources.DateEqual, Value: value},
+		})
+	}
+
+	if !until.IsZero() {
+		filters = append(filters, resources.FilterOption{
+			Field:           "policy.not_after",
+			FilterOperation: resources.DateBefore,
+			Value:           until.Format(time.RFC3339),
+		})
+	}
+
+	return withFilters(queryParams, filters, groups)
+}
+
+// withFilters returns the filters of the query along with the given ones,
+// without its bookmark, sort and page size.
+func withFilters(queryParams *resources.QueryParameters, filters []resources.FilterOption, groups [][]resources.FilterOption) *resources.QueryParameters {
+	filtered := &resources.QueryParameters{}
+	if queryParams != nil {
+		filtered.Filters = slices.Clone(queryParams.Filters)
+		filtered.FilterGroups = slices.Clone(queryParams.FilterGroups)
+	}
+
+	filtered.Filters = append(filtered.Filters, filters...)
+	filtered.FilterGroups = append(filtered.FilterGroups, groups...)
+	return filtered
+}
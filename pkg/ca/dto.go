@@ -15,3 +15,34 @@ type GetCAsInput struct {
 	ExhaustiveRun bool //wether to iter all elems
 	ApplyFunc     func(ca models.CACertificate)
 }
+
+type CountCAsInput struct {
+	QueryParameters *resources.QueryParameters
+}
+
+type GetCAStatsInput struct {
+	// QueryParameters select the CAs to count. Only filters apply.
+	QueryParameters *resources.QueryParameters
+}
+
+// CAStats count the CAs matching a query.
+type CAStats struct {
+	Total    int            `json:"total"`
+	ByStatus map[string]int `json:"by_status"`
+}
+
+type GetCAByIDInput struct {
+	ID string
+}
+
+type UpdateCAStatusInput struct {
+	ID     string
+	Status models.CAStatus
+	// Revision, when set, is the revision the CA must be at for the update
+	// to apply.
+	Revision *int
+}
+
+type UpdateCAStatusRequestBody struct {
+	Status models.CAStatus `json:"status" validate:"required,oneof=ACTIVE INACTIVE"`
+}
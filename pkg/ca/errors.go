@@ -0,0 +1,8 @@
+package ca
+
+import "errors"
+
+var (
+	ErrCANotFound      = errors.New("ca not found")
+	ErrInvalidCAStatus = errors.New("invalid ca status")
+)
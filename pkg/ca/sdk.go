@@ -4,7 +4,13 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
 )
 
 type CASdkService struct{}
@@ -42,6 +48,163 @@ func (s *CASdkService) CreateCA(ctx context.Context, input CreateCAInput) error
 }
 
 func (s *CASdkService) GetCAs(ctx context.Context, input GetCAsInput) (string, error) {
-	// Implementation for retrieving CAs
-	return "", nil
+	queryParams := input.QueryParameters
+	if queryParams == nil {
+		queryParams = &resources.QueryParameters{}
+	}
+
+	for {
+		r, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:8090/v1/ca?"+resources.EncodeQuery(queryParams).Encode(), nil)
+		if err != nil {
+			return "", err
+		}
+
+		res, err := http.DefaultClient.Do(r)
+		if err != nil {
+			return "", err
+		}
+
+		var page resources.IterableList[models.CACertificate]
+		err = decodeResponse(res, &page)
+		if err != nil {
+			return "", err
+		}
+
+		if input.ApplyFunc != nil {
+			for _, ca := range page.List {
+				input.ApplyFunc(ca)
+			}
+		}
+
+		if !input.ExhaustiveRun || page.NextBookmark == "" {
+			return page.NextBookmark, nil
+		}
+
+		next := *queryParams
+		next.NextBookmark = page.NextBookmark
+		queryParams = &next
+	}
+}
+
+func (s *CASdkService) CountCAs(ctx context.Context, input CountCAsInput) (int, error) {
+	queryParams := resources.QueryParameters{}
+	if input.QueryParameters != nil {
+		queryParams = *input.QueryParameters
+	}
+	queryParams.IncludeTotal = true
+	queryParams.PageSize = 1
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:8090/v1/ca?"+resources.EncodeQuery(&queryParams).Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return 0, err
+	}
+
+	var page resources.IterableList[models.CACertificate]
+	err = decodeResponse(res, &page)
+	if err != nil {
+		return 0, err
+	}
+
+	if page.Total == nil {
+		return 0, fmt.Errorf("response has no total")
+	}
+
+	return *page.Total, nil
+}
+
+func (s *CASdkService) GetCAStats(ctx context.Context, input GetCAStatsInput) (*CAStats, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:8090/v1/ca/stats?"+resources.EncodeQuery(input.QueryParameters).Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var stats CAStats
+	err = decodeResponse(res, &stats)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+func (s *CASdkService) GetCAByID(ctx context.Context, input GetCAByIDInput) (*models.CACertificate, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:8090/v1/ca/"+url.PathEscape(input.ID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var caCert models.CACertificate
+	err = decodeResponse(res, &caCert)
+	if err != nil {
+		return nil, err
+	}
+
+	return &caCert, nil
+}
+
+func (s *CASdkService) UpdateCAStatus(ctx context.Context, input UpdateCAStatusInput) (*models.CACertificate, error) {
+	jsonBody, err := json.Marshal(UpdateCAStatusRequestBody{
+		Status: input.Status,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPut, "http://localhost:8090/v1/ca/"+url.PathEscape(input.ID)+"/status", bytes.NewReader(jsonBody))
+	if err != nil {
+		return nil, err
+	}
+
+	r.Header.Set("Content-Type", "application/json")
+	if input.Revision != nil {
+		r.Header.Set("If-Match", resources.ETag(*input.Revision))
+	}
+
+	res, err := http.DefaultClient.Do(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusPreconditionFailed && input.Revision != nil {
+		res.Body.Close()
+		return nil, &resources.ConflictError{ID: input.ID, Revision: *input.Revision}
+	}
+
+	var caCert models.CACertificate
+	err = decodeResponse(res, &caCert)
+	if err != nil {
+		return nil, err
+	}
+
+	return &caCert, nil
+}
+
+func decodeResponse(res *http.Response, out any) error {
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("unexpected status code %d: %s", res.StatusCode, string(body))
+	}
+
+	return json.Unmarshal(body, out)
 }
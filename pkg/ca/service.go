@@ -2,9 +2,15 @@ package ca
 
 import (
 	"context"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
 )
 
 type CAService interface {
 	CreateCA(ctx context.Context, input CreateCAInput) error
 	GetCAs(ctx context.Context, input GetCAsInput) (string, error)
+	CountCAs(ctx context.Context, input CountCAsInput) (int, error)
+	GetCAStats(ctx context.Context, input GetCAStatsInput) (*CAStats, error)
+	GetCAByID(ctx context.Context, input GetCAByIDInput) (*models.CACertificate, error)
+	UpdateCAStatus(ctx context.Context, input UpdateCAStatusInput) (*models.CACertificate, error)
 }
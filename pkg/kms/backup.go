@@ -0,0 +1,110 @@
+package kms
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	BackupArchiveFormat  = "lamassu-kms-backup"
+	BackupArchiveVersion = 1
+)
+
+type BackupProtectionMode string
+
+const (
+	// BackupProtectionPassphrase derives the archive key from a passphrase with scrypt.
+	BackupProtectionPassphrase BackupProtectionMode = "passphrase"
+	// BackupProtectionRecipient wraps the archive key for a recipient public key,
+	// with RSA-OAEP or ECIES.
+	BackupProtectionRecipient BackupProtectionMode = "recipient"
+)
+
+// BackupArchive is a self-contained backup of the KMS. Key metadata is stored in
+// clear, while the private key material of exportable keys is encrypted with
+// AES-256-GCM under the archive key, using the metadata as additional data so
+// that neither can be altered without the archive failing to open.
+type BackupArchive struct {
+	Format     string           `json:"format"`
+	Version    int              `json:"version"`
+	CreationTS time.Time        `json:"creation_ts"`
+	Keys       json.RawMessage  `json:"keys"`
+	Protection BackupProtection `json:"protection"`
+	Material   []byte           `json:"material"`
+	// Checksum is the hex SHA-256 of the archive with an empty checksum. It
+	// detects corruption without requiring the archive secret.
+	Checksum string `json:"checksum"`
+}
+
+type BackupProtection struct {
+	Mode BackupProtectionMode `json:"mode"`
+	// Scrypt parameters, for passphrase protected archives.
+	Salt []byte `json:"salt,omitempty"`
+	N    int    `json:"n,omitempty"`
+	R    int    `json:"r,omitempty"`
+	P    int    `json:"p,omitempty"`
+	// WrappedKey is the archive key encrypted for the recipient, identified by
+	// the SHA-256 hex digest of its public key.
+	WrappedKey           []byte `json:"wrapped_key,omitempty"`
+	RecipientFingerprint string `json:"recipient_fingerprint,omitempty"`
+}
+
+// BackupKeyMaterial is the private key of a key version, as a PKCS#8 PEM, or
+// the secret of AES and HMAC keys, as a SYMMETRIC KEY PEM.
+type BackupKeyMaterial struct {
+	KeyID      string `json:"key_id"`
+	Version    int    `json:"version"`
+	PrivateKey string `json:"private_key"`
+}
+
+// BackupSecret protects a backup archive. Passphrase is used for passphrase
+// protected archives, RecipientPublicKey (PEM) to create recipient protected
+// archives and RecipientPrivateKey (PEM) to open them.
+type BackupSecret struct {
+	Passphrase          []byte
+	RecipientPublicKey  string
+	RecipientPrivateKey []byte
+}
+
+type BackupReport struct {
+	Keys int `json:"keys"`
+	// ExportedVersions is the number of key versions whose material was exported.
+	ExportedVersions int `json:"exported_versions"`
+	// MetadataOnly are the key versions whose engine does not allow exporting
+	// material. Restoring them requires the engine to still hold the material.
+	MetadataOnly []KeyVersionReference `json:"metadata_only"`
+	// ExportNotAllowed are the key versions whose material was left out because
+	// the policy of their key does not allow exporting it. Like MetadataOnly,
+	// restoring them requires the engine to still hold the material.
+	ExportNotAllowed []KeyVersionReference `json:"export_not_allowed"`
+}
+
+type RestoreConflictReason string
+
+const (
+	RestoreConflictKeyExists        RestoreConflictReason = "KEY_EXISTS"
+	RestoreConflictEngineNotFound   RestoreConflictReason = "ENGINE_NOT_FOUND"
+	RestoreConflictMaterialMismatch RestoreConflictReason = "MATERIAL_MISMATCH"
+)
+
+type RestoreConflict struct {
+	KeyID  string                `json:"key_id"`
+	Alias  string                `json:"alias"`
+	Reason RestoreConflictReason `json:"reason"`
+}
+
+type RestoreInput struct {
+	Secret BackupSecret
+	// DryRun checks the archive and reports what would be restored, without
+	// modifying the database or the crypto engines.
+	DryRun bool
+}
+
+type RestoreReport struct {
+	DryRun    bool              `json:"dry_run"`
+	Restored  []string          `json:"restored"`
+	Conflicts []RestoreConflict `json:"conflicts"`
+	// MissingMaterial are restored key versions whose material is neither in the
+	// archive nor in their crypto engine.
+	MissingMaterial []KeyVersionReference `json:"missing_material"`
+}
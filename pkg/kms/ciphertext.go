@@ -0,0 +1,55 @@
+package kms
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	ciphertextPrefix        = "lmsk"
+	ciphertextFormatVersion = "v1"
+)
+
+// Ciphertext is the self-describing output of an encryption operation. It is
+// serialized as "lmsk:v1:<key id>:<key version>:<base64url data>" so that the
+// key used to produce it can be resolved on decryption.
+type Ciphertext struct {
+	KeyID      string
+	KeyVersion int
+	Data       []byte
+}
+
+// Header returns the serialized prefix of the ciphertext. It is bound to the
+// encrypted data as additional authenticated data.
+func (c Ciphertext) Header() string {
+	return fmt.Sprintf("%s:%s:%s:%d:", ciphertextPrefix, ciphertextFormatVersion, c.KeyID, c.KeyVersion)
+}
+
+func (c Ciphertext) String() string {
+	return c.Header() + base64.RawURLEncoding.EncodeToString(c.Data)
+}
+
+func ParseCiphertext(ciphertext string) (*Ciphertext, error) {
+	parts := strings.Split(ciphertext, ":")
+	if len(parts) != 5 || parts[0] != ciphertextPrefix || parts[1] != ciphertextFormatVersion {
+		return nil, ErrInvalidCiphertext
+	}
+
+	keyVersion, err := strconv.Atoi(parts[3])
+	if err != nil || keyVersion <= 0 {
+		return nil, ErrInvalidCiphertext
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(parts[4])
+	if err != nil {
+		return nil, ErrInvalidCiphertext
+	}
+
+	return &Ciphertext{
+		KeyID:      parts[2],
+		KeyVersion: keyVersion,
+		Data:       data,
+	}, nil
+}
@@ -0,0 +1,258 @@
+package cryptoengines
+
+import (
+	"container/list"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"filippo.io/mldsa"
+)
+
+const (
+	defaultCacheMaxEntries = 1024
+	defaultCacheTTL        = 5 * time.Minute
+)
+
+type CryptoEngineCacheConfig struct {
+	Enabled    bool          `mapstructure:"enabled"`
+	MaxEntries int           `mapstructure:"max_entries"`
+	TTL        time.Duration `mapstructure:"ttl"`
+}
+
+type CryptoEngineCacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+	Entries   int    `json:"entries"`
+}
+
+type cachedSigner struct {
+	keyID     string
+	signer    crypto.Signer
+	expiresAt time.Time
+}
+
+// CachedCryptoEngine decorates a CryptoEngine keeping the parsed signers in a
+// bounded LRU cache so that repeated signatures do not hit the backing store.
+type CachedCryptoEngine struct {
+	CryptoEngine
+
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List
+	maxEntries int
+	ttl        time.Duration
+	// generation is incremented by every invalidation. Signers fetched across
+	// an invalidation are not cached, as they may belong to the dropped keys.
+	generation uint64
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+}
+
+func NewCachedCryptoEngine(engine CryptoEngine, conf CryptoEngineCacheConfig) *CachedCryptoEngine {
+	maxEntries := conf.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheMaxEntries
+	}
+
+	ttl := conf.TTL
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+
+	return &CachedCryptoEngine{
+		CryptoEngine: engine,
+		entries:      map[string]*list.Element{},
+		lru:          list.New(),
+		maxEntries:   maxEntries,
+		ttl:          ttl,
+	}
+}
+
+func (engine *CachedCryptoEngine) GetPrivateKeyByID(ctx context.Context, keyID string) (crypto.Signer, error) {
+	if signer, ok := engine.get(keyID); ok {
+		engine.hits.Add(1)
+		return signer, nil
+	}
+
+	engine.misses.Add(1)
+	generation := engine.currentGeneration()
+	signer, err := engine.CryptoEngine.GetPrivateKeyByID(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	engine.putIfGeneration(keyID, signer, generation)
+	return signer, nil
+}
+
+// GetEngineConfig reports the statistics of the cache along with the
+// configuration of the decorated engine.
+func (engine *CachedCryptoEngine) GetEngineConfig(ctx context.Context) CryptoEngineInfo {
+	info := engine.CryptoEngine.GetEngineConfig(ctx)
+	stats := engine.Stats()
+	info.Cache = &stats
+	return info
+}
+
+func (engine *CachedCryptoEngine) CreateRSAPrivateKey(ctx context.Context, keySize int) (string, crypto.Signer, error) {
+	return engine.store(engine.CryptoEngine.CreateRSAPrivateKey(ctx, keySize))
+}
+
+func (engine *CachedCryptoEngine) CreateECDSAPrivateKey(ctx context.Context, curve elliptic.Curve) (string, crypto.Signer, error) {
+	return engine.store(engine.CryptoEngine.CreateECDSAPrivateKey(ctx, curve))
+}
+
+func (engine *CachedCryptoEngine) CreateEd25519PrivateKey(ctx context.Context) (string, crypto.Signer, error) {
+	return engine.store(engine.CryptoEngine.CreateEd25519PrivateKey(ctx))
+}
+
+func (engine *CachedCryptoEngine) CreateMLDSAPrivateKey(ctx context.Context, params *mldsa.Parameters) (string, crypto.Signer, error) {
+	return engine.store(engine.CryptoEngine.CreateMLDSAPrivateKey(ctx, params))
+}
+
+func (engine *CachedCryptoEngine) ImportRSAPrivateKey(ctx context.Context, key *rsa.PrivateKey) (string, crypto.Signer, error) {
+	return engine.store(engine.CryptoEngine.ImportRSAPrivateKey(ctx, key))
+}
+
+func (engine *CachedCryptoEngine) ImportECDSAPrivateKey(ctx context.Context, key *ecdsa.PrivateKey) (string, crypto.Signer, error) {
+	return engine.store(engine.CryptoEngine.ImportECDSAPrivateKey(ctx, key))
+}
+
+func (engine *CachedCryptoEngine) ImportEd25519PrivateKey(ctx context.Context, key ed25519.PrivateKey) (string, crypto.Signer, error) {
+	return engine.store(engine.CryptoEngine.ImportEd25519PrivateKey(ctx, key))
+}
+
+// DeleteKey invalidates the key before and after deleting it, so that it is
+// not cached again by reads racing with the deletion.
+func (engine *CachedCryptoEngine) DeleteKey(ctx context.Context, keyID string) error {
+	engine.Invalidate(keyID)
+	defer engine.Invalidate(keyID)
+	return engine.CryptoEngine.DeleteKey(ctx, keyID)
+}
+
+func (engine *CachedCryptoEngine) RenameKey(ctx context.Context, oldID, newID string) error {
+	engine.Invalidate(oldID, newID)
+	defer engine.Invalidate(oldID, newID)
+	return engine.CryptoEngine.RenameKey(ctx, oldID, newID)
+}
+
+// Invalidate drops the given key IDs from the cache, along with the signers
+// being fetched.
+func (engine *CachedCryptoEngine) Invalidate(keyIDs ...string) {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	engine.generation++
+	for _, keyID := range keyIDs {
+		if elem, ok := engine.entries[keyID]; ok {
+			engine.removeElement(elem)
+		}
+	}
+}
+
+func (engine *CachedCryptoEngine) Stats() CryptoEngineCacheStats {
+	engine.mu.Lock()
+	entries := engine.lru.Len()
+	engine.mu.Unlock()
+
+	return CryptoEngineCacheStats{
+		Hits:      engine.hits.Load(),
+		Misses:    engine.misses.Load(),
+		Evictions: engine.evictions.Load(),
+		Entries:   entries,
+	}
+}
+
+func (engine *CachedCryptoEngine) store(keyID string, signer crypto.Signer, err error) (string, crypto.Signer, error) {
+	if err != nil {
+		return "", nil, err
+	}
+
+	engine.put(keyID, signer)
+	return keyID, signer, nil
+}
+
+func (engine *CachedCryptoEngine) get(keyID string) (crypto.Signer, bool) {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	elem, ok := engine.entries[keyID]
+	if !ok {
+		return nil, false
+	}
+
+	entry := elem.Value.(*cachedSigner)
+	if time.Now().After(entry.expiresAt) {
+		engine.removeElement(elem)
+		return nil, false
+	}
+
+	engine.lru.MoveToFront(elem)
+	return entry.signer, true
+}
+
+func (engine *CachedCryptoEngine) currentGeneration() uint64 {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	return engine.generation
+}
+
+// putIfGeneration caches a signer unless the cache was invalidated since the
+// given generation.
+func (engine *CachedCryptoEngine) putIfGeneration(keyID string, signer crypto.Signer, generation uint64) {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	if engine.generation != generation {
+		return
+	}
+
+	engine.add(keyID, signer)
+}
+
+func (engine *CachedCryptoEngine) put(keyID string, signer crypto.Signer) {
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+
+	engine.add(keyID, signer)
+}
+
+// add caches a signer, evicting the least recently used ones beyond the
+// maximum number of entries. The lock must be held.
+func (engine *CachedCryptoEngine) add(keyID string, signer crypto.Signer) {
+	expiresAt := time.Now().Add(engine.ttl)
+	if elem, ok := engine.entries[keyID]; ok {
+		entry := elem.Value.(*cachedSigner)
+		entry.signer = signer
+		entry.expiresAt = expiresAt
+		engine.lru.MoveToFront(elem)
+		return
+	}
+
+	engine.entries[keyID] = engine.lru.PushFront(&cachedSigner{
+		keyID:     keyID,
+		signer:    signer,
+		expiresAt: expiresAt,
+	})
+
+	for engine.lru.Len() > engine.maxEntries {
+		engine.removeElement(engine.lru.Back())
+		engine.evictions.Add(1)
+	}
+}
+
+func (engine *CachedCryptoEngine) removeElement(elem *list.Element) {
+	engine.lru.Remove(elem)
+	delete(engine.entries, elem.Value.(*cachedSigner).keyID)
+}
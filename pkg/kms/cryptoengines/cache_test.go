@@ -0,0 +1,240 @@
+package cryptoengines
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+)
+
+// countingEngine serves in-memory ECDSA keys and counts how many times each
+// one is read. Operations not used by the cache tests are left unimplemented.
+type countingEngine struct {
+	CryptoEngine
+
+	keys  map[string]crypto.Signer
+	reads map[string]int
+	// onRead runs in the middle of every read, after the key is looked up.
+	onRead func(keyID string)
+}
+
+func newCountingEngine(keyIDs ...string) *countingEngine {
+	engine := &countingEngine{
+		keys:  map[string]crypto.Signer{},
+		reads: map[string]int{},
+	}
+
+	for _, keyID := range keyIDs {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		engine.keys[keyID] = key
+	}
+
+	return engine
+}
+
+func (engine *countingEngine) GetEngineConfig(ctx context.Context) CryptoEngineInfo {
+	return CryptoEngineInfo{Type: Filesystem}
+}
+
+func (engine *countingEngine) GetPrivateKeyByID(ctx context.Context, keyID string) (crypto.Signer, error) {
+	engine.reads[keyID]++
+	signer, ok := engine.keys[keyID]
+	if engine.onRead != nil {
+		engine.onRead(keyID)
+	}
+
+	if !ok {
+		return nil, errors.New("key not found")
+	}
+
+	return signer, nil
+}
+
+func (engine *countingEngine) CreateEd25519PrivateKey(ctx context.Context) (string, crypto.Signer, error) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	keyID := "created"
+	engine.keys[keyID] = key
+	return keyID, key, nil
+}
+
+func (engine *countingEngine) DeleteKey(ctx context.Context, keyID string) error {
+	delete(engine.keys, keyID)
+	return nil
+}
+
+func (engine *countingEngine) RenameKey(ctx context.Context, oldID, newID string) error {
+	engine.keys[newID] = engine.keys[oldID]
+	delete(engine.keys, oldID)
+	return nil
+}
+
+func TestCachedCryptoEngineHits(t *testing.T) {
+	ctx := context.Background()
+	backend := newCountingEngine("a")
+	engine := NewCachedCryptoEngine(backend, CryptoEngineCacheConfig{Enabled: true})
+
+	first, err := engine.GetPrivateKeyByID(ctx, "a")
+	if err != nil {
+		t.Fatalf("could not get key: %s", err)
+	}
+
+	second, err := engine.GetPrivateKeyByID(ctx, "a")
+	if err != nil {
+		t.Fatalf("could not get key: %s", err)
+	}
+
+	if first != second || backend.reads["a"] != 1 {
+		t.Errorf("got %d reads of the backing engine, want 1", backend.reads["a"])
+	}
+
+	stats := engine.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	info := engine.GetEngineConfig(ctx)
+	if info.Cache == nil || *info.Cache != stats {
+		t.Errorf("engine info reports cache stats %+v, want %+v", info.Cache, stats)
+	}
+}
+
+func TestCachedCryptoEngineDoesNotCacheErrors(t *testing.T) {
+	ctx := context.Background()
+	backend := newCountingEngine()
+	engine := NewCachedCryptoEngine(backend, CryptoEngineCacheConfig{Enabled: true})
+
+	for range 2 {
+		if _, err := engine.GetPrivateKeyByID(ctx, "missing"); err == nil {
+			t.Fatalf("missing key was returned")
+		}
+	}
+
+	if backend.reads["missing"] != 2 || engine.Stats().Entries != 0 {
+		t.Errorf("failed read was cached")
+	}
+}
+
+func TestCachedCryptoEngineTTL(t *testing.T) {
+	ctx := context.Background()
+	backend := newCountingEngine("a")
+	engine := NewCachedCryptoEngine(backend, CryptoEngineCacheConfig{Enabled: true, TTL: 20 * time.Millisecond})
+
+	engine.GetPrivateKeyByID(ctx, "a")
+	engine.GetPrivateKeyByID(ctx, "a")
+	if backend.reads["a"] != 1 {
+		t.Fatalf("got %d reads before the TTL, want 1", backend.reads["a"])
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	engine.GetPrivateKeyByID(ctx, "a")
+	if backend.reads["a"] != 2 {
+		t.Errorf("got %d reads after the TTL, want 2", backend.reads["a"])
+	}
+}
+
+func TestCachedCryptoEngineLRUEviction(t *testing.T) {
+	ctx := context.Background()
+	backend := newCountingEngine("a", "b", "c")
+	engine := NewCachedCryptoEngine(backend, CryptoEngineCacheConfig{Enabled: true, MaxEntries: 2})
+
+	engine.GetPrivateKeyByID(ctx, "a")
+	engine.GetPrivateKeyByID(ctx, "b")
+	// Using a makes b the least recently used entry.
+	engine.GetPrivateKeyByID(ctx, "a")
+	engine.GetPrivateKeyByID(ctx, "c")
+
+	stats := engine.Stats()
+	if stats.Entries != 2 || stats.Evictions != 1 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	engine.GetPrivateKeyByID(ctx, "a")
+	engine.GetPrivateKeyByID(ctx, "c")
+	if backend.reads["a"] != 1 || backend.reads["c"] != 1 {
+		t.Errorf("recently used keys were evicted: %v", backend.reads)
+	}
+
+	engine.GetPrivateKeyByID(ctx, "b")
+	if backend.reads["b"] != 2 {
+		t.Errorf("least recently used key was not evicted: %v", backend.reads)
+	}
+}
+
+func TestCachedCryptoEngineCachesCreatedKeys(t *testing.T) {
+	ctx := context.Background()
+	backend := newCountingEngine()
+	engine := NewCachedCryptoEngine(backend, CryptoEngineCacheConfig{Enabled: true})
+
+	keyID, created, err := engine.CreateEd25519PrivateKey(ctx)
+	if err != nil {
+		t.Fatalf("could not create key: %s", err)
+	}
+
+	signer, _ := engine.GetPrivateKeyByID(ctx, keyID)
+	if signer != created || backend.reads[keyID] != 0 {
+		t.Errorf("created key was read from the backing engine")
+	}
+}
+
+func TestCachedCryptoEngineInvalidation(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("DeleteKey", func(t *testing.T) {
+		backend := newCountingEngine("a")
+		engine := NewCachedCryptoEngine(backend, CryptoEngineCacheConfig{Enabled: true})
+
+		engine.GetPrivateKeyByID(ctx, "a")
+		if err := engine.DeleteKey(ctx, "a"); err != nil {
+			t.Fatalf("could not delete key: %s", err)
+		}
+
+		if _, err := engine.GetPrivateKeyByID(ctx, "a"); err == nil {
+			t.Errorf("deleted key was served from the cache")
+		}
+	})
+
+	t.Run("RenameKey", func(t *testing.T) {
+		backend := newCountingEngine("old", "new")
+		engine := NewCachedCryptoEngine(backend, CryptoEngineCacheConfig{Enabled: true})
+
+		renamed, _ := engine.GetPrivateKeyByID(ctx, "old")
+		engine.GetPrivateKeyByID(ctx, "new")
+		if err := engine.RenameKey(ctx, "old", "new"); err != nil {
+			t.Fatalf("could not rename key: %s", err)
+		}
+
+		if _, err := engine.GetPrivateKeyByID(ctx, "old"); err == nil {
+			t.Errorf("renamed key was served from the cache under its old ID")
+		}
+
+		signer, err := engine.GetPrivateKeyByID(ctx, "new")
+		if err != nil || signer != renamed {
+			t.Errorf("stale key was served from the cache under the new ID")
+		}
+	})
+
+	t.Run("DuringRead", func(t *testing.T) {
+		backend := newCountingEngine("a")
+		engine := NewCachedCryptoEngine(backend, CryptoEngineCacheConfig{Enabled: true})
+
+		// The key is deleted while it is being read, so the signer read must
+		// not be cached.
+		backend.onRead = func(keyID string) {
+			backend.onRead = nil
+			engine.DeleteKey(ctx, keyID)
+		}
+
+		if _, err := engine.GetPrivateKeyByID(ctx, "a"); err != nil {
+			t.Fatalf("could not get key: %s", err)
+		}
+
+		if _, err := engine.GetPrivateKeyByID(ctx, "a"); err == nil {
+			t.Errorf("key deleted during a read was cached")
+		}
+	})
+}
@@ -10,19 +10,22 @@ const (
 	AWSSecretsManagerProvider CryptoEngineProvider = "aws_secrets_manager"
 	FilesystemProvider        CryptoEngineProvider = "filesystem"
 	PKCS11Provider            CryptoEngineProvider = "pkcs11"
+	EnvelopeProvider          CryptoEngineProvider = "envelope"
 )
 
 type CryptoEngineConfig struct {
-	ID       string                 `mapstructure:"id"`
-	Metadata map[string]interface{} `mapstructure:"metadata"`
-	Type     CryptoEngineProvider   `mapstructure:"type"`
-	Config   map[string]interface{} `mapstructure:",remain"`
+	ID       string                  `mapstructure:"id"`
+	Metadata map[string]interface{}  `mapstructure:"metadata"`
+	Type     CryptoEngineProvider    `mapstructure:"type"`
+	Cache    CryptoEngineCacheConfig `mapstructure:"cache"`
+	Config   map[string]interface{}  `mapstructure:",remain"`
 }
 
 type CryptoEngineConfigAdapter[E any] struct {
 	ID       string
 	Metadata map[string]interface{}
 	Type     CryptoEngineProvider
+	Cache    CryptoEngineCacheConfig
 	Config   E
 }
 
@@ -35,6 +38,7 @@ func (c CryptoEngineConfigAdapter[E]) Marshal(ce CryptoEngineConfig) (*CryptoEng
 		ID:       ce.ID,
 		Metadata: ce.Metadata,
 		Type:     ce.Type,
+		Cache:    ce.Cache,
 		Config:   config,
 	}, nil
 }
@@ -50,6 +54,7 @@ func (c CryptoEngineConfigAdapter[E]) Unmarshal() (*CryptoEngineConfig, error) {
 		ID:       c.ID,
 		Metadata: c.Metadata,
 		Type:     c.Type,
+		Cache:    c.Cache,
 		Config:   config,
 	}, nil
 }
@@ -0,0 +1,65 @@
+package cryptoengines
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"fmt"
+	"testing"
+)
+
+func TestECIESRoundTrip(t *testing.T) {
+	plaintext := []byte("data encryption key")
+	aad := []byte("lmsk:v1:key:1:")
+
+	for _, curve := range []ecdh.Curve{ecdh.P256(), ecdh.X25519()} {
+		t.Run(fmt.Sprint(curve), func(t *testing.T) {
+			key, err := curve.GenerateKey(rand.Reader)
+			if err != nil {
+				t.Fatalf("could not generate key: %s", err)
+			}
+			decrypter := NewECIESDecrypter(key)
+
+			ciphertext, err := EncryptECIES(key.PublicKey(), plaintext, aad)
+			if err != nil {
+				t.Fatalf("could not encrypt: %s", err)
+			}
+
+			decrypted, err := decrypter.Decrypt(rand.Reader, ciphertext, &ECIESDecrypterOpts{AAD: aad})
+			if err != nil {
+				t.Fatalf("could not decrypt: %s", err)
+			}
+			if !bytes.Equal(decrypted, plaintext) {
+				t.Errorf("got plaintext %q, want %q", decrypted, plaintext)
+			}
+
+			again, _ := EncryptECIES(key.PublicKey(), plaintext, aad)
+			if bytes.Equal(again, ciphertext) {
+				t.Errorf("encrypting twice produced the same ciphertext")
+			}
+
+			if _, err := decrypter.Decrypt(rand.Reader, ciphertext, &ECIESDecrypterOpts{AAD: []byte("other")}); err == nil {
+				t.Errorf("ciphertext decrypted with another AAD")
+			}
+
+			if _, err := decrypter.Decrypt(rand.Reader, ciphertext, nil); err == nil {
+				t.Errorf("ciphertext decrypted without its AAD")
+			}
+
+			tampered := bytes.Clone(ciphertext)
+			tampered[len(tampered)-1] ^= 1
+			if _, err := decrypter.Decrypt(rand.Reader, tampered, &ECIESDecrypterOpts{AAD: aad}); err == nil {
+				t.Errorf("tampered ciphertext decrypted")
+			}
+
+			if _, err := decrypter.Decrypt(rand.Reader, ciphertext[:8], &ECIESDecrypterOpts{AAD: aad}); err == nil {
+				t.Errorf("truncated ciphertext decrypted")
+			}
+
+			otherKey, _ := curve.GenerateKey(rand.Reader)
+			if _, err := NewECIESDecrypter(otherKey).Decrypt(rand.Reader, ciphertext, &ECIESDecrypterOpts{AAD: aad}); err == nil {
+				t.Errorf("ciphertext decrypted with another key")
+			}
+		})
+	}
+}
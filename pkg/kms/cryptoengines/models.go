@@ -7,6 +7,11 @@ type CryptoEngineInfo struct {
 	Name              string                 `json:"name"`
 	Metadata          map[string]any         `json:"metadata"`
 	SupportedKeyTypes []SupportedKeyTypeInfo `json:"supported_key_types"`
+	// PostQuantum reports whether the engine can create post-quantum keys.
+	// Engines that cannot return ErrOperationNotSupported from CreateMLDSAPrivateKey.
+	PostQuantum bool `json:"post_quantum"`
+	// Cache reports the hits and misses of the signer cache, when enabled.
+	Cache *CryptoEngineCacheStats `json:"cache,omitempty"`
 }
 
 type CryptoEngineSL int
@@ -17,9 +22,12 @@ const (
 	SL2 CryptoEngineSL = 2
 )
 
+// SupportedKeyTypeInfo lists the sizes supported for a key type. ML-DSA sizes are
+// the parameter set identifiers: 44, 65 and 87.
 type SupportedKeyTypeInfo struct {
-	Type  string `json:"type"`
-	Sizes []int  `json:"sizes"`
+	Type        string `json:"type"`
+	Sizes       []int  `json:"sizes"`
+	PostQuantum bool   `json:"post_quantum"`
 }
 
 type CryptoEngineType string
@@ -31,4 +39,5 @@ const (
 	AWSKMS            CryptoEngineType = "AWS_KMS"
 	AWSSecretsManager CryptoEngineType = "AWS_SECRETS_MANAGER"
 	Filesystem        CryptoEngineType = "FILESYSTEM"
+	Envelope          CryptoEngineType = "ENVELOPE"
 )
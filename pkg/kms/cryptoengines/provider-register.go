@@ -1,6 +1,10 @@
 package cryptoengines
 
-import "github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
+import (
+	"fmt"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
+)
 
 var cryptoEngineBuilders = make(map[CryptoEngineProvider]func(*logger.Logger, CryptoEngineConfig) (CryptoEngine, error))
 
@@ -11,3 +15,24 @@ func RegisterProvider(name CryptoEngineProvider, builder func(*logger.Logger, Cr
 func GetProvider(name CryptoEngineProvider) func(*logger.Logger, CryptoEngineConfig) (CryptoEngine, error) {
 	return cryptoEngineBuilders[name]
 }
+
+// BuildCryptoEngine builds the engine with its registered provider, wrapping it
+// with a signer cache when enabled in the engine config.
+func BuildCryptoEngine(logger *logger.Logger, conf CryptoEngineConfig) (CryptoEngine, error) {
+	builder := GetProvider(conf.Type)
+	if builder == nil {
+		return nil, fmt.Errorf("crypto engine provider %s not registered", conf.Type)
+	}
+
+	engine, err := builder(logger, conf)
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.Cache.Enabled {
+		logger.Debugf("enabling signer cache for crypto engine %s", conf.ID)
+		return NewCachedCryptoEngine(engine, conf.Cache), nil
+	}
+
+	return engine, nil
+}
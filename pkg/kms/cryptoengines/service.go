@@ -3,24 +3,48 @@ package cryptoengines
 import (
 	"context"
 	"crypto"
+	"crypto/ecdh"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rsa"
+	"errors"
+
+	"filippo.io/mldsa"
 )
 
+var ErrOperationNotSupported = errors.New("operation not supported by crypto engine")
+
 type CryptoEngine interface {
 	GetEngineConfig(context.Context) CryptoEngineInfo
 
 	ListPrivateKeyIDs(context.Context) ([]string, error)
 	GetPrivateKeyByID(context.Context, string) (crypto.Signer, error)
+	GetDecrypterByID(context.Context, string) (crypto.Decrypter, error)
 
 	CreateRSAPrivateKey(context.Context, int) (string, crypto.Signer, error)
 	CreateECDSAPrivateKey(context.Context, elliptic.Curve) (string, crypto.Signer, error)
+	CreateEd25519PrivateKey(context.Context) (string, crypto.Signer, error)
+	CreateX25519PrivateKey(context.Context) (string, *ecdh.PublicKey, error)
+	CreateMLDSAPrivateKey(context.Context, *mldsa.Parameters) (string, crypto.Signer, error)
 
 	ImportRSAPrivateKey(ctx context.Context, key *rsa.PrivateKey) (string, crypto.Signer, error)
 	ImportECDSAPrivateKey(ctx context.Context, key *ecdsa.PrivateKey) (string, crypto.Signer, error)
+	ImportEd25519PrivateKey(ctx context.Context, key ed25519.PrivateKey) (string, crypto.Signer, error)
 
 	DeleteKey(ctx context.Context, keyID string) error
 
 	RenameKey(ctx context.Context, oldID, newID string) error
+
+	CreateAESKey(ctx context.Context, keySize int) (string, error)
+	CreateHMACKey(ctx context.Context, keySize int) (string, error)
+	ImportAESKey(ctx context.Context, key []byte) (string, error)
+	ImportHMACKey(ctx context.Context, key []byte) (string, error)
+	// GetSymmetricKeyByID returns the secret of an AES or HMAC key, for engines
+	// that hand out their material.
+	GetSymmetricKeyByID(ctx context.Context, keyID string) ([]byte, error)
+
+	EncryptAESGCM(ctx context.Context, keyID string, plaintext, aad []byte) ([]byte, error)
+	DecryptAESGCM(ctx context.Context, keyID string, ciphertext, aad []byte) ([]byte, error)
+	ComputeHMAC(ctx context.Context, keyID string, hash crypto.Hash, message []byte) ([]byte, error)
 }
@@ -0,0 +1,241 @@
+package cryptoengines
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const keySharePEMType = "LAMASSU KEY SHARE"
+
+var ErrInvalidKeyShares = errors.New("invalid key shares")
+
+// gf256Exp and gf256Log are the exponential and logarithm tables of GF(2^8)
+// with the AES reduction polynomial, using 3 as generator.
+var gf256Exp, gf256Log = func() ([256]byte, [256]byte) {
+	var exp, log [256]byte
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		exp[i] = x
+		log[x] = byte(i)
+
+		// x *= 3
+		doubled := x << 1
+		if x&0x80 != 0 {
+			doubled ^= 0x1b
+		}
+		x ^= doubled
+	}
+	exp[255] = exp[0]
+
+	return exp, log
+}()
+
+func gf256Mul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+
+	return gf256Exp[(int(gf256Log[a])+int(gf256Log[b]))%255]
+}
+
+func gf256Div(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+
+	return gf256Exp[(int(gf256Log[a])-int(gf256Log[b])+255)%255]
+}
+
+// SplitSecret splits a secret into n Shamir shares over GF(2^8), any threshold
+// of which reconstruct it. Share i is evaluated at x = i + 1.
+func SplitSecret(secret []byte, n, threshold int) ([][]byte, error) {
+	if threshold < 2 || n < threshold || n > 255 {
+		return nil, fmt.Errorf("%w: threshold must be between 2 and the number of shares, at most 255", ErrInvalidKeyShares)
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret))
+	}
+
+	coefficients := make([]byte, threshold)
+	for pos, secretByte := range secret {
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+		coefficients[0] = secretByte
+
+		for i := range shares {
+			x := byte(i + 1)
+			var y byte
+			for c := threshold - 1; c >= 0; c-- {
+				y = gf256Mul(y, x) ^ coefficients[c]
+			}
+			shares[i][pos] = y
+		}
+	}
+
+	return shares, nil
+}
+
+// CombineSecret reconstructs a secret from Shamir shares indexed by their x
+// coordinate, using Lagrange interpolation at zero.
+func CombineSecret(shares map[byte][]byte) ([]byte, error) {
+	if len(shares) < 2 {
+		return nil, fmt.Errorf("%w: at least two shares are required", ErrInvalidKeyShares)
+	}
+
+	size := -1
+	for x, share := range shares {
+		if x == 0 || (size != -1 && len(share) != size) {
+			return nil, fmt.Errorf("%w: shares are not from the same split", ErrInvalidKeyShares)
+		}
+		size = len(share)
+	}
+
+	secret := make([]byte, size)
+	for xi, share := range shares {
+		basis := byte(1)
+		for xj := range shares {
+			if xj != xi {
+				basis = gf256Mul(basis, gf256Div(xj, xj^xi))
+			}
+		}
+
+		for pos := range secret {
+			secret[pos] ^= gf256Mul(share[pos], basis)
+		}
+	}
+
+	return secret, nil
+}
+
+// SplitPrivateKey splits the PKCS#8 encoding of a software private key into n
+// printable shares, threshold of which are needed to rebuild the key. Each share
+// is a PEM block whose headers identify the split, by the public key digest, and
+// carry a checksum of the share.
+func (p *SoftwareKeyProvider) SplitPrivateKey(key crypto.Signer, n, threshold int) ([]string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		p.logger.Errorf("could not marshal private key to split: %s", err)
+		return nil, err
+	}
+
+	setID, err := p.keyShareSetID(key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	shares, err := SplitSecret(der, n, threshold)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := make([]string, n)
+	for i, share := range shares {
+		index := strconv.Itoa(i + 1)
+		thresholdHeader := strconv.Itoa(threshold)
+		encoded[i] = string(pem.EncodeToMemory(&pem.Block{
+			Type: keySharePEMType,
+			Headers: map[string]string{
+				"Set":       setID,
+				"Share":     index,
+				"Threshold": thresholdHeader,
+				"Checksum":  keyShareChecksum(setID, index, thresholdHeader, share),
+			},
+			Bytes: share,
+		}))
+	}
+
+	p.logger.Infof("private key %s split into %d shares with threshold %d", setID, n, threshold)
+	return encoded, nil
+}
+
+// CombinePrivateKeyShares rebuilds a private key split with SplitPrivateKey. It
+// fails when a share is corrupted, shares come from different splits or fewer
+// shares than the threshold are given.
+func (p *SoftwareKeyProvider) CombinePrivateKeyShares(encoded []string) (crypto.Signer, error) {
+	shares := map[byte][]byte{}
+	var setID, threshold string
+	for _, text := range encoded {
+		block, _ := pem.Decode([]byte(strings.TrimSpace(text)))
+		if block == nil || block.Type != keySharePEMType {
+			return nil, fmt.Errorf("%w: not a key share", ErrInvalidKeyShares)
+		}
+
+		index := block.Headers["Share"]
+		checksum := keyShareChecksum(block.Headers["Set"], index, block.Headers["Threshold"], block.Bytes)
+		if block.Headers["Checksum"] != checksum {
+			return nil, fmt.Errorf("%w: checksum mismatch on share %s", ErrInvalidKeyShares, index)
+		}
+
+		if setID == "" {
+			setID, threshold = block.Headers["Set"], block.Headers["Threshold"]
+		} else if block.Headers["Set"] != setID || block.Headers["Threshold"] != threshold {
+			return nil, fmt.Errorf("%w: shares are not from the same split", ErrInvalidKeyShares)
+		}
+
+		x, err := strconv.ParseUint(index, 10, 8)
+		if err != nil || x == 0 {
+			return nil, fmt.Errorf("%w: invalid share index %s", ErrInvalidKeyShares, index)
+		}
+
+		if previous, duplicated := shares[byte(x)]; duplicated && !bytes.Equal(previous, block.Bytes) {
+			return nil, fmt.Errorf("%w: conflicting copies of share %s", ErrInvalidKeyShares, index)
+		}
+		shares[byte(x)] = block.Bytes
+	}
+
+	required, err := strconv.Atoi(threshold)
+	if err != nil || len(shares) < required {
+		return nil, fmt.Errorf("%w: %d distinct shares given, %s required", ErrInvalidKeyShares, len(shares), threshold)
+	}
+
+	der, err := CombineSecret(shares)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: shares do not rebuild a private key", ErrInvalidKeyShares)
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: shares do not rebuild a signing key", ErrInvalidKeyShares)
+	}
+
+	rebuiltSetID, err := p.keyShareSetID(signer.Public())
+	if err != nil || rebuiltSetID != setID {
+		return nil, fmt.Errorf("%w: rebuilt key does not match the split", ErrInvalidKeyShares)
+	}
+
+	p.logger.Infof("private key %s rebuilt from %d shares", setID, len(shares))
+	return signer, nil
+}
+
+func (p *SoftwareKeyProvider) keyShareSetID(pub crypto.PublicKey) (string, error) {
+	digest, err := p.EncodePKIXPublicKeyDigest(pub)
+	if err != nil {
+		return "", err
+	}
+
+	return digest[:16], nil
+}
+
+func keyShareChecksum(setID, index, threshold string, share []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s/%s/%s/", setID, index, threshold)
+	hash.Write(share)
+	return hex.EncodeToString(hash.Sum(nil)[:4])
+}
@@ -0,0 +1,116 @@
+package cryptoengines
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+)
+
+const symmetricKeyPEMType = "SYMMETRIC KEY"
+
+// CreateSymmetricKey creates a random secret of the specified size in bits, together with a random key ID
+func (p *SoftwareKeyProvider) CreateSymmetricKey(keySize int) (string, []byte, error) {
+	p.logger.Infof("starting symmetric key generation with %d bit key size", keySize)
+
+	if keySize <= 0 || keySize%8 != 0 {
+		p.logger.Errorf("invalid symmetric key size: %d", keySize)
+		return "", nil, fmt.Errorf("invalid symmetric key size %d", keySize)
+	}
+
+	key := make([]byte, keySize/8)
+	if _, err := rand.Read(key); err != nil {
+		p.logger.Errorf("symmetric key generation failed: %s", err)
+		return "", nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		p.logger.Errorf("symmetric key ID generation failed: %s", err)
+		return "", nil, err
+	}
+
+	keyID := hex.EncodeToString(id)
+	p.logger.Infof("symmetric key creation completed successfully - key ID: %s", keyID)
+	return keyID, key, nil
+}
+
+func (p *SoftwareKeyProvider) EncodeSymmetricKey(key []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:  symmetricKeyPEMType,
+		Bytes: key,
+	})
+}
+
+func (p *SoftwareKeyProvider) ParseSymmetricKey(pemBytes []byte) ([]byte, error) {
+	block, _ := pem.Decode(pemBytes)
+	if block == nil || block.Type != symmetricKeyPEMType {
+		p.logger.Errorf("PEM decoding failed - no valid symmetric key block found")
+		return nil, fmt.Errorf("no symmetric key found")
+	}
+
+	return block.Bytes, nil
+}
+
+// EncryptAESGCM seals the plaintext with AES-GCM. The random nonce is prepended to the returned ciphertext
+func (p *SoftwareKeyProvider) EncryptAESGCM(key, plaintext, aad []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		p.logger.Errorf("could not initialize AES-GCM: %s", err)
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		p.logger.Errorf("could not generate nonce: %s", err)
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func (p *SoftwareKeyProvider) DecryptAESGCM(key, ciphertext, aad []byte) ([]byte, error) {
+	aead, err := newAESGCM(key)
+	if err != nil {
+		p.logger.Errorf("could not initialize AES-GCM: %s", err)
+		return nil, err
+	}
+
+	nonceSize := aead.NonceSize()
+	if len(ciphertext) < nonceSize {
+		p.logger.Errorf("ciphertext shorter than nonce")
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	plaintext, err := aead.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], aad)
+	if err != nil {
+		p.logger.Errorf("AES-GCM decryption failed: %s", err)
+		return nil, err
+	}
+
+	return plaintext, nil
+}
+
+func (p *SoftwareKeyProvider) ComputeHMAC(key []byte, hash crypto.Hash, message []byte) ([]byte, error) {
+	if !hash.Available() {
+		p.logger.Errorf("hash function %s not available", hash)
+		return nil, fmt.Errorf("hash function %s not available", hash)
+	}
+
+	mac := hmac.New(hash.New, key)
+	mac.Write(message)
+	return mac.Sum(nil), nil
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -2,7 +2,9 @@ package cryptoengines
 
 import (
 	"crypto"
+	"crypto/ecdh"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
@@ -14,6 +16,8 @@ import (
 	"errors"
 	"fmt"
 
+	"filippo.io/mldsa"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/cryptoutils"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
 )
 
@@ -89,6 +93,49 @@ func (p *SoftwareKeyProvider) CreateECDSAPrivateKey(curve elliptic.Curve) (strin
 	return encDigest, key, nil
 }
 
+func (p *SoftwareKeyProvider) CreateEd25519PrivateKey() (string, ed25519.PrivateKey, error) {
+	lFunc := p.logger
+
+	lFunc.Infof("starting Ed25519 key generation")
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		lFunc.Errorf("Ed25519 key generation failed: %s", err)
+		return "", nil, err
+	}
+
+	lFunc.Debugf("encoding public key digest for Ed25519 key")
+	encDigest, err := p.EncodePKIXPublicKeyDigest(key.Public())
+	if err != nil {
+		lFunc.Errorf("failed to encode public key digest for Ed25519 key: %s", err)
+		return "", nil, err
+	}
+
+	lFunc.Infof("Ed25519 key creation completed successfully - digest: %s", encDigest)
+	return encDigest, key, nil
+}
+
+// CreateMLDSAPrivateKey creates a post-quantum ML-DSA private key with the specified parameter set
+func (p *SoftwareKeyProvider) CreateMLDSAPrivateKey(params *mldsa.Parameters) (string, *mldsa.PrivateKey, error) {
+	lFunc := p.logger
+
+	lFunc.Infof("starting %s key generation", params)
+	key, err := mldsa.GenerateKey(params)
+	if err != nil {
+		lFunc.Errorf("%s key generation failed: %s", params, err)
+		return "", nil, err
+	}
+
+	lFunc.Debugf("encoding public key digest for %s key", params)
+	encDigest, err := p.EncodePKIXPublicKeyDigest(key.Public())
+	if err != nil {
+		lFunc.Errorf("failed to encode public key digest for %s key: %s", params, err)
+		return "", nil, err
+	}
+
+	lFunc.Infof("%s key creation completed successfully - digest: %s", params, encDigest)
+	return encDigest, key, nil
+}
+
 func (p *SoftwareKeyProvider) MarshalAndEncodePKIXPrivateKey(key interface{}) (string, error) {
 	p.logger.Infof("starting private key marshaling and encoding process")
 
@@ -103,7 +150,7 @@ func (p *SoftwareKeyProvider) MarshalAndEncodePKIXPrivateKey(key interface{}) (s
 	}
 
 	p.logger.Debugf("marshaling private key to PKCS#8 format")
-	keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	keyBytes, err := cryptoutils.MarshalPKCS8PrivateKey(key)
 	if err != nil {
 		p.logger.Errorf("PKCS#8 marshaling failed: %s", err)
 		return "", err
@@ -138,7 +185,7 @@ func (p *SoftwareKeyProvider) EncodePKIXPublicKeyDigest(key interface{}) (string
 	}
 
 	p.logger.Debugf("marshaling public key to PKIX format")
-	pubkeyBytes, err := x509.MarshalPKIXPublicKey(key)
+	pubkeyBytes, err := cryptoutils.MarshalPKIXPublicKey(key)
 	if err != nil {
 		p.logger.Errorf("PKIX public key marshaling failed: %s", err)
 		return "", err
@@ -159,7 +206,85 @@ func (p *SoftwareKeyProvider) EncodePKIXPublicKeyDigest(key interface{}) (string
 	return hexDigest, nil
 }
 
+func (p *SoftwareKeyProvider) CreateX25519PrivateKey() (string, *ecdh.PrivateKey, error) {
+	lFunc := p.logger
+
+	lFunc.Infof("starting X25519 key generation")
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		lFunc.Errorf("X25519 key generation failed: %s", err)
+		return "", nil, err
+	}
+
+	lFunc.Debugf("encoding public key digest for X25519 key")
+	encDigest, err := p.EncodePKIXPublicKeyDigest(key.PublicKey())
+	if err != nil {
+		lFunc.Errorf("failed to encode public key digest for X25519 key: %s", err)
+		return "", nil, err
+	}
+
+	lFunc.Infof("X25519 key creation completed successfully - digest: %s", encDigest)
+	return encDigest, key, nil
+}
+
 func (p *SoftwareKeyProvider) ParsePrivateKey(pemBytes []byte) (crypto.Signer, error) {
+	genericKey, err := p.parsePEMPrivateKey(pemBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := genericKey.(type) {
+	case *rsa.PrivateKey:
+		p.logger.Infof("parsed RSA private key - key size: %d bits, public exponent: %d",
+			key.Size()*8, key.PublicKey.E)
+		return key, nil
+	case *ecdsa.PrivateKey:
+		p.logger.Infof("parsed ECDSA private key - curve: %s, bit size: %d",
+			key.Curve.Params().Name, key.Curve.Params().BitSize)
+		return key, nil
+	case ed25519.PrivateKey:
+		p.logger.Infof("parsed Ed25519 private key")
+		return key, nil
+	case *mldsa.PrivateKey:
+		p.logger.Infof("parsed %s private key", key.PublicKey().Parameters())
+		return key, nil
+	default:
+		p.logger.Errorf("unsupported private key type: %T", key)
+		return nil, errors.New("unsupported key type")
+	}
+}
+
+// ParseDecrypter parses a PEM private key able to decrypt. RSA keys decrypt with
+// RSA-OAEP while ECDSA P-256 and X25519 keys decrypt with ECIES
+func (p *SoftwareKeyProvider) ParseDecrypter(pemBytes []byte) (crypto.Decrypter, error) {
+	genericKey, err := p.parsePEMPrivateKey(pemBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	switch key := genericKey.(type) {
+	case *rsa.PrivateKey:
+		p.logger.Infof("parsed RSA decrypter - key size: %d bits", key.Size()*8)
+		return key, nil
+	case *ecdsa.PrivateKey:
+		ecdhKey, err := key.ECDH()
+		if err != nil {
+			p.logger.Errorf("ECDSA key with curve %s cannot be used for ECDH: %s", key.Curve.Params().Name, err)
+			return nil, err
+		}
+
+		p.logger.Infof("parsed ECIES decrypter - curve: %s", key.Curve.Params().Name)
+		return NewECIESDecrypter(ecdhKey), nil
+	case *ecdh.PrivateKey:
+		p.logger.Infof("parsed ECIES decrypter - curve: %s", key.Curve())
+		return NewECIESDecrypter(key), nil
+	default:
+		p.logger.Errorf("unsupported decryption key type: %T", key)
+		return nil, errors.New("unsupported key type")
+	}
+}
+
+func (p *SoftwareKeyProvider) parsePEMPrivateKey(pemBytes []byte) (interface{}, error) {
 	p.logger.Infof("starting private key parsing from PEM data")
 	p.logger.Debugf("input PEM data size: %d bytes", len(pemBytes))
 
@@ -183,7 +308,7 @@ func (p *SoftwareKeyProvider) ParsePrivateKey(pemBytes []byte) (crypto.Signer, e
 
 	// First try to parse as PKCS8
 	p.logger.Debugf("attempting to parse as PKCS#8 private key")
-	genericKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	genericKey, err = cryptoutils.ParsePKCS8PrivateKey(block.Bytes)
 	if err != nil {
 		p.logger.Debugf("PKCS#8 parsing failed: %s", err)
 
@@ -209,18 +334,5 @@ func (p *SoftwareKeyProvider) ParsePrivateKey(pemBytes []byte) (crypto.Signer, e
 	}
 
 	p.logger.Infof("private key parsed successfully using %s format", keyFormat)
-
-	switch key := genericKey.(type) {
-	case *rsa.PrivateKey:
-		p.logger.Infof("parsed RSA private key - key size: %d bits, public exponent: %d",
-			key.Size()*8, key.PublicKey.E)
-		return key, nil
-	case *ecdsa.PrivateKey:
-		p.logger.Infof("parsed ECDSA private key - curve: %s, bit size: %d",
-			key.Curve.Params().Name, key.Curve.Params().BitSize)
-		return key, nil
-	default:
-		p.logger.Errorf("unsupported private key type: %T", key)
-		return nil, errors.New("unsupported key type")
-	}
+	return genericKey, nil
 }
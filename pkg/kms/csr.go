@@ -0,0 +1,76 @@
+package kms
+
+type CSRFormat string
+
+const (
+	CSRFormatPEM CSRFormat = "pem"
+	CSRFormatDER CSRFormat = "der"
+)
+
+// Key usage names accepted in certificate signing requests (RFC 5280, 4.2.1.3).
+const (
+	KeyUsageDigitalSignature  = "digital_signature"
+	KeyUsageContentCommitment = "content_commitment"
+	KeyUsageKeyEncipherment   = "key_encipherment"
+	KeyUsageDataEncipherment  = "data_encipherment"
+	KeyUsageKeyAgreement      = "key_agreement"
+	KeyUsageCertSign          = "cert_sign"
+	KeyUsageCRLSign           = "crl_sign"
+	KeyUsageEncipherOnly      = "encipher_only"
+	KeyUsageDecipherOnly      = "decipher_only"
+)
+
+// Extended key usage names accepted in certificate signing requests.
+const (
+	ExtKeyUsageServerAuth      = "server_auth"
+	ExtKeyUsageClientAuth      = "client_auth"
+	ExtKeyUsageCodeSigning     = "code_signing"
+	ExtKeyUsageEmailProtection = "email_protection"
+	ExtKeyUsageTimeStamping    = "time_stamping"
+	ExtKeyUsageOCSPSigning     = "ocsp_signing"
+)
+
+type CSRSubject struct {
+	CommonName       string `json:"common_name"`
+	Organization     string `json:"organization,omitempty"`
+	OrganizationUnit string `json:"organization_unit,omitempty"`
+	Country          string `json:"country,omitempty"`
+	State            string `json:"state,omitempty"`
+	Locality         string `json:"locality,omitempty"`
+}
+
+// CSRExtension is an extension requested verbatim, with its DER encoded value.
+type CSRExtension struct {
+	OID      string `json:"oid"`
+	Critical bool   `json:"critical"`
+	Value    []byte `json:"value"`
+}
+
+type CreateCSRInput struct {
+	ID             string
+	Subject        CSRSubject
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []string
+	URIs           []string
+	// KeyUsages and ExtendedKeyUsages are requested through the key usage and
+	// extended key usage extensions, using the names defined in this package.
+	KeyUsages         []string
+	ExtendedKeyUsages []string
+	Extensions        []CSRExtension
+	// Algorithm selects the signature scheme, as for Sign. ML-DSA keys cannot
+	// sign certificate signing requests yet.
+	Algorithm SigningAlgorithm
+	Format    CSRFormat
+}
+
+// CertificateSigningRequest holds a PKCS#10 request signed with the primary
+// version of a key. Only the field matching the requested format is set.
+type CertificateSigningRequest struct {
+	KeyID      string           `json:"key_id"`
+	KeyVersion int              `json:"key_version"`
+	Algorithm  SigningAlgorithm `json:"algorithm"`
+	Format     CSRFormat        `json:"format"`
+	PEM        string           `json:"pem,omitempty"`
+	DER        []byte           `json:"der,omitempty"`
+}
@@ -6,10 +6,69 @@ import (
 )
 
 type CreateKMSRequestBody struct {
-	Alias     string `json:"alias"`
-	Algorithm string `json:"algorithm"`
-	Size      int    `json:"size"`
-	PublicKey string `json:"public_key"`
+	Alias              string               `json:"alias" validate:"required"`
+	Algorithm          string               `json:"algorithm" validate:"required"`
+	Size               int                  `json:"size" validate:"required"`
+	EngineID           string               `json:"engine_id,omitempty"`
+	RotationPeriodDays int                  `json:"rotation_period_days,omitempty" validate:"gte=0"`
+	Policy             *models.KMSKeyPolicy `json:"policy,omitempty"`
+	PublishJWKS        bool                 `json:"publish_jwks,omitempty"`
+}
+
+type SetKMSKeyJWKSPublicationRequestBody struct {
+	Published bool `json:"published"`
+}
+
+type MigrateKMSKeyRequestBody struct {
+	TargetEngineID string `json:"target_engine_id" validate:"required"`
+	DeleteSource   bool   `json:"delete_source"`
+}
+
+type ExportKMSKeySharesRequestBody struct {
+	Version   int `json:"version"`
+	Shares    int `json:"shares" validate:"required"`
+	Threshold int `json:"threshold" validate:"required"`
+}
+
+type ImportKMSKeySharesRequestBody struct {
+	Alias    string               `json:"name" validate:"required"`
+	EngineID string               `json:"engine_id"`
+	Shares   []string             `json:"shares" validate:"required"`
+	Policy   *models.KMSKeyPolicy `json:"policy,omitempty"`
+}
+
+type CreateCSRRequestBody struct {
+	Subject           CSRSubject       `json:"subject"`
+	DNSNames          []string         `json:"dns_names,omitempty"`
+	EmailAddresses    []string         `json:"email_addresses,omitempty"`
+	IPAddresses       []string         `json:"ip_addresses,omitempty"`
+	URIs              []string         `json:"uris,omitempty"`
+	KeyUsages         []string         `json:"key_usages,omitempty"`
+	ExtendedKeyUsages []string         `json:"extended_key_usages,omitempty"`
+	Extensions        []CSRExtension   `json:"extensions,omitempty"`
+	Algorithm         SigningAlgorithm `json:"algorithm,omitempty"`
+	Format            CSRFormat        `json:"format,omitempty" validate:"omitempty,oneof=pem der"`
+}
+
+type SignJWTRequestBody struct {
+	Claims    map[string]any `json:"claims" validate:"required"`
+	Algorithm string         `json:"algorithm,omitempty"`
+}
+
+type SignJWTResponse struct {
+	Token string `json:"token"`
+}
+
+type VerifyJWSRequestBody struct {
+	Token string `json:"token" validate:"required"`
+}
+
+type UpdateKMSKeyPolicyRequestBody struct {
+	Policy *models.KMSKeyPolicy `json:"policy"`
+}
+
+type UpdateKMSKeyMetadataRequestBody struct {
+	Metadata map[string]any `json:"metadata" validate:"required"`
 }
 
 type GetKMSKeysResponse struct {
@@ -19,3 +78,66 @@ type GetKMSKeysResponse struct {
 type GetItemsResponse[T models.KMSKey] struct {
 	resources.IterableList[T]
 }
+
+type EncryptRequestBody struct {
+	Plaintext []byte `json:"plaintext" validate:"required"`
+	AAD       []byte `json:"aad,omitempty"`
+}
+
+type EncryptResponse struct {
+	Ciphertext string `json:"ciphertext"`
+}
+
+type DecryptRequestBody struct {
+	Ciphertext string `json:"ciphertext" validate:"required"`
+	AAD        []byte `json:"aad,omitempty"`
+}
+
+type DecryptResponse struct {
+	Plaintext []byte `json:"plaintext"`
+}
+
+type MACRequestBody struct {
+	Message []byte `json:"message" validate:"required"`
+}
+
+type MACResponse struct {
+	MAC []byte `json:"mac"`
+}
+
+type VerifyMACRequestBody struct {
+	Message []byte `json:"message" validate:"required"`
+	MAC     []byte `json:"mac" validate:"required"`
+}
+
+type VerifyMACResponse struct {
+	Valid bool `json:"valid"`
+}
+
+type UpdateKMSKeyVersionStateRequestBody struct {
+	State models.KMSKeyVersionState `json:"state" validate:"required,oneof=ENABLED DISABLED"`
+}
+
+type SignRequestBody struct {
+	Message     []byte           `json:"message" validate:"required"`
+	MessageType SignMessageType  `json:"message_type" validate:"omitempty,oneof=raw digest"`
+	Algorithm   SigningAlgorithm `json:"algorithm,omitempty"`
+}
+
+type SignResponse struct {
+	Signature  []byte           `json:"signature"`
+	KeyVersion int              `json:"key_version"`
+	Algorithm  SigningAlgorithm `json:"algorithm"`
+}
+
+type VerifyRequestBody struct {
+	Message     []byte           `json:"message" validate:"required"`
+	MessageType SignMessageType  `json:"message_type" validate:"omitempty,oneof=raw digest"`
+	Signature   []byte           `json:"signature" validate:"required"`
+	Algorithm   SigningAlgorithm `json:"algorithm,omitempty"`
+	KeyVersion  int              `json:"key_version,omitempty" validate:"gte=0"`
+}
+
+type VerifyResponse struct {
+	Valid bool `json:"valid"`
+}
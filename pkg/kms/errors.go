@@ -0,0 +1,66 @@
+package kms
+
+import "errors"
+
+var (
+	ErrKMSKeyNotFound             = errors.New("kms key not found")
+	ErrKMSKeyVersionNotFound      = errors.New("kms key version not found")
+	ErrCryptoEngineNotFound       = errors.New("crypto engine not found")
+	ErrKMSKeyPendingDeletion      = errors.New("kms key is pending deletion")
+	ErrKMSKeyInUse                = errors.New("kms key is still referenced by an active CA")
+	ErrKMSKeyNotMigratable        = errors.New("kms key cannot be migrated")
+	ErrKMSKeyNotExportable        = errors.New("kms key material cannot be exported")
+	ErrInvalidPendingWindow       = errors.New("pending deletion window must be between 7 and 30 days")
+	ErrInvalidPolicy              = errors.New("invalid key policy")
+	ErrUnsupportedPublicKeyFormat = errors.New("unsupported public key format")
+	ErrInvalidJWS                 = errors.New("invalid JWS")
+	ErrKMSKeyVersionNotUsable     = errors.New("kms key version not usable in its current state")
+	ErrInvalidStateTransition     = errors.New("invalid kms key version state transition")
+	ErrInvalidSignatureRequest    = errors.New("invalid signature request")
+	ErrInvalidCSRRequest          = errors.New("invalid certificate signing request")
+	ErrInvalidCiphertext          = errors.New("invalid ciphertext")
+	ErrInvalidBackupArchive       = errors.New("invalid backup archive")
+	ErrBackupIntegrity            = errors.New("backup archive integrity check failed")
+	ErrUnsupportedKeyAlgorithm    = errors.New("unsupported key algorithm or size")
+	ErrUnsupportedKeyOperation    = errors.New("operation not supported by key")
+)
+
+// PolicyError is returned when a key policy denies an operation. Code is a
+// stable identifier that clients can match on.
+type PolicyError struct {
+	Code    string
+	message string
+}
+
+func (e *PolicyError) Error() string {
+	return e.message
+}
+
+var (
+	ErrPolicyOperationNotAllowed = &PolicyError{Code: "OPERATION_NOT_ALLOWED", message: "operation not allowed by key policy"}
+	ErrPolicyAlgorithmNotAllowed = &PolicyError{Code: "ALGORITHM_NOT_ALLOWED", message: "signature algorithm not allowed by key policy"}
+	ErrPolicyHashNotAllowed      = &PolicyError{Code: "HASH_NOT_ALLOWED", message: "hash not allowed by key policy"}
+	ErrPolicyPrincipalNotAllowed = &PolicyError{Code: "PRINCIPAL_NOT_ALLOWED", message: "principal not allowed by key policy"}
+	ErrPolicyNotYetValid         = &PolicyError{Code: "KEY_NOT_YET_VALID", message: "key policy is not yet valid"}
+	ErrPolicyExpired             = &PolicyError{Code: "KEY_EXPIRED", message: "key policy has expired"}
+)
+
+var policyErrors = map[string]*PolicyError{}
+
+func init() {
+	for _, err := range []*PolicyError{
+		ErrPolicyOperationNotAllowed,
+		ErrPolicyAlgorithmNotAllowed,
+		ErrPolicyHashNotAllowed,
+		ErrPolicyPrincipalNotAllowed,
+		ErrPolicyNotYetValid,
+		ErrPolicyExpired,
+	} {
+		policyErrors[err.Code] = err
+	}
+}
+
+// PolicyErrorFromCode returns the policy error identified by code, or nil.
+func PolicyErrorFromCode(code string) *PolicyError {
+	return policyErrors[code]
+}
@@ -0,0 +1,60 @@
+package kms
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var jwsAlgorithms = map[SigningAlgorithm]string{
+	SigningAlgorithmRSAPKCS1v15SHA256: "RS256",
+	SigningAlgorithmRSAPKCS1v15SHA384: "RS384",
+	SigningAlgorithmRSAPKCS1v15SHA512: "RS512",
+	SigningAlgorithmRSAPSSSHA256:      "PS256",
+	SigningAlgorithmRSAPSSSHA384:      "PS384",
+	SigningAlgorithmRSAPSSSHA512:      "PS512",
+	SigningAlgorithmECDSASHA256:       "ES256",
+	SigningAlgorithmECDSASHA384:       "ES384",
+	SigningAlgorithmECDSASHA512:       "ES512",
+	SigningAlgorithmEd25519:           "EdDSA",
+	SigningAlgorithmMLDSA44:           "ML-DSA-44",
+	SigningAlgorithmMLDSA65:           "ML-DSA-65",
+	SigningAlgorithmMLDSA87:           "ML-DSA-87",
+}
+
+// SigningAlgorithmFromJWS returns the signing algorithm identified by a JWS "alg" name.
+func SigningAlgorithmFromJWS(alg string) (SigningAlgorithm, bool) {
+	for algorithm, name := range jwsAlgorithms {
+		if name == alg {
+			return algorithm, true
+		}
+	}
+
+	return "", false
+}
+
+// JWSAlgorithm returns the JWS "alg" name of the signing algorithm, or an empty
+// string if it has none.
+func JWSAlgorithm(algorithm SigningAlgorithm) string {
+	return jwsAlgorithms[algorithm]
+}
+
+// KeyVersionKID returns the JWK key ID identifying a version of a KMS key.
+func KeyVersionKID(keyID string, version int) string {
+	return fmt.Sprintf("%s/%d", keyID, version)
+}
+
+// ParseKeyVersionKID splits a JWK key ID built by KeyVersionKID.
+func ParseKeyVersionKID(kid string) (string, int, error) {
+	keyID, versionStr, found := strings.Cut(kid, "/")
+	if !found || keyID == "" {
+		return "", 0, fmt.Errorf("invalid key id %q", kid)
+	}
+
+	version, err := strconv.Atoi(versionStr)
+	if err != nil || version <= 0 {
+		return "", 0, fmt.Errorf("invalid key version in key id %q", kid)
+	}
+
+	return keyID, version, nil
+}
@@ -4,43 +4,452 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 
+	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	"go.opentelemetry.io/otel"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
+const (
+	kmsBaseURL     = "http://localhost:8091/v1/kms"
+	enginesBaseURL = "http://localhost:8091/v1/engines"
+	jwksURL        = "http://localhost:8091/.well-known/jwks.json"
+)
+
 type KMSSdkService struct{}
 
 func NewKMSSdkService() *KMSSdkService {
 	return &KMSSdkService{}
 }
 
-func (s *KMSSdkService) CreateKMSKey(ctx context.Context, input CreateKMSInput) error {
-	ctx, span := otel.GetTracerProvider().Tracer("kms-sdk").Start(ctx, "CreateKMSKey", trace.WithAttributes(semconv.PeerService("KMS")))
-	defer span.End()
+func (s *KMSSdkService) CreateKMSKey(ctx context.Context, input CreateKMSInput) (*models.KMSKey, error) {
+	var kmsKey models.KMSKey
+	err := s.do(ctx, "CreateKMSKey", http.MethodPost, kmsBaseURL, CreateKMSRequestBody{
+		Alias:              input.Alias,
+		Algorithm:          input.Algorithm,
+		Size:               input.Size,
+		EngineID:           input.EngineID,
+		RotationPeriodDays: input.RotationPeriodDays,
+		Policy:             input.Policy,
+		PublishJWKS:        input.PublishJWKS,
+	}, &kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsKey, nil
+}
+
+func (s *KMSSdkService) GetKMSKeys(ctx context.Context, input GetKMSKeysInput) (string, error) {
+	// Implementation for retrieving KMS keys
+	return "", nil
+}
+
+func (s *KMSSdkService) CountKMSKeys(ctx context.Context, input CountKMSKeysInput) (int, error) {
+	queryParams := resources.QueryParameters{}
+	if input.QueryParameters != nil {
+		queryParams = *input.QueryParameters
+	}
+	queryParams.IncludeTotal = true
+	queryParams.PageSize = 1
+
+	var response GetKMSKeysResponse
+	err := s.do(ctx, "CountKMSKeys", http.MethodGet, kmsBaseURL+"?"+resources.EncodeQuery(&queryParams).Encode(), nil, &response)
+	if err != nil {
+		return 0, err
+	}
+
+	if response.Total == nil {
+		return 0, fmt.Errorf("response has no total")
+	}
+
+	return *response.Total, nil
+}
+
+func (s *KMSSdkService) GetKMSKeyStats(ctx context.Context, input GetKMSKeyStatsInput) (*KMSKeyStats, error) {
+	var stats KMSKeyStats
+	err := s.do(ctx, "GetKMSKeyStats", http.MethodGet, kmsBaseURL+"/stats?"+resources.EncodeQuery(input.QueryParameters).Encode(), nil, &stats)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+func (s *KMSSdkService) GetKMSKeyByID(ctx context.Context, input GetKMSKeyByIDInput) (*models.KMSKey, error) {
+	var kmsKey models.KMSKey
+	err := s.do(ctx, "GetKMSKeyByID", http.MethodGet, fmt.Sprintf("%s/%s", kmsBaseURL, input.ID), nil, &kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsKey, nil
+}
+
+func (s *KMSSdkService) UpdateKMSKeyMetadata(ctx context.Context, input UpdateKMSKeyMetadataInput) (*models.KMSKey, error) {
+	var kmsKey models.KMSKey
+	err := s.doRevision(ctx, "UpdateKMSKeyMetadata", http.MethodPatch, fmt.Sprintf("%s/%s/metadata", kmsBaseURL, input.ID), input.ID, input.Revision, UpdateKMSKeyMetadataRequestBody{
+		Metadata: input.Metadata,
+	}, &kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsKey, nil
+}
+
+func (s *KMSSdkService) Encrypt(ctx context.Context, input EncryptInput) (string, error) {
+	var response EncryptResponse
+	err := s.do(ctx, "Encrypt", http.MethodPost, fmt.Sprintf("%s/%s/encrypt", kmsBaseURL, input.ID), EncryptRequestBody{
+		Plaintext: input.Plaintext,
+		AAD:       input.AAD,
+	}, &response)
+	if err != nil {
+		return "", err
+	}
+
+	return response.Ciphertext, nil
+}
+
+func (s *KMSSdkService) Decrypt(ctx context.Context, input DecryptInput) ([]byte, error) {
+	var response DecryptResponse
+	err := s.do(ctx, "Decrypt", http.MethodPost, fmt.Sprintf("%s/%s/decrypt", kmsBaseURL, input.ID), DecryptRequestBody{
+		Ciphertext: input.Ciphertext,
+		AAD:        input.AAD,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Plaintext, nil
+}
+
+func (s *KMSSdkService) GenerateMAC(ctx context.Context, input GenerateMACInput) ([]byte, error) {
+	var response MACResponse
+	err := s.do(ctx, "GenerateMAC", http.MethodPost, fmt.Sprintf("%s/%s/mac", kmsBaseURL, input.ID), MACRequestBody{
+		Message: input.Message,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.MAC, nil
+}
+
+func (s *KMSSdkService) VerifyMAC(ctx context.Context, input VerifyMACInput) (bool, error) {
+	var response VerifyMACResponse
+	err := s.do(ctx, "VerifyMAC", http.MethodPost, fmt.Sprintf("%s/%s/verify-mac", kmsBaseURL, input.ID), VerifyMACRequestBody{
+		Message: input.Message,
+		MAC:     input.MAC,
+	}, &response)
+	if err != nil {
+		return false, err
+	}
+
+	return response.Valid, nil
+}
+
+func (s *KMSSdkService) RotateKMSKey(ctx context.Context, input RotateKMSKeyInput) (*models.KMSKey, error) {
+	var kmsKey models.KMSKey
+	err := s.doRevision(ctx, "RotateKMSKey", http.MethodPost, fmt.Sprintf("%s/%s/rotate", kmsBaseURL, input.ID), input.ID, input.Revision, nil, &kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsKey, nil
+}
+
+func (s *KMSSdkService) UpdateKMSKeyVersionState(ctx context.Context, input UpdateKMSKeyVersionStateInput) (*models.KMSKey, error) {
+	var kmsKey models.KMSKey
+	err := s.doRevision(ctx, "UpdateKMSKeyVersionState", http.MethodPut, fmt.Sprintf("%s/%s/versions/%d/state", kmsBaseURL, input.ID, input.Version), input.ID, input.Revision, UpdateKMSKeyVersionStateRequestBody{
+		State: input.State,
+	}, &kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsKey, nil
+}
+
+func (s *KMSSdkService) ScheduleKMSKeyDeletion(ctx context.Context, input ScheduleKMSKeyDeletionInput) (*models.KMSKey, error) {
+	reqURL := fmt.Sprintf("%s/%s", kmsBaseURL, input.ID)
+	if input.PendingWindowDays != 0 {
+		reqURL = fmt.Sprintf("%s?pending_window_days=%d", reqURL, input.PendingWindowDays)
+	}
+
+	var kmsKey models.KMSKey
+	err := s.doRevision(ctx, "ScheduleKMSKeyDeletion", http.MethodDelete, reqURL, input.ID, input.Revision, nil, &kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsKey, nil
+}
+
+func (s *KMSSdkService) CancelKMSKeyDeletion(ctx context.Context, input CancelKMSKeyDeletionInput) (*models.KMSKey, error) {
+	var kmsKey models.KMSKey
+	err := s.doRevision(ctx, "CancelKMSKeyDeletion", http.MethodPost, fmt.Sprintf("%s/%s/cancel-deletion", kmsBaseURL, input.ID), input.ID, input.Revision, nil, &kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsKey, nil
+}
+
+func (s *KMSSdkService) UpdateKMSKeyPolicy(ctx context.Context, input UpdateKMSKeyPolicyInput) (*models.KMSKey, error) {
+	var kmsKey models.KMSKey
+	err := s.doRevision(ctx, "UpdateKMSKeyPolicy", http.MethodPut, fmt.Sprintf("%s/%s/policy", kmsBaseURL, input.ID), input.ID, input.Revision, UpdateKMSKeyPolicyRequestBody{
+		Policy: input.Policy,
+	}, &kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsKey, nil
+}
+
+func (s *KMSSdkService) GetPublicKey(ctx context.Context, input GetPublicKeyInput) (*ExportedPublicKey, error) {
+	query := url.Values{}
+	if input.Format != "" {
+		query.Set("format", string(input.Format))
+	}
+
+	if input.Version != 0 {
+		query.Set("version", strconv.Itoa(input.Version))
+	}
 
-	body := CreateKMSRequestBody{
-		Alias:     input.Alias,
+	var publicKey ExportedPublicKey
+	err := s.do(ctx, "GetPublicKey", http.MethodGet, fmt.Sprintf("%s/%s/public-key?%s", kmsBaseURL, input.ID, query.Encode()), nil, &publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &publicKey, nil
+}
+
+func (s *KMSSdkService) SetKMSKeyJWKSPublication(ctx context.Context, input SetKMSKeyJWKSPublicationInput) (*models.KMSKey, error) {
+	var kmsKey models.KMSKey
+	err := s.doRevision(ctx, "SetKMSKeyJWKSPublication", http.MethodPut, fmt.Sprintf("%s/%s/jwks-publication", kmsBaseURL, input.ID), input.ID, input.Revision, SetKMSKeyJWKSPublicationRequestBody{
+		Published: input.Published,
+	}, &kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsKey, nil
+}
+
+func (s *KMSSdkService) GetJWKS(ctx context.Context) (*JWKS, error) {
+	var jwks JWKS
+	err := s.do(ctx, "GetJWKS", http.MethodGet, jwksURL, nil, &jwks)
+	if err != nil {
+		return nil, err
+	}
+
+	return &jwks, nil
+}
+
+func (s *KMSSdkService) SignJWT(ctx context.Context, input SignJWTInput) (string, error) {
+	var response SignJWTResponse
+	err := s.do(ctx, "SignJWT", http.MethodPost, fmt.Sprintf("%s/%s/jwt", kmsBaseURL, input.ID), SignJWTRequestBody{
+		Claims:    input.Claims,
 		Algorithm: input.Algorithm,
-		Size:      input.Size,
-		PublicKey: input.PublicKey,
+	}, &response)
+	if err != nil {
+		return "", err
 	}
 
-	jsonBody, err := json.Marshal(body)
+	return response.Token, nil
+}
+
+func (s *KMSSdkService) VerifyJWS(ctx context.Context, input VerifyJWSInput) (*VerifyJWSOutput, error) {
+	var output VerifyJWSOutput
+	err := s.do(ctx, "VerifyJWS", http.MethodPost, kmsBaseURL+"/jws/verify", VerifyJWSRequestBody{
+		Token: input.Token,
+	}, &output)
 	if err != nil {
-		span.RecordError(err)
-		return err
+		return nil, err
+	}
+
+	return &output, nil
+}
+
+func (s *KMSSdkService) MigrateKMSKey(ctx context.Context, input MigrateKMSKeyInput) (*models.KMSKey, error) {
+	var kmsKey models.KMSKey
+	err := s.do(ctx, "MigrateKMSKey", http.MethodPost, fmt.Sprintf("%s/%s/migrate", kmsBaseURL, input.ID), MigrateKMSKeyRequestBody{
+		TargetEngineID: input.TargetEngineID,
+		DeleteSource:   input.DeleteSource,
+	}, &kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsKey, nil
+}
+
+func (s *KMSSdkService) CreateCSR(ctx context.Context, input CreateCSRInput) (*CertificateSigningRequest, error) {
+	var csr CertificateSigningRequest
+	err := s.do(ctx, "CreateCSR", http.MethodPost, fmt.Sprintf("%s/%s/csr", kmsBaseURL, input.ID), CreateCSRRequestBody{
+		Subject:           input.Subject,
+		DNSNames:          input.DNSNames,
+		EmailAddresses:    input.EmailAddresses,
+		IPAddresses:       input.IPAddresses,
+		URIs:              input.URIs,
+		KeyUsages:         input.KeyUsages,
+		ExtendedKeyUsages: input.ExtendedKeyUsages,
+		Extensions:        input.Extensions,
+		Algorithm:         input.Algorithm,
+		Format:            input.Format,
+	}, &csr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &csr, nil
+}
+
+func (s *KMSSdkService) ExportKMSKeyShares(ctx context.Context, input ExportKMSKeySharesInput) (*KMSKeyShares, error) {
+	var shares KMSKeyShares
+	err := s.do(ctx, "ExportKMSKeyShares", http.MethodPost, fmt.Sprintf("%s/%s/shares", kmsBaseURL, input.ID), ExportKMSKeySharesRequestBody{
+		Version:   input.Version,
+		Shares:    input.Shares,
+		Threshold: input.Threshold,
+	}, &shares)
+	if err != nil {
+		return nil, err
 	}
-	byteReader := bytes.NewReader(jsonBody)
-	r, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://localhost:8091/v1/kms", byteReader)
+
+	return &shares, nil
+}
+
+func (s *KMSSdkService) ImportKMSKeyShares(ctx context.Context, input ImportKMSKeySharesInput) (*models.KMSKey, error) {
+	var kmsKey models.KMSKey
+	err := s.do(ctx, "ImportKMSKeyShares", http.MethodPost, kmsBaseURL+"/shares/import", ImportKMSKeySharesRequestBody{
+		Alias:    input.Alias,
+		EngineID: input.EngineID,
+		Shares:   input.Shares,
+		Policy:   input.Policy,
+	}, &kmsKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &kmsKey, nil
+}
+
+func (s *KMSSdkService) GetCryptoEngines(ctx context.Context) ([]EngineInfo, error) {
+	var engines []EngineInfo
+	err := s.do(ctx, "GetCryptoEngines", http.MethodGet, enginesBaseURL, nil, &engines)
+	if err != nil {
+		return nil, err
+	}
+
+	return engines, nil
+}
+
+func (s *KMSSdkService) SyncCryptoEngine(ctx context.Context, input SyncCryptoEngineInput) (*EngineDriftReport, error) {
+	query := url.Values{}
+	if input.DryRun {
+		query.Set("dry_run", "true")
+	}
+
+	var report EngineDriftReport
+	err := s.do(ctx, "SyncCryptoEngine", http.MethodPost, fmt.Sprintf("%s/%s/sync?%s", enginesBaseURL, input.EngineID, query.Encode()), nil, &report)
+	if err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+func (s *KMSSdkService) Sign(ctx context.Context, input SignInput) (*SignOutput, error) {
+	var response SignResponse
+	err := s.do(ctx, "Sign", http.MethodPost, fmt.Sprintf("%s/%s/sign", kmsBaseURL, input.ID), SignRequestBody{
+		Message:     input.Message,
+		MessageType: input.MessageType,
+		Algorithm:   input.Algorithm,
+	}, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SignOutput{
+		Signature:  response.Signature,
+		KeyVersion: response.KeyVersion,
+		Algorithm:  response.Algorithm,
+	}, nil
+}
+
+func (s *KMSSdkService) Verify(ctx context.Context, input VerifyInput) (bool, error) {
+	var response VerifyResponse
+	err := s.do(ctx, "Verify", http.MethodPost, fmt.Sprintf("%s/%s/verify", kmsBaseURL, input.ID), VerifyRequestBody{
+		Message:     input.Message,
+		MessageType: input.MessageType,
+		Signature:   input.Signature,
+		Algorithm:   input.Algorithm,
+		KeyVersion:  input.KeyVersion,
+	}, &response)
+	if err != nil {
+		return false, err
+	}
+
+	return response.Valid, nil
+}
+
+func (s *KMSSdkService) do(ctx context.Context, operation string, method string, reqURL string, body any, out any) error {
+	_, err := s.doHeader(ctx, operation, method, reqURL, nil, body, out)
+	return err
+}
+
+// doRevision makes a request conditional on the key being at a revision, when
+// set. Requests refused as made from a stale revision return a ConflictError.
+func (s *KMSSdkService) doRevision(ctx context.Context, operation string, method string, reqURL string, id string, revision *int, body any, out any) error {
+	header := http.Header{}
+	if revision != nil {
+		header.Set("If-Match", resources.ETag(*revision))
+	}
+
+	status, err := s.doHeader(ctx, operation, method, reqURL, header, body, out)
+	if status == http.StatusPreconditionFailed && revision != nil {
+		return &resources.ConflictError{ID: id, Revision: *revision}
+	}
+
+	return err
+}
+
+// doHeader sends a request with extra headers and returns the status code of
+// its response.
+func (s *KMSSdkService) doHeader(ctx context.Context, operation string, method string, reqURL string, header http.Header, body any, out any) (int, error) {
+	ctx, span := otel.GetTracerProvider().Tracer("kms-sdk").Start(ctx, operation, trace.WithAttributes(semconv.PeerService("KMS")))
+	defer span.End()
+
+	var byteReader io.Reader
+	if body != nil {
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			span.RecordError(err)
+			return 0, err
+		}
+		byteReader = bytes.NewReader(jsonBody)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, method, reqURL, byteReader)
 	if err != nil {
 		span.RecordError(err)
-		return err
+		return 0, err
 	}
 
+	for key, values := range header {
+		r.Header[key] = values
+	}
 	r.Header.Set("Content-Type", "application/json")
 
 	client := &http.Client{
@@ -52,7 +461,7 @@ func (s *KMSSdkService) CreateKMSKey(ctx context.Context, input CreateKMSInput)
 	res, err := client.Do(r)
 	if err != nil {
 		span.RecordError(err)
-		return err
+		return 0, err
 	}
 
 	defer res.Body.Close()
@@ -60,15 +469,28 @@ func (s *KMSSdkService) CreateKMSKey(ctx context.Context, input CreateKMSInput)
 	// Record the HTTP status code
 	span.SetAttributes(semconv.HTTPStatusCode(res.StatusCode))
 
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		span.RecordError(err)
+		return 0, err
+	}
+
 	if res.StatusCode >= 400 {
-		span.SetAttributes(semconv.HTTPStatusCode(res.StatusCode))
-		// You might want to read the response body for error details
+		var errBody struct {
+			Code string `json:"code"`
+		}
+		if json.Unmarshal(resBody, &errBody) == nil && PolicyErrorFromCode(errBody.Code) != nil {
+			err = PolicyErrorFromCode(errBody.Code)
+		} else {
+			err = fmt.Errorf("unexpected status code %d: %s", res.StatusCode, string(resBody))
+		}
+		span.RecordError(err)
+		return res.StatusCode, err
 	}
 
-	return nil
-}
+	if out == nil {
+		return res.StatusCode, nil
+	}
 
-func (s *KMSSdkService) GetKMSKeys(ctx context.Context, input GetKMSKeysInput) (string, error) {
-	// Implementation for retrieving KMS keys
-	return "", nil
+	return res.StatusCode, json.Unmarshal(resBody, out)
 }
@@ -2,21 +2,56 @@ package kms
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms/cryptoengines"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/models"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/cryptoutils"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
 )
 
 type KMSService interface {
-	CreateKMSKey(ctx context.Context, input CreateKMSInput) error
+	CreateKMSKey(ctx context.Context, input CreateKMSInput) (*models.KMSKey, error)
 	GetKMSKeys(ctx context.Context, input GetKMSKeysInput) (string, error)
+	CountKMSKeys(ctx context.Context, input CountKMSKeysInput) (int, error)
+	GetKMSKeyStats(ctx context.Context, input GetKMSKeyStatsInput) (*KMSKeyStats, error)
+	GetKMSKeyByID(ctx context.Context, input GetKMSKeyByIDInput) (*models.KMSKey, error)
+	UpdateKMSKeyMetadata(ctx context.Context, input UpdateKMSKeyMetadataInput) (*models.KMSKey, error)
+	RotateKMSKey(ctx context.Context, input RotateKMSKeyInput) (*models.KMSKey, error)
+	UpdateKMSKeyVersionState(ctx context.Context, input UpdateKMSKeyVersionStateInput) (*models.KMSKey, error)
+	ScheduleKMSKeyDeletion(ctx context.Context, input ScheduleKMSKeyDeletionInput) (*models.KMSKey, error)
+	CancelKMSKeyDeletion(ctx context.Context, input CancelKMSKeyDeletionInput) (*models.KMSKey, error)
+	UpdateKMSKeyPolicy(ctx context.Context, input UpdateKMSKeyPolicyInput) (*models.KMSKey, error)
+	GetPublicKey(ctx context.Context, input GetPublicKeyInput) (*ExportedPublicKey, error)
+	CreateCSR(ctx context.Context, input CreateCSRInput) (*CertificateSigningRequest, error)
+	SetKMSKeyJWKSPublication(ctx context.Context, input SetKMSKeyJWKSPublicationInput) (*models.KMSKey, error)
+	GetJWKS(ctx context.Context) (*JWKS, error)
+	MigrateKMSKey(ctx context.Context, input MigrateKMSKeyInput) (*models.KMSKey, error)
+	ExportKMSKeyShares(ctx context.Context, input ExportKMSKeySharesInput) (*KMSKeyShares, error)
+	ImportKMSKeyShares(ctx context.Context, input ImportKMSKeySharesInput) (*models.KMSKey, error)
+	SyncCryptoEngine(ctx context.Context, input SyncCryptoEngineInput) (*EngineDriftReport, error)
+	GetCryptoEngines(ctx context.Context) ([]EngineInfo, error)
+	SignJWT(ctx context.Context, input SignJWTInput) (string, error)
+	VerifyJWS(ctx context.Context, input VerifyJWSInput) (*VerifyJWSOutput, error)
+
+	Sign(ctx context.Context, input SignInput) (*SignOutput, error)
+	Verify(ctx context.Context, input VerifyInput) (bool, error)
+
+	Encrypt(ctx context.Context, input EncryptInput) (string, error)
+	Decrypt(ctx context.Context, input DecryptInput) ([]byte, error)
+	GenerateMAC(ctx context.Context, input GenerateMACInput) ([]byte, error)
+	VerifyMAC(ctx context.Context, input VerifyMACInput) (bool, error)
 }
 
 type CreateKMSInput struct {
-	Alias     string
-	Algorithm string
-	Size      int
-	PublicKey string
+	Alias              string
+	Algorithm          string
+	Size               int
+	EngineID           string
+	RotationPeriodDays int
+	Policy             *models.KMSKeyPolicy
+	PublishJWKS        bool
 }
 
 type GetKMSKeysInput struct {
@@ -25,3 +60,316 @@ type GetKMSKeysInput struct {
 	ExhaustiveRun bool //wether to iter all elems
 	ApplyFunc     func(kmsKey models.KMSKey)
 }
+
+type CountKMSKeysInput struct {
+	QueryParameters *resources.QueryParameters
+}
+
+type GetKMSKeyStatsInput struct {
+	// QueryParameters select the keys to count. Only filters apply.
+	QueryParameters *resources.QueryParameters
+}
+
+// KMSKeyStats count the keys matching a query. Types are key algorithms.
+type KMSKeyStats struct {
+	Total    int               `json:"total"`
+	ByStatus map[string]int    `json:"by_status"`
+	ByType   map[string]int    `json:"by_type"`
+	ByEngine map[string]int    `json:"by_engine"`
+	ByExpiry KMSKeyExpiryStats `json:"by_expiry"`
+}
+
+// KMSKeyExpiryStats count keys by the time left until their policy stops
+// allowing their use.
+type KMSKeyExpiryStats struct {
+	Expired    int `json:"expired"`
+	Next30Days int `json:"next_30_days"`
+	Next90Days int `json:"next_90_days"`
+	Later      int `json:"later"`
+	NoExpiry   int `json:"no_expiry"`
+}
+
+type EncryptInput struct {
+	ID        string
+	Plaintext []byte
+	AAD       []byte
+}
+
+type DecryptInput struct {
+	ID         string
+	Ciphertext string
+	AAD        []byte
+}
+
+type GenerateMACInput struct {
+	ID      string
+	Message []byte
+}
+
+type VerifyMACInput struct {
+	ID      string
+	Message []byte
+	MAC     []byte
+}
+
+type RotateKMSKeyInput struct {
+	ID string
+	// Revision, when set, is the revision the key must be at for the update
+	// to apply.
+	Revision *int
+}
+
+type UpdateKMSKeyVersionStateInput struct {
+	ID      string
+	Version int
+	// State is ENABLED or DISABLED. Versions are only destroyed along with
+	// their key, see ScheduleKMSKeyDeletion.
+	State models.KMSKeyVersionState
+	// Revision, when set, is the revision the key must be at for the update
+	// to apply.
+	Revision *int
+}
+
+const (
+	MinPendingWindowDays     = 7
+	MaxPendingWindowDays     = 30
+	DefaultPendingWindowDays = MaxPendingWindowDays
+)
+
+type ScheduleKMSKeyDeletionInput struct {
+	ID string
+	// PendingWindowDays is the number of days the key can still be recovered.
+	// When zero, DefaultPendingWindowDays is used.
+	PendingWindowDays int
+	// Revision, when set, is the revision the key must be at for the update
+	// to apply.
+	Revision *int
+}
+
+type CancelKMSKeyDeletionInput struct {
+	ID string
+	// Revision, when set, is the revision the key must be at for the update
+	// to apply.
+	Revision *int
+}
+
+type UpdateKMSKeyPolicyInput struct {
+	ID string
+	// Policy replaces the current policy. A nil policy removes all restrictions.
+	Policy *models.KMSKeyPolicy
+	// Revision, when set, is the revision the key must be at for the update
+	// to apply.
+	Revision *int
+}
+
+type GetKMSKeyByIDInput struct {
+	ID string
+}
+
+type UpdateKMSKeyMetadataInput struct {
+	ID string
+	// Metadata is merged into the current metadata. Keys set to nil are
+	// removed.
+	Metadata map[string]any
+	// Revision, when set, is the revision the key must be at for the update
+	// to apply.
+	Revision *int
+}
+
+type PublicKeyFormat string
+
+const (
+	PublicKeyFormatPEM PublicKeyFormat = "pem"
+	PublicKeyFormatDER PublicKeyFormat = "der"
+	PublicKeyFormatJWK PublicKeyFormat = "jwk"
+	PublicKeyFormatSSH PublicKeyFormat = "ssh"
+)
+
+type GetPublicKeyInput struct {
+	ID string
+	// Version selects the key version to export. When zero, the primary version is used.
+	Version int
+	Format  PublicKeyFormat
+}
+
+// PublicKeyFingerprints identify a public key. All but SSHSHA256 are renderings of
+// the SHA-256 digest of the PKIX encoded key, which crypto engines also use as key ID.
+type PublicKeyFingerprints struct {
+	SHA256Hex    string `json:"sha256_hex"`
+	SHA256Colon  string `json:"sha256_colon"`
+	SHA256Base64 string `json:"sha256_base64"`
+	SSHSHA256    string `json:"ssh_sha256,omitempty"`
+}
+
+// ExportedPublicKey holds the public key of a key version. Only the field
+// matching the requested format is set.
+type ExportedPublicKey struct {
+	KeyID        string                `json:"key_id"`
+	KeyVersion   int                   `json:"key_version"`
+	Format       PublicKeyFormat       `json:"format"`
+	PEM          string                `json:"pem,omitempty"`
+	DER          []byte                `json:"der,omitempty"`
+	JWK          *cryptoutils.JWK      `json:"jwk,omitempty"`
+	SSH          string                `json:"ssh,omitempty"`
+	Fingerprints PublicKeyFingerprints `json:"fingerprints"`
+}
+
+type SetKMSKeyJWKSPublicationInput struct {
+	ID        string
+	Published bool
+	// Revision, when set, is the revision the key must be at for the update
+	// to apply.
+	Revision *int
+}
+
+type JWKS struct {
+	Keys []cryptoutils.JWK `json:"keys"`
+}
+
+type SignJWTInput struct {
+	ID     string
+	Claims map[string]any
+	// Algorithm is the JWS "alg" to sign with. When empty, it is chosen from the
+	// key type: RS256, ES256, ES384, ES512 or EdDSA.
+	Algorithm string
+}
+
+type VerifyJWSInput struct {
+	Token string
+}
+
+// VerifyJWSOutput is the result of verifying a compact JWS. When the payload is
+// a JWT claims set, its exp and nbf claims are also checked.
+type VerifyJWSOutput struct {
+	Valid      bool            `json:"valid"`
+	Reason     string          `json:"reason,omitempty"`
+	KeyID      string          `json:"key_id,omitempty"`
+	KeyVersion int             `json:"key_version,omitempty"`
+	Header     map[string]any  `json:"header,omitempty"`
+	Payload    json.RawMessage `json:"payload,omitempty"`
+}
+
+type MigrateKMSKeyInput struct {
+	ID             string
+	TargetEngineID string
+	// DeleteSource deletes the key material from the source engine once the key
+	// has been migrated.
+	DeleteSource bool
+}
+
+// ExportKMSKeySharesInput splits the material of a key version into Shares
+// Shamir shares, Threshold of which are needed to rebuild it.
+type ExportKMSKeySharesInput struct {
+	ID        string
+	Version   int
+	Shares    int
+	Threshold int
+}
+
+type KMSKeyShares struct {
+	KeyID      string   `json:"key_id"`
+	KeyVersion int      `json:"key_version"`
+	Threshold  int      `json:"threshold"`
+	Shares     []string `json:"shares"`
+}
+
+// ImportKMSKeySharesInput rebuilds a key from its Shamir shares into a crypto
+// engine, as a new KMS key.
+type ImportKMSKeySharesInput struct {
+	Alias    string
+	EngineID string
+	Shares   []string
+	Policy   *models.KMSKeyPolicy
+}
+
+// EngineInfo describes a configured crypto engine, along with the statistics
+// of its signer cache when enabled.
+type EngineInfo struct {
+	ID      string `json:"id"`
+	Default bool   `json:"default"`
+	cryptoengines.CryptoEngineInfo
+}
+
+type SyncCryptoEngineInput struct {
+	EngineID string
+	// DryRun only reports the drift, without importing orphaned keys or flagging
+	// keys with missing material.
+	DryRun bool
+}
+
+// EngineDriftReport describes the differences found between the keys held by
+// a crypto engine and the KMS keys stored in the database.
+type EngineDriftReport struct {
+	EngineID string    `json:"engine_id"`
+	DryRun   bool      `json:"dry_run"`
+	SyncTS   time.Time `json:"sync_ts"`
+	// InSync is the number of key versions whose material is held by the engine.
+	InSync int `json:"in_sync"`
+	// OrphanedKeys are engine keys without a KMS key. Unless running a dry run,
+	// they are imported as unmanaged KMS keys.
+	OrphanedKeys []OrphanedEngineKey `json:"orphaned_keys"`
+	// UnrecognizedKeys are engine keys without a KMS key whose type could not be
+	// determined, such as symmetric keys. They are never imported.
+	UnrecognizedKeys []string `json:"unrecognized_keys"`
+	// MissingMaterial are key versions whose material is no longer in the engine.
+	MissingMaterial []KeyVersionReference `json:"missing_material"`
+	// RestoredMaterial are key versions flagged as missing that are back in the engine.
+	RestoredMaterial []KeyVersionReference `json:"restored_material"`
+	// FailedUpdates are KMS keys whose missing material flags could not be
+	// stored, such as keys kept being modified during the sync. The next sync
+	// flags them again.
+	FailedUpdates []string `json:"failed_updates"`
+}
+
+type OrphanedEngineKey struct {
+	EngineKeyID string `json:"engine_key_id"`
+	Algorithm   string `json:"algorithm"`
+	Size        int    `json:"size"`
+	ImportedAs  string `json:"imported_as,omitempty"`
+}
+
+type KeyVersionReference struct {
+	KeyID       string `json:"key_id"`
+	Version     int    `json:"version"`
+	EngineKeyID string `json:"engine_key_id"`
+}
+
+// HasDrift reports whether the engine and the database disagree.
+func (r *EngineDriftReport) HasDrift() bool {
+	return len(r.OrphanedKeys) > 0 || len(r.UnrecognizedKeys) > 0 || len(r.MissingMaterial) > 0 || len(r.RestoredMaterial) > 0
+}
+
+type SignMessageType string
+
+const (
+	SignMessageTypeRaw    SignMessageType = "raw"
+	SignMessageTypeDigest SignMessageType = "digest"
+)
+
+type SignInput struct {
+	ID          string
+	Message     []byte
+	MessageType SignMessageType
+	// Algorithm selects the signature scheme. When empty, RSA keys use PKCS#1
+	// v1.5 with SHA-256, ECDSA keys the hash matching their curve and ML-DSA
+	// keys the algorithm of their parameter set.
+	Algorithm SigningAlgorithm
+}
+
+type SignOutput struct {
+	Signature  []byte
+	KeyVersion int
+	// Algorithm is the signature scheme the signature was created with.
+	Algorithm SigningAlgorithm
+}
+
+type VerifyInput struct {
+	ID          string
+	Message     []byte
+	MessageType SignMessageType
+	Signature   []byte
+	Algorithm   SigningAlgorithm
+	// KeyVersion selects the version to verify with. When zero, every version
+	// that has not been destroyed is tried.
+	KeyVersion int
+}
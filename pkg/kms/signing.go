@@ -0,0 +1,26 @@
+package kms
+
+type SigningAlgorithm string
+
+const (
+	SigningAlgorithmRSAPKCS1v15SHA256 SigningAlgorithm = "RSASSA_PKCS1_V1_5_SHA_256"
+	SigningAlgorithmRSAPKCS1v15SHA384 SigningAlgorithm = "RSASSA_PKCS1_V1_5_SHA_384"
+	SigningAlgorithmRSAPKCS1v15SHA512 SigningAlgorithm = "RSASSA_PKCS1_V1_5_SHA_512"
+	SigningAlgorithmRSAPSSSHA256      SigningAlgorithm = "RSASSA_PSS_SHA_256"
+	SigningAlgorithmRSAPSSSHA384      SigningAlgorithm = "RSASSA_PSS_SHA_384"
+	SigningAlgorithmRSAPSSSHA512      SigningAlgorithm = "RSASSA_PSS_SHA_512"
+	SigningAlgorithmECDSASHA256       SigningAlgorithm = "ECDSA_SHA_256"
+	SigningAlgorithmECDSASHA384       SigningAlgorithm = "ECDSA_SHA_384"
+	SigningAlgorithmECDSASHA512       SigningAlgorithm = "ECDSA_SHA_512"
+	SigningAlgorithmEd25519           SigningAlgorithm = "ED25519"
+	SigningAlgorithmMLDSA44           SigningAlgorithm = "ML_DSA_44"
+	SigningAlgorithmMLDSA65           SigningAlgorithm = "ML_DSA_65"
+	SigningAlgorithmMLDSA87           SigningAlgorithm = "ML_DSA_87"
+)
+
+// Hash names used by key policies.
+const (
+	HashSHA256 = "SHA256"
+	HashSHA384 = "SHA384"
+	HashSHA512 = "SHA512"
+)
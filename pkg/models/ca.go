@@ -1,8 +1,20 @@
 package models
 
+type CAStatus string
+
+const (
+	CAStatusActive   CAStatus = "ACTIVE"
+	CAStatusInactive CAStatus = "INACTIVE"
+)
+
 type CACertificate struct {
-	ID   string `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
-	Name string `gorm:"type:varchar(255);not null" json:"name"`
+	ID     string   `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
+	Name   string   `gorm:"type:varchar(255);not null" json:"name"`
+	KeyID  string   `json:"key_id"`
+	Status CAStatus `json:"status"`
+	// Revision is incremented by every update. Updates made from an earlier
+	// revision are refused.
+	Revision int `json:"revision"`
 }
 
 // TableName overrides the table name used by User to `profiles`
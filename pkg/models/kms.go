@@ -2,17 +2,116 @@ package models
 
 import "time"
 
+const (
+	KMSKeyAlgorithmRSA     = "RSA"
+	KMSKeyAlgorithmECDSA   = "ECDSA"
+	KMSKeyAlgorithmEd25519 = "ED25519"
+	KMSKeyAlgorithmX25519  = "X25519"
+	KMSKeyAlgorithmAES     = "AES"
+	KMSKeyAlgorithmHMAC    = "HMAC"
+	// KMSKeyAlgorithmMLDSA keys are post-quantum ML-DSA (FIPS 204) signing keys.
+	// Their size is the parameter set: 44, 65 or 87.
+	KMSKeyAlgorithmMLDSA = "ML-DSA"
+)
+
+type KMSKeyStatus string
+
+const (
+	KMSKeyStatusEnabled         KMSKeyStatus = "ENABLED"
+	KMSKeyStatusPendingDeletion KMSKeyStatus = "PENDING_DELETION"
+	KMSKeyStatusDeleted         KMSKeyStatus = "DELETED"
+)
+
+type KMSKeyVersionState string
+
+const (
+	KMSKeyVersionStateEnabled   KMSKeyVersionState = "ENABLED"
+	KMSKeyVersionStateDisabled  KMSKeyVersionState = "DISABLED"
+	KMSKeyVersionStateDestroyed KMSKeyVersionState = "DESTROYED"
+)
+
 type KMSKey struct {
-	ID         string         `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
-	Alias      string         `gorm:"type:varchar(255);not null" json:"name"`
-	Algorithm  string         `json:"algorithm"`
-	Size       int            `json:"size"`
-	PublicKey  string         `json:"public_key"`
-	Metadata   map[string]any `json:"metadata,omitempty"`
+	ID                 string          `gorm:"primaryKey;type:uuid;default:gen_random_uuid()" json:"id"`
+	Alias              string          `gorm:"type:varchar(255);not null" json:"name"`
+	Algorithm          string          `json:"algorithm"`
+	Size               int             `json:"size"`
+	EngineID           string          `json:"engine_id"`
+	Status             KMSKeyStatus    `gorm:"default:ENABLED" json:"status"`
+	DeletionTS         *time.Time      `json:"deletion_ts,omitempty"`
+	PrimaryVersion     int             `json:"primary_version"`
+	RotationPeriodDays int             `json:"rotation_period_days,omitempty"`
+	NextRotationTS     *time.Time      `json:"next_rotation_ts,omitempty"`
+	Versions           []KMSKeyVersion `gorm:"foreignKey:KMSKeyID" json:"versions"`
+	Policy             *KMSKeyPolicy   `gorm:"serializer:json" json:"policy,omitempty"`
+	JWKSPublished      bool            `json:"jwks_published"`
+	// Unmanaged keys were found in a crypto engine by reconciliation instead of
+	// being created through the KMS.
+	Unmanaged  bool           `json:"unmanaged"`
+	Metadata   map[string]any `gorm:"serializer:json" json:"metadata,omitempty"`
 	CreationTS time.Time      `json:"creation_ts"`
+	// Revision is incremented by every update. Updates made from an earlier
+	// revision are refused.
+	Revision int `json:"revision"`
 }
 
 // TableName overrides the table name used by User to `profiles`
 func (KMSKey) TableName() string {
 	return "kms_keys"
 }
+
+// GetVersion returns the requested version of the key or nil if it does not exist.
+func (k *KMSKey) GetVersion(version int) *KMSKeyVersion {
+	for i := range k.Versions {
+		if k.Versions[i].Version == version {
+			return &k.Versions[i]
+		}
+	}
+
+	return nil
+}
+
+type KMSKeyOperation string
+
+const (
+	KMSKeyOperationSign    KMSKeyOperation = "sign"
+	KMSKeyOperationVerify  KMSKeyOperation = "verify"
+	KMSKeyOperationEncrypt KMSKeyOperation = "encrypt"
+	KMSKeyOperationDecrypt KMSKeyOperation = "decrypt"
+	// KMSKeyOperationExport governs the private material leaving its crypto
+	// engine. Public keys are not restricted by policies.
+	KMSKeyOperationExport KMSKeyOperation = "export"
+	// KMSKeyOperationAdmin governs changes to the key itself: its policy,
+	// metadata, versions, rotation, deletion and JWKS publication. Policies
+	// listing operations without it can no longer be changed.
+	KMSKeyOperationAdmin KMSKeyOperation = "admin"
+)
+
+// KMSKeyPolicy restricts how a key can be used. Empty lists place no
+// restriction on the corresponding attribute. MAC generation and verification
+// are governed by the sign and verify operations.
+type KMSKeyPolicy struct {
+	AllowedOperations          []KMSKeyOperation `json:"allowed_operations,omitempty"`
+	AllowedSignatureAlgorithms []string          `json:"allowed_signature_algorithms,omitempty"`
+	AllowedHashes              []string          `json:"allowed_hashes,omitempty"`
+	AllowedPrincipals          []string          `json:"allowed_principals,omitempty"`
+	NotBefore                  *time.Time        `json:"not_before,omitempty"`
+	NotAfter                   *time.Time        `json:"not_after,omitempty"`
+}
+
+type KMSKeyVersion struct {
+	KMSKeyID    string             `gorm:"primaryKey;type:uuid" json:"-"`
+	Version     int                `gorm:"primaryKey" json:"version"`
+	EngineKeyID string             `json:"engine_key_id"`
+	PublicKey   string             `json:"public_key,omitempty"`
+	State       KMSKeyVersionState `json:"state"`
+	CreationTS  time.Time          `json:"creation_ts"`
+	// SupersededTS is set when a rotation replaces this version as the primary one.
+	SupersededTS *time.Time `json:"superseded_ts,omitempty"`
+	// MaterialMissing is set by reconciliation when the crypto engine no longer
+	// holds the key material of this version.
+	MaterialMissing bool `json:"material_missing"`
+}
+
+func (KMSKeyVersion) TableName() string {
+	return "kms_key_versions"
+}
@@ -0,0 +1,7 @@
+package config
+
+type SQLiteConfig struct {
+	// Directory holds one database file per service. When empty, databases are
+	// kept in memory and lost on restart.
+	Directory string `mapstructure:"directory"`
+}
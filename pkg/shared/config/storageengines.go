@@ -1,16 +1,35 @@
 package config
 
-import "github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
+import (
+	"time"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
+)
 
 type PluggableStorageEngine struct {
 	LogLevel logger.Level `mapstructure:"log_level"`
 
-	Provider StorageProvider        `mapstructure:"provider"`
-	Config   map[string]interface{} `mapstructure:"config,remain"`
+	Provider  StorageProvider        `mapstructure:"provider"`
+	Bookmarks BookmarksConfig        `mapstructure:"bookmarks"`
+	Config    map[string]interface{} `mapstructure:"config,remain"`
+}
+
+// BookmarksConfig configures the signing of the pagination bookmarks handed to
+// clients.
+type BookmarksConfig struct {
+	// SigningKey authenticates bookmarks, and must be shared by the replicas of
+	// a service. When empty, a random key is used and bookmarks are lost on
+	// restart.
+	SigningKey Password `mapstructure:"signing_key"`
+	// TTL is how long a bookmark can be used. Defaults to 24 hours.
+	TTL time.Duration `mapstructure:"ttl"`
 }
 
 type StorageProvider string
 
 const (
 	Postgres StorageProvider = "postgres"
+	SQLite   StorageProvider = "sqlite"
+	// Memory keeps everything in process memory, and loses it on restart.
+	Memory StorageProvider = "memory"
 )
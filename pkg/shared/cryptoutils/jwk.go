@@ -0,0 +1,166 @@
+package cryptoutils
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"filippo.io/mldsa"
+)
+
+// JWK is the JSON Web Key (RFC 7517) representation of a public key.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	Pub string `json:"pub,omitempty"`
+}
+
+// PublicKeyToJWK converts an RSA, ECDSA, Ed25519, X25519 or ML-DSA public key to
+// its JWK form. ML-DSA keys use the AKP key type, identified by their algorithm.
+func PublicKeyToJWK(key any) (*JWK, error) {
+	b64 := base64.RawURLEncoding
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		return &JWK{
+			Kty: "RSA",
+			N:   b64.EncodeToString(pub.N.Bytes()),
+			E:   b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		ecdhPub, err := pub.ECDH()
+		if err != nil {
+			return nil, err
+		}
+
+		// Uncompressed point: 0x04 || X || Y, each coordinate padded to the curve size.
+		point := ecdhPub.Bytes()[1:]
+		size := len(point) / 2
+		return &JWK{
+			Kty: "EC",
+			Crv: pub.Curve.Params().Name,
+			X:   b64.EncodeToString(point[:size]),
+			Y:   b64.EncodeToString(point[size:]),
+		}, nil
+	case ed25519.PublicKey:
+		return &JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   b64.EncodeToString(pub),
+		}, nil
+	case *ecdh.PublicKey:
+		if pub.Curve() != ecdh.X25519() {
+			return nil, fmt.Errorf("unsupported ECDH curve %s", pub.Curve())
+		}
+
+		return &JWK{
+			Kty: "OKP",
+			Crv: "X25519",
+			X:   b64.EncodeToString(pub.Bytes()),
+		}, nil
+	case *mldsa.PublicKey:
+		return &JWK{
+			Kty: "AKP",
+			Alg: pub.Parameters().String(),
+			Pub: b64.EncodeToString(pub.Bytes()),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+}
+
+// PublicKey returns the public key held by the JWK.
+func (jwk *JWK) PublicKey() (any, error) {
+	b64 := base64.RawURLEncoding
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := b64.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := b64.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-224":
+			curve = elliptic.P224()
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+
+		x, err := b64.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := b64.DecodeString(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		pub := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("point is not on curve")
+		}
+
+		return pub, nil
+	case "OKP":
+		x, err := b64.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+
+		switch jwk.Crv {
+		case "Ed25519":
+			if len(x) != ed25519.PublicKeySize {
+				return nil, errors.New("invalid Ed25519 public key size")
+			}
+			return ed25519.PublicKey(x), nil
+		case "X25519":
+			return ecdh.X25519().NewPublicKey(x)
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", jwk.Crv)
+		}
+	case "AKP":
+		pub, err := b64.DecodeString(jwk.Pub)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, set := range mldsaParameterSets {
+			if set.params.String() == jwk.Alg {
+				return mldsa.NewPublicKey(set.params, pub)
+			}
+		}
+
+		return nil, fmt.Errorf("unsupported algorithm %s", jwk.Alg)
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", jwk.Kty)
+	}
+}
@@ -0,0 +1,173 @@
+package cryptoutils
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+
+	"filippo.io/mldsa"
+)
+
+// mldsaParameterSet ties an ML-DSA parameter set to its object identifier (RFC
+// 9881) and to the size used to identify it in the KMS, its NIST name suffix.
+type mldsaParameterSet struct {
+	size   int
+	oid    asn1.ObjectIdentifier
+	params *mldsa.Parameters
+}
+
+var mldsaParameterSets = []mldsaParameterSet{
+	{size: 44, oid: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 3, 17}, params: mldsa.MLDSA44()},
+	{size: 65, oid: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 3, 18}, params: mldsa.MLDSA65()},
+	{size: 87, oid: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 3, 19}, params: mldsa.MLDSA87()},
+}
+
+// MLDSAParameters returns the ML-DSA parameter set identified by size: 44, 65 or 87.
+func MLDSAParameters(size int) (*mldsa.Parameters, bool) {
+	for _, set := range mldsaParameterSets {
+		if set.size == size {
+			return set.params, true
+		}
+	}
+
+	return nil, false
+}
+
+// MLDSASize returns the size identifying an ML-DSA parameter set, 65 for ML-DSA-65.
+func MLDSASize(params *mldsa.Parameters) int {
+	for _, set := range mldsaParameterSets {
+		if set.params == params {
+			return set.size
+		}
+	}
+
+	return 0
+}
+
+func mldsaParameterSetByOID(oid asn1.ObjectIdentifier) (mldsaParameterSet, bool) {
+	for _, set := range mldsaParameterSets {
+		if set.oid.Equal(oid) {
+			return set, true
+		}
+	}
+
+	return mldsaParameterSet{}, false
+}
+
+func mldsaParameterSetByParams(params *mldsa.Parameters) mldsaParameterSet {
+	for _, set := range mldsaParameterSets {
+		if set.params == params {
+			return set
+		}
+	}
+
+	return mldsaParameterSet{}
+}
+
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+type pkcs8PrivateKey struct {
+	Version    int
+	Algorithm  pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// MarshalPKIXPublicKey works like x509.MarshalPKIXPublicKey, and also encodes
+// ML-DSA public keys as specified in RFC 9881.
+func MarshalPKIXPublicKey(key any) ([]byte, error) {
+	pub, ok := key.(*mldsa.PublicKey)
+	if !ok {
+		return x509.MarshalPKIXPublicKey(key)
+	}
+
+	set := mldsaParameterSetByParams(pub.Parameters())
+	publicKey := pub.Bytes()
+	return asn1.Marshal(subjectPublicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: set.oid},
+		PublicKey: asn1.BitString{Bytes: publicKey, BitLength: 8 * len(publicKey)},
+	})
+}
+
+// ParsePKIXPublicKey works like x509.ParsePKIXPublicKey, and also parses ML-DSA
+// public keys, returned as *mldsa.PublicKey.
+func ParsePKIXPublicKey(der []byte) (any, error) {
+	var spki subjectPublicKeyInfo
+	if rest, err := asn1.Unmarshal(der, &spki); err != nil || len(rest) != 0 {
+		return x509.ParsePKIXPublicKey(der)
+	}
+
+	set, ok := mldsaParameterSetByOID(spki.Algorithm.Algorithm)
+	if !ok {
+		return x509.ParsePKIXPublicKey(der)
+	}
+
+	if len(spki.Algorithm.Parameters.FullBytes) != 0 || spki.PublicKey.BitLength%8 != 0 {
+		return nil, errors.New("invalid ML-DSA public key encoding")
+	}
+
+	return mldsa.NewPublicKey(set.params, spki.PublicKey.Bytes)
+}
+
+// MarshalPKCS8PrivateKey works like x509.MarshalPKCS8PrivateKey, and also
+// encodes ML-DSA private keys in the seed form of RFC 9881.
+func MarshalPKCS8PrivateKey(key any) ([]byte, error) {
+	priv, ok := key.(*mldsa.PrivateKey)
+	if !ok {
+		return x509.MarshalPKCS8PrivateKey(key)
+	}
+
+	seed, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: priv.Bytes()})
+	if err != nil {
+		return nil, err
+	}
+
+	set := mldsaParameterSetByParams(priv.PublicKey().Parameters())
+	return asn1.Marshal(pkcs8PrivateKey{
+		Algorithm:  pkix.AlgorithmIdentifier{Algorithm: set.oid},
+		PrivateKey: seed,
+	})
+}
+
+// ParsePKCS8PrivateKey works like x509.ParsePKCS8PrivateKey, and also parses
+// ML-DSA private keys, returned as *mldsa.PrivateKey. Only the seed and the
+// seed and expanded key forms are accepted, as the seed cannot be recovered
+// from the expanded key alone.
+func ParsePKCS8PrivateKey(der []byte) (any, error) {
+	var pkcs8 pkcs8PrivateKey
+	if _, err := asn1.Unmarshal(der, &pkcs8); err != nil {
+		return x509.ParsePKCS8PrivateKey(der)
+	}
+
+	set, ok := mldsaParameterSetByOID(pkcs8.Algorithm.Algorithm)
+	if !ok {
+		return x509.ParsePKCS8PrivateKey(der)
+	}
+
+	var choice asn1.RawValue
+	if rest, err := asn1.Unmarshal(pkcs8.PrivateKey, &choice); err != nil || len(rest) != 0 {
+		return nil, errors.New("invalid ML-DSA private key encoding")
+	}
+
+	var seed []byte
+	switch {
+	case choice.Class == asn1.ClassContextSpecific && choice.Tag == 0 && !choice.IsCompound:
+		seed = choice.Bytes
+	case choice.Class == asn1.ClassUniversal && choice.Tag == asn1.TagSequence:
+		var both struct {
+			Seed        []byte
+			ExpandedKey []byte
+		}
+		if _, err := asn1.Unmarshal(choice.FullBytes, &both); err != nil {
+			return nil, errors.New("invalid ML-DSA private key encoding")
+		}
+		seed = both.Seed
+	default:
+		return nil, errors.New("unsupported ML-DSA private key form")
+	}
+
+	return mldsa.NewPrivateKey(set.params, seed)
+}
@@ -0,0 +1,85 @@
+package cryptoutils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"testing"
+
+	"filippo.io/mldsa"
+)
+
+func TestMLDSAKeyEncodingRoundTrip(t *testing.T) {
+	message := []byte("message")
+
+	for _, params := range []*mldsa.Parameters{mldsa.MLDSA44(), mldsa.MLDSA65(), mldsa.MLDSA87()} {
+		t.Run(params.String(), func(t *testing.T) {
+			key, err := mldsa.GenerateKey(params)
+			if err != nil {
+				t.Fatalf("could not generate key: %s", err)
+			}
+
+			der, err := MarshalPKCS8PrivateKey(key)
+			if err != nil {
+				t.Fatalf("could not marshal private key: %s", err)
+			}
+
+			parsed, err := ParsePKCS8PrivateKey(der)
+			if err != nil {
+				t.Fatalf("could not parse private key: %s", err)
+			}
+
+			parsedKey, ok := parsed.(*mldsa.PrivateKey)
+			if !ok || !parsedKey.Equal(key) {
+				t.Fatalf("parsed private key does not match the marshalled one")
+			}
+
+			pubDER, err := MarshalPKIXPublicKey(key.PublicKey())
+			if err != nil {
+				t.Fatalf("could not marshal public key: %s", err)
+			}
+
+			parsedPub, err := ParsePKIXPublicKey(pubDER)
+			if err != nil {
+				t.Fatalf("could not parse public key: %s", err)
+			}
+
+			pub, ok := parsedPub.(*mldsa.PublicKey)
+			if !ok || !pub.Equal(key.PublicKey()) {
+				t.Fatalf("parsed public key does not match the marshalled one")
+			}
+
+			// A signature of the parsed private key verifies with the parsed public key.
+			signature, err := parsedKey.Sign(rand.Reader, message, &mldsa.Options{})
+			if err != nil {
+				t.Fatalf("could not sign: %s", err)
+			}
+
+			if err := mldsa.Verify(pub, message, signature, nil); err != nil {
+				t.Errorf("signature does not verify: %s", err)
+			}
+
+			if err := mldsa.Verify(pub, []byte("other message"), signature, nil); err == nil {
+				t.Errorf("signature verifies another message")
+			}
+		})
+	}
+}
+
+func TestPKCS8PrivateKeyOtherAlgorithms(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	der, err := MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("could not marshal private key: %s", err)
+	}
+
+	parsed, err := ParsePKCS8PrivateKey(der)
+	if err != nil {
+		t.Fatalf("could not parse private key: %s", err)
+	}
+
+	if parsedKey, ok := parsed.(*ecdsa.PrivateKey); !ok || !parsedKey.Equal(key) {
+		t.Errorf("parsed private key does not match the marshalled one")
+	}
+}
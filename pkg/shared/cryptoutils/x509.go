@@ -13,8 +13,11 @@ import (
 	"fmt"
 	"math/big"
 	"os"
+	"strings"
 
+	"filippo.io/mldsa"
 	"github.com/gofiber/fiber/v2/log"
+	"golang.org/x/crypto/ssh"
 )
 
 // ReadCertificateFromFile reads and parses an X.509 certificate from a file
@@ -70,9 +73,9 @@ func ParsePrivateKey(privKeyBytes []byte) (interface{}, error) {
 	if key, err := x509.ParsePKCS1PrivateKey(keyDERBlock.Bytes); err == nil {
 		return key, nil
 	}
-	if key, err := x509.ParsePKCS8PrivateKey(keyDERBlock.Bytes); err == nil {
+	if key, err := ParsePKCS8PrivateKey(keyDERBlock.Bytes); err == nil {
 		switch key := key.(type) {
-		case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
+		case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey, *mldsa.PrivateKey:
 			return key, nil
 		default:
 			return nil, errors.New("tls: found unknown private key type in PKCS#8 wrapping")
@@ -93,7 +96,7 @@ func CertificateToPEM(c *x509.Certificate) string {
 
 // PrivateKeyToPEM converts a private key to PEM-encoded string using PKCS#8 format
 func PrivateKeyToPEM(key any) (string, error) {
-	b, err := x509.MarshalPKCS8PrivateKey(key)
+	b, err := MarshalPKCS8PrivateKey(key)
 	if err != nil {
 		return "", err
 	}
@@ -108,7 +111,59 @@ func PrivateKeyToPEM(key any) (string, error) {
 	return string(pemdata), nil
 }
 
+// PublicKeyToPEM converts a public key to PEM-encoded string using PKIX format
+func PublicKeyToPEM(key any) (string, error) {
+	b, err := MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	pemdata := pem.EncodeToMemory(
+		&pem.Block{
+			Type:  "PUBLIC KEY",
+			Bytes: b,
+		},
+	)
+
+	return string(pemdata), nil
+}
+
+// ParsePublicKey parses a PKIX public key from PEM-encoded string
+func ParsePublicKey(pubKey string) (any, error) {
+	pubKeyDERBlock, _ := pem.Decode([]byte(pubKey))
+	if pubKeyDERBlock == nil {
+		return nil, fmt.Errorf("failed to decode PEM public key")
+	}
+	return ParsePKIXPublicKey(pubKeyDERBlock.Bytes)
+}
+
 // GenerateSelfSignedCertificate generates a self-signed X.509 certificate for the given key and common name
+// PublicKeyToDER returns the PKIX, ASN.1 DER encoding of the public key.
+func PublicKeyToDER(key any) ([]byte, error) {
+	return MarshalPKIXPublicKey(key)
+}
+
+// PublicKeyToSSH returns the public key in OpenSSH authorized_keys format.
+func PublicKeyToSSH(key any) (string, error) {
+	sshKey, err := ssh.NewPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshKey))), nil
+}
+
+// SSHFingerprint returns the OpenSSH SHA-256 fingerprint of the public key, as
+// printed by ssh-keygen -l.
+func SSHFingerprint(key any) (string, error) {
+	sshKey, err := ssh.NewPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	return ssh.FingerprintSHA256(sshKey), nil
+}
+
 func GenerateSelfSignedCertificate(key crypto.Signer, cn string) (*x509.Certificate, error) {
 	sn, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 160))
 	if err != nil {
@@ -2,9 +2,11 @@ package server
 
 import (
 	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"net"
+	"os"
 	"sync"
 	"time"
 
@@ -99,6 +101,13 @@ func RunHttpServer(log *logger.Logger, routerEngine *fiber.App, httpServerCfg co
 			}
 
 			tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+			if httpServerCfg.Authentication.MutualTLS.Enabled {
+				err = configureMutualTLS(tlsConfig, httpServerCfg.Authentication.MutualTLS)
+				if err != nil {
+					log.Fatalf("failed to configure mutual TLS: %v", err)
+					httpErrChan <- err
+				}
+			}
 			tlsListener := tls.NewListener(listener, tlsConfig)
 
 			err = mainEngine.Listener(tlsListener)
@@ -121,3 +130,39 @@ func RunHttpServer(log *logger.Logger, routerEngine *fiber.App, httpServerCfg co
 
 	return usedPort, nil
 }
+
+func configureMutualTLS(tlsConfig *tls.Config, conf config.HttpServerMutualTLSAuthentication) error {
+	switch conf.ValidationMode {
+	case config.Strict:
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	case config.Request:
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case config.Any:
+		tlsConfig.ClientAuth = tls.RequireAnyClientCert
+	default:
+		return fmt.Errorf("unknown mutual TLS validation mode %s", conf.ValidationMode)
+	}
+
+	if conf.CACertificateFile == "" {
+		// Client certificates would otherwise be verified against the system
+		// roots, and any public CA could issue one for a chosen principal.
+		if conf.ValidationMode != config.Any {
+			return fmt.Errorf("mutual TLS validation mode %s requires a CA certificate file", conf.ValidationMode)
+		}
+
+		return nil
+	}
+
+	caPEM, err := os.ReadFile(conf.CACertificateFile)
+	if err != nil {
+		return err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return fmt.Errorf("no certificates found in %s", conf.CACertificateFile)
+	}
+
+	tlsConfig.ClientCAs = pool
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/auth"
 )
 
 const CtxKey = "context"
@@ -12,6 +13,9 @@ const CtxKey = "context"
 func WithContext(timeout time.Duration) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		if principal := clientCertificatePrincipal(c); principal != "" {
+			ctx = auth.WithPrincipal(ctx, principal)
+		}
 
 		// Guardar en c.Locals para acceso posterior
 		c.Locals(CtxKey, ctx)
@@ -23,6 +27,17 @@ func WithContext(timeout time.Duration) fiber.Handler {
 	}
 }
 
+// clientCertificatePrincipal returns the common name of the client certificate
+// when it was verified against the configured mTLS trust anchors.
+func clientCertificatePrincipal(c *fiber.Ctx) string {
+	state := c.Context().TLSConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 {
+		return ""
+	}
+
+	return state.VerifiedChains[0][0].Subject.CommonName
+}
+
 func GetRequestContext(c *fiber.Ctx) context.Context {
 	if ctx, ok := c.Locals(CtxKey).(context.Context); ok {
 		return ctx
@@ -0,0 +1,242 @@
+package resources
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ExportFormat string
+
+const (
+	ExportFormatNDJSON ExportFormat = "ndjson"
+	ExportFormatCSV    ExportFormat = "csv"
+)
+
+// ExportBatchSize is the number of elements exports read from storage at once.
+const ExportBatchSize = 500
+
+var ErrInvalidExport = errors.New("invalid export")
+
+type ExportOptions struct {
+	Format ExportFormat
+	// Columns are the JSON fields of the elements written as CSV columns, in
+	// order. NDJSON exports write whole elements.
+	Columns []string
+}
+
+func (o ExportOptions) ContentType() string {
+	if o.Format == ExportFormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// ExportQuery parses the format and the comma separated CSV columns of an
+// export. Columns default to defaultColumns and must be JSON fields of E.
+func ExportQuery[E any](f *fiber.Ctx, defaultColumns []string) (ExportOptions, error) {
+	options := ExportOptions{
+		Format:  ExportFormat(f.Query("format", string(ExportFormatNDJSON))),
+		Columns: defaultColumns,
+	}
+
+	if options.Format != ExportFormatNDJSON && options.Format != ExportFormatCSV {
+		return options, fmt.Errorf("%w: unsupported format %q", ErrInvalidExport, options.Format)
+	}
+
+	if columns := f.Query("columns"); columns != "" {
+		options.Columns = strings.Split(columns, ",")
+	}
+
+	fields := jsonFields(reflect.TypeFor[E]())
+	for _, column := range options.Columns {
+		if !slices.Contains(fields, column) {
+			return options, fmt.Errorf("%w: unknown column %q", ErrInvalidExport, column)
+		}
+	}
+
+	return options, nil
+}
+
+// StreamExport streams the elements of a list to the client, as name.<format>.
+// The list runs once the handler returns, so its context outlives the request
+// context, and is canceled when the client goes away.
+func StreamExport[E any](f *fiber.Ctx, ctx context.Context, options ExportOptions, name string, list func(ctx context.Context, applyFunc func(elem E)) error) error {
+	f.Attachment(name + "." + string(options.Format))
+	f.Set(fiber.HeaderContentType, options.ContentType())
+
+	ctx = context.WithoutCancel(ctx)
+	f.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		writer, err := NewExportWriter[E](w, options)
+		if err != nil {
+			return
+		}
+
+		var writeErr error
+		err = list(ctx, func(elem E) {
+			if writeErr != nil {
+				return
+			}
+			if writeErr = writer.Write(elem); writeErr != nil {
+				cancel()
+			}
+		})
+		if writeErr != nil {
+			return
+		}
+
+		if err != nil {
+			writer.Fail(err)
+			return
+		}
+		writer.Flush()
+	})
+
+	return nil
+}
+
+// jsonFields returns the names of the JSON fields of a struct.
+func jsonFields(t reflect.Type) []string {
+	fields := []string{}
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() || field.Anonymous {
+			continue
+		}
+
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch name {
+		case "-":
+			continue
+		case "":
+			name = field.Name
+		}
+		fields = append(fields, name)
+	}
+
+	return fields
+}
+
+// ExportWriter writes elements in the format of an export, flushing every
+// ExportBatchSize elements.
+type ExportWriter[E any] struct {
+	options ExportOptions
+	w       io.Writer
+	csv     *csv.Writer
+	json    *json.Encoder
+	pending int
+}
+
+// NewExportWriter returns a writer of elements to w. CSV exports start with
+// their header.
+func NewExportWriter[E any](w io.Writer, options ExportOptions) (*ExportWriter[E], error) {
+	writer := &ExportWriter[E]{options: options, w: w}
+	if options.Format != ExportFormatCSV {
+		writer.json = json.NewEncoder(w)
+		return writer, nil
+	}
+
+	writer.csv = csv.NewWriter(w)
+	if err := writer.csv.Write(options.Columns); err != nil {
+		return nil, err
+	}
+
+	return writer, nil
+}
+
+func (e *ExportWriter[E]) Write(elem E) error {
+	if e.csv == nil {
+		if err := e.json.Encode(elem); err != nil {
+			return err
+		}
+	} else {
+		record, err := e.record(elem)
+		if err != nil {
+			return err
+		}
+
+		if err := e.csv.Write(record); err != nil {
+			return err
+		}
+	}
+
+	e.pending++
+	if e.pending < ExportBatchSize {
+		return nil
+	}
+
+	return e.Flush()
+}
+
+// record returns the CSV columns of an element. Strings are written as is,
+// other values as JSON.
+func (e *ExportWriter[E]) record(elem E) ([]string, error) {
+	encoded, err := json.Marshal(elem)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+
+	record := make([]string, 0, len(e.options.Columns))
+	for _, column := range e.options.Columns {
+		value := fields[column]
+		switch {
+		case value == nil, string(value) == "null":
+			record = append(record, "")
+		case value[0] == '"':
+			var text string
+			if err := json.Unmarshal(value, &text); err != nil {
+				return nil, err
+			}
+			record = append(record, text)
+		default:
+			record = append(record, string(value))
+		}
+	}
+
+	return record, nil
+}
+
+// Fail ends an export that could not be completed. NDJSON exports end with an
+// object holding the error, while CSV exports are cut short.
+func (e *ExportWriter[E]) Fail(err error) error {
+	if e.json != nil {
+		if err := e.json.Encode(fiber.Map{"err": err.Error()}); err != nil {
+			return err
+		}
+	}
+
+	return e.Flush()
+}
+
+// Flush writes buffered elements through to the client.
+func (e *ExportWriter[E]) Flush() error {
+	e.pending = 0
+	if e.csv != nil {
+		e.csv.Flush()
+		if err := e.csv.Error(); err != nil {
+			return err
+		}
+	}
+
+	if flusher, ok := e.w.(interface{ Flush() error }); ok {
+		return flusher.Flush()
+	}
+
+	return nil
+}
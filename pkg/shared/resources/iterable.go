@@ -8,6 +8,9 @@ type Iterator[E any] interface {
 type IterableList[E any] struct {
 	NextBookmark string `json:"next"`
 	List         []E    `json:"list"`
+	// Total is the number of elements matching the filters of the list, over
+	// all pages. It is only set when requested with include_total.
+	Total *int `json:"total,omitempty"`
 }
 
 func (itr IterableList[E]) GetList() []E {
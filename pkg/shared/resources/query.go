@@ -1,5 +1,12 @@
 package resources
 
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
 type SortMode string
 
 const (
@@ -26,13 +33,25 @@ type FilterOption struct {
 	Field           string
 	FilterOperation FilterOperation
 	Value           string
+	// Values holds the operands of In and NotIn, and the lower and upper
+	// bounds of the Between operations.
+	Values []string `json:",omitempty"`
 }
 
 type QueryParameters struct {
 	NextBookmark string
-	Sort         SortOptions
-	PageSize     int
-	Filters      []FilterOption
+	// BookmarkScope binds bookmarks to the list they were issued for: a
+	// bookmark is only accepted with the scope it was issued with.
+	BookmarkScope string
+	Sort          SortOptions
+	PageSize      int
+	Filters       []FilterOption
+	// FilterGroups match when any of their filters does. Groups are AND-ed
+	// with each other and with Filters.
+	FilterGroups [][]FilterOption
+	// IncludeTotal requests the number of elements matching the filters
+	// along with the page.
+	IncludeTotal bool
 }
 
 type FilterFieldType int
@@ -45,6 +64,64 @@ const (
 	EnumFilterFieldType
 )
 
+// FilterField maps a field clients filter and sort lists by to the column
+// storing it.
+type FilterField struct {
+	Type   FilterFieldType
+	Column string
+	// Path selects a value nested in a JSON column, such as the common name in
+	// a subject. Such fields can be filtered but not sorted by. String array
+	// fields are JSON arrays when they have a path, and Postgres arrays
+	// otherwise.
+	Path []string
+}
+
+func (f FilterField) Sortable() bool {
+	return len(f.Path) == 0
+}
+
+// FilterFields are the fields of a resource, by name. A field named with a
+// ".*" suffix, such as "metadata.*", stands for the keys of a JSON column:
+// "metadata.team" selects the team key.
+type FilterFields map[string]FilterField
+
+var jsonKeyPath = regexp.MustCompile(`^[A-Za-z0-9_-]+(\.[A-Za-z0-9_-]+)*$`)
+
+// Lookup returns the named field, resolving the keys of JSON columns.
+func (f FilterFields) Lookup(name string) (FilterField, bool) {
+	if field, ok := f[name]; ok {
+		return field, true
+	}
+
+	prefix, keys, found := strings.Cut(name, ".")
+	if !found || !jsonKeyPath.MatchString(keys) {
+		return FilterField{}, false
+	}
+
+	field, ok := f[prefix+".*"]
+	if !ok {
+		return FilterField{}, false
+	}
+
+	field.Path = append(slices.Clone(field.Path), strings.Split(keys, ".")...)
+	return field, true
+}
+
+// Select returns the named fields, for instance those exposed by an endpoint.
+// Field sets are declared statically, so unknown names panic.
+func (f FilterFields) Select(names ...string) FilterFields {
+	selected := FilterFields{}
+	for _, name := range names {
+		field, ok := f[name]
+		if !ok {
+			panic(fmt.Sprintf("unknown field %q", name))
+		}
+		selected[name] = field
+	}
+
+	return selected
+}
+
 type FilterOperation int
 
 const (
@@ -75,6 +152,17 @@ const (
 
 	EnumEqual
 	EnumNotEqual
+
+	// In, NotIn, IsNull and NotNull apply to fields of any type. NULL values
+	// never match In nor NotIn.
+	In
+	NotIn
+	IsNull
+	NotNull
+
+	// Ranges include their bounds.
+	DateBetween
+	NumberBetween
 )
 
 type ListInput[E any] struct {
@@ -0,0 +1,49 @@
+package resources
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ConflictError is returned by writes made from a stale revision of a
+// resource: it was modified since it was read.
+type ConflictError struct {
+	ID       string
+	Revision int
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s was modified since revision %d", e.ID, e.Revision)
+}
+
+var ErrInvalidIfMatch = errors.New("invalid If-Match header")
+
+// ETag returns the entity tag of a resource at a revision.
+func ETag(revision int) string {
+	return strconv.Quote(strconv.Itoa(revision))
+}
+
+// IfMatch returns the revision required by the If-Match header of a request,
+// or nil when any revision is accepted.
+func IfMatch(f *fiber.Ctx) (*int, error) {
+	header := strings.TrimSpace(f.Get(fiber.HeaderIfMatch))
+	if header == "" || header == "*" {
+		return nil, nil
+	}
+
+	tag, err := strconv.Unquote(header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidIfMatch, header)
+	}
+
+	revision, err := strconv.Atoi(tag)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidIfMatch, header)
+	}
+
+	return &revision, nil
+}
@@ -1,6 +1,10 @@
 package resources
 
 import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
 	"strconv"
 	"strings"
 
@@ -14,14 +18,29 @@ type StorageListRequest[E any] struct {
 	ExtraOpts     map[string]interface{}
 }
 
-func FilterQuery(f *fiber.Ctx, filterFieldMap map[string]FilterFieldType) *QueryParameters {
+// ErrInvalidQuery is returned for list queries sorting or filtering by fields
+// that are not listed as filterable, or with malformed filters.
+var ErrInvalidQuery = errors.New("invalid query")
+
+// FilterQuery parses the list query parameters of a request. Sorting by a field
+// that is not sortable and malformed filters, or filters on fields that are not
+// filterable, are rejected with ErrInvalidQuery rather than ignored, as they
+// would otherwise return more elements than requested.
+func FilterQuery(f *fiber.Ctx, filterFieldMap FilterFields) (*QueryParameters, error) {
 	queryParams := QueryParameters{
-		NextBookmark: "",
-		Filters:      []FilterOption{},
-		PageSize:     25,
+		NextBookmark:  "",
+		BookmarkScope: bookmarkScope(f, filterFieldMap),
+		Filters:       []FilterOption{},
+		PageSize:      25,
 	}
 
+	groups := []string{}
+	var queryErr error
 	f.Context().QueryArgs().VisitAll(func(k, value []byte) {
+		if queryErr != nil {
+			return
+		}
+
 		v := []string{string(value)}
 		switch string(k) {
 		case "sort_by":
@@ -29,11 +48,14 @@ func FilterQuery(f *fiber.Ctx, filterFieldMap map[string]FilterFieldType) *Query
 			sortQueryParam := value
 			sortField := strings.Trim(sortQueryParam, " ")
 
-			_, exists := filterFieldMap[sortField]
-			if exists {
-				queryParams.Sort.SortField = sortField
+			field, exists := filterFieldMap[sortField]
+			if !exists || !field.Sortable() {
+				queryErr = fmt.Errorf("%w: cannot sort by %q", ErrInvalidQuery, sortField)
+				return
 			}
 
+			queryParams.Sort.SortField = sortField
+
 		case "sort_mode":
 			value := v[len(v)-1] //only get last
 			sortQueryParam := value
@@ -56,93 +78,277 @@ func FilterQuery(f *fiber.Ctx, filterFieldMap map[string]FilterFieldType) *Query
 			value := v[len(v)-1] //only get last
 			queryParams.NextBookmark = value
 
+		case "include_total":
+			value := v[len(v)-1] //only get last
+			includeTotal, err := strconv.ParseBool(value)
+			if err == nil {
+				queryParams.IncludeTotal = includeTotal
+			}
+
 		case "filter":
 			for _, value := range v {
-				bs := strings.Index(value, "[")
-				es := strings.Index(value, "]")
-				if bs != -1 && es != -1 && bs < es {
-					field, rest, _ := strings.Cut(value, "[")
-					operand, arg, _ := strings.Cut(rest, "]")
-					operand = strings.ToLower(operand)
-
-					fieldOperandType, exists := filterFieldMap[field]
-					if !exists {
-						continue
-					}
-
-					var filterOperand FilterOperation
-					switch fieldOperandType {
-					case StringFilterFieldType:
-						switch operand {
-						case "eq", "equal":
-							filterOperand = StringEqual
-						case "eq_ic", "equal_ignorecase":
-							filterOperand = StringEqualIgnoreCase
-						case "ne", "notequal":
-							filterOperand = StringNotEqual
-						case "ne_ic", "notequal_ignorecase":
-							filterOperand = StringNotEqualIgnoreCase
-						case "ct", "contains":
-							filterOperand = StringContains
-						case "ct_ic", "contains_ignorecase":
-							filterOperand = StringContainsIgnoreCase
-						case "nc", "notcontains":
-							filterOperand = StringNotContains
-						case "nc_ic", "notcontains_ignorecase":
-							filterOperand = StringNotContainsIgnoreCase
-						}
-
-					case StringArrayFilterFieldType:
-						if strings.Contains(operand, "ignorecase") {
-							filterOperand = StringArrayContainsIgnoreCase
-						} else {
-							filterOperand = StringArrayContains
-						}
-
-					case DateFilterFieldType:
-						switch operand {
-						case "bf", "before":
-							filterOperand = DateBefore
-						case "eq", "equal":
-							filterOperand = DateEqual
-						case "af", "after":
-							filterOperand = DateAfter
-						}
-					case NumberFilterFieldType:
-						switch operand {
-						case "eq", "equal":
-							filterOperand = NumberEqual
-						case "ne", "notequal":
-							filterOperand = NumberNotEqual
-						case "lt", "lessthan":
-							filterOperand = NumberLessThan
-						case "le", "lessequal", "lessorequal":
-							filterOperand = NumberLessOrEqualThan
-						case "gt", "greaterthan":
-							filterOperand = NumberGreaterThan
-						case "ge", "greaterequal", "greaterorequal":
-							filterOperand = NumberGreaterOrEqualThan
-						}
-					case EnumFilterFieldType:
-						switch operand {
-						case "eq", "equal":
-							filterOperand = EnumEqual
-						case "ne", "notequal":
-							filterOperand = EnumNotEqual
-						}
-					}
-					if exists {
-						queryParams.Filters = append(queryParams.Filters, FilterOption{
-							Field:           field,
-							Value:           arg,
-							FilterOperation: filterOperand,
-						})
-					}
+				filter, err := parseFilter(value, filterFieldMap)
+				if err != nil {
+					queryErr = err
+					return
+				}
+
+				queryParams.Filters = append(queryParams.Filters, filter)
+			}
+
+		default:
+			// filter_or and filter_or.<group> hold the filters of OR groups.
+			key, group, _ := strings.Cut(string(k), ".")
+			if key != "filter_or" {
+				return
+			}
+
+			for _, value := range v {
+				filter, err := parseFilter(value, filterFieldMap)
+				if err != nil {
+					queryErr = err
+					return
 				}
 
+				idx := slices.Index(groups, group)
+				if idx == -1 {
+					groups = append(groups, group)
+					queryParams.FilterGroups = append(queryParams.FilterGroups, nil)
+					idx = len(groups) - 1
+				}
+				queryParams.FilterGroups[idx] = append(queryParams.FilterGroups[idx], filter)
 			}
 		}
 	})
+	if queryErr != nil {
+		return nil, queryErr
+	}
+
+	return &queryParams, nil
+}
+
+// parseFilter parses a "field[operand]value" filter. In, NotIn and Between
+// take comma separated values.
+func parseFilter(value string, filterFieldMap FilterFields) (FilterOption, error) {
+	bs := strings.Index(value, "[")
+	es := strings.Index(value, "]")
+	if bs == -1 || es == -1 || bs > es {
+		return FilterOption{}, fmt.Errorf("%w: malformed filter %q, expected field[operand]value", ErrInvalidQuery, value)
+	}
+
+	field, rest, _ := strings.Cut(value, "[")
+	operand, arg, _ := strings.Cut(rest, "]")
+	operand = strings.ToLower(operand)
+
+	filterField, exists := filterFieldMap.Lookup(field)
+	if !exists {
+		return FilterOption{}, fmt.Errorf("%w: cannot filter by %q", ErrInvalidQuery, field)
+	}
+
+	unsupported := fmt.Errorf("%w: operand %q cannot filter field %q", ErrInvalidQuery, operand, field)
+
+	filter := FilterOption{
+		Field: field,
+		Value: arg,
+	}
+
+	switch operand {
+	case "is_null":
+		filter.FilterOperation = IsNull
+		return filter, nil
+	case "not_null":
+		filter.FilterOperation = NotNull
+		return filter, nil
+	case "in", "nin":
+		if filterField.Type == StringArrayFilterFieldType || filterField.Type == DateFilterFieldType {
+			return FilterOption{}, unsupported
+		}
+
+		filter.FilterOperation = In
+		if operand == "nin" {
+			filter.FilterOperation = NotIn
+		}
+		filter.Values = strings.Split(arg, ",")
+		return filter, nil
+	case "between", "bt":
+		switch filterField.Type {
+		case DateFilterFieldType:
+			filter.FilterOperation = DateBetween
+		case NumberFilterFieldType:
+			filter.FilterOperation = NumberBetween
+		default:
+			return FilterOption{}, unsupported
+		}
+
+		filter.Values = strings.Split(arg, ",")
+		if len(filter.Values) != 2 {
+			return FilterOption{}, fmt.Errorf("%w: filter %q requires two comma separated values", ErrInvalidQuery, value)
+		}
+		return filter, nil
+	}
+
+	switch filterField.Type {
+	case StringFilterFieldType:
+		switch operand {
+		case "eq", "equal":
+			filter.FilterOperation = StringEqual
+		case "eq_ic", "equal_ignorecase":
+			filter.FilterOperation = StringEqualIgnoreCase
+		case "ne", "notequal":
+			filter.FilterOperation = StringNotEqual
+		case "ne_ic", "notequal_ignorecase":
+			filter.FilterOperation = StringNotEqualIgnoreCase
+		case "ct", "contains":
+			filter.FilterOperation = StringContains
+		case "ct_ic", "contains_ignorecase":
+			filter.FilterOperation = StringContainsIgnoreCase
+		case "nc", "notcontains":
+			filter.FilterOperation = StringNotContains
+		case "nc_ic", "notcontains_ignorecase":
+			filter.FilterOperation = StringNotContainsIgnoreCase
+		}
+
+	case StringArrayFilterFieldType:
+		if strings.Contains(operand, "ignorecase") {
+			filter.FilterOperation = StringArrayContainsIgnoreCase
+		} else {
+			filter.FilterOperation = StringArrayContains
+		}
+
+	case DateFilterFieldType:
+		switch operand {
+		case "bf", "before":
+			filter.FilterOperation = DateBefore
+		case "eq", "equal":
+			filter.FilterOperation = DateEqual
+		case "af", "after":
+			filter.FilterOperation = DateAfter
+		}
+	case NumberFilterFieldType:
+		switch operand {
+		case "eq", "equal":
+			filter.FilterOperation = NumberEqual
+		case "ne", "notequal":
+			filter.FilterOperation = NumberNotEqual
+		case "lt", "lessthan":
+			filter.FilterOperation = NumberLessThan
+		case "le", "lessequal", "lessorequal":
+			filter.FilterOperation = NumberLessOrEqualThan
+		case "gt", "greaterthan":
+			filter.FilterOperation = NumberGreaterThan
+		case "ge", "greaterequal", "greaterorequal":
+			filter.FilterOperation = NumberGreaterOrEqualThan
+		}
+	case EnumFilterFieldType:
+		switch operand {
+		case "eq", "equal":
+			filter.FilterOperation = EnumEqual
+		case "ne", "notequal":
+			filter.FilterOperation = EnumNotEqual
+		}
+	}
+
+	if filter.FilterOperation == UnspecifiedFilter {
+		return FilterOption{}, unsupported
+	}
+
+	return filter, nil
+}
+
+// bookmarkScope identifies the route and filterable fields of a list request,
+// so that its bookmarks are rejected by other endpoints.
+func bookmarkScope(f *fiber.Ctx, filterFieldMap FilterFields) string {
+	fields := make([]string, 0, len(filterFieldMap))
+	for name, field := range filterFieldMap {
+		fields = append(fields, fmt.Sprintf("%s:%d:%s:%s", name, field.Type, field.Column, strings.Join(field.Path, ".")))
+	}
+	slices.Sort(fields)
+
+	return f.Method() + " " + f.Route().Path + "?" + strings.Join(fields, ",")
+}
+
+var filterOperationTokens = map[FilterOperation]string{
+	StringEqual:                   "eq",
+	StringEqualIgnoreCase:         "eq_ic",
+	StringNotEqual:                "ne",
+	StringNotEqualIgnoreCase:      "ne_ic",
+	StringContains:                "ct",
+	StringContainsIgnoreCase:      "ct_ic",
+	StringNotContains:             "nc",
+	StringNotContainsIgnoreCase:   "nc_ic",
+	StringArrayContains:           "contains",
+	StringArrayContainsIgnoreCase: "contains_ignorecase",
+	DateEqual:                     "eq",
+	DateBefore:                    "bf",
+	DateAfter:                     "af",
+	NumberEqual:                   "eq",
+	NumberNotEqual:                "ne",
+	NumberLessThan:                "lt",
+	NumberLessOrEqualThan:         "le",
+	NumberGreaterThan:             "gt",
+	NumberGreaterOrEqualThan:      "ge",
+	EnumEqual:                     "eq",
+	EnumNotEqual:                  "ne",
+	In:                            "in",
+	NotIn:                         "nin",
+	IsNull:                        "is_null",
+	NotNull:                       "not_null",
+	DateBetween:                   "between",
+	NumberBetween:                 "between",
+}
+
+// EncodeQuery serializes the query parameters in the format parsed by FilterQuery.
+func EncodeQuery(queryParams *QueryParameters) url.Values {
+	values := url.Values{}
+	if queryParams == nil {
+		return values
+	}
+
+	if queryParams.NextBookmark != "" {
+		values.Set("bookmark", queryParams.NextBookmark)
+	}
+
+	if queryParams.PageSize > 0 {
+		values.Set("page_size", strconv.Itoa(queryParams.PageSize))
+	}
+
+	if queryParams.Sort.SortField != "" {
+		values.Set("sort_by", queryParams.Sort.SortField)
+		values.Set("sort_mode", string(queryParams.Sort.SortMode))
+	}
+
+	if queryParams.IncludeTotal {
+		values.Set("include_total", "true")
+	}
+
+	for _, filter := range queryParams.Filters {
+		if encoded, ok := encodeFilter(filter); ok {
+			values.Add("filter", encoded)
+		}
+	}
+
+	for i, group := range queryParams.FilterGroups {
+		for _, filter := range group {
+			if encoded, ok := encodeFilter(filter); ok {
+				values.Add(fmt.Sprintf("filter_or.%d", i), encoded)
+			}
+		}
+	}
+
+	return values
+}
+
+func encodeFilter(filter FilterOption) (string, bool) {
+	operand, ok := filterOperationTokens[filter.FilterOperation]
+	if !ok {
+		return "", false
+	}
+
+	value := filter.Value
+	switch filter.FilterOperation {
+	case In, NotIn, DateBetween, NumberBetween:
+		value = strings.Join(filter.Values, ",")
+	}
 
-	return &queryParams
+	return fmt.Sprintf("%s[%s]%s", filter.Field, operand, value), true
 }
@@ -0,0 +1,86 @@
+package resources
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var testFilterFields = FilterFields{
+	"status":     {Type: EnumFilterFieldType, Column: "status"},
+	"size":       {Type: NumberFilterFieldType, Column: "size"},
+	"tags":       {Type: StringArrayFilterFieldType, Column: "tags"},
+	"created":    {Type: DateFilterFieldType, Column: "creation_ts"},
+	"subject_cn": {Type: StringFilterFieldType, Column: "subject", Path: []string{"common_name"}},
+	"metadata.*": {Type: StringFilterFieldType, Column: "metadata"},
+}
+
+func filterTestQuery(t *testing.T, query url.Values) (*QueryParameters, error) {
+	var queryParams *QueryParameters
+	var queryErr error
+
+	app := fiber.New()
+	app.Get("/", func(ctx *fiber.Ctx) error {
+		queryParams, queryErr = FilterQuery(ctx, testFilterFields)
+		return nil
+	})
+
+	res, err := app.Test(httptest.NewRequest(http.MethodGet, "/?"+query.Encode(), nil))
+	if err != nil {
+		t.Fatalf("request failed: %s", err)
+	}
+	res.Body.Close()
+
+	return queryParams, queryErr
+}
+
+func TestFilterQuery(t *testing.T) {
+	queryParams, err := filterTestQuery(t, url.Values{
+		"sort_by":       {"size"},
+		"sort_mode":     {"desc"},
+		"filter":        {"status[eq]ACTIVE", "size[between]1,10", "metadata.team[eq]pki"},
+		"filter_or.a":   {"tags[contains]x", "subject_cn[is_null]"},
+		"page_size":     {"10"},
+		"include_total": {"true"},
+	})
+	if err != nil {
+		t.Fatalf("could not parse query: %s", err)
+	}
+
+	if queryParams.Sort != (SortOptions{SortField: "size", SortMode: SortModeDesc}) || queryParams.PageSize != 10 || !queryParams.IncludeTotal {
+		t.Errorf("unexpected query parameters: %+v", queryParams)
+	}
+
+	if len(queryParams.Filters) != 3 || len(queryParams.FilterGroups) != 1 || len(queryParams.FilterGroups[0]) != 2 {
+		t.Errorf("got filters %+v and groups %+v, want 3 filters and a group of 2", queryParams.Filters, queryParams.FilterGroups)
+	}
+}
+
+func TestFilterQueryRejectsInvalidQueries(t *testing.T) {
+	tests := []struct {
+		name  string
+		query url.Values
+	}{
+		{"UnknownSortField", url.Values{"sort_by": {"owner"}}},
+		{"UnsortableField", url.Values{"sort_by": {"subject_cn"}}},
+		{"UnknownFilterField", url.Values{"filter": {"owner[eq]alice"}}},
+		{"UnknownJSONKey", url.Values{"filter": {"labels.team[eq]pki"}}},
+		{"MalformedFilter", url.Values{"filter": {"status=ACTIVE"}}},
+		{"UnknownOperand", url.Values{"filter": {"status[ct]ACT"}}},
+		{"DateIn", url.Values{"filter": {"created[in]2024-01-01"}}},
+		{"BetweenOneValue", url.Values{"filter": {"size[between]1"}}},
+		{"StringBetween", url.Values{"filter": {"subject_cn[between]a,b"}}},
+		{"UnknownFilterInGroup", url.Values{"filter_or": {"status[eq]ACTIVE", "owner[eq]alice"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := filterTestQuery(t, tt.query); !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("got error %v, want %v", err, ErrInvalidQuery)
+			}
+		})
+	}
+}
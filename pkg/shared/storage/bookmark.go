@@ -0,0 +1,307 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/config"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
+	"gorm.io/gorm/schema"
+)
+
+// InvalidBookmarkError is returned for bookmarks that are malformed, expired,
+// tampered with or issued for another list. It is a client error.
+type InvalidBookmarkError struct {
+	Reason string
+}
+
+func (e *InvalidBookmarkError) Error() string {
+	return "invalid bookmark: " + e.Reason
+}
+
+const (
+	bookmarkVersion    = "v1"
+	defaultBookmarkTTL = 24 * time.Hour
+)
+
+// BookmarkSigner issues the bookmarks of list pages and verifies the ones sent
+// back by clients. Bookmarks are HMAC-SHA256 signed, expire, and are bound to
+// the table and the scope of the query they were issued for, so that clients
+// cannot edit the filters or sort column they carry.
+type BookmarkSigner struct {
+	key []byte
+	ttl time.Duration
+}
+
+func NewBookmarkSigner(logger *logger.Logger, conf config.BookmarksConfig) (*BookmarkSigner, error) {
+	key := []byte(conf.SigningKey)
+	if len(key) == 0 {
+		logger.Warnf("no bookmark signing key configured, using a random one: bookmarks will not survive restarts nor be valid across replicas")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("could not generate bookmark signing key: %w", err)
+		}
+	} else if len(key) < 32 {
+		return nil, errors.New("bookmark signing key must be at least 32 bytes long")
+	}
+
+	ttl := conf.TTL
+	if ttl <= 0 {
+		ttl = defaultBookmarkTTL
+	}
+
+	return &BookmarkSigner{
+		key: key,
+		ttl: ttl,
+	}, nil
+}
+
+// sign returns "<version>.<payload>.<mac>", the payload and MAC being base64url
+// encoded. The scope is authenticated but not part of the bookmark.
+func (s *BookmarkSigner) sign(scope string, payload []byte) string {
+	body := bookmarkVersion + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + base64.RawURLEncoding.EncodeToString(s.mac(scope, body))
+}
+
+// verify returns the payload of a bookmark signed for the given scope.
+func (s *BookmarkSigner) verify(scope string, bookmark string) ([]byte, error) {
+	version, rest, _ := strings.Cut(bookmark, ".")
+	encodedPayload, encodedMAC, found := strings.Cut(rest, ".")
+	if !found {
+		return nil, &InvalidBookmarkError{Reason: "malformed"}
+	}
+
+	if version != bookmarkVersion {
+		return nil, &InvalidBookmarkError{Reason: fmt.Sprintf("unsupported version %q", version)}
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil || !hmac.Equal(mac, s.mac(scope, version+"."+encodedPayload)) {
+		return nil, &InvalidBookmarkError{Reason: "signature mismatch"}
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return nil, &InvalidBookmarkError{Reason: "malformed"}
+	}
+
+	return payload, nil
+}
+
+func (s *BookmarkSigner) mac(scope string, body string) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(body))
+	mac.Write([]byte{0})
+	mac.Write([]byte(scope))
+	return mac.Sum(nil)
+}
+
+// listQuery is a page request resolved from the query parameters or from the
+// bookmark of a previous page. Every querier builds its pages from it, so that
+// bookmarks are interchangeable between storage providers.
+//
+// Pages are ordered by the sort column and then by the primary key, which
+// breaks ties. Each page starts right after the cursor of the previous one
+// (keyset pagination), so rows changing between pages are neither skipped nor
+// repeated.
+type listQuery struct {
+	// scope binds the bookmarks of the query to its table and endpoint.
+	scope    string
+	limit    int
+	sortBy   string
+	sortDesc bool
+	filters  []resources.FilterOption
+	// filterGroups match when any of their filters does.
+	filterGroups [][]resources.FilterOption
+	// after is nil for the first page.
+	after *listCursor
+}
+
+// listBookmark is the signed payload of the bookmarks handed to clients.
+type listBookmark struct {
+	Limit    int                        `json:"l"`
+	SortBy   string                     `json:"sb,omitempty"`
+	SortDesc bool                       `json:"sd,omitempty"`
+	Filters  []resources.FilterOption   `json:"f,omitempty"`
+	Groups   [][]resources.FilterOption `json:"g,omitempty"`
+	After    listCursor                 `json:"a"`
+	// Expires is a Unix timestamp.
+	Expires int64 `json:"e"`
+}
+
+// listCursor holds the sort column and primary key values of the last row of
+// a page, JSON encoded. A NULL sort value is encoded as null.
+type listCursor struct {
+	Sort json.RawMessage `json:"s,omitempty"`
+	ID   json.RawMessage `json:"id"`
+}
+
+func (s *BookmarkSigner) parseListQuery(table string, queryParams *resources.QueryParameters) (listQuery, error) {
+	query := listQuery{
+		scope: table + "\x00",
+		limit: 15,
+	}
+
+	if queryParams == nil {
+		return query, nil
+	}
+
+	query.scope += queryParams.BookmarkScope
+
+	if queryParams.NextBookmark == "" {
+		if queryParams.PageSize > 0 {
+			query.limit = queryParams.PageSize
+		}
+
+		query.sortBy = queryParams.Sort.SortField
+		query.sortDesc = queryParams.Sort.SortMode == resources.SortModeDesc
+		query.filters = queryParams.Filters
+		query.filterGroups = queryParams.FilterGroups
+
+		return query, nil
+	}
+
+	payload, err := s.verify(query.scope, queryParams.NextBookmark)
+	if err != nil {
+		return query, err
+	}
+
+	var bookmark listBookmark
+	err = json.Unmarshal(payload, &bookmark)
+	if err != nil || bookmark.Limit <= 0 || len(bookmark.After.ID) == 0 {
+		return query, &InvalidBookmarkError{Reason: "malformed"}
+	}
+
+	if time.Now().Unix() > bookmark.Expires {
+		return query, &InvalidBookmarkError{Reason: "expired"}
+	}
+
+	query.limit = bookmark.Limit
+	query.sortBy = bookmark.SortBy
+	query.sortDesc = bookmark.SortDesc
+	query.filters = bookmark.Filters
+	query.filterGroups = bookmark.Groups
+	query.after = &bookmark.After
+
+	return query, nil
+}
+
+// bookmarkAfter returns the bookmark of the page following the given row.
+func (s *BookmarkSigner) bookmarkAfter(ctx context.Context, query listQuery, keys listKeys, last reflect.Value) (string, error) {
+	cursor, err := query.cursorAfter(ctx, keys, last)
+	if err != nil {
+		return "", err
+	}
+
+	bookmark, err := json.Marshal(listBookmark{
+		Limit:    query.limit,
+		SortBy:   query.sortBy,
+		SortDesc: query.sortDesc,
+		Filters:  query.filters,
+		Groups:   query.filterGroups,
+		After:    cursor,
+		Expires:  time.Now().Add(s.ttl).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return s.sign(query.scope, bookmark), nil
+}
+
+// cursorAfter returns the cursor of the given row.
+func (q listQuery) cursorAfter(ctx context.Context, keys listKeys, last reflect.Value) (listCursor, error) {
+	var cursor listCursor
+	var err error
+
+	if keys.sort != nil {
+		sortValue := sqlValue(keys.sort.ReflectValueOf(ctx, last))
+		if sortValue.IsValid() {
+			cursor.Sort, err = json.Marshal(sortValue.Interface())
+		} else {
+			cursor.Sort = json.RawMessage("null")
+		}
+		if err != nil {
+			return cursor, err
+		}
+	}
+
+	cursor.ID, err = json.Marshal(sqlValue(keys.primaryKey.ReflectValueOf(ctx, last)).Interface())
+	if err != nil {
+		return cursor, err
+	}
+
+	return cursor, nil
+}
+
+// listKeys are the columns ordering the pages of a query.
+type listKeys struct {
+	// sort is nil when pages are only ordered by primary key.
+	sort       *schema.Field
+	primaryKey *schema.Field
+}
+
+func (q listQuery) keys(fields queryFields, primaryKey *schema.Field) (listKeys, error) {
+	keys := listKeys{primaryKey: primaryKey}
+	if q.sortBy == "" {
+		return keys, nil
+	}
+
+	field, err := fields.lookup(q.sortBy)
+	if err != nil {
+		return keys, err
+	}
+
+	if !field.Sortable() {
+		return keys, fmt.Errorf("field %s cannot be sorted by", q.sortBy)
+	}
+
+	keys.sort = field.column
+	return keys, nil
+}
+
+// cursorValues decodes the cursor into values of the key columns. The sort
+// value is the zero Value when NULL.
+func (q listQuery) cursorValues(keys listKeys) (reflect.Value, reflect.Value, error) {
+	decode := func(field *schema.Field, data json.RawMessage) (reflect.Value, error) {
+		value := reflect.New(field.FieldType)
+		if err := json.Unmarshal(data, value.Interface()); err != nil {
+			return reflect.Value{}, &InvalidBookmarkError{Reason: "malformed cursor"}
+		}
+
+		return sqlValue(value.Elem()), nil
+	}
+
+	var sortValue reflect.Value
+	if keys.sort != nil {
+		if len(q.after.Sort) == 0 {
+			return reflect.Value{}, reflect.Value{}, &InvalidBookmarkError{Reason: "malformed cursor"}
+		}
+
+		var err error
+		sortValue, err = decode(keys.sort, q.after.Sort)
+		if err != nil {
+			return reflect.Value{}, reflect.Value{}, err
+		}
+	}
+
+	id, err := decode(keys.primaryKey, q.after.ID)
+	if err != nil {
+		return reflect.Value{}, reflect.Value{}, err
+	}
+	if !id.IsValid() {
+		return reflect.Value{}, reflect.Value{}, &InvalidBookmarkError{Reason: "malformed cursor"}
+	}
+
+	return sortValue, id, nil
+}
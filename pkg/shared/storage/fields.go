@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var ErrUnknownField = errors.New("unknown field")
+
+// queryField is a field of the list API resolved to its column.
+type queryField struct {
+	resources.FilterField
+	name   string
+	column *schema.Field
+}
+
+// queryFields resolves the fields of the list API, including the keys of JSON
+// columns, to the columns storing them.
+type queryFields struct {
+	fields  resources.FilterFields
+	columns map[string]*schema.Field
+}
+
+// resolveFields checks that every field maps to a column of the schema.
+func resolveFields(sch *schema.Schema, fields resources.FilterFields) (queryFields, error) {
+	resolved := queryFields{
+		fields:  fields,
+		columns: map[string]*schema.Field{},
+	}
+
+	for name, field := range fields {
+		column := sch.LookUpField(field.Column)
+		if column == nil || column.DBName == "" {
+			return resolved, fmt.Errorf("field %s maps to unknown column %s of %s", name, field.Column, sch.Table)
+		}
+
+		resolved.columns[field.Column] = column
+	}
+
+	return resolved, nil
+}
+
+func (f queryFields) lookup(name string) (queryField, error) {
+	field, ok := f.fields.Lookup(name)
+	if !ok {
+		return queryField{}, fmt.Errorf("%w %q", ErrUnknownField, name)
+	}
+
+	return queryField{
+		FilterField: field,
+		name:        name,
+		column:      f.columns[field.Column],
+	}, nil
+}
+
+// countable checks that elements can be counted by the field. Counts are keyed
+// by text, which only string and enum values convert to alike on every store.
+func (f queryField) countable() error {
+	if f.Type != resources.StringFilterFieldType && f.Type != resources.EnumFilterFieldType {
+		return fmt.Errorf("cannot count by field %s", f.name)
+	}
+
+	return nil
+}
+
+// countKey returns the text of a value of the field, as scanned from a row.
+// SQLite stores booleans as integers.
+func (f queryField) countKey(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(value)
+	case int64:
+		if f.column.DataType == schema.Bool && len(f.Path) == 0 {
+			return strconv.FormatBool(value != 0)
+		}
+		return strconv.FormatInt(value, 10)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// revisionField returns the revision column of a schema, if any. Revisions
+// count the updates of a row, so that updates from a stale copy are refused.
+func revisionField(sch *schema.Schema) *schema.Field {
+	field := sch.LookUpField("revision")
+	if field == nil || field.DBName == "" {
+		return nil
+	}
+
+	return field
+}
+
+// revisionOf returns the revision of an element.
+func revisionOf(ctx context.Context, field *schema.Field, rv reflect.Value) int {
+	revision, _ := floatValue(sqlValue(field.ReflectValueOf(ctx, rv)))
+	return int(revision)
+}
+
+// columnExpr selects the value of a field, with its column name quoted. Values
+// nested in JSON columns are extracted and cast to the type of the field.
+func columnExpr(tx *gorm.DB, field resources.FilterField) clause.Expression {
+	column := clause.Column{Name: field.Column}
+	if len(field.Path) == 0 {
+		return clause.Expr{SQL: "?", Vars: []any{column}}
+	}
+
+	if isSQLite(tx) {
+		// Values take the type of the field, for literals to be converted to it.
+		extract := "json_extract(?, ?)"
+		switch field.Type {
+		case resources.StringFilterFieldType:
+			extract = "CAST(" + extract + " AS TEXT)"
+		case resources.NumberFilterFieldType:
+			extract = "CAST(" + extract + " AS NUMERIC)"
+		}
+
+		return clause.Expr{SQL: extract, Vars: []any{column, sqliteJSONPath(field.Path)}}
+	}
+
+	vars := []any{column}
+	for _, key := range field.Path {
+		vars = append(vars, key)
+	}
+	extract := "jsonb_extract_path_text(CAST(? AS jsonb)" + strings.Repeat(", ?", len(field.Path)) + ")"
+
+	switch field.Type {
+	case resources.DateFilterFieldType:
+		extract = "CAST(" + extract + " AS timestamptz)"
+	case resources.NumberFilterFieldType:
+		extract = "CAST(" + extract + " AS numeric)"
+	}
+
+	return clause.Expr{SQL: extract, Vars: vars}
+}
+
+// arrayContains matches string array fields holding the value. Fields with a
+// path are JSON arrays, other fields are Postgres arrays, stored as JSON text
+// on SQLite.
+func arrayContains(tx *gorm.DB, field resources.FilterField, value string, ignoreCase bool) clause.Expression {
+	column := clause.Column{Name: field.Column}
+	equal := "elem.value = ?"
+	if ignoreCase {
+		equal = "LOWER(elem.value) = LOWER(?)"
+	}
+
+	if isSQLite(tx) {
+		vars := []any{column}
+		array := "?"
+		if len(field.Path) > 0 {
+			array = "?, ?"
+			vars = append(vars, sqliteJSONPath(field.Path))
+		}
+
+		return clause.Expr{
+			SQL:  "json_type(" + array + ") = 'array' AND EXISTS (SELECT 1 FROM json_each(" + array + ") AS elem WHERE " + equal + ")",
+			Vars: append(append(slices.Clone(vars), vars...), value),
+		}
+	}
+
+	if len(field.Path) == 0 {
+		if ignoreCase {
+			return clause.Expr{SQL: "EXISTS (SELECT 1 FROM unnest(?) AS elem(value) WHERE " + equal + ")", Vars: []any{column, value}}
+		}
+		return clause.Expr{SQL: "? = ANY(?)", Vars: []any{value, column}}
+	}
+
+	vars := []any{column}
+	for _, key := range field.Path {
+		vars = append(vars, key)
+	}
+	array := "jsonb_extract_path(CAST(? AS jsonb)" + strings.Repeat(", ?", len(field.Path)) + ")"
+
+	if !ignoreCase {
+		contained, _ := json.Marshal([]string{value})
+		return clause.Expr{SQL: array + " @> CAST(? AS jsonb)", Vars: append(vars, string(contained))}
+	}
+
+	// jsonb_array_elements_text fails on anything but arrays.
+	return clause.Expr{
+		SQL:  "EXISTS (SELECT 1 FROM jsonb_array_elements_text(CASE WHEN jsonb_typeof(" + array + ") = 'array' THEN " + array + " ELSE '[]' END) AS elem(value) WHERE " + equal + ")",
+		Vars: append(append(slices.Clone(vars), vars...), value),
+	}
+}
+
+// sqliteJSONPath returns the SQLite JSON path of the keys.
+func sqliteJSONPath(keys []string) string {
+	path := "$"
+	for _, key := range keys {
+		path += "." + strconv.Quote(key)
+	}
+
+	return path
+}
+
+// value returns the value of the field in an element, the zero Value when
+// NULL. Values nested in JSON columns are read from the JSON encoding of the
+// column, as stored by its serializer.
+func (f queryField) value(ctx context.Context, rv reflect.Value) reflect.Value {
+	if len(f.Path) == 0 {
+		return sqlValue(f.column.ReflectValueOf(ctx, rv))
+	}
+
+	switch nested := f.nested(ctx, rv).(type) {
+	case nil:
+		return reflect.Value{}
+	case string:
+		if f.Type == resources.DateFilterFieldType {
+			t, err := time.Parse(time.RFC3339Nano, nested)
+			if err != nil {
+				return reflect.Value{}
+			}
+			return reflect.ValueOf(t)
+		}
+		return reflect.ValueOf(nested)
+	case float64, bool:
+		if f.Type == resources.StringFilterFieldType {
+			return reflect.ValueOf(fmt.Sprint(nested))
+		}
+		return reflect.ValueOf(nested)
+	default:
+		encoded, err := json.Marshal(nested)
+		if err != nil {
+			return reflect.Value{}
+		}
+		return reflect.ValueOf(string(encoded))
+	}
+}
+
+// elements returns the elements of a string array field, as text.
+func (f queryField) elements(ctx context.Context, rv reflect.Value) []string {
+	var elements []string
+	if len(f.Path) > 0 {
+		array, _ := f.nested(ctx, rv).([]any)
+		for _, elem := range array {
+			if elem != nil {
+				elements = append(elements, fmt.Sprint(elem))
+			}
+		}
+		return elements
+	}
+
+	value := sqlValue(f.column.ReflectValueOf(ctx, rv))
+	if !value.IsValid() || value.Kind() != reflect.Slice {
+		return nil
+	}
+
+	for i := range value.Len() {
+		elem := sqlValue(value.Index(i))
+		if elem.IsValid() {
+			elements = append(elements, fmt.Sprint(elem.Interface()))
+		}
+	}
+	return elements
+}
+
+// nested decodes the value at the path of the field in its JSON column.
+func (f queryField) nested(ctx context.Context, rv reflect.Value) any {
+	value := sqlValue(f.column.ReflectValueOf(ctx, rv))
+	if !value.IsValid() {
+		return nil
+	}
+
+	encoded, err := json.Marshal(value.Interface())
+	if err != nil {
+		return nil
+	}
+
+	var nested any
+	if err := json.Unmarshal(encoded, &nested); err != nil {
+		return nil
+	}
+
+	for _, key := range f.Path {
+		object, ok := nested.(map[string]any)
+		if !ok {
+			return nil
+		}
+		nested = object[key]
+	}
+
+	return nested
+}
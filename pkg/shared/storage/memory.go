@@ -0,0 +1,779 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// MemoryQuerier keeps elements in memory and answers the same queries as
+// PostgresDBQuerier: filters, sorting, page sizes and bookmarks behave alike,
+// and columns are named after the gorm schema of E. Elements are copied in and
+// out, so callers never share state with the store.
+//
+// Strings sort by byte value, which may differ from the collation of a
+// Postgres database.
+type MemoryQuerier[E any] struct {
+	mu         sync.RWMutex
+	schema     *schema.Schema
+	primaryKey *schema.Field
+	fields     queryFields
+	bookmarks  *BookmarkSigner
+	revision   *schema.Field
+	ids        []string
+	elems      map[string]E
+}
+
+func NewMemoryQuerier[E any](primaryKeyColumn string, fields resources.FilterFields, bookmarks *BookmarkSigner) (*MemoryQuerier[E], error) {
+	schema.RegisterSerializer("text", TextSerializer{})
+
+	var model E
+	sch, err := schema.Parse(&model, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		return nil, err
+	}
+
+	primaryKey := sch.LookUpField(primaryKeyColumn)
+	if primaryKey == nil {
+		return nil, fmt.Errorf("unknown primary key column %s", primaryKeyColumn)
+	}
+
+	queryFields, err := resolveFields(sch, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MemoryQuerier[E]{
+		schema:     sch,
+		primaryKey: primaryKey,
+		fields:     queryFields,
+		bookmarks:  bookmarks,
+		revision:   revisionField(sch),
+		elems:      map[string]E{},
+	}, nil
+}
+
+// Count returns the number of elements matching the filters of the query. The
+// cursor of a bookmark is ignored, so that all pages are counted.
+func (db *MemoryQuerier[E]) Count(ctx context.Context, queryParams *resources.QueryParameters) (int, error) {
+	query, err := db.bookmarks.parseListQuery(db.schema.Table, queryParams)
+	if err != nil {
+		return -1, err
+	}
+
+	match, err := db.matcher(ctx, query)
+	if err != nil {
+		return -1, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	count := 0
+	for _, id := range db.ids {
+		elem := db.elems[id]
+		if match(reflect.ValueOf(&elem).Elem()) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// CountBy returns the number of elements matching the filters of the query for
+// each value of a string or enum field. Elements where the field is NULL are
+// counted under the empty string.
+func (db *MemoryQuerier[E]) CountBy(ctx context.Context, queryParams *resources.QueryParameters, fieldName string) (map[string]int, error) {
+	field, err := db.fields.lookup(fieldName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := field.countable(); err != nil {
+		return nil, err
+	}
+
+	query, err := db.bookmarks.parseListQuery(db.schema.Table, queryParams)
+	if err != nil {
+		return nil, err
+	}
+
+	match, err := db.matcher(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	counts := map[string]int{}
+	for _, id := range db.ids {
+		elem := db.elems[id]
+		rv := reflect.ValueOf(&elem).Elem()
+		if !match(rv) {
+			continue
+		}
+
+		var value any
+		if v := field.value(ctx, rv); v.IsValid() {
+			value = v.Interface()
+		}
+		counts[field.countKey(value)]++
+	}
+
+	return counts, nil
+}
+
+func (db *MemoryQuerier[E]) SelectAll(ctx context.Context, queryParams *resources.QueryParameters, exhaustiveRun bool, applyFunc func(elem E)) (string, error) {
+	query, err := db.bookmarks.parseListQuery(db.schema.Table, queryParams)
+	if err != nil {
+		return "", err
+	}
+
+	keys, err := query.keys(db.fields, db.primaryKey)
+	if err != nil {
+		return "", err
+	}
+
+	elems, err := db.selectMatching(ctx, query, keys)
+	if err != nil {
+		return "", err
+	}
+
+	if exhaustiveRun {
+		for _, elem := range elems {
+			applyFunc(elem)
+		}
+
+		return "", nil
+	}
+
+	hasMore := len(elems) > query.limit
+	if hasMore {
+		elems = elems[:query.limit]
+	}
+
+	for _, elem := range elems {
+		applyFunc(elem)
+	}
+
+	if !hasMore {
+		return "", nil
+	}
+
+	last := elems[len(elems)-1]
+	return db.bookmarks.bookmarkAfter(ctx, query, keys, reflect.ValueOf(&last).Elem())
+}
+
+// matcher returns a function reporting whether an element passes every filter
+// and filter group of the query.
+func (db *MemoryQuerier[E]) matcher(ctx context.Context, query listQuery) (func(reflect.Value) bool, error) {
+	matchers := make([]func(reflect.Value) bool, 0, len(query.filters))
+	for _, filter := range query.filters {
+		matcher, err := db.filterMatcher(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, matcher)
+	}
+
+	for _, group := range query.filterGroups {
+		if len(group) == 0 {
+			continue
+		}
+
+		groupMatchers := make([]func(reflect.Value) bool, 0, len(group))
+		for _, filter := range group {
+			matcher, err := db.filterMatcher(ctx, filter)
+			if err != nil {
+				return nil, err
+			}
+			groupMatchers = append(groupMatchers, matcher)
+		}
+
+		matchers = append(matchers, func(rv reflect.Value) bool {
+			return slices.ContainsFunc(groupMatchers, func(match func(reflect.Value) bool) bool { return match(rv) })
+		})
+	}
+
+	return func(rv reflect.Value) bool {
+		return !slices.ContainsFunc(matchers, func(match func(reflect.Value) bool) bool { return !match(rv) })
+	}, nil
+}
+
+// selectMatching returns copies of the elements passing every filter of the
+// query and following its cursor, in page order.
+func (db *MemoryQuerier[E]) selectMatching(ctx context.Context, query listQuery, keys listKeys) ([]E, error) {
+	match, err := db.matcher(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	keyOf := func(elem *E) (reflect.Value, reflect.Value) {
+		rv := reflect.ValueOf(elem).Elem()
+		var sortValue reflect.Value
+		if keys.sort != nil {
+			sortValue = sqlValue(keys.sort.ReflectValueOf(ctx, rv))
+		}
+
+		return sortValue, sqlValue(keys.primaryKey.ReflectValueOf(ctx, rv))
+	}
+
+	var afterSort, afterID reflect.Value
+	if query.after != nil {
+		afterSort, afterID, err = query.cursorValues(keys)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var compareErr error
+	compare := func(aSort, aID, bSort, bID reflect.Value) int {
+		c, err := compareKeys(keys, query.sortDesc, aSort, aID, bSort, bID)
+		if err != nil {
+			compareErr = err
+		}
+		return c
+	}
+
+	db.mu.RLock()
+	elems := []E{}
+	for _, id := range db.ids {
+		elem := db.elems[id]
+		rv := reflect.ValueOf(&elem).Elem()
+		if !match(rv) {
+			continue
+		}
+
+		if query.after != nil {
+			sortValue, id := keyOf(&elem)
+			if compare(sortValue, id, afterSort, afterID) <= 0 {
+				continue
+			}
+		}
+
+		elems = append(elems, copyElem(elem))
+	}
+	db.mu.RUnlock()
+
+	slices.SortFunc(elems, func(a, b E) int {
+		aSort, aID := keyOf(&a)
+		bSort, bID := keyOf(&b)
+		return compare(aSort, aID, bSort, bID)
+	})
+	if compareErr != nil {
+		return nil, compareErr
+	}
+
+	return elems, nil
+}
+
+// compareKeys orders rows by sort value and then by primary key, as the SQL
+// queriers do. NULL sort values are the zero Value and, as in Postgres, sort
+// as if larger than any other value.
+func compareKeys(keys listKeys, desc bool, aSort, aID, bSort, bID reflect.Value) (int, error) {
+	c := 0
+	if keys.sort != nil {
+		switch {
+		case !aSort.IsValid() && !bSort.IsValid():
+			c = 0
+		case !aSort.IsValid():
+			c = 1
+		case !bSort.IsValid():
+			c = -1
+		default:
+			var err error
+			c, err = compareValues(aSort, bSort)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if c == 0 {
+		var err error
+		c, err = compareValues(aID, bID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if desc {
+		return -c, nil
+	}
+	return c, nil
+}
+
+// filterMatcher mirrors FilterOperandToWhereClause. Comparisons against NULL
+// never match, as in SQL.
+func (db *MemoryQuerier[E]) filterMatcher(ctx context.Context, filter resources.FilterOption) (func(reflect.Value) bool, error) {
+	field, err := db.fields.lookup(filter.Field)
+	if err != nil {
+		return nil, err
+	}
+
+	compare := func(test func(int) bool) func(reflect.Value) bool {
+		return func(rv reflect.Value) bool {
+			value := field.value(ctx, rv)
+			if !value.IsValid() {
+				return false
+			}
+
+			c, err := compareLiteral(value, filter.Value)
+			return err == nil && test(c)
+		}
+	}
+
+	like := func(pattern string, ignoreCase bool, negate bool) func(reflect.Value) bool {
+		re := likePattern(pattern, ignoreCase)
+		return func(rv reflect.Value) bool {
+			value := field.value(ctx, rv)
+			if !value.IsValid() || value.Kind() != reflect.String {
+				return false
+			}
+
+			return re.MatchString(value.String()) != negate
+		}
+	}
+
+	arrayContains := func(ignoreCase bool) func(reflect.Value) bool {
+		return func(rv reflect.Value) bool {
+			return slices.ContainsFunc(field.elements(ctx, rv), func(elem string) bool {
+				if ignoreCase {
+					return strings.EqualFold(elem, filter.Value)
+				}
+				return elem == filter.Value
+			})
+		}
+	}
+
+	in := func(negate bool) func(reflect.Value) bool {
+		return func(rv reflect.Value) bool {
+			value := field.value(ctx, rv)
+			if !value.IsValid() {
+				return false
+			}
+
+			found := slices.ContainsFunc(filter.Values, func(literal string) bool {
+				c, err := compareLiteral(value, literal)
+				return err == nil && c == 0
+			})
+			return found != negate
+		}
+	}
+
+	between := func(rv reflect.Value) bool {
+		value := field.value(ctx, rv)
+		if !value.IsValid() {
+			return false
+		}
+
+		lower, err := compareLiteral(value, filter.Values[0])
+		if err != nil {
+			return false
+		}
+		upper, err := compareLiteral(value, filter.Values[1])
+		return err == nil && lower >= 0 && upper <= 0
+	}
+
+	contains := fmt.Sprintf("%%%s%%", filter.Value)
+
+	switch filter.FilterOperation {
+	case resources.StringEqual, resources.DateEqual, resources.NumberEqual, resources.EnumEqual:
+		return compare(func(c int) bool { return c == 0 }), nil
+	case resources.StringNotEqual, resources.NumberNotEqual, resources.EnumNotEqual:
+		return compare(func(c int) bool { return c != 0 }), nil
+	case resources.StringEqualIgnoreCase:
+		return like(filter.Value, true, false), nil
+	case resources.StringNotEqualIgnoreCase:
+		return like(filter.Value, true, true), nil
+	case resources.StringContains:
+		return like(contains, false, false), nil
+	case resources.StringContainsIgnoreCase:
+		return like(contains, true, false), nil
+	case resources.StringArrayContains:
+		return arrayContains(false), nil
+	case resources.StringArrayContainsIgnoreCase:
+		return arrayContains(true), nil
+	case resources.StringNotContains:
+		return like(contains, false, true), nil
+	case resources.StringNotContainsIgnoreCase:
+		return like(contains, true, true), nil
+	case resources.DateBefore, resources.NumberLessThan:
+		return compare(func(c int) bool { return c < 0 }), nil
+	case resources.NumberLessOrEqualThan:
+		return compare(func(c int) bool { return c <= 0 }), nil
+	case resources.DateAfter, resources.NumberGreaterThan:
+		return compare(func(c int) bool { return c > 0 }), nil
+	case resources.NumberGreaterOrEqualThan:
+		return compare(func(c int) bool { return c >= 0 }), nil
+	case resources.In, resources.NotIn:
+		if len(filter.Values) == 0 {
+			return nil, fmt.Errorf("filter on field %s has no values", filter.Field)
+		}
+		return in(filter.FilterOperation == resources.NotIn), nil
+	case resources.IsNull:
+		return func(rv reflect.Value) bool { return !field.value(ctx, rv).IsValid() }, nil
+	case resources.NotNull:
+		return func(rv reflect.Value) bool { return field.value(ctx, rv).IsValid() }, nil
+	case resources.DateBetween, resources.NumberBetween:
+		if len(filter.Values) != 2 {
+			return nil, fmt.Errorf("range on field %s needs two bounds", filter.Field)
+		}
+		return between, nil
+	default:
+		return nil, fmt.Errorf("unsupported filter operation %d on field %s", filter.FilterOperation, filter.Field)
+	}
+}
+
+// Selects the first element matching queryID. if queryCol is empty or nil, the
+// primary key column defined in the creation process, is used.
+func (db *MemoryQuerier[E]) SelectExists(ctx context.Context, queryID string, queryCol *string) (bool, *E, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if queryCol == nil || *queryCol == "" || *queryCol == db.primaryKey.DBName {
+		elem, ok := db.elems[queryID]
+		if !ok {
+			return false, nil, nil
+		}
+
+		elem = copyElem(elem)
+		return true, &elem, nil
+	}
+
+	field := db.schema.LookUpField(*queryCol)
+	if field == nil {
+		return false, nil, fmt.Errorf("unknown column %s", *queryCol)
+	}
+
+	for _, id := range db.ids {
+		elem := db.elems[id]
+		value := sqlValue(field.ReflectValueOf(ctx, reflect.ValueOf(&elem).Elem()))
+		if !value.IsValid() {
+			continue
+		}
+
+		if c, err := compareLiteral(value, queryID); err == nil && c == 0 {
+			elem = copyElem(elem)
+			return true, &elem, nil
+		}
+	}
+
+	return false, nil, nil
+}
+
+func (db *MemoryQuerier[E]) Insert(ctx context.Context, elem *E) (*E, error) {
+	rv := reflect.ValueOf(elem).Elem()
+
+	// Column defaults are filled in as the database would on insert.
+	for _, field := range db.schema.Fields {
+		if !field.HasDefaultValue {
+			continue
+		}
+
+		if _, zero := field.ValueOf(ctx, rv); !zero {
+			continue
+		}
+
+		var err error
+		switch {
+		case field.DefaultValue == "gen_random_uuid()":
+			err = field.Set(ctx, rv, uuid.NewString())
+		case field.DefaultValueInterface != nil:
+			err = field.Set(ctx, rv, field.DefaultValueInterface)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	id, err := db.elemID(ctx, rv)
+	if err != nil {
+		return nil, err
+	}
+
+	db.setForeignKeys(ctx, rv)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, exists := db.elems[id]; exists {
+		return nil, gorm.ErrDuplicatedKey
+	}
+
+	db.ids = append(db.ids, id)
+	db.elems[id] = copyElem(*elem)
+
+	return elem, nil
+}
+
+// Update saves an element, refusing stale revisions as PostgresDBQuerier does.
+func (db *MemoryQuerier[E]) Update(ctx context.Context, elem *E, elemID string) (*E, error) {
+	rv := reflect.ValueOf(elem).Elem()
+	db.setForeignKeys(ctx, rv)
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	stored, exists := db.elems[elemID]
+	if !exists {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if db.revision != nil {
+		revision := revisionOf(ctx, db.revision, rv)
+		if revision != revisionOf(ctx, db.revision, reflect.ValueOf(&stored).Elem()) {
+			return nil, &resources.ConflictError{ID: elemID, Revision: revision}
+		}
+
+		if err := db.revision.Set(ctx, rv, revision+1); err != nil {
+			return nil, err
+		}
+	}
+
+	db.elems[elemID] = copyElem(*elem)
+
+	return elem, nil
+}
+
+func (db *MemoryQuerier[E]) Delete(ctx context.Context, elemID string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, exists := db.elems[elemID]; !exists {
+		return gorm.ErrRecordNotFound
+	}
+
+	delete(db.elems, elemID)
+	db.ids = slices.DeleteFunc(db.ids, func(id string) bool { return id == elemID })
+
+	return nil
+}
+
+func (db *MemoryQuerier[E]) elemID(ctx context.Context, rv reflect.Value) (string, error) {
+	value, zero := db.primaryKey.ValueOf(ctx, rv)
+	if zero {
+		return "", gorm.ErrPrimaryKeyRequired
+	}
+
+	return fmt.Sprint(value), nil
+}
+
+// setForeignKeys points the associations owned by the element back to it, as
+// gorm does when saving them along with their owner.
+func (db *MemoryQuerier[E]) setForeignKeys(ctx context.Context, rv reflect.Value) {
+	for _, rel := range db.schema.Relationships.Relations {
+		if rel.Type != schema.HasMany && rel.Type != schema.HasOne {
+			continue
+		}
+
+		assoc := reflect.Indirect(rel.Field.ReflectValueOf(ctx, rv))
+		var children []reflect.Value
+		switch assoc.Kind() {
+		case reflect.Slice:
+			for i := range assoc.Len() {
+				children = append(children, reflect.Indirect(assoc.Index(i)))
+			}
+		case reflect.Struct:
+			children = append(children, assoc)
+		}
+
+		for _, ref := range rel.References {
+			if !ref.OwnPrimaryKey {
+				continue
+			}
+
+			value, _ := ref.PrimaryKey.ValueOf(ctx, rv)
+			for _, child := range children {
+				if child.IsValid() && child.CanAddr() {
+					ref.ForeignKey.Set(ctx, child, value)
+				}
+			}
+		}
+	}
+}
+
+// likePattern translates a SQL LIKE pattern into a regular expression.
+func likePattern(pattern string, ignoreCase bool) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("(?s)")
+	if ignoreCase {
+		expr.WriteString("(?i)")
+	}
+	expr.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			expr.WriteString(".*")
+		case '_':
+			expr.WriteString(".")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expr.WriteString("$")
+
+	return regexp.MustCompile(expr.String())
+}
+
+// sqlValue dereferences pointers, returning the zero Value for NULL.
+func sqlValue(v reflect.Value) reflect.Value {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+
+	return v
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// literalTimeLayouts are the timestamp formats accepted in filter values.
+var literalTimeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05", "2006-01-02"}
+
+// compareLiteral compares a column value with a filter value, converting the
+// filter value to the type of the column as Postgres does with literals.
+func compareLiteral(value reflect.Value, literal string) (int, error) {
+	switch {
+	case value.Type() == timeType:
+		for _, layout := range literalTimeLayouts {
+			if t, err := time.Parse(layout, literal); err == nil {
+				return value.Interface().(time.Time).Compare(t), nil
+			}
+		}
+		return 0, fmt.Errorf("invalid timestamp %q", literal)
+	case value.Kind() == reflect.String:
+		return strings.Compare(value.String(), literal), nil
+	case value.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(literal)
+		if err != nil {
+			return 0, fmt.Errorf("invalid boolean %q", literal)
+		}
+		return compareValues(value, reflect.ValueOf(b))
+	case value.CanInt(), value.CanUint(), value.CanFloat():
+		f, err := strconv.ParseFloat(literal, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number %q", literal)
+		}
+		return compareValues(value, reflect.ValueOf(f))
+	default:
+		return 0, fmt.Errorf("cannot compare %s values", value.Type())
+	}
+}
+
+// compareValues orders two non NULL values of the same kind of column.
+func compareValues(a, b reflect.Value) (int, error) {
+	switch {
+	case a.Type() == timeType && b.Type() == timeType:
+		return a.Interface().(time.Time).Compare(b.Interface().(time.Time)), nil
+	case a.Kind() == reflect.String && b.Kind() == reflect.String:
+		return strings.Compare(a.String(), b.String()), nil
+	case a.Kind() == reflect.Bool && b.Kind() == reflect.Bool:
+		return boolToOrder(a.Bool()) - boolToOrder(b.Bool()), nil
+	}
+
+	af, aok := floatValue(a)
+	bf, bok := floatValue(b)
+	if !aok || !bok {
+		return 0, fmt.Errorf("cannot compare %s and %s values", a.Type(), b.Type())
+	}
+
+	switch {
+	case af < bf:
+		return -1, nil
+	case af > bf:
+		return 1, nil
+	default:
+		return 0, nil
+	}
+}
+
+func floatValue(v reflect.Value) (float64, bool) {
+	switch {
+	case v.CanInt():
+		return float64(v.Int()), true
+	case v.CanUint():
+		return float64(v.Uint()), true
+	case v.CanFloat():
+		return v.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+func boolToOrder(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// copyElem deep copies an element, so that stored elements are not shared
+// with callers.
+func copyElem[E any](elem E) E {
+	src := reflect.ValueOf(&elem).Elem()
+	dst := reflect.New(src.Type()).Elem()
+	copyValue(dst, src)
+
+	return dst.Interface().(E)
+}
+
+func copyValue(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Pointer:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.New(src.Elem().Type()))
+		copyValue(dst.Elem(), src.Elem())
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.MakeSlice(src.Type(), src.Len(), src.Len()))
+		for i := range src.Len() {
+			copyValue(dst.Index(i), src.Index(i))
+		}
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		dst.Set(reflect.MakeMapWithSize(src.Type(), src.Len()))
+		iter := src.MapRange()
+		for iter.Next() {
+			value := reflect.New(iter.Value().Type()).Elem()
+			copyValue(value, iter.Value())
+			dst.SetMapIndex(iter.Key(), value)
+		}
+	case reflect.Interface:
+		if src.IsNil() {
+			return
+		}
+		value := reflect.New(src.Elem().Type()).Elem()
+		copyValue(value, src.Elem())
+		dst.Set(value)
+	case reflect.Struct:
+		dst.Set(src)
+		for i := range src.NumField() {
+			if dst.Field(i).CanSet() {
+				copyValue(dst.Field(i), src.Field(i))
+			}
+		}
+	default:
+		dst.Set(src)
+	}
+}
@@ -0,0 +1,319 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"slices"
+	"time"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
+	"gorm.io/gorm"
+)
+
+var ErrUnknownSchemaVersion = errors.New("database schema is newer than this release")
+
+// Migration is a versioned schema change. Versions are positive and applied in
+// ascending order, each one in its own transaction.
+type Migration struct {
+	Version int
+	Name    string
+	Up      MigrationFunc
+	// Down reverts Up. Migrations without it cannot be reverted.
+	Down MigrationFunc
+}
+
+type MigrationFunc func(tx *gorm.DB) error
+
+// DialectSQL returns a MigrationFunc running the statements written for the
+// dialect of the database.
+func DialectSQL(postgres []string, sqlite []string) MigrationFunc {
+	return func(tx *gorm.DB) error {
+		statements := postgres
+		if isSQLite(tx) {
+			statements = sqlite
+		}
+
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+type MigrationStatus struct {
+	Version int
+	Name    string
+	// AppliedAt is nil for pending migrations.
+	AppliedAt *time.Time
+}
+
+type schemaMigration struct {
+	Service   string `gorm:"primaryKey"`
+	Version   int    `gorm:"primaryKey"`
+	Name      string
+	AppliedAt time.Time
+}
+
+const schemaMigrationsTable = "schema_migrations"
+
+// SchemaMigrator applies the migrations of a service, recording them in the
+// schema_migrations table. On Postgres, an advisory lock serializes replicas
+// migrating the same database. SQLite databases serve a single instance, and
+// are not locked.
+type SchemaMigrator struct {
+	logger     *logger.Logger
+	db         *gorm.DB
+	service    string
+	migrations []Migration
+}
+
+func NewSchemaMigrator(logger *logger.Logger, db *gorm.DB, service string, migrations []Migration) (*SchemaMigrator, error) {
+	migrations = slices.Clone(migrations)
+	slices.SortFunc(migrations, func(a, b Migration) int { return a.Version - b.Version })
+
+	for i, migration := range migrations {
+		if migration.Version <= 0 {
+			return nil, fmt.Errorf("migration %q has invalid version %d", migration.Name, migration.Version)
+		}
+		if i > 0 && migrations[i-1].Version == migration.Version {
+			return nil, fmt.Errorf("duplicate migration version %d", migration.Version)
+		}
+		if migration.Up == nil {
+			return nil, fmt.Errorf("migration %d has no up function", migration.Version)
+		}
+	}
+
+	return &SchemaMigrator{
+		logger:     logger,
+		db:         db,
+		service:    service,
+		migrations: migrations,
+	}, nil
+}
+
+// Latest returns the version of the newest migration known to this release.
+func (m *SchemaMigrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration.
+func (m *SchemaMigrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down reverts the last applied migration.
+func (m *SchemaMigrator) Down(ctx context.Context) error {
+	return m.migrate(ctx, func(applied []int) (int, error) {
+		if len(applied) == 0 {
+			return 0, errors.New("no migration to revert")
+		}
+		if len(applied) == 1 {
+			return 0, nil
+		}
+
+		return applied[len(applied)-2], nil
+	})
+}
+
+// To applies or reverts migrations until the schema is at the given version.
+// Version 0 reverts every migration.
+func (m *SchemaMigrator) To(ctx context.Context, version int) error {
+	if version != 0 && !slices.ContainsFunc(m.migrations, func(migration Migration) bool { return migration.Version == version }) {
+		return fmt.Errorf("unknown migration version %d", version)
+	}
+
+	return m.migrate(ctx, func([]int) (int, error) {
+		return version, nil
+	})
+}
+
+// Version returns the version of the last applied migration, 0 if none.
+func (m *SchemaMigrator) Version(ctx context.Context) (int, error) {
+	applied, err := m.applied(m.db.WithContext(ctx))
+	if err != nil {
+		return 0, err
+	}
+
+	if len(applied) == 0 {
+		return 0, nil
+	}
+
+	return applied[len(applied)-1].Version, nil
+}
+
+// Status lists every known migration, and any applied migration unknown to
+// this release, in version order.
+func (m *SchemaMigrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	applied, err := m.applied(m.db.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	status := []MigrationStatus{}
+	for _, migration := range m.migrations {
+		status = append(status, MigrationStatus{Version: migration.Version, Name: migration.Name})
+	}
+
+	for _, record := range applied {
+		appliedAt := record.AppliedAt
+		idx := slices.IndexFunc(status, func(s MigrationStatus) bool { return s.Version == record.Version })
+		if idx == -1 {
+			status = append(status, MigrationStatus{Version: record.Version, Name: record.Name, AppliedAt: &appliedAt})
+		} else {
+			status[idx].AppliedAt = &appliedAt
+		}
+	}
+
+	slices.SortFunc(status, func(a, b MigrationStatus) int { return a.Version - b.Version })
+	return status, nil
+}
+
+// migrate moves the schema to the version returned by target, which is given
+// the applied versions once the migration lock is held.
+func (m *SchemaMigrator) migrate(ctx context.Context, target func(applied []int) (int, error)) error {
+	return m.db.WithContext(ctx).Connection(func(conn *gorm.DB) error {
+		unlock, err := m.lock(conn)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		err = m.createTable(conn)
+		if err != nil {
+			return err
+		}
+
+		records, err := m.applied(conn)
+		if err != nil {
+			return err
+		}
+
+		applied := []int{}
+		for _, record := range records {
+			if !slices.ContainsFunc(m.migrations, func(migration Migration) bool { return migration.Version == record.Version }) {
+				return fmt.Errorf("%w: migration %d (%s) is applied but unknown", ErrUnknownSchemaVersion, record.Version, record.Name)
+			}
+			applied = append(applied, record.Version)
+		}
+
+		version, err := target(applied)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if migration.Version <= version || !slices.Contains(applied, migration.Version) {
+				continue
+			}
+
+			if migration.Down == nil {
+				return fmt.Errorf("migration %d (%s) cannot be reverted", migration.Version, migration.Name)
+			}
+
+			m.logger.Infof("reverting %s schema migration %d: %s", m.service, migration.Version, migration.Name)
+			err = conn.Transaction(func(tx *gorm.DB) error {
+				if err := migration.Down(tx); err != nil {
+					return err
+				}
+
+				return tx.Table(schemaMigrationsTable).Delete(&schemaMigration{Service: m.service, Version: migration.Version}).Error
+			})
+			if err != nil {
+				m.logger.Errorf("could not revert %s schema migration %d: %s", m.service, migration.Version, err)
+				return fmt.Errorf("could not revert migration %d (%s): %w", migration.Version, migration.Name, err)
+			}
+		}
+
+		for _, migration := range m.migrations {
+			if migration.Version > version || slices.Contains(applied, migration.Version) {
+				continue
+			}
+
+			m.logger.Infof("applying %s schema migration %d: %s", m.service, migration.Version, migration.Name)
+			err = conn.Transaction(func(tx *gorm.DB) error {
+				if err := migration.Up(tx); err != nil {
+					return err
+				}
+
+				return tx.Table(schemaMigrationsTable).Create(&schemaMigration{
+					Service:   m.service,
+					Version:   migration.Version,
+					Name:      migration.Name,
+					AppliedAt: time.Now().UTC(),
+				}).Error
+			})
+			if err != nil {
+				m.logger.Errorf("could not apply %s schema migration %d: %s", m.service, migration.Version, err)
+				return fmt.Errorf("could not apply migration %d (%s): %w", migration.Version, migration.Name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// lock takes the migration lock of the service on a Postgres connection.
+func (m *SchemaMigrator) lock(conn *gorm.DB) (func(), error) {
+	if isSQLite(conn) {
+		return func() {}, nil
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte("lamassu-schema-migrations:" + m.service))
+	key := int64(h.Sum64())
+
+	m.logger.Debugf("waiting for the %s schema migration lock", m.service)
+	if err := conn.Exec("SELECT pg_advisory_lock(?)", key).Error; err != nil {
+		return nil, fmt.Errorf("could not take migration lock: %w", err)
+	}
+
+	return func() {
+		if err := conn.Exec("SELECT pg_advisory_unlock(?)", key).Error; err != nil {
+			m.logger.Errorf("could not release the %s schema migration lock: %s", m.service, err)
+		}
+	}, nil
+}
+
+func (m *SchemaMigrator) createTable(conn *gorm.DB) error {
+	return DialectSQL([]string{
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			service text NOT NULL,
+			version bigint NOT NULL,
+			name text NOT NULL,
+			applied_at timestamptz NOT NULL,
+			PRIMARY KEY (service, version)
+		)`,
+	}, []string{
+		`CREATE TABLE IF NOT EXISTS schema_migrations (
+			service text NOT NULL,
+			version integer NOT NULL,
+			name text NOT NULL,
+			applied_at datetime NOT NULL,
+			PRIMARY KEY (service, version)
+		)`,
+	})(conn)
+}
+
+func (m *SchemaMigrator) applied(tx *gorm.DB) ([]schemaMigration, error) {
+	if !tx.Migrator().HasTable(schemaMigrationsTable) {
+		return nil, nil
+	}
+
+	var records []schemaMigration
+	err := tx.Table(schemaMigrationsTable).Where("service = ?", m.service).Order("version").Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
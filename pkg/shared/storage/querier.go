@@ -3,11 +3,9 @@ package storage
 import (
 	"context"
 	"encoding"
-	"encoding/base64"
 	"fmt"
 	"reflect"
-	"strconv"
-	"strings"
+	"sync"
 
 	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/resources"
@@ -16,9 +14,33 @@ import (
 	"gorm.io/gorm/schema"
 )
 
-func TableQuery[E any](log *logger.Logger, db *gorm.DB, tableName string, primaryKeyColumn string, model E) (*PostgresDBQuerier[E], error) {
+// TableQuery queries the table storing E. Lists are filtered and sorted by the
+// given fields, and fail on any other. Tables with a revision column are
+// updated optimistically, see Update.
+func TableQuery[E any](log *logger.Logger, db *gorm.DB, tableName string, primaryKeyColumn string, model E, fields resources.FilterFields, bookmarks *BookmarkSigner) (*PostgresDBQuerier[E], error) {
 	schema.RegisterSerializer("text", TextSerializer{})
+
+	sch, err := schema.Parse(&model, &sync.Map{}, db.NamingStrategy)
+	if err != nil {
+		return nil, err
+	}
+
+	primaryKey := sch.LookUpField(primaryKeyColumn)
+	if primaryKey == nil {
+		return nil, fmt.Errorf("unknown primary key column %s", primaryKeyColumn)
+	}
+
+	queryFields, err := resolveFields(sch, fields)
+	if err != nil {
+		return nil, err
+	}
+
 	querier := newPostgresDBQuerier[E](db, tableName, primaryKeyColumn)
+	querier.schema = sch
+	querier.primaryKey = primaryKey
+	querier.fields = queryFields
+	querier.bookmarks = bookmarks
+	querier.revision = revisionField(sch)
 	return &querier, nil
 }
 
@@ -74,6 +96,11 @@ type PostgresDBQuerier[E any] struct {
 	*gorm.DB
 	tableName        string
 	primaryKeyColumn string
+	schema           *schema.Schema
+	primaryKey       *schema.Field
+	fields           queryFields
+	bookmarks        *BookmarkSigner
+	revision         *schema.Field
 }
 
 func newPostgresDBQuerier[E any](db *gorm.DB, tableName string, primaryKeyColumn string) PostgresDBQuerier[E] {
@@ -104,12 +131,22 @@ func applyExtraOpts(tx *gorm.DB, extraOpts []GormExtraOps) *gorm.DB {
 	return tx
 }
 
-func (db *PostgresDBQuerier[E]) Count(ctx context.Context, extraOpts []GormExtraOps) (int, error) {
-	var count int64
-	tx := db.Table(db.tableName).WithContext(ctx)
+// Count returns the number of rows matching the filters of the query. The
+// cursor of a bookmark is ignored, so that all pages are counted.
+func (db *PostgresDBQuerier[E]) Count(ctx context.Context, queryParams *resources.QueryParameters, extraOpts []GormExtraOps) (int, error) {
+	query, err := db.bookmarks.parseListQuery(db.tableName, queryParams)
+	if err != nil {
+		return -1, err
+	}
+
+	tx, err := db.where(db.Table(db.tableName).WithContext(ctx), query)
+	if err != nil {
+		return -1, err
+	}
 
 	tx = applyExtraOpts(tx, extraOpts)
 
+	var count int64
 	tx.Count(&count)
 	if err := tx.Error; err != nil {
 		return -1, err
@@ -118,164 +155,231 @@ func (db *PostgresDBQuerier[E]) Count(ctx context.Context, extraOpts []GormExtra
 	return int(count), nil
 }
 
-func (db *PostgresDBQuerier[E]) SelectAll(ctx context.Context, queryParams *resources.QueryParameters, extraOpts []GormExtraOps, exhaustiveRun bool, applyFunc func(elem E)) (string, error) {
-	var elems []E
-	tx := db.Table(db.tableName)
+// CountBy returns the number of rows matching the filters of the query for
+// each value of a string or enum field. Rows where the field is NULL are
+// counted under the empty string.
+func (db *PostgresDBQuerier[E]) CountBy(ctx context.Context, queryParams *resources.QueryParameters, extraOpts []GormExtraOps, fieldName string) (map[string]int, error) {
+	field, err := db.fields.lookup(fieldName)
+	if err != nil {
+		return nil, err
+	}
 
-	offset := 0
-	limit := 15
+	if err := field.countable(); err != nil {
+		return nil, err
+	}
 
-	var sortMode string
-	var sortBy string
+	query, err := db.bookmarks.parseListQuery(db.tableName, queryParams)
+	if err != nil {
+		return nil, err
+	}
 
-	nextBookmark := ""
+	tx, err := db.where(db.Table(db.tableName).WithContext(ctx), query)
+	if err != nil {
+		return nil, err
+	}
 
-	if queryParams != nil {
-		if queryParams.NextBookmark == "" {
-			if queryParams.PageSize > 0 {
-				limit = queryParams.PageSize
-			}
+	tx = applyExtraOpts(tx, extraOpts)
 
-			if queryParams.Sort.SortMode == "" {
-				sortMode = string(resources.SortModeAsc)
-			} else {
-				sortMode = string(queryParams.Sort.SortMode)
-			}
+	column := columnExpr(tx, field.FilterField)
+	rows, err := tx.Select("? AS count_value, COUNT(*)", column).Group("count_value").Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	for rows.Next() {
+		var value any
+		var count int
+		if err := rows.Scan(&value, &count); err != nil {
+			return nil, err
+		}
 
-			nextBookmark = fmt.Sprintf("off:%d;lim:%d;", limit+offset, limit)
+		counts[field.countKey(value)] += count
+	}
 
-			if queryParams.Sort.SortField != "" {
-				sortBy = strings.ReplaceAll(queryParams.Sort.SortField, ".", "_")
-				nextBookmark = nextBookmark + fmt.Sprintf("sortM:%s;sortB:%s;", sortMode, sortBy)
-				tx = tx.Order(sortBy + " " + sortMode)
-			}
+	return counts, rows.Err()
+}
 
-			for _, filter := range queryParams.Filters {
-				tx = FilterOperandToWhereClause(filter, tx)
-				nextBookmark = nextBookmark + fmt.Sprintf("filter:%s-%d-%s;", base64.StdEncoding.EncodeToString([]byte(filter.Field)), filter.FilterOperation, base64.StdEncoding.EncodeToString([]byte(filter.Value)))
-			}
+func (db *PostgresDBQuerier[E]) SelectAll(ctx context.Context, queryParams *resources.QueryParameters, extraOpts []GormExtraOps, exhaustiveRun bool, applyFunc func(elem E)) (string, error) {
+	query, err := db.bookmarks.parseListQuery(db.tableName, queryParams)
+	if err != nil {
+		return "", err
+	}
+
+	keys, err := query.keys(db.fields, db.primaryKey)
+	if err != nil {
+		return "", err
+	}
 
-		} else {
-			nextBookmark = ""
-			decodedBookmark, err := base64.RawURLEncoding.DecodeString(queryParams.NextBookmark)
+	if exhaustiveRun {
+		// Batches are pages of the query, so that they keep its order.
+		for {
+			elems, err := db.selectPage(ctx, query, keys, extraOpts, query.limit)
 			if err != nil {
-				return "", fmt.Errorf("not a valid bookmark")
+				return "", err
+			}
+
+			for _, elem := range elems {
+				applyFunc(elem)
 			}
 
-			splits := strings.SplitSeq(string(decodedBookmark), ";")
-
-			for splitPart := range splits {
-				queryPart := strings.Split(splitPart, ":")
-				switch queryPart[0] {
-				case "off":
-					offset, err = strconv.Atoi(queryPart[1])
-					if err != nil {
-						return "", fmt.Errorf("not a valid bookmark")
-					}
-				case "lim":
-					limit, err = strconv.Atoi(queryPart[1])
-					if err != nil {
-						return "", fmt.Errorf("not a valid bookmark")
-					}
-				case "sortM":
-					sortMode = queryPart[1]
-					if err != nil {
-						return "", fmt.Errorf("not a valid bookmark")
-					}
-				case "sortB":
-					sortBy = strings.ReplaceAll(queryPart[1], ".", "_")
-					if err != nil {
-						return "", fmt.Errorf("not a valid bookmark")
-					}
-				case "filter":
-					filter := queryPart[1]
-					if err != nil {
-						return "", fmt.Errorf("not a valid bookmark")
-					}
-					filterSplit := strings.Split(filter, "-")
-					if len(filterSplit) == 3 {
-						field, err := base64.StdEncoding.DecodeString(filterSplit[0])
-						if err != nil {
-							continue
-						}
-						value, err := base64.StdEncoding.DecodeString(filterSplit[2])
-						if err != nil {
-							continue
-						}
-
-						operand, err := strconv.Atoi(filterSplit[1])
-						if err != nil {
-							continue
-						}
-
-						tx = FilterOperandToWhereClause(resources.FilterOption{
-							Field:           string(field),
-							FilterOperation: resources.FilterOperation(operand),
-							Value:           string(value),
-						}, tx)
-
-						nextBookmark = nextBookmark + fmt.Sprintf("filter:%s-%d-%s;", base64.StdEncoding.EncodeToString([]byte(field)), operand, base64.StdEncoding.EncodeToString([]byte(value)))
-					}
-				}
-				if sortMode != "" && sortBy != "" {
-					tx = tx.Order(sortBy + " " + sortMode)
-				}
+			if len(elems) < query.limit {
+				return "", nil
 			}
-			nextBookmark = nextBookmark + fmt.Sprintf("off:%d;lim:%d;", offset+limit, limit)
-			if queryParams.Sort.SortField != "" {
-				sortBy = queryParams.Sort.SortField
-				nextBookmark = nextBookmark + fmt.Sprintf("sortM:%s;sortB:%s;", sortMode, sortBy)
+
+			last := elems[len(elems)-1]
+			cursor, err := query.cursorAfter(ctx, keys, reflect.ValueOf(&last).Elem())
+			if err != nil {
+				return "", err
 			}
+			query.after = &cursor
 		}
 	}
 
-	tx = applyExtraOpts(tx, extraOpts)
-
-	if offset > 0 {
-		tx.Offset(offset)
+	elems, err := db.selectPage(ctx, query, keys, extraOpts, query.limit+1)
+	if err != nil {
+		return "", err
 	}
 
-	if exhaustiveRun {
-		res := tx.WithContext(ctx).Preload(clause.Associations).FindInBatches(&elems, limit, func(tx *gorm.DB, batch int) error {
-			for _, elem := range elems {
-				applyFunc(elem)
-			}
+	// Check if we got more than the requested limit
+	hasMore := len(elems) > query.limit
 
-			return nil
-		})
-		if res.Error != nil {
-			return "", res.Error
-		}
+	// Trim elems to the requested limit
+	if hasMore {
+		elems = elems[:query.limit] // Keep only the requested limit
+	}
 
+	for _, elem := range elems {
+		// batch processing found records
+		applyFunc(elem)
+	}
+
+	if !hasMore {
+		// no more records to fetch
 		return "", nil
-	} else {
-		tx.Offset(offset)
-		tx.Limit(limit + 1)
-		rs := tx.WithContext(ctx).Preload(clause.Associations).Find(&elems)
+	}
 
-		if rs.Error != nil {
-			return "", rs.Error
+	last := elems[len(elems)-1]
+	return db.bookmarks.bookmarkAfter(ctx, query, keys, reflect.ValueOf(&last).Elem())
+}
+
+// selectPage returns up to limit elements following the cursor of the query.
+func (db *PostgresDBQuerier[E]) selectPage(ctx context.Context, query listQuery, keys listKeys, extraOpts []GormExtraOps, limit int) ([]E, error) {
+	tx, err := db.where(db.Table(db.tableName).WithContext(ctx), query)
+	if err != nil {
+		return nil, err
+	}
+
+	tx = applyExtraOpts(tx, extraOpts)
+
+	if query.after != nil {
+		sortValue, id, err := query.cursorValues(keys)
+		if err != nil {
+			return nil, err
 		}
 
-		// Check if we got more than the requested limit
-		hasMore := len(elems) > limit
+		tx = tx.Where(keysetCondition(query, keys, sortValue, id))
+	}
+
+	tx = tx.Order(keysetOrder(query, keys))
 
-		// Trim elems to the requested limit
-		if hasMore {
-			elems = elems[:limit] // Keep only the requested limit
+	var elems []E
+	rs := tx.Limit(limit).Preload(clause.Associations).Find(&elems)
+	if rs.Error != nil {
+		return nil, rs.Error
+	}
+
+	return elems, nil
+}
+
+// where applies the filters and filter groups of the query.
+func (db *PostgresDBQuerier[E]) where(tx *gorm.DB, query listQuery) (*gorm.DB, error) {
+	for _, filter := range query.filters {
+		condition, err := db.filterCondition(filter, tx)
+		if err != nil {
+			return nil, err
 		}
+		tx = tx.Where(condition)
+	}
 
-		for _, elem := range elems {
-			// batch processing found records
-			applyFunc(elem)
+	for _, group := range query.filterGroups {
+		conditions := []clause.Expression{}
+		for _, filter := range group {
+			condition, err := db.filterCondition(filter, tx)
+			if err != nil {
+				return nil, err
+			}
+			conditions = append(conditions, condition)
 		}
 
-		if !hasMore {
-			// no more records to fetch. Reset nextBookmark to empty string
-			return "", nil
+		// gorm ORs a single condition group with the previous conditions.
+		switch len(conditions) {
+		case 0:
+		case 1:
+			tx = tx.Where(conditions[0])
+		default:
+			tx = tx.Where(clause.Or(conditions...))
 		}
+	}
+
+	return tx, nil
+}
 
-		return base64.RawURLEncoding.EncodeToString([]byte(nextBookmark)), nil
+func (db *PostgresDBQuerier[E]) filterCondition(filter resources.FilterOption, tx *gorm.DB) (clause.Expression, error) {
+	field, err := db.fields.lookup(filter.Field)
+	if err != nil {
+		return nil, err
+	}
+
+	return filterCondition(filter, field.FilterField, tx)
+}
+
+// keysetOrder orders rows by sort column and then by primary key. NULLs are
+// placed explicitly, as Postgres and SQLite disagree on where.
+func keysetOrder(query listQuery, keys listKeys) clause.OrderBy {
+	direction := "ASC"
+	nulls := "NULLS LAST"
+	if query.sortDesc {
+		direction = "DESC"
+		nulls = "NULLS FIRST"
+	}
+
+	pk := clause.Column{Name: keys.primaryKey.DBName}
+	if keys.sort == nil {
+		return clause.OrderBy{Expression: clause.Expr{SQL: "? " + direction, Vars: []any{pk}}}
+	}
+
+	col := clause.Column{Name: keys.sort.DBName}
+	return clause.OrderBy{Expression: clause.Expr{
+		SQL:  fmt.Sprintf("? %s %s, ? %s", direction, nulls, direction),
+		Vars: []any{col, pk},
+	}}
+}
+
+// keysetCondition selects the rows ordered after the cursor values. NULL sort
+// values go last in ascending order and first in descending order.
+func keysetCondition(query listQuery, keys listKeys, sortValue reflect.Value, id reflect.Value) clause.Expr {
+	pk := clause.Column{Name: keys.primaryKey.DBName}
+	after := ">"
+	if query.sortDesc {
+		after = "<"
+	}
+
+	if keys.sort == nil {
+		return clause.Expr{SQL: "? " + after + " ?", Vars: []any{pk, id.Interface()}}
+	}
+
+	col := clause.Column{Name: keys.sort.DBName}
+	switch {
+	case !sortValue.IsValid() && !query.sortDesc:
+		return clause.Expr{SQL: fmt.Sprintf("(? IS NULL AND ? %s ?)", after), Vars: []any{col, pk, id.Interface()}}
+	case !sortValue.IsValid():
+		return clause.Expr{SQL: fmt.Sprintf("((? IS NULL AND ? %s ?) OR ? IS NOT NULL)", after), Vars: []any{col, pk, id.Interface(), col}}
+	case !query.sortDesc:
+		return clause.Expr{SQL: fmt.Sprintf("(? %s ? OR (? = ? AND ? %s ?) OR ? IS NULL)", after, after), Vars: []any{col, sortValue.Interface(), col, sortValue.Interface(), pk, id.Interface(), col}}
+	default:
+		return clause.Expr{SQL: fmt.Sprintf("(? %s ? OR (? = ? AND ? %s ?))", after, after), Vars: []any{col, sortValue.Interface(), col, sortValue.Interface(), pk, id.Interface()}}
 	}
 }
 
@@ -288,7 +392,7 @@ func (db *PostgresDBQuerier[E]) SelectExists(ctx context.Context, queryID string
 	}
 
 	var elem E
-	tx := db.Table(db.tableName).WithContext(ctx).Preload(clause.Associations).Limit(1).Find(&elem, fmt.Sprintf("%s = ?", searchCol), queryID)
+	tx := db.Table(db.tableName).WithContext(ctx).Preload(clause.Associations).Limit(1).Find(&elem, clause.Eq{Column: clause.Column{Name: searchCol}, Value: queryID})
 	if tx.Error != nil {
 		return false, nil, tx.Error
 	}
@@ -309,8 +413,15 @@ func (db *PostgresDBQuerier[E]) Insert(ctx context.Context, elem *E) (*E, error)
 	return elem, nil
 }
 
+// Update saves an element. When E has a revision column, the update only
+// applies if the stored revision is the one of elem, which is then
+// incremented. Otherwise it fails with a *resources.ConflictError.
 func (db *PostgresDBQuerier[E]) Update(ctx context.Context, elem *E, elemID string) (*E, error) {
-	tx := db.Session(&gorm.Session{FullSaveAssociations: true}).Table(db.tableName).WithContext(ctx).Where(fmt.Sprintf("%s = ?", db.primaryKeyColumn), elemID).Save(elem)
+	if db.revision != nil {
+		return db.updateRevision(ctx, elem, elemID)
+	}
+
+	tx := db.Session(&gorm.Session{FullSaveAssociations: true}).Table(db.tableName).WithContext(ctx).Where(clause.Eq{Column: clause.Column{Name: db.primaryKeyColumn}, Value: elemID}).Save(elem)
 	if err := tx.Error; err != nil {
 		return nil, err
 	}
@@ -322,8 +433,49 @@ func (db *PostgresDBQuerier[E]) Update(ctx context.Context, elem *E, elemID stri
 	return elem, nil
 }
 
+func (db *PostgresDBQuerier[E]) updateRevision(ctx context.Context, elem *E, elemID string) (*E, error) {
+	rv := reflect.ValueOf(elem).Elem()
+	revision := revisionOf(ctx, db.revision, rv)
+	if err := db.revision.Set(ctx, rv, revision+1); err != nil {
+		return nil, err
+	}
+
+	// Save would insert the element when no row matches, so rows are updated
+	// along with their associations, all of which is rolled back on conflicts.
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		rs := tx.Session(&gorm.Session{FullSaveAssociations: true}).Table(db.tableName).Model(elem).Select("*").
+			Where(clause.Eq{Column: clause.Column{Name: db.primaryKeyColumn}, Value: elemID}).
+			Where(clause.Eq{Column: clause.Column{Name: db.revision.DBName}, Value: revision}).
+			Updates(elem)
+		if rs.Error != nil {
+			return rs.Error
+		}
+
+		if rs.RowsAffected == 1 {
+			return nil
+		}
+
+		var count int64
+		if err := tx.Table(db.tableName).Where(clause.Eq{Column: clause.Column{Name: db.primaryKeyColumn}, Value: elemID}).Count(&count).Error; err != nil {
+			return err
+		}
+
+		if count == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		return &resources.ConflictError{ID: elemID, Revision: revision}
+	})
+	if err != nil {
+		db.revision.Set(ctx, rv, revision)
+		return nil, err
+	}
+
+	return elem, nil
+}
+
 func (db *PostgresDBQuerier[E]) Delete(ctx context.Context, elemID string) error {
-	tx := db.Table(db.tableName).WithContext(ctx).Delete(nil, db.Where(fmt.Sprintf("%s = ?", db.primaryKeyColumn), elemID))
+	tx := db.Table(db.tableName).WithContext(ctx).Delete(nil, db.Where(clause.Eq{Column: clause.Column{Name: db.primaryKeyColumn}, Value: elemID}))
 	if err := tx.Error; err != nil {
 		return err
 	}
@@ -335,57 +487,133 @@ func (db *PostgresDBQuerier[E]) Delete(ctx context.Context, elemID string) error
 	return nil
 }
 
-func FilterOperandToWhereClause(filter resources.FilterOption, tx *gorm.DB) *gorm.DB {
-	if strings.Contains(filter.Field, ".") {
-		filter.Field = strings.ReplaceAll(filter.Field, ".", "_")
+// FilterOperandToWhereClause adds the condition of a filter on the given
+// field. Column names are quoted and values are always bound as parameters.
+func FilterOperandToWhereClause(filter resources.FilterOption, field resources.FilterField, tx *gorm.DB) (*gorm.DB, error) {
+	condition, err := filterCondition(filter, field, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx.Where(condition), nil
+}
+
+// filterCondition builds the condition of a filter on the given field.
+func filterCondition(filter resources.FilterOption, field resources.FilterField, tx *gorm.DB) (clause.Expression, error) {
+	column := columnExpr(tx, field)
+	compare := func(sql string, value any) (clause.Expression, error) {
+		return clause.Expr{SQL: sql, Vars: []any{column, value}}, nil
 	}
 
+	contains := fmt.Sprintf("%%%s%%", filter.Value)
+
 	switch filter.FilterOperation {
 	case resources.StringEqual:
-		return tx.Where(fmt.Sprintf("%s = ?", filter.Field), filter.Value)
+		return compare("? = ?", filter.Value)
 	case resources.StringEqualIgnoreCase:
-		return tx.Where(fmt.Sprintf("%s ILIKE ?", filter.Field), filter.Value)
+		return compare(ilike(tx, false), filter.Value)
 	case resources.StringNotEqual:
-		return tx.Where(fmt.Sprintf("%s <> ?", filter.Field), filter.Value)
+		return compare("? <> ?", filter.Value)
 	case resources.StringNotEqualIgnoreCase:
-		return tx.Where(fmt.Sprintf("%s NOT ILIKE ?", filter.Field), filter.Value)
+		return compare(ilike(tx, true), filter.Value)
 	case resources.StringContains:
-		return tx.Where(fmt.Sprintf("%s LIKE ?", filter.Field), fmt.Sprintf("%%%s%%", filter.Value))
+		return compare("? LIKE ?", contains)
 	case resources.StringContainsIgnoreCase:
-		return tx.Where(fmt.Sprintf("%s ILIKE ?", filter.Field), fmt.Sprintf("%%%s%%", filter.Value))
+		return compare(ilike(tx, false), contains)
 	case resources.StringArrayContains:
-		// return tx.Where(fmt.Sprintf("? = ANY(%s)", filter.Field), filter.Value)
-		return tx.Where(fmt.Sprintf("%s LIKE ?", filter.Field), fmt.Sprintf("%%%s%%", filter.Value))
+		return arrayContains(tx, field, filter.Value, false), nil
 	case resources.StringArrayContainsIgnoreCase:
-		// return tx.Where(fmt.Sprintf("? = ANY(%s)", filter.Field), filter.Value)
-		return tx.Where(fmt.Sprintf("%s ILIKE ?", filter.Field), fmt.Sprintf("%%%s%%", filter.Value))
+		return arrayContains(tx, field, filter.Value, true), nil
 	case resources.StringNotContains:
-		return tx.Where(fmt.Sprintf("%s NOT LIKE ?", filter.Field), fmt.Sprintf("%%%s%%", filter.Value))
+		return compare("? NOT LIKE ?", contains)
 	case resources.StringNotContainsIgnoreCase:
-		return tx.Where(fmt.Sprintf("%s NOT ILIKE ?", filter.Field), fmt.Sprintf("%%%s%%", filter.Value))
+		return compare(ilike(tx, true), contains)
 	case resources.DateEqual:
-		return tx.Where(fmt.Sprintf("%s = ?", filter.Field), filter.Value)
+		return compare(compareDates(tx, "="), filter.Value)
 	case resources.DateBefore:
-		return tx.Where(fmt.Sprintf("%s < ?", filter.Field), filter.Value)
+		return compare(compareDates(tx, "<"), filter.Value)
 	case resources.DateAfter:
-		return tx.Where(fmt.Sprintf("%s > ?", filter.Field), filter.Value)
+		return compare(compareDates(tx, ">"), filter.Value)
 	case resources.NumberEqual:
-		return tx.Where(fmt.Sprintf("%s = ?", filter.Field), filter.Value)
+		return compare("? = ?", filter.Value)
 	case resources.NumberNotEqual:
-		return tx.Where(fmt.Sprintf("%s <> ?", filter.Field), filter.Value)
+		return compare("? <> ?", filter.Value)
 	case resources.NumberLessThan:
-		return tx.Where(fmt.Sprintf("%s < ?", filter.Field), filter.Value)
+		return compare("? < ?", filter.Value)
 	case resources.NumberLessOrEqualThan:
-		return tx.Where(fmt.Sprintf("%s <= ?", filter.Field), filter.Value)
+		return compare("? <= ?", filter.Value)
 	case resources.NumberGreaterThan:
-		return tx.Where(fmt.Sprintf("%s > ?", filter.Field), filter.Value)
+		return compare("? > ?", filter.Value)
 	case resources.NumberGreaterOrEqualThan:
-		return tx.Where(fmt.Sprintf("%s >= ?", filter.Field), filter.Value)
+		return compare("? >= ?", filter.Value)
 	case resources.EnumEqual:
-		return tx.Where(fmt.Sprintf("%s = ?", filter.Field), filter.Value)
+		return compare("? = ?", enumValue(tx, filter.Value))
 	case resources.EnumNotEqual:
-		return tx.Where(fmt.Sprintf("%s <> ?", filter.Field), filter.Value)
+		return compare("? <> ?", enumValue(tx, filter.Value))
+	case resources.In, resources.NotIn:
+		if len(filter.Values) == 0 {
+			return nil, fmt.Errorf("filter on field %s has no values", filter.Field)
+		}
+
+		values := make([]any, 0, len(filter.Values))
+		for _, value := range filter.Values {
+			values = append(values, enumValue(tx, value))
+		}
+
+		if filter.FilterOperation == resources.NotIn {
+			return compare("? NOT IN ?", values)
+		}
+		return compare("? IN ?", values)
+	case resources.IsNull:
+		return clause.Expr{SQL: "? IS NULL", Vars: []any{column}}, nil
+	case resources.NotNull:
+		return clause.Expr{SQL: "? IS NOT NULL", Vars: []any{column}}, nil
+	case resources.DateBetween, resources.NumberBetween:
+		if len(filter.Values) != 2 {
+			return nil, fmt.Errorf("range on field %s needs two bounds", filter.Field)
+		}
+
+		sql := "? BETWEEN ? AND ?"
+		if filter.FilterOperation == resources.DateBetween && isSQLite(tx) {
+			sql = "julianday(?) BETWEEN julianday(?) AND julianday(?)"
+		}
+		return clause.Expr{SQL: sql, Vars: []any{column, filter.Values[0], filter.Values[1]}}, nil
 	default:
-		return tx
+		return nil, fmt.Errorf("unsupported filter operation %d on field %s", filter.FilterOperation, filter.Field)
+	}
+}
+
+// ilike builds a case insensitive LIKE condition. SQLite has no ILIKE operator,
+// so both sides are lowered there instead.
+func ilike(tx *gorm.DB, negate bool) string {
+	not := ""
+	if negate {
+		not = "NOT "
+	}
+
+	if isSQLite(tx) {
+		return "LOWER(?) " + not + "LIKE LOWER(?)"
 	}
+
+	return "? " + not + "ILIKE ?"
+}
+
+// compareDates builds a timestamp comparison. SQLite stores timestamps as text,
+// so both sides are converted to Julian days there instead.
+func compareDates(tx *gorm.DB, operator string) string {
+	if isSQLite(tx) {
+		return "julianday(?) " + operator + " julianday(?)"
+	}
+
+	return "? " + operator + " ?"
+}
+
+// enumValue passes boolean enum values as booleans to SQLite, which stores
+// them as integers and would not match them against text.
+func enumValue(tx *gorm.DB, value string) any {
+	if isSQLite(tx) && (value == "true" || value == "false") {
+		return value == "true"
+	}
+
+	return value
 }
@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/config"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/plugin/opentelemetry/tracing"
+)
+
+// SQLiteRandomUUID is a SQLite expression building a random (version 4) UUID,
+// standing in for gen_random_uuid() in column defaults.
+const SQLiteRandomUUID = "(lower(hex(randomblob(4))) || '-' || lower(hex(randomblob(2))) || '-4' || " +
+	"substr(lower(hex(randomblob(2))), 2) || '-' || substr('89ab', 1 + (abs(random()) % 4), 1) || " +
+	"substr(lower(hex(randomblob(2))), 2) || '-' || lower(hex(randomblob(6))))"
+
+func CreateSQLiteDBConnection(logger *logger.Logger, cfg config.SQLiteConfig, database string) (*gorm.DB, error) {
+	dbLogger := &GormLogger{
+		logger: logger,
+	}
+
+	// LIKE is made case sensitive, as in Postgres. ILIKE is emulated by the querier.
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared&_foreign_keys=1&_case_sensitive_like=1", database)
+	if cfg.Directory != "" {
+		err := os.MkdirAll(cfg.Directory, 0o750)
+		if err != nil {
+			logger.Errorf("could not create sqlite directory %s: %s", cfg.Directory, err)
+			return nil, err
+		}
+
+		path := filepath.Join(cfg.Directory, database+".db")
+		dsn = fmt.Sprintf("file:%s?_foreign_keys=1&_case_sensitive_like=1&_journal_mode=WAL&_busy_timeout=5000", path)
+	}
+
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: dbLogger,
+	})
+	if err != nil {
+		logger.Errorf("could not open sqlite database %s: %s", database, err)
+		return nil, err
+	}
+
+	err = db.Use(tracing.NewPlugin())
+	if err != nil {
+		logger.Errorf("Failed to use OpenTelemetry plugin: %v", err)
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func isSQLite(tx *gorm.DB) bool {
+	return tx.Dialector.Name() == "sqlite"
+}
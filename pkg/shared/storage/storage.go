@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/config"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
+	"gorm.io/gorm"
+)
+
+// CreateDBConnection opens the database of the configured SQL provider. The
+// returned connection works with PostgresDBQuerier regardless of the provider.
+func CreateDBConnection(logger *logger.Logger, conf config.PluggableStorageEngine, database string) (*gorm.DB, error) {
+	switch conf.Provider {
+	case config.Postgres:
+		pconf, err := config.DecodeStruct[config.PostgresConfig](conf.Config)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode storage config: %s", err)
+		}
+
+		return CreatePostgresDBConnection(logger, pconf, database)
+	case config.SQLite:
+		sconf, err := config.DecodeStruct[config.SQLiteConfig](conf.Config)
+		if err != nil {
+			return nil, fmt.Errorf("could not decode storage config: %s", err)
+		}
+
+		return CreateSQLiteDBConnection(logger, sconf, database)
+	default:
+		return nil, fmt.Errorf("unsupported storage provider %q", conf.Provider)
+	}
+}
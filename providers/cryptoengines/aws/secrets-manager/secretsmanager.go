@@ -3,7 +3,9 @@ package secretsmanager
 import (
 	"context"
 	"crypto"
+	"crypto/ecdh"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/rsa"
 	"encoding/base64"
@@ -11,6 +13,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"filippo.io/mldsa"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/kms/cryptoengines"
@@ -64,6 +67,12 @@ func NewAWSSecretManagerEngine(logger *logger.Logger, awsConf aws.Config, metada
 						521,
 					},
 				},
+				{
+					Type: "ED25519",
+					Sizes: []int{
+						256,
+					},
+				},
 			},
 		},
 	}, nil
@@ -76,6 +85,26 @@ func (engine *AWSSecretsManagerCryptoEngine) GetEngineConfig(ctx context.Context
 func (engine *AWSSecretsManagerCryptoEngine) GetPrivateKeyByID(ctx context.Context, keyID string) (crypto.Signer, error) {
 	engine.logger.Debugf("Getting the private key with ID: %s", keyID)
 
+	pemBytes, err := engine.getKeyPEM(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return engine.keyProvider.ParsePrivateKey(pemBytes)
+}
+
+func (engine *AWSSecretsManagerCryptoEngine) GetDecrypterByID(ctx context.Context, keyID string) (crypto.Decrypter, error) {
+	engine.logger.Debugf("Getting the decryption key with ID: %s", keyID)
+
+	pemBytes, err := engine.getKeyPEM(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return engine.keyProvider.ParseDecrypter(pemBytes)
+}
+
+func (engine *AWSSecretsManagerCryptoEngine) getKeyPEM(ctx context.Context, keyID string) ([]byte, error) {
 	result, err := engine.smngerCli.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
 		SecretId: aws.String(keyID),
 	})
@@ -105,7 +134,7 @@ func (engine *AWSSecretsManagerCryptoEngine) GetPrivateKeyByID(ctx context.Conte
 		return nil, err
 	}
 
-	return engine.keyProvider.ParsePrivateKey(decodedPemBytes)
+	return decodedPemBytes, nil
 }
 
 func (engine *AWSSecretsManagerCryptoEngine) ListPrivateKeyIDs(ctx context.Context) ([]string, error) {
@@ -153,6 +182,27 @@ func (engine *AWSSecretsManagerCryptoEngine) CreateECDSAPrivateKey(ctx context.C
 	return engine.importKey(ctx, key)
 }
 
+func (engine *AWSSecretsManagerCryptoEngine) CreateEd25519PrivateKey(ctx context.Context) (string, crypto.Signer, error) {
+	engine.logger.Debugf("creating Ed25519 private key")
+
+	_, key, err := engine.keyProvider.CreateEd25519PrivateKey()
+	if err != nil {
+		engine.logger.Errorf("could not create Ed25519 private key: %s", err)
+		return "", nil, err
+	}
+
+	engine.logger.Debugf("Ed25519 key successfully generated")
+	return engine.importKey(ctx, key)
+}
+
+func (engine *AWSSecretsManagerCryptoEngine) CreateX25519PrivateKey(ctx context.Context) (string, *ecdh.PublicKey, error) {
+	return "", nil, cryptoengines.ErrOperationNotSupported
+}
+
+func (engine *AWSSecretsManagerCryptoEngine) CreateMLDSAPrivateKey(ctx context.Context, params *mldsa.Parameters) (string, crypto.Signer, error) {
+	return "", nil, cryptoengines.ErrOperationNotSupported
+}
+
 func (engine *AWSSecretsManagerCryptoEngine) ImportRSAPrivateKey(ctx context.Context, key *rsa.PrivateKey) (string, crypto.Signer, error) {
 	engine.logger.Debugf("importing RSA private key")
 
@@ -179,6 +229,19 @@ func (engine *AWSSecretsManagerCryptoEngine) ImportECDSAPrivateKey(ctx context.C
 	return keyID, signer, nil
 }
 
+func (engine *AWSSecretsManagerCryptoEngine) ImportEd25519PrivateKey(ctx context.Context, key ed25519.PrivateKey) (string, crypto.Signer, error) {
+	engine.logger.Debugf("importing Ed25519 private key")
+
+	keyID, signer, err := engine.importKey(ctx, key)
+	if err != nil {
+		engine.logger.Errorf("could not import Ed25519 key: %s", err)
+		return "", nil, err
+	}
+
+	engine.logger.Debugf("Ed25519 key successfully imported")
+	return keyID, signer, nil
+}
+
 func (engine *AWSSecretsManagerCryptoEngine) importKey(ctx context.Context, key crypto.Signer) (string, crypto.Signer, error) {
 	pubKey := key.Public()
 
@@ -254,3 +317,35 @@ func (engine *AWSSecretsManagerCryptoEngine) DeleteKey(ctx context.Context, keyI
 	engine.logger.Debugf("key successfully deleted")
 	return nil
 }
+
+func (engine *AWSSecretsManagerCryptoEngine) CreateAESKey(ctx context.Context, keySize int) (string, error) {
+	return "", cryptoengines.ErrOperationNotSupported
+}
+
+func (engine *AWSSecretsManagerCryptoEngine) CreateHMACKey(ctx context.Context, keySize int) (string, error) {
+	return "", cryptoengines.ErrOperationNotSupported
+}
+
+func (engine *AWSSecretsManagerCryptoEngine) ImportAESKey(ctx context.Context, key []byte) (string, error) {
+	return "", cryptoengines.ErrOperationNotSupported
+}
+
+func (engine *AWSSecretsManagerCryptoEngine) ImportHMACKey(ctx context.Context, key []byte) (string, error) {
+	return "", cryptoengines.ErrOperationNotSupported
+}
+
+func (engine *AWSSecretsManagerCryptoEngine) GetSymmetricKeyByID(ctx context.Context, keyID string) ([]byte, error) {
+	return nil, cryptoengines.ErrOperationNotSupported
+}
+
+func (engine *AWSSecretsManagerCryptoEngine) EncryptAESGCM(ctx context.Context, keyID string, plaintext, aad []byte) ([]byte, error) {
+	return nil, cryptoengines.ErrOperationNotSupported
+}
+
+func (engine *AWSSecretsManagerCryptoEngine) DecryptAESGCM(ctx context.Context, keyID string, ciphertext, aad []byte) ([]byte, error) {
+	return nil, cryptoengines.ErrOperationNotSupported
+}
+
+func (engine *AWSSecretsManagerCryptoEngine) ComputeHMAC(ctx context.Context, keyID string, hash crypto.Hash, message []byte) ([]byte, error) {
+	return nil, cryptoengines.ErrOperationNotSupported
+}
@@ -0,0 +1,21 @@
+package envelope
+
+import (
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms/cryptoengines"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/config"
+	filestore "github.com/lamassuiot/lamassuiot/v4/providers/file-store/service"
+)
+
+type EnvelopeEngineConfig struct {
+	FileStore filestore.FileStoreConfig `mapstructure:"file_store"`
+	KeyPrefix string                    `mapstructure:"key_prefix"`
+	KEK       KeyEncryptionKeyConfig    `mapstructure:"kek"`
+}
+
+// KeyEncryptionKeyConfig selects where the key-encryption key lives. Either a
+// base64 encoded AES-256 master key or a key held by another crypto engine must be set.
+type KeyEncryptionKeyConfig struct {
+	MasterKey config.Password                   `mapstructure:"master_key"`
+	Engine    *cryptoengines.CryptoEngineConfig `mapstructure:"engine"`
+	KeyID     string                            `mapstructure:"key_id"`
+}
@@ -0,0 +1,404 @@
+package envelope
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"filippo.io/mldsa"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms/cryptoengines"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
+	"gocloud.dev/blob"
+)
+
+const (
+	envelopeVersion = 1
+	envelopeAlg     = "AES-256-GCM"
+	dekSize         = 32
+)
+
+// sealedKey is the object stored in the bucket for every private key.
+type sealedKey struct {
+	Version    int    `json:"version"`
+	Algorithm  string `json:"alg"`
+	WrappedDEK []byte `json:"wrapped_dek"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+type EnvelopeCryptoEngine struct {
+	softCryptoEngine *cryptoengines.SoftwareKeyProvider
+	config           cryptoengines.CryptoEngineInfo
+	bucket           *blob.Bucket
+	kek              KeyWrapper
+	keyPrefix        string
+	logger           *logger.Logger
+}
+
+func NewEnvelopeCryptoEngine(logger *logger.Logger, bucket *blob.Bucket, kek KeyWrapper, keyPrefix string, metadata map[string]any) (cryptoengines.CryptoEngine, error) {
+	lEnv := logger.With("subsystem-provider", "Envelope")
+
+	return &EnvelopeCryptoEngine{
+		logger:           lEnv,
+		softCryptoEngine: cryptoengines.NewSoftwareKeyProvider(lEnv),
+		bucket:           bucket,
+		kek:              kek,
+		keyPrefix:        keyPrefix,
+		config: cryptoengines.CryptoEngineInfo{
+			Type:          cryptoengines.Envelope,
+			SecurityLevel: kek.SecurityLevel(),
+			Provider:      "Lamassu",
+			Name:          "Envelope Encryption",
+			Metadata:      metadata,
+			SupportedKeyTypes: []cryptoengines.SupportedKeyTypeInfo{
+				{
+					Type: "RSA",
+					Sizes: []int{
+						2048,
+						3072,
+						4096,
+					},
+				},
+				{
+					Type: "ECDSA",
+					Sizes: []int{
+						224,
+						256,
+						384,
+						521,
+					},
+				},
+				{
+					Type: "ED25519",
+					Sizes: []int{
+						256,
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+func (engine *EnvelopeCryptoEngine) GetEngineConfig(ctx context.Context) cryptoengines.CryptoEngineInfo {
+	return engine.config
+}
+
+func (engine *EnvelopeCryptoEngine) GetPrivateKeyByID(ctx context.Context, keyID string) (crypto.Signer, error) {
+	engine.logger.Debugf("reading %s Key", keyID)
+
+	pemBytes, err := engine.openKey(ctx, keyID)
+	if err != nil {
+		engine.logger.Errorf("could not read %s Key: %s", keyID, err)
+		return nil, err
+	}
+
+	return engine.softCryptoEngine.ParsePrivateKey(pemBytes)
+}
+
+func (engine *EnvelopeCryptoEngine) GetDecrypterByID(ctx context.Context, keyID string) (crypto.Decrypter, error) {
+	engine.logger.Debugf("reading %s Key", keyID)
+
+	pemBytes, err := engine.openKey(ctx, keyID)
+	if err != nil {
+		engine.logger.Errorf("could not read %s Key: %s", keyID, err)
+		return nil, err
+	}
+
+	return engine.softCryptoEngine.ParseDecrypter(pemBytes)
+}
+
+func (engine *EnvelopeCryptoEngine) ListPrivateKeyIDs(ctx context.Context) ([]string, error) {
+	engine.logger.Debugf("listing private key IDs")
+
+	keyIDs := []string{}
+	iter := engine.bucket.List(&blob.ListOptions{Prefix: engine.keyPrefix})
+	for {
+		obj, err := iter.Next(ctx)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			engine.logger.Errorf("could not list objects: %s", err)
+			return nil, err
+		}
+
+		if obj.IsDir {
+			continue
+		}
+
+		keyIDs = append(keyIDs, strings.TrimPrefix(obj.Key, engine.keyPrefix))
+	}
+
+	engine.logger.Debugf("private key IDs successfully listed")
+	return keyIDs, nil
+}
+
+func (engine *EnvelopeCryptoEngine) CreateRSAPrivateKey(ctx context.Context, keySize int) (string, crypto.Signer, error) {
+	engine.logger.Debugf("creating RSA private key")
+
+	_, key, err := engine.softCryptoEngine.CreateRSAPrivateKey(keySize)
+	if err != nil {
+		engine.logger.Errorf("could not create RSA private key: %s", err)
+		return "", nil, err
+	}
+
+	engine.logger.Debugf("RSA key successfully generated")
+	return engine.importKey(ctx, key)
+}
+
+func (engine *EnvelopeCryptoEngine) CreateECDSAPrivateKey(ctx context.Context, curve elliptic.Curve) (string, crypto.Signer, error) {
+	engine.logger.Debugf("creating ECDSA private key")
+
+	_, key, err := engine.softCryptoEngine.CreateECDSAPrivateKey(curve)
+	if err != nil {
+		engine.logger.Errorf("could not create ECDSA private key: %s", err)
+		return "", nil, err
+	}
+
+	engine.logger.Debugf("ECDSA key successfully generated")
+	return engine.importKey(ctx, key)
+}
+
+func (engine *EnvelopeCryptoEngine) CreateEd25519PrivateKey(ctx context.Context) (string, crypto.Signer, error) {
+	engine.logger.Debugf("creating Ed25519 private key")
+
+	_, key, err := engine.softCryptoEngine.CreateEd25519PrivateKey()
+	if err != nil {
+		engine.logger.Errorf("could not create Ed25519 private key: %s", err)
+		return "", nil, err
+	}
+
+	engine.logger.Debugf("Ed25519 key successfully generated")
+	return engine.importKey(ctx, key)
+}
+
+func (engine *EnvelopeCryptoEngine) CreateX25519PrivateKey(ctx context.Context) (string, *ecdh.PublicKey, error) {
+	return "", nil, cryptoengines.ErrOperationNotSupported
+}
+
+func (engine *EnvelopeCryptoEngine) CreateMLDSAPrivateKey(ctx context.Context, params *mldsa.Parameters) (string, crypto.Signer, error) {
+	return "", nil, cryptoengines.ErrOperationNotSupported
+}
+
+func (engine *EnvelopeCryptoEngine) ImportRSAPrivateKey(ctx context.Context, key *rsa.PrivateKey) (string, crypto.Signer, error) {
+	engine.logger.Debugf("importing RSA private key")
+
+	keyID, signer, err := engine.importKey(ctx, key)
+	if err != nil {
+		engine.logger.Errorf("could not import RSA key: %s", err)
+		return "", nil, err
+	}
+
+	engine.logger.Debugf("RSA key successfully imported")
+	return keyID, signer, nil
+}
+
+func (engine *EnvelopeCryptoEngine) ImportECDSAPrivateKey(ctx context.Context, key *ecdsa.PrivateKey) (string, crypto.Signer, error) {
+	engine.logger.Debugf("importing ECDSA private key")
+
+	keyID, signer, err := engine.importKey(ctx, key)
+	if err != nil {
+		engine.logger.Errorf("could not import ECDSA key: %s", err)
+		return "", nil, err
+	}
+
+	engine.logger.Debugf("ECDSA key successfully imported")
+	return keyID, signer, nil
+}
+
+func (engine *EnvelopeCryptoEngine) ImportEd25519PrivateKey(ctx context.Context, key ed25519.PrivateKey) (string, crypto.Signer, error) {
+	engine.logger.Debugf("importing Ed25519 private key")
+
+	keyID, signer, err := engine.importKey(ctx, key)
+	if err != nil {
+		engine.logger.Errorf("could not import Ed25519 key: %s", err)
+		return "", nil, err
+	}
+
+	engine.logger.Debugf("Ed25519 key successfully imported")
+	return keyID, signer, nil
+}
+
+func (engine *EnvelopeCryptoEngine) DeleteKey(ctx context.Context, keyID string) error {
+	engine.logger.Debugf("deleting key with ID: %s", keyID)
+
+	err := engine.bucket.Delete(ctx, engine.objectKey(keyID))
+	if err != nil {
+		engine.logger.Errorf("could not delete key: %s", err)
+		return err
+	}
+
+	engine.logger.Debugf("key successfully deleted")
+	return nil
+}
+
+// RenameKey re-seals the key under the new ID, as the key ID is bound to the
+// ciphertext as additional authenticated data.
+func (engine *EnvelopeCryptoEngine) RenameKey(ctx context.Context, oldID, newID string) error {
+	engine.logger.Debugf("renaming key %s to %s", oldID, newID)
+
+	pemBytes, err := engine.openKey(ctx, oldID)
+	if err != nil {
+		engine.logger.Errorf("could not read %s Key: %s", oldID, err)
+		return err
+	}
+
+	err = engine.sealKey(ctx, newID, pemBytes)
+	if err != nil {
+		engine.logger.Errorf("could not store key %s: %s", newID, err)
+		return err
+	}
+
+	err = engine.DeleteKey(ctx, oldID)
+	if err != nil {
+		engine.logger.Errorf("could not delete old key: %s", err)
+		return err
+	}
+
+	engine.logger.Debugf("key %s successfully renamed to %s", oldID, newID)
+	return nil
+}
+
+func (engine *EnvelopeCryptoEngine) CreateAESKey(ctx context.Context, keySize int) (string, error) {
+	return "", cryptoengines.ErrOperationNotSupported
+}
+
+func (engine *EnvelopeCryptoEngine) CreateHMACKey(ctx context.Context, keySize int) (string, error) {
+	return "", cryptoengines.ErrOperationNotSupported
+}
+
+func (engine *EnvelopeCryptoEngine) ImportAESKey(ctx context.Context, key []byte) (string, error) {
+	return "", cryptoengines.ErrOperationNotSupported
+}
+
+func (engine *EnvelopeCryptoEngine) ImportHMACKey(ctx context.Context, key []byte) (string, error) {
+	return "", cryptoengines.ErrOperationNotSupported
+}
+
+func (engine *EnvelopeCryptoEngine) GetSymmetricKeyByID(ctx context.Context, keyID string) ([]byte, error) {
+	return nil, cryptoengines.ErrOperationNotSupported
+}
+
+func (engine *EnvelopeCryptoEngine) EncryptAESGCM(ctx context.Context, keyID string, plaintext, aad []byte) ([]byte, error) {
+	return nil, cryptoengines.ErrOperationNotSupported
+}
+
+func (engine *EnvelopeCryptoEngine) DecryptAESGCM(ctx context.Context, keyID string, ciphertext, aad []byte) ([]byte, error) {
+	return nil, cryptoengines.ErrOperationNotSupported
+}
+
+func (engine *EnvelopeCryptoEngine) ComputeHMAC(ctx context.Context, keyID string, hash crypto.Hash, message []byte) ([]byte, error) {
+	return nil, cryptoengines.ErrOperationNotSupported
+}
+
+func (engine *EnvelopeCryptoEngine) importKey(ctx context.Context, key crypto.Signer) (string, crypto.Signer, error) {
+	keyID, err := engine.softCryptoEngine.EncodePKIXPublicKeyDigest(key.Public())
+	if err != nil {
+		engine.logger.Errorf("could not encode public key digest: %s", err)
+		return "", nil, err
+	}
+
+	b64PemKey, err := engine.softCryptoEngine.MarshalAndEncodePKIXPrivateKey(key)
+	if err != nil {
+		engine.logger.Errorf("could not marshal and encode private key: %s", err)
+		return "", nil, err
+	}
+
+	pemKey, err := base64.StdEncoding.DecodeString(b64PemKey)
+	if err != nil {
+		engine.logger.Errorf("could not decode private key: %s", err)
+		return "", nil, err
+	}
+
+	err = engine.sealKey(ctx, keyID, pemKey)
+	if err != nil {
+		engine.logger.Errorf("could not store private key: %s", err)
+		return "", nil, err
+	}
+
+	return keyID, key, nil
+}
+
+func (engine *EnvelopeCryptoEngine) sealKey(ctx context.Context, keyID string, pemKey []byte) error {
+	dek := make([]byte, dekSize)
+	if _, err := rand.Read(dek); err != nil {
+		return err
+	}
+
+	aead, err := newAESGCM(dek)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	wrappedDEK, err := engine.kek.WrapKey(ctx, dek)
+	if err != nil {
+		return fmt.Errorf("could not wrap data encryption key: %s", err)
+	}
+
+	sealed, err := json.Marshal(sealedKey{
+		Version:    envelopeVersion,
+		Algorithm:  envelopeAlg,
+		WrappedDEK: wrappedDEK,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, pemKey, []byte(keyID)),
+	})
+	if err != nil {
+		return err
+	}
+
+	return engine.bucket.WriteAll(ctx, engine.objectKey(keyID), sealed, &blob.WriterOptions{
+		ContentType: "application/json",
+	})
+}
+
+func (engine *EnvelopeCryptoEngine) openKey(ctx context.Context, keyID string) ([]byte, error) {
+	sealedBytes, err := engine.bucket.ReadAll(ctx, engine.objectKey(keyID))
+	if err != nil {
+		return nil, err
+	}
+
+	var sealed sealedKey
+	err = json.Unmarshal(sealedBytes, &sealed)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode sealed key: %s", err)
+	}
+
+	if sealed.Version != envelopeVersion || sealed.Algorithm != envelopeAlg {
+		return nil, fmt.Errorf("unsupported sealed key format: version %d, alg %s", sealed.Version, sealed.Algorithm)
+	}
+
+	dek, err := engine.kek.UnwrapKey(ctx, sealed.WrappedDEK)
+	if err != nil {
+		return nil, fmt.Errorf("could not unwrap data encryption key: %s", err)
+	}
+
+	aead, err := newAESGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid sealed key nonce")
+	}
+
+	return aead.Open(nil, sealed.Nonce, sealed.Ciphertext, []byte(keyID))
+}
+
+func (engine *EnvelopeCryptoEngine) objectKey(keyID string) string {
+	return engine.keyPrefix + keyID
+}
@@ -0,0 +1,216 @@
+package envelope
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"testing"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms/cryptoengines"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
+	"gocloud.dev/blob"
+	"gocloud.dev/blob/memblob"
+)
+
+const testKeyPrefix = "keys/"
+
+func newTestEngine(t *testing.T, bucket *blob.Bucket) *EnvelopeCryptoEngine {
+	masterKey := make([]byte, masterKeySize)
+	rand.Read(masterKey)
+
+	kek, err := NewMasterKeyWrapper(masterKey)
+	if err != nil {
+		t.Fatalf("could not create master key wrapper: %s", err)
+	}
+
+	engine, err := NewEnvelopeCryptoEngine(logger.SetupLogger(logger.LevelNone, "KMS", "Test"), bucket, kek, testKeyPrefix, nil)
+	if err != nil {
+		t.Fatalf("could not create engine: %s", err)
+	}
+
+	return engine.(*EnvelopeCryptoEngine)
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+	engine := newTestEngine(t, bucket)
+
+	keyID, signer, err := engine.CreateECDSAPrivateKey(ctx, elliptic.P256())
+	if err != nil {
+		t.Fatalf("could not create key: %s", err)
+	}
+
+	opened, err := engine.GetPrivateKeyByID(ctx, keyID)
+	if err != nil {
+		t.Fatalf("could not open key: %s", err)
+	}
+
+	digest := sha256.Sum256([]byte("message"))
+	signature, err := opened.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("could not sign: %s", err)
+	}
+
+	if !ecdsa.VerifyASN1(signer.Public().(*ecdsa.PublicKey), digest[:], signature) {
+		t.Errorf("signature of opened key does not verify with the created key")
+	}
+
+	sealedBytes, err := bucket.ReadAll(ctx, testKeyPrefix+keyID)
+	if err != nil {
+		t.Fatalf("could not read sealed key: %s", err)
+	}
+
+	var sealed sealedKey
+	if err := json.Unmarshal(sealedBytes, &sealed); err != nil {
+		t.Fatalf("could not decode sealed key: %s", err)
+	}
+	if sealed.Version != envelopeVersion || sealed.Algorithm != envelopeAlg || len(sealed.WrappedDEK) == 0 {
+		t.Errorf("unexpected sealed key header: %+v", sealed)
+	}
+
+	ids, err := engine.ListPrivateKeyIDs(ctx)
+	if err != nil || len(ids) != 1 || ids[0] != keyID {
+		t.Errorf("got key IDs %v, %v, want [%s]", ids, err, keyID)
+	}
+}
+
+func TestOpenTamperedKey(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		tamper func(t *testing.T, bucket *blob.Bucket, keyID string) string
+	}{
+		{
+			// The key ID is the AAD of the sealed key, so a sealed key copied
+			// under another ID must not open.
+			name: "MovedToAnotherID",
+			tamper: func(t *testing.T, bucket *blob.Bucket, keyID string) string {
+				sealedBytes, _ := bucket.ReadAll(ctx, testKeyPrefix+keyID)
+				bucket.WriteAll(ctx, testKeyPrefix+"other", sealedBytes, nil)
+				return "other"
+			},
+		},
+		{
+			name: "Ciphertext",
+			tamper: func(t *testing.T, bucket *blob.Bucket, keyID string) string {
+				rewriteSealedKey(t, bucket, keyID, func(sealed *sealedKey) { sealed.Ciphertext[0] ^= 1 })
+				return keyID
+			},
+		},
+		{
+			name: "WrappedDEK",
+			tamper: func(t *testing.T, bucket *blob.Bucket, keyID string) string {
+				rewriteSealedKey(t, bucket, keyID, func(sealed *sealedKey) { sealed.WrappedDEK[len(sealed.WrappedDEK)-1] ^= 1 })
+				return keyID
+			},
+		},
+		{
+			name: "Nonce",
+			tamper: func(t *testing.T, bucket *blob.Bucket, keyID string) string {
+				rewriteSealedKey(t, bucket, keyID, func(sealed *sealedKey) { sealed.Nonce = sealed.Nonce[1:] })
+				return keyID
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bucket := memblob.OpenBucket(nil)
+			engine := newTestEngine(t, bucket)
+
+			keyID, _, err := engine.CreateEd25519PrivateKey(ctx)
+			if err != nil {
+				t.Fatalf("could not create key: %s", err)
+			}
+
+			tamperedID := tt.tamper(t, bucket, keyID)
+			if _, err := engine.GetPrivateKeyByID(ctx, tamperedID); err == nil {
+				t.Errorf("tampered key was opened")
+			}
+		})
+	}
+}
+
+func TestOpenWithAnotherMasterKey(t *testing.T) {
+	ctx := context.Background()
+	bucket := memblob.OpenBucket(nil)
+
+	keyID, _, err := newTestEngine(t, bucket).CreateRSAPrivateKey(ctx, 2048)
+	if err != nil {
+		t.Fatalf("could not create key: %s", err)
+	}
+
+	if _, err := newTestEngine(t, bucket).GetPrivateKeyByID(ctx, keyID); err == nil {
+		t.Errorf("key was opened with another master key")
+	}
+}
+
+func TestRenameKeyReseals(t *testing.T) {
+	ctx := context.Background()
+	engine := newTestEngine(t, memblob.OpenBucket(nil))
+
+	keyID, signer, err := engine.CreateECDSAPrivateKey(ctx, elliptic.P384())
+	if err != nil {
+		t.Fatalf("could not create key: %s", err)
+	}
+
+	if err := engine.RenameKey(ctx, keyID, "renamed"); err != nil {
+		t.Fatalf("could not rename key: %s", err)
+	}
+
+	if _, err := engine.GetPrivateKeyByID(ctx, keyID); err == nil {
+		t.Errorf("old key ID still opens")
+	}
+
+	renamed, err := engine.GetPrivateKeyByID(ctx, "renamed")
+	if err != nil {
+		t.Fatalf("could not open renamed key: %s", err)
+	}
+
+	if !renamed.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(signer.Public()) {
+		t.Errorf("renamed key does not match the created key")
+	}
+}
+
+func TestNewMasterKeyWrapperKeySize(t *testing.T) {
+	for _, size := range []int{0, 16, 24, 31, 33, 64} {
+		if _, err := NewMasterKeyWrapper(make([]byte, size)); err == nil {
+			t.Errorf("%d byte master key was accepted", size)
+		}
+	}
+
+	wrapper, err := NewMasterKeyWrapper(make([]byte, masterKeySize))
+	if err != nil {
+		t.Fatalf("could not create master key wrapper: %s", err)
+	}
+
+	if wrapper.SecurityLevel() != cryptoengines.SL0 {
+		t.Errorf("got security level %d, want %d", wrapper.SecurityLevel(), cryptoengines.SL0)
+	}
+}
+
+func rewriteSealedKey(t *testing.T, bucket *blob.Bucket, keyID string, tamper func(sealed *sealedKey)) {
+	ctx := context.Background()
+
+	sealedBytes, err := bucket.ReadAll(ctx, testKeyPrefix+keyID)
+	if err != nil {
+		t.Fatalf("could not read sealed key: %s", err)
+	}
+
+	var sealed sealedKey
+	if err := json.Unmarshal(sealedBytes, &sealed); err != nil {
+		t.Fatalf("could not decode sealed key: %s", err)
+	}
+
+	tamper(&sealed)
+
+	sealedBytes, _ = json.Marshal(sealed)
+	if err := bucket.WriteAll(ctx, testKeyPrefix+keyID, sealedBytes, nil); err != nil {
+		t.Fatalf("could not write sealed key: %s", err)
+	}
+}
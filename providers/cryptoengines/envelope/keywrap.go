@@ -0,0 +1,126 @@
+package envelope
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms/cryptoengines"
+)
+
+// KeyWrapper protects the data-encryption keys used to seal each private key.
+type KeyWrapper interface {
+	WrapKey(ctx context.Context, dek []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, wrappedDEK []byte) ([]byte, error)
+	SecurityLevel() cryptoengines.CryptoEngineSL
+}
+
+// masterKeySize is the size of AES-256 master keys.
+const masterKeySize = 32
+
+type masterKeyWrapper struct {
+	aead cipher.AEAD
+}
+
+// NewMasterKeyWrapper wraps data-encryption keys with AES-256-GCM using a
+// locally held 32 byte master key.
+func NewMasterKeyWrapper(masterKey []byte) (KeyWrapper, error) {
+	if len(masterKey) != masterKeySize {
+		return nil, fmt.Errorf("invalid master key: got %d bytes, want %d", len(masterKey), masterKeySize)
+	}
+
+	aead, err := newAESGCM(masterKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid master key: %s", err)
+	}
+
+	return &masterKeyWrapper{aead: aead}, nil
+}
+
+func (w *masterKeyWrapper) WrapKey(ctx context.Context, dek []byte) ([]byte, error) {
+	nonce := make([]byte, w.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	return w.aead.Seal(nonce, nonce, dek, nil), nil
+}
+
+func (w *masterKeyWrapper) UnwrapKey(ctx context.Context, wrappedDEK []byte) ([]byte, error) {
+	nonceSize := w.aead.NonceSize()
+	if len(wrappedDEK) < nonceSize {
+		return nil, fmt.Errorf("wrapped key too short")
+	}
+
+	return w.aead.Open(nil, wrappedDEK[:nonceSize], wrappedDEK[nonceSize:], nil)
+}
+
+func (w *masterKeyWrapper) SecurityLevel() cryptoengines.CryptoEngineSL {
+	return cryptoengines.SL0
+}
+
+type cryptoEngineKeyWrapper struct {
+	engine cryptoengines.CryptoEngine
+	keyID  string
+	pubKey *rsa.PublicKey
+}
+
+// NewCryptoEngineKeyWrapper wraps data-encryption keys with RSA-OAEP using a key
+// held by another crypto engine. The key must be an RSA key able to decrypt.
+func NewCryptoEngineKeyWrapper(ctx context.Context, engine cryptoengines.CryptoEngine, keyID string) (KeyWrapper, error) {
+	signer, err := engine.GetPrivateKeyByID(ctx, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get kek %s: %s", keyID, err)
+	}
+
+	pubKey, ok := signer.Public().(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("kek %s is not an RSA key", keyID)
+	}
+
+	if _, ok := signer.(crypto.Decrypter); !ok {
+		return nil, fmt.Errorf("kek %s does not support decryption", keyID)
+	}
+
+	return &cryptoEngineKeyWrapper{
+		engine: engine,
+		keyID:  keyID,
+		pubKey: pubKey,
+	}, nil
+}
+
+func (w *cryptoEngineKeyWrapper) WrapKey(ctx context.Context, dek []byte) ([]byte, error) {
+	return rsa.EncryptOAEP(sha256.New(), rand.Reader, w.pubKey, dek, nil)
+}
+
+func (w *cryptoEngineKeyWrapper) UnwrapKey(ctx context.Context, wrappedDEK []byte) ([]byte, error) {
+	signer, err := w.engine.GetPrivateKeyByID(ctx, w.keyID)
+	if err != nil {
+		return nil, fmt.Errorf("could not get kek %s: %s", w.keyID, err)
+	}
+
+	decrypter, ok := signer.(crypto.Decrypter)
+	if !ok {
+		return nil, fmt.Errorf("kek %s does not support decryption", w.keyID)
+	}
+
+	return decrypter.Decrypt(rand.Reader, wrappedDEK, &rsa.OAEPOptions{Hash: crypto.SHA256})
+}
+
+func (w *cryptoEngineKeyWrapper) SecurityLevel() cryptoengines.CryptoEngineSL {
+	return w.engine.GetEngineConfig(context.Background()).SecurityLevel
+}
+
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,60 @@
+package envelope
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms/cryptoengines"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
+	filestore "github.com/lamassuiot/lamassuiot/v4/providers/file-store/service"
+)
+
+func Register() {
+	cryptoengines.RegisterProvider(cryptoengines.EnvelopeProvider, func(logger *logger.Logger, conf cryptoengines.CryptoEngineConfig) (cryptoengines.CryptoEngine, error) {
+		engineConfig, err := cryptoengines.CryptoEngineConfigAdapter[EnvelopeEngineConfig]{}.Marshal(conf)
+		if err != nil {
+			return nil, err
+		}
+
+		fsBuilder := filestore.GetProvider(engineConfig.Config.FileStore.Type)
+		if fsBuilder == nil {
+			return nil, fmt.Errorf("file store provider %s not registered", engineConfig.Config.FileStore.Type)
+		}
+
+		bucket, err := fsBuilder(logger, engineConfig.Config.FileStore)
+		if err != nil {
+			return nil, fmt.Errorf("could not open file store bucket: %s", err)
+		}
+
+		kek, err := buildKeyWrapper(logger, engineConfig.Config.KEK)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewEnvelopeCryptoEngine(logger, bucket, kek, engineConfig.Config.KeyPrefix, conf.Metadata)
+	})
+}
+
+func buildKeyWrapper(logger *logger.Logger, conf KeyEncryptionKeyConfig) (KeyWrapper, error) {
+	switch {
+	case conf.Engine != nil && conf.MasterKey != "":
+		return nil, fmt.Errorf("only one of kek master_key or engine can be set")
+	case conf.MasterKey != "":
+		masterKey, err := base64.StdEncoding.DecodeString(string(conf.MasterKey))
+		if err != nil {
+			return nil, fmt.Errorf("could not decode kek master key: %s", err)
+		}
+
+		return NewMasterKeyWrapper(masterKey)
+	case conf.Engine != nil:
+		engine, err := cryptoengines.BuildCryptoEngine(logger, *conf.Engine)
+		if err != nil {
+			return nil, fmt.Errorf("could not build kek crypto engine: %s", err)
+		}
+
+		return NewCryptoEngineKeyWrapper(context.Background(), engine, conf.KeyID)
+	default:
+		return nil, fmt.Errorf("kek master_key or engine must be set")
+	}
+}
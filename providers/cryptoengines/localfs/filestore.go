@@ -3,14 +3,19 @@ package filestore
 import (
 	"context"
 	"crypto"
+	"crypto/ecdh"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
 	"encoding/base64"
+	"encoding/hex"
 	"os"
 	"path/filepath"
 	"runtime"
 
+	"filippo.io/mldsa"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/kms/cryptoengines"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
 	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/utils"
@@ -65,7 +70,44 @@ func NewFilesystemPEMEngine(logger *logger.Logger, conf cryptoengines.CryptoEngi
 						521,
 					},
 				},
+				{
+					Type: "ED25519",
+					Sizes: []int{
+						256,
+					},
+				},
+				{
+					Type: "X25519",
+					Sizes: []int{
+						256,
+					},
+				},
+				{
+					Type: "AES",
+					Sizes: []int{
+						128,
+						256,
+					},
+				},
+				{
+					Type: "HMAC",
+					Sizes: []int{
+						256,
+						384,
+						512,
+					},
+				},
+				{
+					Type: "ML-DSA",
+					Sizes: []int{
+						44,
+						65,
+						87,
+					},
+					PostQuantum: true,
+				},
 			},
+			PostQuantum: true,
 		},
 	}, nil
 }
@@ -87,6 +129,19 @@ func (engine *FilesystemCryptoEngine) GetPrivateKeyByID(ctx context.Context, key
 	return engine.softCryptoEngine.ParsePrivateKey(pemBytes)
 }
 
+func (engine *FilesystemCryptoEngine) GetDecrypterByID(ctx context.Context, keyID string) (crypto.Decrypter, error) {
+	engine.logger.Debugf("reading %s Key", keyID)
+	file := filepath.Join(engine.storageDirectory, keyID)
+
+	pemBytes, err := os.ReadFile(file)
+	if err != nil {
+		engine.logger.Errorf("Could not read %s Key: %s", keyID, err)
+		return nil, err
+	}
+
+	return engine.softCryptoEngine.ParseDecrypter(pemBytes)
+}
+
 func (engine *FilesystemCryptoEngine) ListPrivateKeyIDs(ctx context.Context) ([]string, error) {
 	// Update KeyIDs in folder and remove old naming
 	entries, err := os.ReadDir(engine.storageDirectory)
@@ -144,6 +199,64 @@ func (engine *FilesystemCryptoEngine) CreateECDSAPrivateKey(ctx context.Context,
 	return engine.importKey(ctx, key)
 }
 
+func (engine *FilesystemCryptoEngine) CreateEd25519PrivateKey(ctx context.Context) (string, crypto.Signer, error) {
+	engine.logger.Debugf("creating Ed25519 private key")
+
+	_, key, err := engine.softCryptoEngine.CreateEd25519PrivateKey()
+	if err != nil {
+		engine.logger.Errorf("could not create Ed25519 private key: %s", err)
+		return "", nil, err
+	}
+
+	engine.logger.Debugf("Ed25519 key successfully generated")
+	return engine.importKey(ctx, key)
+}
+
+func (engine *FilesystemCryptoEngine) CreateX25519PrivateKey(ctx context.Context) (string, *ecdh.PublicKey, error) {
+	engine.logger.Debugf("creating X25519 private key")
+
+	keyID, key, err := engine.softCryptoEngine.CreateX25519PrivateKey()
+	if err != nil {
+		engine.logger.Errorf("could not create X25519 private key: %s", err)
+		return "", nil, err
+	}
+
+	b64PemKey, err := engine.softCryptoEngine.MarshalAndEncodePKIXPrivateKey(key)
+	if err != nil {
+		engine.logger.Errorf("could not marshal and encode private key: %s", err)
+		return "", nil, err
+	}
+
+	pemKey, err := base64.StdEncoding.DecodeString(b64PemKey)
+	if err != nil {
+		engine.logger.Errorf("could not decode X25519 private key: %s", err)
+		return "", nil, err
+	}
+
+	file := filepath.Join(engine.storageDirectory, keyID)
+	err = os.WriteFile(file, pemKey, 0600)
+	if err != nil {
+		engine.logger.Errorf("could not store X25519 private key: %s", err)
+		return "", nil, err
+	}
+
+	engine.logger.Debugf("X25519 key successfully generated")
+	return keyID, key.PublicKey(), nil
+}
+
+func (engine *FilesystemCryptoEngine) CreateMLDSAPrivateKey(ctx context.Context, params *mldsa.Parameters) (string, crypto.Signer, error) {
+	engine.logger.Debugf("creating %s private key", params)
+
+	_, key, err := engine.softCryptoEngine.CreateMLDSAPrivateKey(params)
+	if err != nil {
+		engine.logger.Errorf("could not create %s private key: %s", params, err)
+		return "", nil, err
+	}
+
+	engine.logger.Debugf("%s key successfully generated", params)
+	return engine.importKey(ctx, key)
+}
+
 func (engine *FilesystemCryptoEngine) DeleteKey(ctx context.Context, keyID string) error {
 	return os.Remove(engine.storageDirectory + "/" + keyID)
 }
@@ -174,6 +287,19 @@ func (engine *FilesystemCryptoEngine) ImportECDSAPrivateKey(ctx context.Context,
 	return keyID, signer, nil
 }
 
+func (engine *FilesystemCryptoEngine) ImportEd25519PrivateKey(ctx context.Context, key ed25519.PrivateKey) (string, crypto.Signer, error) {
+	engine.logger.Debugf("importing Ed25519 private key")
+
+	keyID, signer, err := engine.importKey(ctx, key)
+	if err != nil {
+		engine.logger.Errorf("could not import Ed25519 key: %s", err)
+		return "", nil, err
+	}
+
+	engine.logger.Debugf("Ed25519 key successfully imported")
+	return keyID, signer, nil
+}
+
 func (engine *FilesystemCryptoEngine) importKey(ctx context.Context, key interface{}) (string, crypto.Signer, error) {
 	pubKey := key.(crypto.Signer).Public()
 
@@ -211,6 +337,116 @@ func (engine *FilesystemCryptoEngine) importKey(ctx context.Context, key interfa
 	return keyID, signer, nil
 }
 
+func (engine *FilesystemCryptoEngine) CreateAESKey(ctx context.Context, keySize int) (string, error) {
+	engine.logger.Debugf("creating AES key")
+	return engine.createSymmetricKey(keySize)
+}
+
+func (engine *FilesystemCryptoEngine) CreateHMACKey(ctx context.Context, keySize int) (string, error) {
+	engine.logger.Debugf("creating HMAC key")
+	return engine.createSymmetricKey(keySize)
+}
+
+func (engine *FilesystemCryptoEngine) EncryptAESGCM(ctx context.Context, keyID string, plaintext, aad []byte) ([]byte, error) {
+	key, err := engine.getSymmetricKeyByID(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return engine.softCryptoEngine.EncryptAESGCM(key, plaintext, aad)
+}
+
+func (engine *FilesystemCryptoEngine) DecryptAESGCM(ctx context.Context, keyID string, ciphertext, aad []byte) ([]byte, error) {
+	key, err := engine.getSymmetricKeyByID(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return engine.softCryptoEngine.DecryptAESGCM(key, ciphertext, aad)
+}
+
+func (engine *FilesystemCryptoEngine) ComputeHMAC(ctx context.Context, keyID string, hash crypto.Hash, message []byte) ([]byte, error) {
+	key, err := engine.getSymmetricKeyByID(keyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return engine.softCryptoEngine.ComputeHMAC(key, hash, message)
+}
+
+func (engine *FilesystemCryptoEngine) ImportAESKey(ctx context.Context, key []byte) (string, error) {
+	engine.logger.Debugf("importing AES key")
+	return engine.importSymmetricKey(key)
+}
+
+func (engine *FilesystemCryptoEngine) ImportHMACKey(ctx context.Context, key []byte) (string, error) {
+	engine.logger.Debugf("importing HMAC key")
+	return engine.importSymmetricKey(key)
+}
+
+func (engine *FilesystemCryptoEngine) GetSymmetricKeyByID(ctx context.Context, keyID string) ([]byte, error) {
+	return engine.getSymmetricKeyByID(keyID)
+}
+
+func (engine *FilesystemCryptoEngine) createSymmetricKey(keySize int) (string, error) {
+	keyID, key, err := engine.softCryptoEngine.CreateSymmetricKey(keySize)
+	if err != nil {
+		engine.logger.Errorf("could not create symmetric key: %s", err)
+		return "", err
+	}
+
+	err = engine.storeSymmetricKey(keyID, key)
+	if err != nil {
+		return "", err
+	}
+
+	engine.logger.Debugf("symmetric key %s successfully generated", keyID)
+	return keyID, nil
+}
+
+// importSymmetricKey stores an existing secret under a random key ID, as
+// symmetric keys have no public key to derive it from.
+func (engine *FilesystemCryptoEngine) importSymmetricKey(key []byte) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		engine.logger.Errorf("could not generate symmetric key ID: %s", err)
+		return "", err
+	}
+
+	keyID := hex.EncodeToString(id)
+	err := engine.storeSymmetricKey(keyID, key)
+	if err != nil {
+		return "", err
+	}
+
+	engine.logger.Debugf("symmetric key %s successfully imported", keyID)
+	return keyID, nil
+}
+
+func (engine *FilesystemCryptoEngine) storeSymmetricKey(keyID string, key []byte) error {
+	file := filepath.Join(engine.storageDirectory, keyID)
+	err := os.WriteFile(file, engine.softCryptoEngine.EncodeSymmetricKey(key), 0600)
+	if err != nil {
+		engine.logger.Errorf("could not store symmetric key: %s", err)
+		return err
+	}
+
+	return nil
+}
+
+func (engine *FilesystemCryptoEngine) getSymmetricKeyByID(keyID string) ([]byte, error) {
+	engine.logger.Debugf("reading %s symmetric Key", keyID)
+	file := filepath.Join(engine.storageDirectory, keyID)
+
+	pemBytes, err := os.ReadFile(file)
+	if err != nil {
+		engine.logger.Errorf("Could not read %s Key: %s", keyID, err)
+		return nil, err
+	}
+
+	return engine.softCryptoEngine.ParseSymmetricKey(pemBytes)
+}
+
 func checkAndCreateStorageDir(logger *logger.Logger, dir string) error {
 	var err error
 	if _, err = os.Stat(dir); os.IsNotExist(err) {
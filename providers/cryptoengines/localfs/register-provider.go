@@ -0,0 +1,17 @@
+package filestore
+
+import (
+	"github.com/lamassuiot/lamassuiot/v4/pkg/kms/cryptoengines"
+	"github.com/lamassuiot/lamassuiot/v4/pkg/shared/logger"
+)
+
+func Register() {
+	cryptoengines.RegisterProvider(cryptoengines.FilesystemProvider, func(logger *logger.Logger, conf cryptoengines.CryptoEngineConfig) (cryptoengines.CryptoEngine, error) {
+		engineConfig, err := cryptoengines.CryptoEngineConfigAdapter[FilesystemEngineConfig]{}.Marshal(conf)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewFilesystemPEMEngine(logger, *engineConfig)
+	})
+}